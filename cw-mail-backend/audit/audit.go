@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type Action string
+
+
+const (
+	ActionLoginSucceeded Action = "auth.login.succeeded"
+	ActionLoginFailed    Action = "auth.login.failed"
+	ActionLockout        Action = "auth.lockout"
+	ActionMFAEnabled     Action = "auth.mfa.enabled"
+	ActionMFADisabled    Action = "auth.mfa.disabled"
+	ActionEmailVerified  Action = "auth.email.verified"
+
+	ActionPasswordChanged Action = "user.password.changed"
+	ActionTokenCreated    Action = "user.token.created"
+	ActionTokenRevoked    Action = "user.token.revoked"
+	ActionAliasCreated    Action = "user.alias.created"
+	ActionAliasDeleted    Action = "user.alias.deleted"
+	ActionWebhookCreated  Action = "user.webhook.created"
+	ActionWebhookUpdated  Action = "user.webhook.updated"
+	ActionWebhookDeleted  Action = "user.webhook.deleted"
+
+	ActionDataExportRequested      Action = "user.data_export.requested"
+	ActionDataExportDownloaded     Action = "user.data_export.downloaded"
+	ActionAccountDeletionScheduled Action = "user.account.deletion_scheduled"
+	ActionAccountDeletionCanceled  Action = "user.account.deletion_canceled"
+	ActionAccountDeleted           Action = "user.account.deleted"
+
+	ActionUserRoleChanged        Action = "admin.user.role_changed"
+	ActionUserDisabled           Action = "admin.user.disabled"
+	ActionUserEnabled            Action = "admin.user.enabled"
+	ActionUserDeleted            Action = "admin.user.deleted"
+	ActionUserUnlocked           Action = "admin.user.unlocked"
+	ActionUserPasswordResetForce Action = "admin.user.password_reset_forced"
+	ActionUserAliasAdded         Action = "admin.user.alias_added"
+	ActionUserAliasRemoved       Action = "admin.user.alias_removed"
+	ActionUserAliasQuotaChanged  Action = "admin.user.alias_quota_changed"
+
+	ActionQuarantineReleased Action = "admin.quarantine.released"
+	ActionQuarantineDeleted  Action = "admin.quarantine.deleted"
+
+	ActionDeadLetterReplayed  Action = "admin.dead_letter.replayed"
+	ActionDeadLetterDiscarded Action = "admin.dead_letter.discarded"
+
+	ActionAdminWebhookCreated Action = "admin.webhook.created"
+	ActionAdminWebhookUpdated Action = "admin.webhook.updated"
+	ActionAdminWebhookDeleted Action = "admin.webhook.deleted"
+
+	ActionMessageTrashed            Action = "message.trashed"
+	ActionMessageReadLimitDestroyed Action = "message.read_limit_destroyed"
+	ActionMessagesExpired           Action = "message.expired_deleted"
+)
+
+
+const (
+	TargetUser       = "user"
+	TargetMessage    = "message"
+	TargetToken      = "api_token"
+	TargetExport     = "data_export"
+	TargetAlias      = "email_alias"
+	TargetIP         = "ip"
+	TargetQuarantine = "quarantined_message"
+	TargetDeadLetter = "dead_letter"
+	TargetWebhook    = "webhook"
+)
+
+
+type Event struct {
+	Action     Action
+	ActorID    *uint
+	TargetType string
+	TargetID   *uint
+	IP         string
+	UserAgent  string
+	Details    interface{}
+}
+
+
+// Logger записывает события в журнал аудита. Нулевой *Logger ничего не
+// делает, поэтому его можно не передавать в тестах.
+type Logger struct {
+	DB *gorm.DB
+}
+
+
+func NewLogger(db *gorm.DB) *Logger {
+	return &Logger{DB: db}
+}
+
+
+// Record сохраняет событие. Ошибка записи журнала не должна прерывать
+// основное действие, поэтому она только логируется.
+func (l *Logger) Record(ctx context.Context, event Event) {
+	if l == nil || l.DB == nil {
+		return
+	}
+
+	entry := &models.AuditLog{
+		ActorID:    event.ActorID,
+		Action:     string(event.Action),
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IP:         event.IP,
+		UserAgent:  event.UserAgent,
+	}
+
+	if err := models.RecordAuditLog(l.DB.WithContext(ctx), entry, event.Details); err != nil {
+		log.Printf("Ошибка записи в журнал аудита (%s): %v", event.Action, err)
+	}
+}
+
+
+// RecordRequest дополняет событие данными запроса: текущим пользователем
+// (если он аутентифицирован), IP-адресом и User-Agent.
+func (l *Logger) RecordRequest(c *gin.Context, event Event) {
+	if event.ActorID == nil {
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := userID.(uint); ok {
+				event.ActorID = &id
+			}
+		}
+	}
+	if event.IP == "" {
+		event.IP = c.ClientIP()
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = c.Request.UserAgent()
+	}
+
+	l.Record(c.Request.Context(), event)
+}
+
+
+func ID(id uint) *uint {
+	return &id
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	logger.Record(t.Context(), Event{Action: ActionLoginFailed})
+}
+
+func TestRecordRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/tokens", nil)
+	c.Request.RemoteAddr = "10.0.0.5:40000"
+	c.Request.Header.Set("User-Agent", "cw-test")
+	c.Set("user_id", uint(3))
+
+	NewLogger(db).RecordRequest(c, Event{
+		Action:     ActionTokenCreated,
+		TargetType: TargetToken,
+		TargetID:   ID(9),
+		Details:    map[string]string{"name": "backup"},
+	})
+
+	var entry models.AuditLog
+	if err := db.First(&entry).Error; err != nil {
+		t.Fatalf("Запись не сохранена: %v", err)
+	}
+
+	if entry.ActorID == nil || *entry.ActorID != 3 {
+		t.Errorf("Ожидался actor_id 3, получено %v", entry.ActorID)
+	}
+	if entry.Action != string(ActionTokenCreated) || entry.TargetID == nil || *entry.TargetID != 9 {
+		t.Errorf("Неверное событие: %+v", entry)
+	}
+	if entry.IP != "10.0.0.5" || entry.UserAgent != "cw-test" {
+		t.Errorf("Не сохранены данные запроса: ip=%q ua=%q", entry.IP, entry.UserAgent)
+	}
+	if entry.Details != `{"name":"backup"}` {
+		t.Errorf("Неверные details: %s", entry.Details)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,14 +10,26 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
+	"github.com/mail-service/audit"
 	"github.com/mail-service/config"
 	"github.com/mail-service/database"
 	_ "github.com/mail-service/docs" // Импорт сгенерированных docs
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/mailer"
+	"github.com/mail-service/managesieve"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"github.com/mail-service/outbox"
+	"github.com/mail-service/privacy"
+	"github.com/mail-service/realtime"
 	"github.com/mail-service/queue"
 	"github.com/mail-service/routes"
+	"github.com/mail-service/scanner"
+	"github.com/mail-service/webhook"
 )
 
 // @title          Mail Service API
@@ -60,13 +73,106 @@ func main() {
 		}
 	}
 
-	notifyQueue, err := queue.NewNotificationQueue(cfg)
+	// Redis нужен для хранения блокировок входа и для шины событий redis
+	var redisClient *redis.Client
+	if cfg.Lockout.Store == "redis" || cfg.Events.Driver == "redis" {
+		redisClient, err = database.InitRedis(cfg)
+		if err != nil {
+			log.Fatalf("Ошибка подключения к Redis: %v", err)
+		}
+		defer redisClient.Close()
+	}
+
+	// Недоступность брокера не мешает запуску: RabbitMQ переподключается в
+	// фоне, а уведомления ждут в outbox
+	eventBus, err := queue.New(cfg, redisClient)
 	if err != nil {
-		log.Fatalf("Ошибка подключения к RabbitMQ: %v", err)
+		log.Fatalf("Ошибка настройки шины событий: %v", err)
+	}
+	defer eventBus.Close()
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка настройки отправки почты: %v", err)
+	}
+
+	contentScanner, err := scanner.New(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка настройки проверки содержимого: %v", err)
+	}
+
+	var lockoutStore lockout.Store = lockout.NewMemoryStore()
+	if cfg.Lockout.Store == "redis" {
+		lockoutStore = lockout.NewRedisStore(redisClient)
+	}
+
+	loginGuard := lockout.NewGuard(lockoutStore, lockout.PolicyFromConfig(cfg))
+	auditLog := audit.NewLogger(db)
+	loginGuard.OnLockout = func(ctx context.Context, event lockout.Event) {
+		auditLog.Record(ctx, audit.Event{Action: audit.ActionLockout, TargetType: event.Scope, IP: event.IP, Details: event})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	privacyService := privacy.NewService(db, cfg, auditLog)
+	privacyService.Start(ctx)
+
+	// Уведомления публикуются из outbox: контроллеры пишут их в базу в
+	// транзакции письма, а Relay отправляет в шину событий после фиксации
+	outbox.NewRelay(db, cfg, eventBus).Start(ctx)
+
+	// Хаб получает уведомления в собственную очередь экземпляра и рассылает их
+	// клиентам, подключенным по WebSocket и SSE
+	hub := realtime.NewHub(cfg.Realtime.HistorySize)
+	if err := eventBus.Subscribe(ctx, realtime.RoutingKeys(), hub.HandleNotification); err != nil {
+		log.Fatalf("Ошибка подписки на уведомления: %v", err)
+	}
+
+	// События, которые потребители не смогли обработать после всех повторов,
+	// хранятся в базе до решения администратора
+	if deadLetters, ok := eventBus.(queue.DeadLetterQueue); ok {
+		err := deadLetters.CollectDeadLetters(ctx, func(letter queue.DeadLetter) error {
+			return models.SaveDeadLetter(db, &models.DeadLetter{
+				Queue:      letter.Queue,
+				RoutingKey: letter.RoutingKey,
+				MessageID:  letter.MessageID,
+				Payload:    string(letter.Body),
+				Reason:     letter.Reason,
+				LastError:  letter.LastError,
+				Attempts:   letter.Attempts,
+			})
+		})
+		if err != nil {
+			log.Fatalf("Ошибка подписки на недоставленные события: %v", err)
+		}
+	}
+
+	// Вебхуки получают события из шины, доставки хранятся в базе и
+	// отправляются фоновой задачей с повторами
+	webhookService := webhook.NewService(db, cfg)
+	if err := webhookService.Subscribe(ctx, eventBus); err != nil {
+		log.Fatalf("Ошибка подписки вебхуков на события: %v", err)
+	}
+	webhookService.Start(ctx)
+
+	if cfg.ManageSieve.Addr != "" {
+		sieveServer, err := managesieve.NewServer(db, cfg, loginGuard, auditLog)
+		if err != nil {
+			log.Fatalf("Ошибка настройки ManageSieve: %v", err)
+		}
+		go func() {
+			log.Printf("ManageSieve запущен на %s", cfg.ManageSieve.Addr)
+			if err := sieveServer.ListenAndServe(ctx, cfg.ManageSieve.Addr); err != nil {
+				log.Printf("Ошибка сервера ManageSieve: %v", err)
+			}
+		}()
 	}
-	defer notifyQueue.Close()
 
-	router := gin.Default()
+	// Токен потоков событий передается в access_token, поэтому его значение
+	// не пишется в журнал
+	router := gin.New()
+	router.Use(middleware.RedactedLogger("access_token"), gin.Recovery())
 	router.Use(cors.New(cors.Config{
 		
 		AllowOrigins: []string{
@@ -93,7 +199,7 @@ func main() {
 
 	router.LoadHTMLGlob(filepath.Join("templates", "*.html"))
 
-	routes.SetupRoutes(router, db, cfg, notifyQueue)
+	routes.SetupRoutes(router, db, cfg, mail, loginGuard, auditLog, privacyService, contentScanner, hub, eventBus, webhookService)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
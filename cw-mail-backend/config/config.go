@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -22,10 +25,15 @@ type Config struct {
 		Expiration time.Duration
 	}
 	RabbitMQ struct {
-		Host     string
-		Port     string
-		User     string
-		Password string
+		Host         string
+		Port         string
+		User         string
+		Password     string
+		ReconnectMin time.Duration
+		ReconnectMax time.Duration
+		// Задержка первого повтора обработки; каждая следующая вдвое больше
+		RetryBase     time.Duration
+		RetryAttempts int
 	}
 	Redis struct {
 		Host     string
@@ -36,6 +44,97 @@ type Config struct {
 	Server struct {
 		Port string
 	}
+	Mail struct {
+		Driver       string
+		From         string
+		SMTPHost     string
+		SMTPPort     string
+		SMTPUser     string
+		SMTPPassword string
+	}
+	Verification struct {
+		URL             string
+		TokenTTL        time.Duration
+		ResendInterval  time.Duration
+		MaxResendPerDay int
+		RestrictSending bool
+		RestrictReading bool
+	}
+	MFA struct {
+		Issuer           string
+		ChallengeTTL     time.Duration
+		RequireForAdmins bool
+	}
+	Lockout struct {
+		Store              string
+		MaxAccountFailures int
+		MaxIPFailures      int
+		DelayAfter         int
+		BaseDelay          time.Duration
+		MaxDelay           time.Duration
+		Window             time.Duration
+		Duration           time.Duration
+	}
+	Uploads struct {
+		Dir           string
+		MaxAvatarSize int64
+	}
+	Privacy struct {
+		DeletionGrace time.Duration
+		ExportDir     string
+		ExportTTL     time.Duration
+		SweepInterval time.Duration
+	}
+	Aliases struct {
+		DefaultQuota int
+	}
+	Addresses struct {
+		// Домены сервиса: только в них пользователи сами создают списки
+		// рассылки и псевдонимы; администраторы — в любом домене
+		Domains []string
+	}
+	ManageSieve struct {
+		Addr        string
+		TLSCert     string
+		TLSKey      string
+		IdleTimeout time.Duration
+	}
+	Scanner struct {
+		Driver         string
+		ClamAVAddress  string
+		Timeout        time.Duration
+		InfectedAction string
+		FailureAction  string
+		Notify         string
+	}
+	Outbox struct {
+		PollInterval time.Duration
+		BatchSize    int
+		BaseBackoff  time.Duration
+		MaxBackoff   time.Duration
+		Retention    time.Duration
+	}
+	Realtime struct {
+		HeartbeatInterval time.Duration
+		HistorySize       int
+	}
+	Events struct {
+		Driver       string
+		StreamMaxLen int
+	}
+	Webhooks struct {
+		PollInterval time.Duration
+		BatchSize    int
+		Timeout      time.Duration
+		MaxAttempts  int
+		BaseBackoff  time.Duration
+		MaxBackoff   time.Duration
+		Retention    time.Duration
+		MaxPerUser   int
+		// Внутренние сети, куда разрешено отправлять вебхуки администраторов;
+		// вебхуки пользователей во внутренние сети не отправляются никогда
+		AdminNetworks []*net.IPNet
+	}
 }
 
 func Load() (*Config, error) {
@@ -62,6 +161,18 @@ func Load() (*Config, error) {
 	config.RabbitMQ.Port = getEnv("RABBITMQ_PORT", "5672")
 	config.RabbitMQ.User = getEnv("RABBITMQ_USER", "guest")
 	config.RabbitMQ.Password = getEnv("RABBITMQ_PASSWORD", "guest")
+	if config.RabbitMQ.ReconnectMin, err = getEnvDuration("RABBITMQ_RECONNECT_MIN", "1s"); err != nil {
+		return nil, err
+	}
+	if config.RabbitMQ.ReconnectMax, err = getEnvDuration("RABBITMQ_RECONNECT_MAX", "30s"); err != nil {
+		return nil, err
+	}
+	if config.RabbitMQ.RetryBase, err = getEnvDuration("RABBITMQ_RETRY_BASE", "10s"); err != nil {
+		return nil, err
+	}
+	if config.RabbitMQ.RetryAttempts, err = getEnvInt("RABBITMQ_RETRY_ATTEMPTS", 3); err != nil {
+		return nil, err
+	}
 
 	config.Redis.Host = getEnv("REDIS_HOST", "localhost")
 	config.Redis.Port = getEnv("REDIS_PORT", "6379")
@@ -70,6 +181,156 @@ func Load() (*Config, error) {
 
 	config.Server.Port = getEnv("SERVER_PORT", "8080")
 
+	config.Mail.Driver = getEnv("MAIL_DRIVER", "log")
+	config.Mail.From = getEnv("MAIL_FROM", "no-reply@mail-service.local")
+	config.Mail.SMTPHost = getEnv("SMTP_HOST", "localhost")
+	config.Mail.SMTPPort = getEnv("SMTP_PORT", "25")
+	config.Mail.SMTPUser = getEnv("SMTP_USER", "")
+	config.Mail.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+
+	config.Verification.URL = getEnv("EMAIL_VERIFICATION_URL", "http://localhost:8080/api/auth/verify-email")
+	if config.Verification.TokenTTL, err = getEnvDuration("EMAIL_VERIFICATION_TTL", "24h"); err != nil {
+		return nil, err
+	}
+	if config.Verification.ResendInterval, err = getEnvDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", "1m"); err != nil {
+		return nil, err
+	}
+	if config.Verification.MaxResendPerDay, err = getEnvInt("EMAIL_VERIFICATION_MAX_PER_DAY", 5); err != nil {
+		return nil, err
+	}
+	if config.Verification.RestrictSending, err = getEnvBool("EMAIL_VERIFICATION_RESTRICT_SENDING", true); err != nil {
+		return nil, err
+	}
+	if config.Verification.RestrictReading, err = getEnvBool("EMAIL_VERIFICATION_RESTRICT_READING", false); err != nil {
+		return nil, err
+	}
+
+	config.MFA.Issuer = getEnv("MFA_ISSUER", "CW Mail")
+	if config.MFA.ChallengeTTL, err = getEnvDuration("MFA_CHALLENGE_TTL", "5m"); err != nil {
+		return nil, err
+	}
+	if config.MFA.RequireForAdmins, err = getEnvBool("MFA_REQUIRE_FOR_ADMINS", false); err != nil {
+		return nil, err
+	}
+
+	config.Lockout.Store = getEnv("LOCKOUT_STORE", "redis")
+	if config.Lockout.MaxAccountFailures, err = getEnvInt("LOCKOUT_MAX_ACCOUNT_FAILURES", 5); err != nil {
+		return nil, err
+	}
+	if config.Lockout.MaxIPFailures, err = getEnvInt("LOCKOUT_MAX_IP_FAILURES", 20); err != nil {
+		return nil, err
+	}
+	if config.Lockout.DelayAfter, err = getEnvInt("LOCKOUT_DELAY_AFTER", 2); err != nil {
+		return nil, err
+	}
+	if config.Lockout.BaseDelay, err = getEnvDuration("LOCKOUT_BASE_DELAY", "1s"); err != nil {
+		return nil, err
+	}
+	if config.Lockout.MaxDelay, err = getEnvDuration("LOCKOUT_MAX_DELAY", "30s"); err != nil {
+		return nil, err
+	}
+	if config.Lockout.Window, err = getEnvDuration("LOCKOUT_WINDOW", "15m"); err != nil {
+		return nil, err
+	}
+	if config.Lockout.Duration, err = getEnvDuration("LOCKOUT_DURATION", "15m"); err != nil {
+		return nil, err
+	}
+
+	config.Uploads.Dir = getEnv("UPLOAD_DIR", "./uploads")
+	maxAvatarSize, err := getEnvInt("AVATAR_MAX_SIZE", 2<<20)
+	if err != nil {
+		return nil, err
+	}
+	config.Uploads.MaxAvatarSize = int64(maxAvatarSize)
+
+	if config.Privacy.DeletionGrace, err = getEnvDuration("ACCOUNT_DELETION_GRACE", "720h"); err != nil {
+		return nil, err
+	}
+	config.Privacy.ExportDir = getEnv("EXPORT_DIR", "./exports")
+	if config.Privacy.ExportTTL, err = getEnvDuration("EXPORT_TTL", "72h"); err != nil {
+		return nil, err
+	}
+	if config.Privacy.SweepInterval, err = getEnvDuration("PRIVACY_SWEEP_INTERVAL", "1h"); err != nil {
+		return nil, err
+	}
+
+	if config.Aliases.DefaultQuota, err = getEnvInt("ALIAS_DEFAULT_QUOTA", 5); err != nil {
+		return nil, err
+	}
+	config.Addresses.Domains = getEnvList("SERVICE_DOMAINS")
+
+	config.ManageSieve.Addr = getEnv("MANAGESIEVE_ADDR", "")
+	config.ManageSieve.TLSCert = getEnv("MANAGESIEVE_TLS_CERT", "")
+	config.ManageSieve.TLSKey = getEnv("MANAGESIEVE_TLS_KEY", "")
+	if config.ManageSieve.IdleTimeout, err = getEnvDuration("MANAGESIEVE_IDLE_TIMEOUT", "5m"); err != nil {
+		return nil, err
+	}
+
+	config.Scanner.Driver = getEnv("SCANNER_DRIVER", "none")
+	config.Scanner.ClamAVAddress = getEnv("CLAMAV_ADDRESS", "localhost:3310")
+	if config.Scanner.Timeout, err = getEnvDuration("CLAMAV_TIMEOUT", "30s"); err != nil {
+		return nil, err
+	}
+	config.Scanner.InfectedAction = getEnv("SCANNER_INFECTED_ACTION", "quarantine")
+	config.Scanner.FailureAction = getEnv("SCANNER_FAILURE_ACTION", "quarantine")
+	config.Scanner.Notify = getEnv("SCANNER_NOTIFY", "quarantine,reject")
+
+	if config.Outbox.PollInterval, err = getEnvDuration("OUTBOX_POLL_INTERVAL", "1s"); err != nil {
+		return nil, err
+	}
+	if config.Outbox.BatchSize, err = getEnvInt("OUTBOX_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if config.Outbox.BaseBackoff, err = getEnvDuration("OUTBOX_BASE_BACKOFF", "1s"); err != nil {
+		return nil, err
+	}
+	if config.Outbox.MaxBackoff, err = getEnvDuration("OUTBOX_MAX_BACKOFF", "5m"); err != nil {
+		return nil, err
+	}
+	if config.Outbox.Retention, err = getEnvDuration("OUTBOX_RETENTION", "24h"); err != nil {
+		return nil, err
+	}
+
+	if config.Realtime.HeartbeatInterval, err = getEnvDuration("REALTIME_HEARTBEAT_INTERVAL", "25s"); err != nil {
+		return nil, err
+	}
+	if config.Realtime.HistorySize, err = getEnvInt("REALTIME_HISTORY_SIZE", 100); err != nil {
+		return nil, err
+	}
+
+	config.Events.Driver = getEnv("EVENT_BUS_DRIVER", "rabbitmq")
+	if config.Events.StreamMaxLen, err = getEnvInt("EVENT_STREAM_MAXLEN", 100000); err != nil {
+		return nil, err
+	}
+
+	if config.Webhooks.PollInterval, err = getEnvDuration("WEBHOOK_POLL_INTERVAL", "1s"); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.BatchSize, err = getEnvInt("WEBHOOK_BATCH_SIZE", 20); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.Timeout, err = getEnvDuration("WEBHOOK_TIMEOUT", "10s"); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.MaxAttempts, err = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.BaseBackoff, err = getEnvDuration("WEBHOOK_BASE_BACKOFF", "30s"); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.MaxBackoff, err = getEnvDuration("WEBHOOK_MAX_BACKOFF", "1h"); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.Retention, err = getEnvDuration("WEBHOOK_RETENTION", "168h"); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.MaxPerUser, err = getEnvInt("WEBHOOK_MAX_PER_USER", 10); err != nil {
+		return nil, err
+	}
+	if config.Webhooks.AdminNetworks, err = getEnvNetworks("WEBHOOK_ADMIN_NETWORKS"); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
@@ -85,6 +346,10 @@ func (c *Config) GetDSN() string {
 	)
 }
 
+func (c *Config) GetRedisAddr() string {
+	return fmt.Sprintf("%s:%s", c.Redis.Host, c.Redis.Port)
+}
+
 func (c *Config) GetRabbitMQURI() string {
 	return fmt.Sprintf(
 		"amqp://%s:%s@%s:%s/",
@@ -101,3 +366,61 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key, defaultValue string) (time.Duration, error) {
+	duration, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil {
+		return 0, fmt.Errorf("неверный формат %s: %w", key, err)
+	}
+	return duration, nil
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("неверный формат %s: %w", key, err)
+	}
+	return number, nil
+}
+
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("неверный формат %s: %w", key, err)
+	}
+	return flag, nil
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvNetworks(key string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("неверный формат %s: %w", key, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
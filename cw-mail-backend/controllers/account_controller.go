@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"github.com/mail-service/privacy"
+	"gorm.io/gorm"
+)
+
+
+type AccountController struct {
+	DB      *gorm.DB
+	Config  *config.Config
+	Privacy *privacy.Service
+	Audit   *audit.Logger
+}
+
+
+type DataExportResponse struct {
+	ID          uint       `json:"id" example:"1"`
+	Status      string     `json:"status" example:"ready"`
+	Size        int64      `json:"size,omitempty" example:"20480"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty" example:"/api/users/me/exports/1/download"`
+}
+
+
+type AccountDeletionRequest struct {
+	Password string `json:"password" binding:"required" example:"password123"`
+	Code     string `json:"code" example:"123456"` // обязателен, если включена двухфакторная аутентификация
+}
+
+
+type AccountDeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+
+func NewAccountController(db *gorm.DB, cfg *config.Config, privacyService *privacy.Service, auditLog *audit.Logger) *AccountController {
+	return &AccountController{
+		DB:      db,
+		Config:  cfg,
+		Privacy: privacyService,
+		Audit:   auditLog,
+	}
+}
+
+
+func newDataExportResponse(export *models.DataExport) DataExportResponse {
+	response := DataExportResponse{
+		ID:          export.ID,
+		Status:      export.Status,
+		Size:        export.Size,
+		Error:       export.Error,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}
+	if export.IsReady() {
+		response.DownloadURL = fmt.Sprintf("/api/users/me/exports/%d/download", export.ID)
+	}
+	return response
+}
+
+
+// @Summary Запросить выгрузку данных
+// @Description Запускает фоновую сборку архива с профилем, письмами в формате EML и аватаром. Статус выгрузки доступен в списке выгрузок
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} DataExportResponse "Выгрузка поставлена в очередь"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 409 {object} map[string]string "Выгрузка уже выполняется"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/exports [post]
+func (ac *AccountController) RequestExport(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	export, err := ac.Privacy.RequestExport(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrExportInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось запросить выгрузку"})
+		}
+		return
+	}
+
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionDataExportRequested,
+		TargetType: audit.TargetExport,
+		TargetID:   audit.ID(export.ID),
+	})
+
+	c.JSON(http.StatusAccepted, newDataExportResponse(export))
+}
+
+
+// @Summary Список выгрузок данных
+// @Description Возвращает выгрузки текущего пользователя. Готовые архивы хранятся ограниченное время (EXPORT_TTL)
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} DataExportResponse "Выгрузки"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/exports [get]
+func (ac *AccountController) ListExports(c *gin.Context) {
+	exports, err := models.ListDataExports(ac.DB, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить выгрузки"})
+		return
+	}
+
+	response := make([]DataExportResponse, 0, len(exports))
+	for i := range exports {
+		response = append(response, newDataExportResponse(&exports[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Статус выгрузки данных
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID выгрузки"
+// @Success 200 {object} DataExportResponse "Выгрузка"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Выгрузка не найдена"
+// @Router /users/me/exports/{id} [get]
+func (ac *AccountController) GetExport(c *gin.Context) {
+	export, ok := ac.findExport(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newDataExportResponse(export))
+}
+
+
+// @Summary Скачать архив выгрузки
+// @Tags account
+// @Produce application/zip
+// @Security BearerAuth
+// @Param id path int true "ID выгрузки"
+// @Success 200 {file} file "Zip-архив"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Выгрузка не найдена"
+// @Failure 409 {object} map[string]string "Архив еще не готов"
+// @Router /users/me/exports/{id}/download [get]
+func (ac *AccountController) DownloadExport(c *gin.Context) {
+	export, ok := ac.findExport(c)
+	if !ok {
+		return
+	}
+
+	if !export.IsReady() {
+		c.JSON(http.StatusConflict, gin.H{"error": "архив еще не готов"})
+		return
+	}
+
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionDataExportDownloaded,
+		TargetType: audit.TargetExport,
+		TargetID:   audit.ID(export.ID),
+	})
+
+	filename := fmt.Sprintf("cw-mail-export-%s.zip", export.CreatedAt.UTC().Format("20060102"))
+	c.FileAttachment(ac.Privacy.ExportPath(export), filename)
+}
+
+
+// @Summary Запросить удаление учетной записи
+// @Description Планирует удаление учетной записи по истечении периода ожидания (ACCOUNT_DELETION_GRACE). До этого момента удаление можно отменить. После удаления персональные данные стираются, а письма, отправленные другим пользователям и полученные от них, остаются у собеседников с участником «Удаленный пользователь»
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AccountDeletionRequest true "Пароль и код второго фактора"
+// @Success 202 {object} AccountDeletionResponse "Удаление запланировано"
+// @Failure 400 {object} map[string]string "Неверные данные запроса или код"
+// @Failure 401 {object} map[string]string "Неверный пароль"
+// @Failure 409 {object} map[string]string "Удаление уже запланировано или это последний администратор"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/deletion [post]
+func (ac *AccountController) ScheduleDeletion(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req AccountDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверные учетные данные"})
+		return
+	}
+
+	if user.MFAEnabled {
+		if err := models.VerifyMFACode(ac.DB, user, req.Code); err != nil {
+			respondMFAError(c, err)
+			return
+		}
+	}
+
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.EnsureAdminRemains(tx, user.ID); err != nil {
+			return err
+		}
+		return models.ScheduleAccountDeletion(tx, user, ac.Config.Privacy.DeletionGrace)
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrDeletionAlreadyScheduled) || errors.Is(err, models.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось запланировать удаление"})
+		}
+		return
+	}
+
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionAccountDeletionScheduled,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+		Details:    gin.H{"scheduled_at": user.DeletionScheduledAt},
+	})
+
+	c.JSON(http.StatusAccepted, AccountDeletionResponse{DeletionScheduledAt: *user.DeletionScheduledAt})
+}
+
+
+// @Summary Отменить удаление учетной записи
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Удаление отменено"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Удаление не запланировано"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/deletion [delete]
+func (ac *AccountController) CancelDeletion(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	if err := models.CancelAccountDeletion(ac.DB, user); err != nil {
+		if errors.Is(err, models.ErrDeletionNotScheduled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отменить удаление"})
+		}
+		return
+	}
+
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionAccountDeletionCanceled,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "удаление учетной записи отменено"})
+}
+
+
+func (ac *AccountController) findExport(c *gin.Context) (*models.DataExport, bool) {
+	exportID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, false
+	}
+
+	export, err := models.GetDataExport(ac.DB, uint(exportID), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "выгрузка не найдена"})
+		return nil, false
+	}
+
+	return export, true
+}
@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"github.com/mail-service/privacy"
+	"github.com/mail-service/queue"
+	"gorm.io/gorm"
+)
+
+
+type AdminController struct {
+	DB      *gorm.DB
+	Guard   *lockout.Guard
+	Audit   *audit.Logger
+	Privacy *privacy.Service
+}
+
+
+type LockoutStatusResponse struct {
+	UserID      uint       `json:"user_id" example:"1"`
+	Email       string     `json:"email" example:"user@example.com"`
+	Failures    int64      `json:"failures" example:"3"`
+	Locked      bool       `json:"locked" example:"false"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+
+type UserListResponse struct {
+	Users []models.User `json:"users"`
+	Total int64         `json:"total" example:"42"`
+	Page  int           `json:"page" example:"1"`
+	Limit int           `json:"limit" example:"20"`
+}
+
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"admin"`
+}
+
+
+func NewAdminController(db *gorm.DB, guard *lockout.Guard, auditLog *audit.Logger, privacyService *privacy.Service) *AdminController {
+	return &AdminController{
+		DB:      db,
+		Guard:   guard,
+		Audit:   auditLog,
+		Privacy: privacyService,
+	}
+}
+
+
+// @Summary Состояние блокировки входа пользователя
+// @Description Возвращает число неудачных попыток входа и время окончания блокировки
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} LockoutStatusResponse "Состояние блокировки"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/lockout [get]
+func (ac *AdminController) GetLockoutStatus(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	failures, lockedFor, err := ac.Guard.Status(c.Request.Context(), user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить состояние блокировки"})
+		return
+	}
+
+	response := LockoutStatusResponse{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Failures: failures,
+		Locked:   lockedFor > 0,
+	}
+	if lockedFor > 0 {
+		until := time.Now().Add(lockedFor)
+		response.LockedUntil = &until
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Снять блокировку входа
+// @Description Сбрасывает счетчик неудачных попыток и блокировку входа пользователя
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Блокировка снята"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/unlock [post]
+func (ac *AdminController) UnlockUser(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Guard.Unlock(c.Request.Context(), user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось снять блокировку"})
+		return
+	}
+
+	ac.audit(c, audit.ActionUserUnlocked, user.ID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "блокировка снята"})
+}
+
+
+// @Summary Список пользователей
+// @Description Возвращает пользователей с поиском по email и фильтрами по роли и статусу
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Подстрока email"
+// @Param role query string false "Роль (user, admin)"
+// @Param status query string false "Статус (active, disabled)"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Размер страницы" default(20)
+// @Success 200 {object} UserListResponse "Список пользователей"
+// @Failure 400 {object} map[string]string "Неверные параметры запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users [get]
+func (ac *AdminController) ListUsers(c *gin.Context) {
+	filter := models.UserFilter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+	}
+
+	if filter.Role != "" && !models.IsValidRole(filter.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимая роль"})
+		return
+	}
+	if filter.Status != "" && filter.Status != "active" && filter.Status != "disabled" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимый статус"})
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if filter.Page < 1 || filter.Limit < 1 || filter.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные параметры страницы"})
+		return
+	}
+
+	users, total, err := models.SearchUsers(ac.DB, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить пользователей"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserListResponse{
+		Users: users,
+		Total: total,
+		Page:  filter.Page,
+		Limit: filter.Limit,
+	})
+}
+
+
+// @Summary Получить пользователя
+// @Description Возвращает учетную запись пользователя
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.User "Пользователь"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Router /admin/users/{id} [get]
+func (ac *AdminController) GetUser(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+
+// @Summary Статистика почтового ящика пользователя
+// @Description Возвращает количество сообщений пользователя по меткам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.MailboxStats "Статистика"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/stats [get]
+func (ac *AdminController) GetUserStats(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	stats, err := models.GetMailboxStats(ac.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить статистику"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+
+// @Summary Изменить роль пользователя
+// @Description Назначает пользователю роль. Последнего администратора понизить нельзя
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body UpdateRoleRequest true "Новая роль"
+// @Success 200 {object} map[string]string "Роль изменена"
+// @Failure 400 {object} map[string]string "Недопустимая роль"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 409 {object} map[string]string "Нельзя понизить последнего администратора"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/role [put]
+func (ac *AdminController) UpdateUserRole(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимая роль"})
+		return
+	}
+
+	modifier, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Role != models.RoleAdmin {
+			if err := models.EnsureAdminRemains(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		if err := models.UpdateUserRole(tx, user.ID, req.Role, modifier); err != nil {
+			return err
+		}
+		if user.Role == req.Role {
+			return nil
+		}
+		return models.EnqueueOutboxEvent(tx, queue.RoutingKeyUserRoleChanged, queue.UserRoleChangedNotification{
+			Version:     queue.EventVersion,
+			UserID:      user.ID,
+			From:        user.Role,
+			To:          req.Role,
+			ChangedByID: modifier.ID,
+			Timestamp:   time.Now(),
+		})
+	})
+	if errors.Is(err, models.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось изменить роль"})
+		return
+	}
+
+	ac.audit(c, audit.ActionUserRoleChanged, user.ID, gin.H{"from": user.Role, "to": req.Role})
+	c.JSON(http.StatusOK, gin.H{"message": "роль изменена"})
+}
+
+
+// @Summary Отключить учетную запись
+// @Description Запрещает пользователю вход и отзывает выданные JWT
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Учетная запись отключена"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 409 {object} map[string]string "Нельзя отключить собственную учетную запись или последнего администратора"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/disable [post]
+func (ac *AdminController) DisableUser(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok || !ac.ensureNotSelf(c, user, "нельзя отключить собственную учетную запись") {
+		return
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.EnsureAdminRemains(tx, user.ID); err != nil {
+			return err
+		}
+		return models.SetUserDisabled(tx, user.ID, true)
+	})
+	if errors.Is(err, models.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отключить учетную запись"})
+		return
+	}
+
+	ac.audit(c, audit.ActionUserDisabled, user.ID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "учетная запись отключена"})
+}
+
+
+// @Summary Включить учетную запись
+// @Description Снова разрешает пользователю вход
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Учетная запись включена"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/enable [post]
+func (ac *AdminController) EnableUser(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.SetUserDisabled(ac.DB, user.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось включить учетную запись"})
+		return
+	}
+
+	ac.audit(c, audit.ActionUserEnabled, user.ID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "учетная запись включена"})
+}
+
+
+// @Summary Потребовать смену пароля
+// @Description Отзывает выданные JWT и требует от пользователя сменить пароль после следующего входа
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Смена пароля запрошена"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/force-password-reset [post]
+func (ac *AdminController) ForcePasswordReset(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.ForcePasswordReset(ac.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось запросить смену пароля"})
+		return
+	}
+
+	ac.audit(c, audit.ActionUserPasswordResetForce, user.ID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "смена пароля запрошена"})
+}
+
+
+// @Summary Удалить учетную запись
+// @Description Немедленно удаляет учетную запись без периода ожидания: персональные данные стираются, письма, отправленные другим пользователям и полученные от них, остаются у собеседников
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Учетная запись удалена"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 409 {object} map[string]string "Нельзя удалить собственную учетную запись или последнего администратора"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id} [delete]
+func (ac *AdminController) DeleteUser(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok || !ac.ensureNotSelf(c, user, "нельзя удалить собственную учетную запись") {
+		return
+	}
+
+	if err := ac.Privacy.DeleteAccount(c.Request.Context(), user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		} else if errors.Is(err, models.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить учетную запись"})
+		}
+		return
+	}
+
+	ac.audit(c, audit.ActionUserDeleted, user.ID, gin.H{"email": user.Email})
+	c.JSON(http.StatusOK, gin.H{"message": "учетная запись удалена"})
+}
+
+
+func (ac *AdminController) ensureNotSelf(c *gin.Context, user *models.User, message string) bool {
+	if c.GetUint("user_id") == user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": message})
+		return false
+	}
+	return true
+}
+
+
+func (ac *AdminController) audit(c *gin.Context, action audit.Action, targetID uint, details interface{}) {
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   &targetID,
+		Details:    details,
+	})
+}
+
+
+func (ac *AdminController) findUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := ac.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		return nil, false
+	}
+
+	return &user, true
+}
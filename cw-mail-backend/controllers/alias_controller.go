@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type AliasController struct {
+	DB     *gorm.DB
+	Config *config.Config
+	Audit  *audit.Logger
+}
+
+
+type CreateAliasRequest struct {
+	Address string `json:"address" binding:"required" example:"sales@example.com"`
+}
+
+
+type UpdateAliasQuotaRequest struct {
+	Quota *int `json:"quota" example:"10"` // null возвращает квоту по умолчанию
+}
+
+
+// AliasListResponse — псевдонимы пользователя вместе с квотой. Основной
+// адрес в квоту не входит.
+type AliasListResponse struct {
+	PrimaryAddress string              `json:"primary_address" example:"user@example.com"`
+	Aliases        []models.EmailAlias `json:"aliases"`
+	Quota          int                 `json:"quota" example:"5"`
+	Used           int                 `json:"used" example:"2"`
+}
+
+
+func NewAliasController(db *gorm.DB, cfg *config.Config, auditLog *audit.Logger) *AliasController {
+	return &AliasController{
+		DB:     db,
+		Config: cfg,
+		Audit:  auditLog,
+	}
+}
+
+
+func respondAliasError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrAddressInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidAliasAddress), errors.Is(err, models.ErrInvalidAliasQuota),
+		errors.Is(err, models.ErrAddressDomainNotAllowed), errors.Is(err, models.ErrAddressReserved):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrAliasQuotaExceeded):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+
+func (ac *AliasController) respondAliases(c *gin.Context, user *models.User) {
+	aliases, err := models.ListAliases(ac.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить псевдонимы"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AliasListResponse{
+		PrimaryAddress: user.Email,
+		Aliases:        aliases,
+		Quota:          user.EffectiveAliasQuota(ac.Config.Aliases.DefaultQuota),
+		Used:           len(aliases),
+	})
+}
+
+
+func (ac *AliasController) audit(c *gin.Context, action audit.Action, alias *models.EmailAlias) {
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetAlias,
+		TargetID:   audit.ID(alias.ID),
+		Details:    gin.H{"address": alias.Address, "user_id": alias.UserID},
+	})
+}
+
+
+// findUser загружает пользователя из параметра :id для маршрутов администратора.
+func (ac *AliasController) findUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := ac.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+
+func (ac *AliasController) deleteAlias(c *gin.Context, user *models.User, param string, action audit.Action) {
+	aliasID, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	alias, err := models.DeleteAlias(ac.DB, uint(aliasID), user.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "псевдоним не найден"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить псевдоним"})
+		}
+		return
+	}
+
+	ac.audit(c, action, alias)
+	c.JSON(http.StatusOK, gin.H{"message": "псевдоним удален"})
+}
+
+
+// @Summary Мои псевдонимы
+// @Description Возвращает дополнительные адреса пользователя и квоту псевдонимов
+// @Tags aliases
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} AliasListResponse "Псевдонимы"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/aliases [get]
+func (ac *AliasController) ListAliases(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	ac.respondAliases(c, user)
+}
+
+
+// @Summary Добавить псевдоним
+// @Description Добавляет дополнительный адрес. Письма на него попадают в тот же ящик, с него можно отправлять письма. Адрес должен быть свободен среди пользователей, псевдонимов и списков рассылки, принадлежать домену сервиса (SERVICE_DOMAINS) и не быть служебным (admin@, postmaster@ и т. п.)
+// @Tags aliases
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAliasRequest true "Адрес псевдонима"
+// @Success 201 {object} models.EmailAlias "Созданный псевдоним"
+// @Failure 400 {object} map[string]string "Неверный адрес, адрес вне доменов сервиса или служебный адрес"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 403 {object} map[string]string "Достигнута квота псевдонимов"
+// @Failure 409 {object} map[string]string "Адрес уже занят"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/aliases [post]
+func (ac *AliasController) CreateAlias(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req CreateAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	quota := user.EffectiveAliasQuota(ac.Config.Aliases.DefaultQuota)
+	alias, err := models.CreateAlias(ac.DB, user, req.Address, quota, true, addressPolicy(ac.Config))
+	if err != nil {
+		respondAliasError(c, err, "не удалось создать псевдоним")
+		return
+	}
+
+	ac.audit(c, audit.ActionAliasCreated, alias)
+	c.JSON(http.StatusCreated, alias)
+}
+
+
+// @Summary Удалить псевдоним
+// @Description Удаляет псевдоним. Уже полученные на него письма остаются в ящике
+// @Tags aliases
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID псевдонима"
+// @Success 200 {object} map[string]string "Псевдоним удален"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Псевдоним не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/aliases/{id} [delete]
+func (ac *AliasController) DeleteAlias(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	ac.deleteAlias(c, user, "id", audit.ActionAliasDeleted)
+}
+
+
+// @Summary Псевдонимы пользователя
+// @Description Возвращает псевдонимы пользователя и его квоту
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} AliasListResponse "Псевдонимы"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/aliases [get]
+func (ac *AliasController) AdminListAliases(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	ac.respondAliases(c, user)
+}
+
+
+// @Summary Добавить псевдоним пользователю
+// @Description Добавляет пользователю псевдоним без учета квоты, в любом домене, в том числе служебный адрес. Адрес должен быть свободен
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body CreateAliasRequest true "Адрес псевдонима"
+// @Success 201 {object} models.EmailAlias "Созданный псевдоним"
+// @Failure 400 {object} map[string]string "Неверный адрес"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 409 {object} map[string]string "Адрес уже занят"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/aliases [post]
+func (ac *AliasController) AdminCreateAlias(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	alias, err := models.CreateAlias(ac.DB, user, req.Address, 0, false, models.AddressPolicy{})
+	if err != nil {
+		respondAliasError(c, err, "не удалось создать псевдоним")
+		return
+	}
+
+	ac.audit(c, audit.ActionUserAliasAdded, alias)
+	c.JSON(http.StatusCreated, alias)
+}
+
+
+// @Summary Удалить псевдоним пользователя
+// @Description Удаляет псевдоним пользователя
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param alias_id path int true "ID псевдонима"
+// @Success 200 {object} map[string]string "Псевдоним удален"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь или псевдоним не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/aliases/{alias_id} [delete]
+func (ac *AliasController) AdminDeleteAlias(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	ac.deleteAlias(c, user, "alias_id", audit.ActionUserAliasRemoved)
+}
+
+
+// @Summary Изменить квоту псевдонимов
+// @Description Назначает пользователю квоту псевдонимов; null возвращает значение по умолчанию (ALIAS_DEFAULT_QUOTA). Уже созданные псевдонимы сверх квоты сохраняются
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param request body UpdateAliasQuotaRequest true "Новая квота"
+// @Success 200 {object} AliasListResponse "Псевдонимы с новой квотой"
+// @Failure 400 {object} map[string]string "Отрицательная квота"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/users/{id}/alias-quota [put]
+func (ac *AliasController) UpdateAliasQuota(c *gin.Context) {
+	user, ok := ac.findUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAliasQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	previous := user.EffectiveAliasQuota(ac.Config.Aliases.DefaultQuota)
+	if err := models.SetAliasQuota(ac.DB, user, req.Quota); err != nil {
+		respondAliasError(c, err, "не удалось изменить квоту псевдонимов")
+		return
+	}
+
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionUserAliasQuotaChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+		Details:    gin.H{"from": previous, "to": user.EffectiveAliasQuota(ac.Config.Aliases.DefaultQuota)},
+	})
+	ac.respondAliases(c, user)
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type AuditController struct {
+	DB *gorm.DB
+}
+
+
+type AuditLogListResponse struct {
+	Entries []models.AuditLog `json:"entries"`
+	Total   int64             `json:"total" example:"120"`
+	Page    int               `json:"page" example:"1"`
+	Limit   int               `json:"limit" example:"50"`
+}
+
+
+func NewAuditController(db *gorm.DB) *AuditController {
+	return &AuditController{
+		DB: db,
+	}
+}
+
+
+// @Summary Журнал аудита
+// @Description Возвращает записи журнала аудита, новые первыми. Действие можно задать префиксом со звездочкой, например auth.*
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param actor_id query int false "ID пользователя, выполнившего действие"
+// @Param action query string false "Действие (auth.login.failed или auth.*)"
+// @Param target_type query string false "Тип объекта (user, message, api_token)"
+// @Param target_id query int false "ID объекта"
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339)"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Размер страницы" default(50)
+// @Success 200 {object} AuditLogListResponse "Записи журнала"
+// @Failure 400 {object} map[string]string "Неверные параметры запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/audit [get]
+func (ac *AuditController) ListAuditLogs(c *gin.Context) {
+	filter, ok := parseAuditLogFilter(c)
+	if !ok {
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if filter.Page < 1 || filter.Limit < 1 || filter.Limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные параметры страницы"})
+		return
+	}
+
+	entries, total, err := models.FindAuditLogs(ac.DB, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить журнал аудита"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuditLogListResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    filter.Page,
+		Limit:   filter.Limit,
+	})
+}
+
+
+// @Summary Выгрузить журнал аудита
+// @Description Выгружает записи журнала в формате JSON Lines (по одной записи в строке) в хронологическом порядке. Поддерживает те же фильтры, что и просмотр журнала
+// @Tags admin
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Param actor_id query int false "ID пользователя, выполнившего действие"
+// @Param action query string false "Действие (auth.login.failed или auth.*)"
+// @Param target_type query string false "Тип объекта (user, message, api_token)"
+// @Param target_id query int false "ID объекта"
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339)"
+// @Success 200 {string} string "Записи журнала в формате JSON Lines"
+// @Failure 400 {object} map[string]string "Неверные параметры запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Router /admin/audit/export [get]
+func (ac *AuditController) ExportAuditLogs(c *gin.Context) {
+	filter, ok := parseAuditLogFilter(c)
+	if !ok {
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + ".jsonl"
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// Заголовки уже отправлены, поэтому ошибку выгрузки можно только залогировать
+	encoder := json.NewEncoder(c.Writer)
+	err := models.EachAuditLog(ac.DB, filter, func(entry *models.AuditLog) error {
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		log.Printf("Ошибка выгрузки журнала аудита: %v", err)
+	}
+}
+
+
+func parseAuditLogFilter(c *gin.Context) (models.AuditLogFilter, bool) {
+	filter := models.AuditLogFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+	}
+
+	for param, dst := range map[string]**uint{"actor_id": &filter.ActorID, "target_id": &filter.TargetID} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный параметр " + param})
+			return filter, false
+		}
+		uid := uint(id)
+		*dst = &uid
+	}
+
+	for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "параметр " + param + " должен быть в формате RFC 3339"})
+			return filter, false
+		}
+		*dst = &t
+	}
+
+	return filter, true
+}
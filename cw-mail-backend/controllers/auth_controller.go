@@ -1,13 +1,20 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
 	"github.com/mail-service/config"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/mailer"
 	"github.com/mail-service/middleware"
 	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
 	"gorm.io/gorm"
 )
 
@@ -15,6 +22,9 @@ import (
 type AuthController struct {
 	DB     *gorm.DB
 	Config *config.Config
+	Mailer mailer.Mailer
+	Guard  *lockout.Guard
+	Audit  *audit.Logger
 }
 
 
@@ -35,16 +45,31 @@ type TokenResponse struct {
 }
 
 
-func NewAuthController(db *gorm.DB, cfg *config.Config) *AuthController {
+type MFAChallengeResponse struct {
+	MFARequired           bool   `json:"mfa_required" example:"true"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty" example:"false"`
+	ChallengeToken        string `json:"challenge_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" example:"3f2a9c..."`
+}
+
+
+func NewAuthController(db *gorm.DB, cfg *config.Config, m mailer.Mailer, guard *lockout.Guard, auditLog *audit.Logger) *AuthController {
 	return &AuthController{
 		DB:     db,
 		Config: cfg,
+		Mailer: m,
+		Guard:  guard,
+		Audit:  auditLog,
 	}
 }
 
 
 // @Summary Регистрация нового пользователя
-// @Description Создает нового пользователя и возвращает JWT токен
+// @Description Создает нового пользователя, отправляет письмо для подтверждения email и возвращает JWT токен
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -65,20 +90,42 @@ func (ac *AuthController) Register(c *gin.Context) {
 	email := strings.ToLower(strings.TrimSpace(req.Email))
 
 
-	var existingUser models.User
-	if result := ac.DB.Where("email = ?", email).First(&existingUser); result.Error == nil {
+	// Адрес не должен совпадать ни с пользователем, ни со списком рассылки
+	inUse, err := models.AddressInUse(ac.DB, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось создать пользователя"})
+		return
+	}
+	if inUse {
 		c.JSON(http.StatusConflict, gin.H{"error": "пользователь с таким email уже существует"})
 		return
 	}
 
 
-	user, err := models.CreateUser(ac.DB, email, req.Password)
+	var user *models.User
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if user, err = models.CreateUser(tx, email, req.Password); err != nil {
+			return err
+		}
+		return models.EnqueueOutboxEvent(tx, queue.RoutingKeyUserRegistered, queue.UserRegisteredNotification{
+			Version:   queue.EventVersion,
+			UserID:    user.ID,
+			Email:     user.Email,
+			Timestamp: user.CreatedAt,
+		})
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось создать пользователя"})
 		return
 	}
 
 
+	if err := ac.sendVerificationEmail(user); err != nil {
+		log.Printf("Не удалось отправить письмо подтверждения для %s: %v", user.Email, err)
+	}
+
+
 	token, err := middleware.GenerateToken(user, ac.Config)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сгенерировать токен"})
@@ -90,14 +137,17 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 
 // @Summary Вход в систему
-// @Description Аутентифицирует пользователя и возвращает JWT токен
+// @Description Аутентифицирует пользователя и возвращает JWT токен. Если у пользователя включена двухфакторная аутентификация, возвращается токен подтверждения, который нужно обменять на JWT через /auth/login/mfa
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "Данные для входа"
 // @Success 200 {object} TokenResponse "JWT токен"
+// @Success 202 {object} MFAChallengeResponse "Требуется код второго фактора"
 // @Failure 400 {object} map[string]string "Неверные данные запроса"
 // @Failure 401 {object} map[string]string "Неверные учетные данные"
+// @Failure 403 {object} map[string]string "Учетная запись отключена"
+// @Failure 429 {object} map[string]string "Слишком много неудачных попыток входа"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /auth/login [post]
 func (ac *AuthController) Login(c *gin.Context) {
@@ -111,19 +161,40 @@ func (ac *AuthController) Login(c *gin.Context) {
 	email := strings.ToLower(strings.TrimSpace(req.Email))
 
 
+	if !checkLoginAllowed(c, ac.Guard, email) {
+		return
+	}
+
+
 	user, err := models.FindUserByEmail(ac.DB, email)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверные учетные данные"})
+		registerLoginFailure(c, ac.Guard, ac.Audit, email, nil, "unknown_user")
 		return
 	}
 
 
 	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверные учетные данные"})
+		registerLoginFailure(c, ac.Guard, ac.Audit, email, user, "invalid_password")
+		return
+	}
+
+
+	if user.IsDisabled() {
+		auditLoginFailure(c, ac.Audit, email, user, "disabled")
+		c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись отключена"})
 		return
 	}
 
 
+	if user.MFAEnabled || (user.IsAdmin() && ac.Config.MFA.RequireForAdmins) {
+		ac.respondMFAChallenge(c, user)
+		return
+	}
+
+
+	registerLoginSuccess(c, ac.Guard, ac.Audit, email, user)
+
+
 	token, err := middleware.GenerateToken(user, ac.Config)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сгенерировать токен"})
@@ -132,3 +203,130 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, TokenResponse{Token: token})
 }
+
+
+// @Summary Подтвердить адрес электронной почты
+// @Description Подтверждает email по токену из письма. Токен принимается в теле запроса или в параметре token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token query string false "Токен подтверждения"
+// @Param request body VerifyEmailRequest false "Токен подтверждения"
+// @Success 200 {object} map[string]string "Email подтвержден"
+// @Failure 400 {object} map[string]string "Недействительный или просроченный токен"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/verify-email [get]
+// @Router /auth/verify-email [post]
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var req VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+			return
+		}
+		token = req.Token
+	}
+
+	user, err := models.VerifyEmailToken(ac.DB, token)
+	if err != nil {
+		if errors.Is(err, models.ErrVerificationTokenInvalid) || errors.Is(err, models.ErrVerificationTokenExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось подтвердить email"})
+		}
+		return
+	}
+
+	ac.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionEmailVerified,
+		ActorID:    audit.ID(user.ID),
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "email успешно подтвержден"})
+}
+
+
+// @Summary Повторно отправить письмо подтверждения
+// @Description Отправляет новое письмо для подтверждения email. Частота отправки ограничена
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Письмо отправлено"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 409 {object} map[string]string "Email уже подтвержден"
+// @Failure 429 {object} map[string]string "Слишком частые запросы"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/verify-email/resend [post]
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "email уже подтвержден"})
+		return
+	}
+
+	wait, err := models.VerificationResendWait(ac.DB, user.ID, ac.Config.Verification.ResendInterval, ac.Config.Verification.MaxResendPerDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить письмо"})
+		return
+	}
+
+	if wait > 0 {
+		c.Header("Retry-After", retryAfterSeconds(wait))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "письмо уже отправлено, повторите попытку позже"})
+		return
+	}
+
+	if err := ac.sendVerificationEmail(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить письмо"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "письмо для подтверждения отправлено"})
+}
+
+
+func (ac *AuthController) respondMFAChallenge(c *gin.Context, user *models.User) {
+	purpose := middleware.MFAPurposeLogin
+	if !user.MFAEnabled {
+		purpose = middleware.MFAPurposeEnroll
+	}
+
+	challenge, err := middleware.GenerateMFAChallengeToken(user, purpose, ac.Config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сгенерировать токен"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, MFAChallengeResponse{
+		MFARequired:           true,
+		MFAEnrollmentRequired: purpose == middleware.MFAPurposeEnroll,
+		ChallengeToken:        challenge,
+	})
+}
+
+
+func (ac *AuthController) sendVerificationEmail(user *models.User) error {
+	token, err := models.CreateEmailVerification(ac.DB, user.ID, ac.Config.Verification.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", ac.Config.Verification.URL, token)
+
+	return ac.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Подтверждение адреса электронной почты",
+		Body: fmt.Sprintf(
+			"Здравствуйте!\n\nДля подтверждения адреса %s перейдите по ссылке:\n%s\n\nСсылка действительна %s.\n",
+			user.Email, link, ac.Config.Verification.TokenTTL,
+		),
+	})
+}
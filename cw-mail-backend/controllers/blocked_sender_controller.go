@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type BlockedSenderController struct {
+	DB *gorm.DB
+}
+
+
+type BlockSenderRequest struct {
+	Pattern string `json:"pattern" binding:"required" example:"spam@example.com"` // адрес или домен (example.com)
+}
+
+
+type BlockActionRequest struct {
+	Action string `json:"action" binding:"required" example:"spam"` // spam или reject
+}
+
+
+// BlockListResponse — список блокировки и действие для писем от
+// заблокированных отправителей.
+type BlockListResponse struct {
+	Action  string                 `json:"action" example:"spam"`
+	Entries []models.BlockedSender `json:"entries"`
+}
+
+
+func NewBlockedSenderController(db *gorm.DB) *BlockedSenderController {
+	return &BlockedSenderController{DB: db}
+}
+
+
+func respondBlockListError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrAlreadyBlocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidBlockPattern):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidBlockAction):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "valid_actions": models.ValidBlockActions})
+	case errors.Is(err, models.ErrBlockListFull):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+
+func (bc *BlockedSenderController) respondBlockList(c *gin.Context, user *models.User) {
+	entries, err := models.ListBlockedSenders(bc.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить список блокировки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BlockListResponse{Action: user.BlockAction, Entries: entries})
+}
+
+
+// @Summary Список блокировки
+// @Description Возвращает заблокированные адреса и домены, а также действие для писем от них
+// @Tags blocked-senders
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} BlockListResponse "Список блокировки"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/blocked-senders [get]
+func (bc *BlockedSenderController) ListBlockedSenders(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	bc.respondBlockList(c, user)
+}
+
+
+// @Summary Заблокировать отправителя
+// @Description Добавляет в список блокировки адрес (spam@example.com) или весь домен (example.com или @example.com)
+// @Tags blocked-senders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BlockSenderRequest true "Адрес или домен"
+// @Success 201 {object} models.BlockedSender "Запись списка блокировки"
+// @Failure 400 {object} map[string]string "Неверный адрес или домен"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 403 {object} map[string]string "Список блокировки заполнен"
+// @Failure 409 {object} map[string]string "Отправитель уже заблокирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/blocked-senders [post]
+func (bc *BlockedSenderController) BlockSender(c *gin.Context) {
+	var req BlockSenderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	entry, err := models.AddBlockedSender(bc.DB, c.GetUint("user_id"), req.Pattern)
+	if err != nil {
+		respondBlockListError(c, err, "не удалось заблокировать отправителя")
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+
+// @Summary Разблокировать отправителя
+// @Description Удаляет запись из списка блокировки
+// @Tags blocked-senders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID записи"
+// @Success 200 {object} map[string]string "Отправитель разблокирован"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Запись не найдена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/blocked-senders/{id} [delete]
+func (bc *BlockedSenderController) UnblockSender(c *gin.Context) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if err := models.DeleteBlockedSender(bc.DB, uint(entryID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "запись не найдена"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось разблокировать отправителя"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "отправитель разблокирован"})
+}
+
+
+// @Summary Действие для заблокированных отправителей
+// @Description spam — письма попадают в спам, reject — отправитель получает отказ
+// @Tags blocked-senders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BlockActionRequest true "Действие"
+// @Success 200 {object} BlockListResponse "Список блокировки"
+// @Failure 400 {object} map[string]string "Недопустимое действие"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/blocked-senders/action [put]
+func (bc *BlockedSenderController) UpdateBlockAction(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req BlockActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.SetBlockAction(bc.DB, user, req.Action); err != nil {
+		respondBlockListError(c, err, "не удалось изменить действие")
+		return
+	}
+
+	bc.respondBlockList(c, user)
+}
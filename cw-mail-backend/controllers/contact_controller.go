@@ -0,0 +1,600 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"github.com/mail-service/vcard"
+	"gorm.io/gorm"
+)
+
+
+// maxVCardImportSize ограничивает размер импортируемого файла vCard.
+const maxVCardImportSize = 1 << 20
+
+
+type ContactController struct {
+	DB *gorm.DB
+}
+
+
+type ContactRequest struct {
+	Email        string `json:"email" binding:"required" example:"ivan@example.com"`
+	Name         string `json:"name" example:"Иван Петров"`
+	Phone        string `json:"phone" example:"+79000000000"`
+	Organization string `json:"organization" example:"ООО Пример"`
+	Notes        string `json:"notes"`
+	GroupIDs     []uint `json:"group_ids"`
+}
+
+
+type ContactGroupRequest struct {
+	Name string `json:"name" binding:"required" example:"Работа"`
+}
+
+
+type ContactGroupResponse struct {
+	ID      uint   `json:"id" example:"1"`
+	Name    string `json:"name" example:"Работа"`
+	Members *int64 `json:"members,omitempty" example:"12"`
+}
+
+
+type ContactResponse struct {
+	ID              uint                   `json:"id" example:"1"`
+	Email           string                 `json:"email" example:"ivan@example.com"`
+	Name            string                 `json:"name" example:"Иван Петров"`
+	Phone           string                 `json:"phone"`
+	Organization    string                 `json:"organization"`
+	Notes           string                 `json:"notes"`
+	ContactCount    int                    `json:"contact_count" example:"5"`
+	LastContactedAt *time.Time             `json:"last_contacted_at,omitempty"`
+	Groups          []ContactGroupResponse `json:"groups"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+
+// ContactSuggestion — адресат в подсказках. ContactID пустой, если адрес
+// известен только по отправленным письмам и не сохранен в адресной книге.
+type ContactSuggestion struct {
+	ContactID       uint       `json:"contact_id,omitempty" example:"1"`
+	Email           string     `json:"email" example:"ivan@example.com"`
+	Name            string     `json:"name" example:"Иван Петров"`
+	ContactCount    int        `json:"contact_count" example:"5"`
+	LastContactedAt *time.Time `json:"last_contacted_at,omitempty"`
+}
+
+
+func NewContactController(db *gorm.DB) *ContactController {
+	return &ContactController{DB: db}
+}
+
+
+func newContactResponse(contact *models.Contact) ContactResponse {
+	groups := make([]ContactGroupResponse, 0, len(contact.Groups))
+	for _, group := range contact.Groups {
+		groups = append(groups, ContactGroupResponse{ID: group.ID, Name: group.Name})
+	}
+
+	return ContactResponse{
+		ID:              contact.ID,
+		Email:           contact.Email,
+		Name:            contact.Name,
+		Phone:           contact.Phone,
+		Organization:    contact.Organization,
+		Notes:           contact.Notes,
+		ContactCount:    contact.ContactCount,
+		LastContactedAt: contact.LastContactedAt,
+		Groups:          groups,
+		CreatedAt:       contact.CreatedAt,
+		UpdatedAt:       contact.UpdatedAt,
+	}
+}
+
+
+func newContactSuggestions(contacts []models.Contact) []ContactSuggestion {
+	suggestions := make([]ContactSuggestion, 0, len(contacts))
+	for _, contact := range contacts {
+		suggestion := ContactSuggestion{
+			Email:           contact.Email,
+			Name:            contact.Name,
+			ContactCount:    contact.ContactCount,
+			LastContactedAt: contact.LastContactedAt,
+		}
+		if !contact.Auto {
+			suggestion.ContactID = contact.ID
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions
+}
+
+
+func (r ContactRequest) fields() models.ContactFields {
+	return models.ContactFields{
+		Email:        r.Email,
+		Name:         r.Name,
+		Phone:        r.Phone,
+		Organization: r.Organization,
+		Notes:        r.Notes,
+		GroupIDs:     r.GroupIDs,
+	}
+}
+
+
+func respondContactError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrContactExists), errors.Is(err, models.ErrContactGroupExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidContactEmail),
+		errors.Is(err, models.ErrContactFieldTooLong),
+		errors.Is(err, models.ErrContactGroupName),
+		errors.Is(err, models.ErrContactGroupNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "не найдено"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+
+// @Summary Список контактов
+// @Description Возвращает сохраненные контакты текущего пользователя. Можно отфильтровать по группе и подстроке адреса или имени
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Param group_id query int false "ID группы"
+// @Param q query string false "Подстрока адреса или имени"
+// @Success 200 {array} ContactResponse "Контакты"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts [get]
+func (cc *ContactController) ListContacts(c *gin.Context) {
+	filter := models.ContactFilter{Query: c.Query("q")}
+	if raw := c.Query("group_id"); raw != "" {
+		groupID, err := strconv.Atoi(raw)
+		if err != nil || groupID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат group_id"})
+			return
+		}
+		filter.GroupID = uint(groupID)
+	}
+
+	contacts, err := models.ListContacts(cc.DB, c.GetUint("user_id"), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить контакты"})
+		return
+	}
+
+	response := make([]ContactResponse, 0, len(contacts))
+	for i := range contacts {
+		response = append(response, newContactResponse(&contacts[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Создать контакт
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ContactRequest true "Контакт"
+// @Success 201 {object} ContactResponse "Созданный контакт"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 409 {object} map[string]string "Контакт с таким адресом уже существует"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts [post]
+func (cc *ContactController) CreateContact(c *gin.Context) {
+	var req ContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	contact, err := models.CreateContact(cc.DB, c.GetUint("user_id"), req.fields())
+	if err != nil {
+		respondContactError(c, err, "не удалось создать контакт")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newContactResponse(contact))
+}
+
+
+// @Summary Получить контакт
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID контакта"
+// @Success 200 {object} ContactResponse "Контакт"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Контакт не найден"
+// @Router /contacts/{id} [get]
+func (cc *ContactController) GetContact(c *gin.Context) {
+	contact, ok := cc.findContact(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newContactResponse(contact))
+}
+
+
+// @Summary Обновить контакт
+// @Description Заменяет поля контакта и список его групп
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID контакта"
+// @Param request body ContactRequest true "Контакт"
+// @Success 200 {object} ContactResponse "Обновленный контакт"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 404 {object} map[string]string "Контакт не найден"
+// @Failure 409 {object} map[string]string "Контакт с таким адресом уже существует"
+// @Router /contacts/{id} [put]
+func (cc *ContactController) UpdateContact(c *gin.Context) {
+	contact, ok := cc.findContact(c)
+	if !ok {
+		return
+	}
+
+	var req ContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.UpdateContact(cc.DB, contact, req.fields()); err != nil {
+		respondContactError(c, err, "не удалось обновить контакт")
+		return
+	}
+
+	c.JSON(http.StatusOK, newContactResponse(contact))
+}
+
+
+// @Summary Удалить контакт
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID контакта"
+// @Success 200 {object} map[string]string "Контакт удален"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Контакт не найден"
+// @Router /contacts/{id} [delete]
+func (cc *ContactController) DeleteContact(c *gin.Context) {
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if err := models.DeleteContact(cc.DB, uint(contactID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "контакт не найден"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить контакт"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "контакт удален"})
+}
+
+
+// @Summary Частые адресаты
+// @Description Адресаты, которым пользователь чаще всего пишет, включая еще не сохраненных в адресной книге
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Количество (по умолчанию 10, максимум 50)"
+// @Success 200 {array} ContactSuggestion "Адресаты"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts/frequent [get]
+func (cc *ContactController) FrequentContacts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	contacts, err := models.FrequentContacts(cc.DB, c.GetUint("user_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить адресатов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newContactSuggestions(contacts))
+}
+
+
+// @Summary Подсказки адресатов
+// @Description Подбирает адресатов по началу адреса или слова в имени. Частые адресаты идут первыми
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Начало адреса или имени"
+// @Param limit query int false "Количество (по умолчанию 10, максимум 50)"
+// @Success 200 {array} ContactSuggestion "Подсказки"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts/autocomplete [get]
+func (cc *ContactController) Autocomplete(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	contacts, err := models.AutocompleteContacts(cc.DB, c.GetUint("user_id"), c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить подсказки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newContactSuggestions(contacts))
+}
+
+
+// @Summary Импорт контактов из vCard
+// @Description Принимает файл vCard 3.0 или 4.0 (поле file в multipart/form-data или тело запроса text/vcard). Существующие контакты дополняются, категории становятся группами
+// @Tags contacts
+// @Accept mpfd
+// @Accept text/vcard
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "Файл .vcf"
+// @Success 200 {object} models.ContactImportResult "Результат импорта"
+// @Failure 400 {object} map[string]string "Файл не передан или не разобран"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts/import [post]
+func (cc *ContactController) ImportContacts(c *gin.Context) {
+	data, status, message := readVCardUpload(c)
+	if status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	cards, err := vcard.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не удалось разобрать файл vCard"})
+		return
+	}
+
+	entries := make([]models.ContactImport, 0, len(cards))
+	for i := range cards {
+		entries = append(entries, models.ContactImportFromCard(&cards[i]))
+	}
+
+	result, err := models.ImportContacts(cc.DB, c.GetUint("user_id"), entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось импортировать контакты"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+
+// @Summary Экспорт контактов в vCard
+// @Tags contacts
+// @Produce text/vcard
+// @Security BearerAuth
+// @Param version query string false "Версия vCard: 3.0 (по умолчанию) или 4.0"
+// @Param group_id query int false "Экспортировать только группу"
+// @Success 200 {file} file "Файл .vcf"
+// @Failure 400 {object} map[string]string "Неверные параметры"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts/export [get]
+func (cc *ContactController) ExportContacts(c *gin.Context) {
+	version := c.DefaultQuery("version", vcard.Version3)
+	if version != vcard.Version3 && version != vcard.Version4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "поддерживаются версии vCard 3.0 и 4.0"})
+		return
+	}
+
+	var filter models.ContactFilter
+	if raw := c.Query("group_id"); raw != "" {
+		groupID, err := strconv.Atoi(raw)
+		if err != nil || groupID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат group_id"})
+			return
+		}
+		filter.GroupID = uint(groupID)
+	}
+
+	contacts, err := models.ListContacts(cc.DB, c.GetUint("user_id"), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить контакты"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := vcard.Encode(&buf, models.ContactCards(contacts), version); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сформировать файл"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="contacts.vcf"`)
+	c.Data(http.StatusOK, "text/vcard; charset=utf-8", buf.Bytes())
+}
+
+
+// @Summary Список групп контактов
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} ContactGroupResponse "Группы с количеством контактов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /contacts/groups [get]
+func (cc *ContactController) ListGroups(c *gin.Context) {
+	groups, err := models.ListContactGroups(cc.DB, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить группы"})
+		return
+	}
+
+	response := make([]ContactGroupResponse, 0, len(groups))
+	for i := range groups {
+		response = append(response, ContactGroupResponse{
+			ID:      groups[i].ID,
+			Name:    groups[i].Name,
+			Members: &groups[i].Members,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Создать группу контактов
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ContactGroupRequest true "Название группы"
+// @Success 201 {object} ContactGroupResponse "Созданная группа"
+// @Failure 400 {object} map[string]string "Неверное название"
+// @Failure 409 {object} map[string]string "Группа уже существует"
+// @Router /contacts/groups [post]
+func (cc *ContactController) CreateGroup(c *gin.Context) {
+	var req ContactGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	group, err := models.CreateContactGroup(cc.DB, c.GetUint("user_id"), req.Name)
+	if err != nil {
+		respondContactError(c, err, "не удалось создать группу")
+		return
+	}
+
+	c.JSON(http.StatusCreated, ContactGroupResponse{ID: group.ID, Name: group.Name})
+}
+
+
+// @Summary Переименовать группу контактов
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param request body ContactGroupRequest true "Новое название"
+// @Success 200 {object} ContactGroupResponse "Группа"
+// @Failure 400 {object} map[string]string "Неверное название"
+// @Failure 404 {object} map[string]string "Группа не найдена"
+// @Failure 409 {object} map[string]string "Группа с таким названием уже существует"
+// @Router /contacts/groups/{id} [put]
+func (cc *ContactController) RenameGroup(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	var req ContactGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	group, err := models.GetContactGroup(cc.DB, uint(groupID), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "группа не найдена"})
+		return
+	}
+
+	if err := models.RenameContactGroup(cc.DB, group, req.Name); err != nil {
+		respondContactError(c, err, "не удалось переименовать группу")
+		return
+	}
+
+	c.JSON(http.StatusOK, ContactGroupResponse{ID: group.ID, Name: group.Name})
+}
+
+
+// @Summary Удалить группу контактов
+// @Description Удаляет группу. Контакты, входившие в нее, сохраняются
+// @Tags contacts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Success 200 {object} map[string]string "Группа удалена"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Группа не найдена"
+// @Router /contacts/groups/{id} [delete]
+func (cc *ContactController) DeleteGroup(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if err := models.DeleteContactGroup(cc.DB, uint(groupID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "группа не найдена"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить группу"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "группа удалена"})
+}
+
+
+func (cc *ContactController) findContact(c *gin.Context) (*models.Contact, bool) {
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, false
+	}
+
+	contact, err := models.GetContact(cc.DB, uint(contactID), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "контакт не найден"})
+		return nil, false
+	}
+
+	return contact, true
+}
+
+
+// readVCardUpload читает файл из поля file формы или из тела запроса.
+// Возвращает ненулевой статус и сообщение, если файл получить не удалось.
+func readVCardUpload(c *gin.Context) ([]byte, int, string) {
+	var src io.Reader = c.Request.Body
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, http.StatusBadRequest, "файл file не передан"
+		}
+		if header.Size > maxVCardImportSize {
+			return nil, http.StatusRequestEntityTooLarge, "файл слишком большой"
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, http.StatusBadRequest, "не удалось прочитать файл"
+		}
+		defer file.Close()
+		src = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(src, maxVCardImportSize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, "не удалось прочитать файл"
+	}
+	if len(data) > maxVCardImportSize {
+		return nil, http.StatusRequestEntityTooLarge, "файл слишком большой"
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, http.StatusBadRequest, "файл пуст"
+	}
+	return data, 0, ""
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+)
+
+func TestContactVCardImportExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	user, _ := models.CreateUser(db, "owner@example.com", "password123")
+
+	cc := NewContactController(db)
+	router := gin.New()
+	router.POST("/contacts/import", asUser(user), cc.ImportContacts)
+	router.GET("/contacts/export", asUser(user), cc.ExportContacts)
+
+	input := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Иван Петров\r\nEMAIL:ivan@example.com\r\nCATEGORIES:Работа\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Без адреса\r\nEND:VCARD\r\n"
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "contacts.vcf")
+	part.Write([]byte(input))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/contacts/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+	var result models.ContactImportResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result != (models.ContactImportResult{Created: 1, Skipped: 1}) {
+		t.Errorf("Неверный результат импорта: %+v", result)
+	}
+
+	// Тот же файл можно передать телом запроса
+	req = httptest.NewRequest(http.MethodPost, "/contacts/import", strings.NewReader(input))
+	req.Header.Set("Content-Type", "text/vcard")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Updated != 1 {
+		t.Errorf("Повторный импорт должен обновить контакт: %+v", result)
+	}
+
+	w = performRequest(t, router, http.MethodGet, "/contacts/export?version=4.0")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/vcard") {
+		t.Fatalf("Неверный ответ экспорта: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	exported := w.Body.String()
+	for _, line := range []string{"VERSION:4.0", "FN:Иван Петров", "EMAIL:ivan@example.com", "CATEGORIES:Работа"} {
+		if !strings.Contains(exported, line+"\r\n") {
+			t.Errorf("В экспорте нет строки %q:\n%s", line, exported)
+		}
+	}
+
+	if w := performRequest(t, router, http.MethodGet, "/contacts/export?version=2.1"); w.Code != http.StatusBadRequest {
+		t.Errorf("Неизвестная версия должна отклоняться, получено %d", w.Code)
+	}
+}
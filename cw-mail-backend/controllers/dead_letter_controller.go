@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
+	"gorm.io/gorm"
+)
+
+
+// DeadLetterReplayer отправляет недоставленное сообщение в исходную очередь.
+// Реализуется брокером RabbitMQ; с другими драйверами шины повторная
+// отправка недоступна.
+type DeadLetterReplayer interface {
+	Replay(ctx context.Context, letter queue.DeadLetter) error
+}
+
+
+type DeadLetterController struct {
+	DB       *gorm.DB
+	Replayer DeadLetterReplayer
+	Audit    *audit.Logger
+}
+
+
+type DeadLetterListResponse struct {
+	DeadLetters []models.DeadLetter `json:"dead_letters"`
+	Total       int64               `json:"total" example:"3"`
+	Page        int                 `json:"page" example:"1"`
+	Limit       int                 `json:"limit" example:"20"`
+}
+
+
+func NewDeadLetterController(db *gorm.DB, replayer DeadLetterReplayer, auditLog *audit.Logger) *DeadLetterController {
+	return &DeadLetterController{
+		DB:       db,
+		Replayer: replayer,
+		Audit:    auditLog,
+	}
+}
+
+
+// @Summary Недоставленные события
+// @Description Возвращает события, которые потребители очередей не смогли обработать после всех повторов, начиная с новых
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param queue query string false "Исходная очередь (notifications.v2, scan_verdicts.v2, domain_events.v2, webhooks)"
+// @Param status query string false "Статус (pending, replayed, discarded)"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Размер страницы" default(20)
+// @Success 200 {object} DeadLetterListResponse "Недоставленные события"
+// @Failure 400 {object} map[string]string "Неверные параметры запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/dead-letters [get]
+func (dc *DeadLetterController) ListDeadLetters(c *gin.Context) {
+	filter := models.DeadLetterFilter{Queue: c.Query("queue"), Status: c.Query("status")}
+	switch filter.Status {
+	case "", models.DeadLetterPending, models.DeadLetterReplayed, models.DeadLetterDiscarded:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимый статус"})
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if filter.Page < 1 || filter.Limit < 1 || filter.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные параметры страницы"})
+		return
+	}
+
+	letters, total, err := models.ListDeadLetters(dc.DB, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить недоставленные события"})
+		return
+	}
+
+	c.JSON(http.StatusOK, DeadLetterListResponse{
+		DeadLetters: letters,
+		Total:       total,
+		Page:        filter.Page,
+		Limit:       filter.Limit,
+	})
+}
+
+
+// @Summary Недоставленное событие
+// @Description Возвращает недоставленное событие вместе с телом и последней ошибкой обработки
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID недоставленного события"
+// @Success 200 {object} models.DeadLetter "Недоставленное событие"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Событие не найдено"
+// @Router /admin/dead-letters/{id} [get]
+func (dc *DeadLetterController) GetDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := models.GetDeadLetter(dc.DB, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "недоставленное событие не найдено"})
+		return
+	}
+
+	c.JSON(http.StatusOK, letter)
+}
+
+
+// @Summary Повторно отправить событие
+// @Description Публикует недоставленное событие в исходную очередь с исходным ключом маршрутизации. Счетчик повторов сбрасывается
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID недоставленного события"
+// @Success 200 {object} models.DeadLetter "Событие отправлено повторно"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Событие не найдено"
+// @Failure 409 {object} map[string]string "Событие уже отправлено повторно или удалено"
+// @Failure 503 {object} map[string]string "Нет соединения с RabbitMQ"
+// @Router /admin/dead-letters/{id}/replay [post]
+func (dc *DeadLetterController) ReplayDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+	if dc.Replayer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "повторная отправка доступна только с брокером RabbitMQ"})
+		return
+	}
+
+	tx := dc.DB.Begin()
+
+	letter, err := models.ReplayDeadLetter(tx, id, c.GetUint("user_id"))
+	if err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "недоставленное событие не найдено"})
+		case errors.Is(err, models.ErrDeadLetterResolved):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить событие"})
+		}
+		return
+	}
+
+	// Отметка фиксируется только после подтверждения брокера
+	err = dc.Replayer.Replay(c.Request.Context(), queue.DeadLetter{
+		Queue:      letter.Queue,
+		RoutingKey: letter.RoutingKey,
+		MessageID:  letter.MessageID,
+		Body:       []byte(letter.Payload),
+	})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "не удалось опубликовать событие в RabbitMQ"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить событие"})
+		return
+	}
+
+	dc.audit(c, audit.ActionDeadLetterReplayed, letter)
+	c.JSON(http.StatusOK, letter)
+}
+
+
+// @Summary Удалить недоставленное событие
+// @Description Отказывается от повторной отправки события. Тело события удаляется, запись остается со статусом discarded
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID недоставленного события"
+// @Success 200 {object} models.DeadLetter "Событие удалено"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Событие не найдено"
+// @Failure 409 {object} map[string]string "Событие уже отправлено повторно или удалено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/dead-letters/{id} [delete]
+func (dc *DeadLetterController) DiscardDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := models.DiscardDeadLetter(dc.DB, id, c.GetUint("user_id"))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "недоставленное событие не найдено"})
+		return
+	case errors.Is(err, models.ErrDeadLetterResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить событие"})
+		return
+	}
+
+	dc.audit(c, audit.ActionDeadLetterDiscarded, letter)
+	c.JSON(http.StatusOK, letter)
+}
+
+
+func (dc *DeadLetterController) audit(c *gin.Context, action audit.Action, letter *models.DeadLetter) {
+	dc.Audit.RecordRequest(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetDeadLetter,
+		TargetID:   &letter.ID,
+		Details: gin.H{
+			"queue":       letter.Queue,
+			"routing_key": letter.RoutingKey,
+			"message_id":  letter.MessageID,
+			"reason":      letter.Reason,
+		},
+	})
+}
+
+
+func parseDeadLetterID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
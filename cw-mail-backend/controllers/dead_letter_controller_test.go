@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
+)
+
+type stubReplayer struct {
+	err      error
+	replayed []queue.DeadLetter
+}
+
+func (r *stubReplayer) Replay(ctx context.Context, letter queue.DeadLetter) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.replayed = append(r.replayed, letter)
+	return nil
+}
+
+func TestDeadLetterReplayAndDiscard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	admin, _ := models.CreateUser(db, "admin@example.com", "password123")
+
+	letter := &models.DeadLetter{Queue: queue.DomainQueueName, RoutingKey: queue.RoutingKeyMessageRead, MessageID: "12", Payload: `{"version":1}`, Reason: queue.DeadLetterReasonFailed, Attempts: 4}
+	models.SaveDeadLetter(db, letter)
+	other := &models.DeadLetter{Queue: queue.ScanQueueName, RoutingKey: "scan.reject", Payload: `{}`, Reason: "rejected"}
+	models.SaveDeadLetter(db, other)
+
+	replayer := &stubReplayer{err: queue.ErrNotConnected}
+	dc := NewDeadLetterController(db, replayer, nil)
+	router := gin.New()
+	router.POST("/admin/dead-letters/:id/replay", asUser(admin), dc.ReplayDeadLetter)
+	router.DELETE("/admin/dead-letters/:id", asUser(admin), dc.DiscardDeadLetter)
+
+	request := func(method string, id uint, suffix string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		path := "/admin/dead-letters/" + strconv.FormatUint(uint64(id), 10) + suffix
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// Без брокера отметка о повторной отправке откатывается
+	if w := request(http.MethodPost, letter.ID, "/replay"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Без брокера: ожидался статус 503, получено %d", w.Code)
+	}
+	if stored, _ := models.GetDeadLetter(db, letter.ID); stored.Status != models.DeadLetterPending {
+		t.Errorf("Статус после ошибки публикации: %s", stored.Status)
+	}
+
+	replayer.err = nil
+	if w := request(http.MethodPost, letter.ID, "/replay"); w.Code != http.StatusOK {
+		t.Fatalf("Повторная отправка: ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+	if len(replayer.replayed) != 1 {
+		t.Fatalf("Опубликовано %d событий, ожидалось 1", len(replayer.replayed))
+	}
+	if replayed := replayer.replayed[0]; replayed.Queue != queue.DomainQueueName || replayed.RoutingKey != queue.RoutingKeyMessageRead || string(replayed.Body) != `{"version":1}` {
+		t.Errorf("Опубликовано событие %+v", replayed)
+	}
+	if w := request(http.MethodPost, letter.ID, "/replay"); w.Code != http.StatusConflict {
+		t.Errorf("Повторная отправка обработанного события: ожидался статус 409, получено %d", w.Code)
+	}
+
+	if w := request(http.MethodDelete, other.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("Удаление: ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodDelete, other.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("Повторное удаление: ожидался статус 409, получено %d", w.Code)
+	}
+	if w := request(http.MethodDelete, 999, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Несуществующее событие: ожидался статус 404, получено %d", w.Code)
+	}
+
+	// С шиной без очередей недоставленных повторная отправка недоступна
+	router = gin.New()
+	router.POST("/admin/dead-letters/:id/replay", asUser(admin), NewDeadLetterController(db, nil, nil).ReplayDeadLetter)
+	if w := request(http.MethodPost, other.ID, "/replay"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Без поддержки повторной отправки: ожидался статус 503, получено %d", w.Code)
+	}
+}
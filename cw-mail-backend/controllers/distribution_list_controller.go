@@ -0,0 +1,468 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type DistributionListController struct {
+	DB     *gorm.DB
+	Config *config.Config
+}
+
+
+type DistributionListRequest struct {
+	Address     string `json:"address" binding:"required" example:"team@example.com"`
+	Name        string `json:"name" example:"Команда"`
+	Description string `json:"description" example:"Рассылка для всей команды"`
+	PostPolicy  string `json:"post_policy" example:"members"` // anyone, members или owner; по умолчанию members
+}
+
+
+type AddListMemberRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+}
+
+
+type DistributionListResponse struct {
+	ID          uint      `json:"id" example:"1"`
+	Address     string    `json:"address" example:"team@example.com"`
+	Name        string    `json:"name" example:"Команда"`
+	Description string    `json:"description"`
+	PostPolicy  string    `json:"post_policy" example:"members"`
+	Owner       UserCard  `json:"owner"`
+	Members     int64     `json:"members" example:"5"`
+	CanManage   bool      `json:"can_manage" example:"true"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+
+type DistributionListMemberResponse struct {
+	User     UserCard  `json:"user"`
+	IsOwner  bool      `json:"is_owner" example:"false"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+
+func NewDistributionListController(db *gorm.DB, cfg *config.Config) *DistributionListController {
+	return &DistributionListController{DB: db, Config: cfg}
+}
+
+
+// addressPolicy — ограничения на адреса, которые пользователи создают себе
+// сами: домены SERVICE_DOMAINS и запрет служебных имен.
+func addressPolicy(cfg *config.Config) models.AddressPolicy {
+	return models.AddressPolicy{Domains: cfg.Addresses.Domains}
+}
+
+
+func newDistributionListResponse(list *models.DistributionList, members int64, viewer *models.User) DistributionListResponse {
+	return DistributionListResponse{
+		ID:          list.ID,
+		Address:     list.Address,
+		Name:        list.Name,
+		Description: list.Description,
+		PostPolicy:  list.PostPolicy,
+		Owner:       newUserCard(&list.Owner),
+		Members:     members,
+		CanManage:   list.CanManage(viewer),
+		CreatedAt:   list.CreatedAt,
+	}
+}
+
+
+func (r DistributionListRequest) fields() models.DistributionListFields {
+	return models.DistributionListFields{
+		Address:     r.Address,
+		Name:        r.Name,
+		Description: r.Description,
+		PostPolicy:  r.PostPolicy,
+	}
+}
+
+
+func respondDistributionListError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrAddressInUse), errors.Is(err, models.ErrAlreadyListMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidListAddress),
+		errors.Is(err, models.ErrAddressDomainNotAllowed),
+		errors.Is(err, models.ErrAddressReserved),
+		errors.Is(err, models.ErrListFieldTooLong),
+		errors.Is(err, models.ErrListOwnerMembership):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidPostPolicy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "valid_policies": models.ValidListPostPolicies})
+	case errors.Is(err, models.ErrListLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+
+func (dc *DistributionListController) listResponses(c *gin.Context, lists []models.DistributionList, viewer *models.User) {
+	ids := make([]uint, 0, len(lists))
+	for _, list := range lists {
+		ids = append(ids, list.ID)
+	}
+
+	counts, err := models.DistributionListMemberCounts(dc.DB, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить списки рассылки"})
+		return
+	}
+
+	response := make([]DistributionListResponse, 0, len(lists))
+	for i := range lists {
+		response = append(response, newDistributionListResponse(&lists[i], counts[lists[i].ID], viewer))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Мои списки рассылки
+// @Description Возвращает списки рассылки, которыми пользователь владеет или в которых состоит
+// @Tags lists
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} DistributionListResponse "Списки рассылки"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /lists [get]
+func (dc *DistributionListController) ListMyLists(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	lists, err := models.ListUserDistributionLists(dc.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить списки рассылки"})
+		return
+	}
+
+	dc.listResponses(c, lists, user)
+}
+
+
+// @Summary Все списки рассылки
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} DistributionListResponse "Списки рассылки"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/lists [get]
+func (dc *DistributionListController) ListAllLists(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	lists, err := models.ListAllDistributionLists(dc.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить списки рассылки"})
+		return
+	}
+
+	dc.listResponses(c, lists, user)
+}
+
+
+// @Summary Создать список рассылки
+// @Description Создает групповой адрес, владелец становится его участником. Адрес не должен совпадать с адресом пользователя или другого списка. Обычные пользователи создают списки только в доменах сервиса (SERVICE_DOMAINS) и не на служебных адресах (admin@, postmaster@ и т. п.), администраторы — любые
+// @Tags lists
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DistributionListRequest true "Параметры списка"
+// @Success 201 {object} DistributionListResponse "Созданный список"
+// @Failure 400 {object} map[string]string "Неверные данные запроса или адрес вне доменов сервиса"
+// @Failure 403 {object} map[string]string "Достигнут лимит списков"
+// @Failure 409 {object} map[string]string "Адрес уже занят"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /lists [post]
+func (dc *DistributionListController) CreateList(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req DistributionListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	list, err := models.CreateDistributionList(dc.DB, user, req.fields(), addressPolicy(dc.Config))
+	if err != nil {
+		respondDistributionListError(c, err, "не удалось создать список рассылки")
+		return
+	}
+	list.Owner = *user
+
+	c.JSON(http.StatusCreated, newDistributionListResponse(list, 1, user))
+}
+
+
+// @Summary Получить список рассылки
+// @Description Доступно владельцу, участникам и администраторам
+// @Tags lists
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID списка"
+// @Success 200 {object} DistributionListResponse "Список рассылки"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Список не найден"
+// @Router /lists/{id} [get]
+func (dc *DistributionListController) GetList(c *gin.Context) {
+	list, user, ok := dc.findList(c, false)
+	if !ok {
+		return
+	}
+
+	counts, err := models.DistributionListMemberCounts(dc.DB, []uint{list.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить список рассылки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newDistributionListResponse(list, counts[list.ID], user))
+}
+
+
+// @Summary Обновить список рассылки
+// @Description Меняет адрес, название, описание и политику отправки. Доступно владельцу и администраторам; новый адрес обычного пользователя должен быть в домене сервиса
+// @Tags lists
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID списка"
+// @Param request body DistributionListRequest true "Параметры списка"
+// @Success 200 {object} DistributionListResponse "Обновленный список"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Список не найден"
+// @Failure 409 {object} map[string]string "Адрес уже занят"
+// @Router /lists/{id} [put]
+func (dc *DistributionListController) UpdateList(c *gin.Context) {
+	list, user, ok := dc.findList(c, true)
+	if !ok {
+		return
+	}
+
+	var req DistributionListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.UpdateDistributionList(dc.DB, list, user, req.fields(), addressPolicy(dc.Config)); err != nil {
+		respondDistributionListError(c, err, "не удалось обновить список рассылки")
+		return
+	}
+
+	counts, _ := models.DistributionListMemberCounts(dc.DB, []uint{list.ID})
+	c.JSON(http.StatusOK, newDistributionListResponse(list, counts[list.ID], user))
+}
+
+
+// @Summary Удалить список рассылки
+// @Description Удаляет список. Уже доставленные письма остаются у получателей. Доступно владельцу и администраторам
+// @Tags lists
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID списка"
+// @Success 200 {object} map[string]string "Список удален"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Список не найден"
+// @Router /lists/{id} [delete]
+func (dc *DistributionListController) DeleteList(c *gin.Context) {
+	list, _, ok := dc.findList(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteDistributionList(dc.DB, list.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить список рассылки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "список рассылки удален"})
+}
+
+
+// @Summary Участники списка рассылки
+// @Tags lists
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID списка"
+// @Success 200 {array} DistributionListMemberResponse "Участники"
+// @Failure 404 {object} map[string]string "Список не найден"
+// @Router /lists/{id}/members [get]
+func (dc *DistributionListController) ListMembers(c *gin.Context) {
+	list, _, ok := dc.findList(c, false)
+	if !ok {
+		return
+	}
+
+	members, err := models.ListDistributionListMembers(dc.DB, list.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить участников"})
+		return
+	}
+
+	response := make([]DistributionListMemberResponse, 0, len(members))
+	for i := range members {
+		response = append(response, DistributionListMemberResponse{
+			User:     newUserCard(&members[i].User),
+			IsOwner:  members[i].UserID == list.OwnerID,
+			JoinedAt: members[i].CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Добавить участника в список рассылки
+// @Description Добавляет зарегистрированного пользователя по адресу. Доступно владельцу и администраторам
+// @Tags lists
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID списка"
+// @Param request body AddListMemberRequest true "Адрес пользователя"
+// @Success 201 {object} DistributionListMemberResponse "Участник"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Список или пользователь не найден"
+// @Failure 409 {object} map[string]string "Пользователь уже в списке"
+// @Router /lists/{id}/members [post]
+func (dc *DistributionListController) AddMember(c *gin.Context) {
+	list, _, ok := dc.findList(c, true)
+	if !ok {
+		return
+	}
+
+	var req AddListMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	member, err := models.AddDistributionListMember(dc.DB, list, req.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		} else {
+			respondDistributionListError(c, err, "не удалось добавить участника")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, DistributionListMemberResponse{
+		User:     newUserCard(&member.User),
+		JoinedAt: member.CreatedAt,
+	})
+}
+
+
+// @Summary Исключить участника из списка рассылки
+// @Description Владелец и администраторы могут исключить любого участника, кроме владельца. Участник может исключить себя сам
+// @Tags lists
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID списка"
+// @Param user_id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Участник исключен"
+// @Failure 400 {object} map[string]string "Владельца нельзя исключить"
+// @Failure 403 {object} map[string]string "Недостаточно прав"
+// @Failure 404 {object} map[string]string "Список или участник не найден"
+// @Router /lists/{id}/members/{user_id} [delete]
+func (dc *DistributionListController) RemoveMember(c *gin.Context) {
+	list, user, ok := dc.findList(c, false)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if uint(memberID) != user.ID && !list.CanManage(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для управления списком"})
+		return
+	}
+
+	if err := models.RemoveDistributionListMember(dc.DB, list, uint(memberID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "участник не найден"})
+		} else {
+			respondDistributionListError(c, err, "не удалось исключить участника")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "участник исключен из списка"})
+}
+
+
+// findList загружает список и проверяет доступ: просматривать список могут
+// участники, владелец и администраторы, управлять — только владелец и
+// администраторы. Посторонним список не раскрывается.
+func (dc *DistributionListController) findList(c *gin.Context, manage bool) (*models.DistributionList, *models.User, bool) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return nil, nil, false
+	}
+
+	listID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, nil, false
+	}
+
+	list, err := models.GetDistributionList(dc.DB, uint(listID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "список рассылки не найден"})
+		return nil, nil, false
+	}
+
+	if list.CanManage(user) {
+		return list, user, true
+	}
+
+	member, err := models.IsDistributionListMember(dc.DB, list.ID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось проверить доступ"})
+		return nil, nil, false
+	}
+	if !member {
+		c.JSON(http.StatusNotFound, gin.H{"error": "список рассылки не найден"})
+		return nil, nil, false
+	}
+	if manage {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для управления списком"})
+		return nil, nil, false
+	}
+
+	return list, user, true
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/queue"
+)
+
+
+type EventCatalogController struct{}
+
+
+func NewEventCatalogController() *EventCatalogController {
+	return &EventCatalogController{}
+}
+
+
+// @Summary Каталог событий
+// @Description Возвращает события, которые сервис публикует в брокер и отправляет клиентам: ключ маршрутизации, версию схемы и имя документа JSON Schema. Тело каждого события содержит поле version; новые поля добавляются без смены версии, поэтому потребители должны игнорировать незнакомые поля
+// @Tags events
+// @Produce json
+// @Success 200 {array} queue.EventType "Каталог событий"
+// @Router /events/schemas [get]
+func (ec *EventCatalogController) ListEventTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, queue.Catalog)
+}
+
+
+// @Summary Схема события
+// @Description Возвращает документ JSON Schema тела события
+// @Tags events
+// @Produce json
+// @Param routing_key path string true "Ключ маршрутизации события, например message.read"
+// @Success 200 {object} map[string]interface{} "Документ JSON Schema"
+// @Failure 404 {object} map[string]string "Событие не найдено"
+// @Router /events/schemas/{routing_key} [get]
+func (ec *EventCatalogController) GetEventSchema(c *gin.Context) {
+	schema, err := queue.EventSchema(c.Param("routing_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "событие не найдено"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/schema+json", schema)
+}
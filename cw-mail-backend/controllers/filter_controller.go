@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type FilterController struct {
+	DB *gorm.DB
+}
+
+
+type FilterRuleRequest struct {
+	Name           string                   `json:"name" binding:"required" example:"Рассылки"`
+	Enabled        *bool                    `json:"enabled" example:"true"`   // по умолчанию true
+	MatchAll       *bool                    `json:"match_all" example:"true"` // true — все условия, false — любое; по умолчанию true
+	StopProcessing bool                     `json:"stop_processing" example:"false"`
+	Conditions     []models.FilterCondition `json:"conditions" binding:"required"`
+	Actions        []models.FilterAction    `json:"actions" binding:"required"`
+}
+
+
+type ReorderFiltersRequest struct {
+	IDs []uint `json:"ids" binding:"required"`
+}
+
+
+type FilterMatchResponse struct {
+	Message MessageResponse      `json:"message"`
+	Outcome models.FilterOutcome `json:"outcome"`
+}
+
+
+// FilterDryRunResponse — письма, к которым правило применилось бы. Проверяются
+// полученные письма, кроме удаленных, от новых к старым; Truncated означает,
+// что достигнут предел и проверены не все письма.
+type FilterDryRunResponse struct {
+	Matched   int                   `json:"matched" example:"3"`
+	Truncated bool                  `json:"truncated" example:"false"`
+	Messages  []FilterMatchResponse `json:"messages"`
+}
+
+
+func NewFilterController(db *gorm.DB) *FilterController {
+	return &FilterController{DB: db}
+}
+
+
+func (r FilterRuleRequest) fields() models.FilterRuleFields {
+	fields := models.FilterRuleFields{
+		Name:           r.Name,
+		Enabled:        true,
+		MatchAll:       true,
+		StopProcessing: r.StopProcessing,
+		Conditions:     r.Conditions,
+		Actions:        r.Actions,
+	}
+	if r.Enabled != nil {
+		fields.Enabled = *r.Enabled
+	}
+	if r.MatchAll != nil {
+		fields.MatchAll = *r.MatchAll
+	}
+	return fields
+}
+
+
+func respondFilterError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidFilterRule):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":           err.Error(),
+			"valid_fields":    models.ValidFilterFields,
+			"valid_operators": models.ValidFilterOperators,
+			"valid_actions":   models.ValidFilterActions,
+			"valid_labels":    models.ValidLabels,
+		})
+	case errors.Is(err, models.ErrInvalidFilterOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrFilterLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+
+func (fc *FilterController) findRule(c *gin.Context) (*models.FilterRule, bool) {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, false
+	}
+
+	rule, err := models.GetFilterRule(fc.DB, uint(ruleID), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "правило не найдено"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить правило"})
+		}
+		return nil, false
+	}
+
+	return rule, true
+}
+
+
+func (fc *FilterController) respondDryRun(c *gin.Context, rule *models.FilterRule) {
+	matches, err := models.DryRunFilterRule(fc.DB, rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось проверить правило"})
+		return
+	}
+
+	response := FilterDryRunResponse{
+		Matched:   len(matches),
+		Truncated: len(matches) >= models.MaxFilterDryRunMatches,
+		Messages:  make([]FilterMatchResponse, 0, len(matches)),
+	}
+	for i := range matches {
+		response.Messages = append(response.Messages, FilterMatchResponse{
+			Message: newMessageResponse(&matches[i].Message, c.GetUint("user_id")),
+			Outcome: matches[i].Outcome,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Правила фильтрации
+// @Description Возвращает правила фильтрации в порядке применения
+// @Tags filters
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.FilterRule "Правила"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters [get]
+func (fc *FilterController) ListRules(c *gin.Context) {
+	rules, err := models.ListFilterRules(fc.DB, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить правила"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+
+// @Summary Создать правило фильтрации
+// @Description Добавляет правило в конец списка. Условия: поля from, to, subject, body; операторы contains, not_contains, equals, starts_with, ends_with, matches (регулярное выражение). Действия: label (inbox, spam, trash), mark_read, star, forward (адрес), delete
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body FilterRuleRequest true "Правило"
+// @Success 201 {object} models.FilterRule "Созданное правило"
+// @Failure 400 {object} map[string]string "Неверное правило"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 403 {object} map[string]string "Достигнуто максимальное количество правил"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters [post]
+func (fc *FilterController) CreateRule(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req FilterRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	rule, err := models.CreateFilterRule(fc.DB, user, req.fields())
+	if err != nil {
+		respondFilterError(c, err, "не удалось создать правило")
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+
+// @Summary Правило фильтрации
+// @Description Возвращает правило по ID
+// @Tags filters
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID правила"
+// @Success 200 {object} models.FilterRule "Правило"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Правило не найдено"
+// @Router /filters/{id} [get]
+func (fc *FilterController) GetRule(c *gin.Context) {
+	rule, ok := fc.findRule(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+
+// @Summary Изменить правило фильтрации
+// @Description Заменяет условия, действия и настройки правила. Позиция не меняется
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID правила"
+// @Param request body FilterRuleRequest true "Правило"
+// @Success 200 {object} models.FilterRule "Измененное правило"
+// @Failure 400 {object} map[string]string "Неверное правило"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Правило не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters/{id} [put]
+func (fc *FilterController) UpdateRule(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	rule, ok := fc.findRule(c)
+	if !ok {
+		return
+	}
+
+	var req FilterRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.UpdateFilterRule(fc.DB, rule, user, req.fields()); err != nil {
+		respondFilterError(c, err, "не удалось изменить правило")
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+
+// @Summary Удалить правило фильтрации
+// @Description Удаляет правило. Уже обработанные письма не меняются
+// @Tags filters
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID правила"
+// @Success 200 {object} map[string]string "Правило удалено"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Правило не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters/{id} [delete]
+func (fc *FilterController) DeleteRule(c *gin.Context) {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if err := models.DeleteFilterRule(fc.DB, uint(ruleID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "правило не найдено"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить правило"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "правило удалено"})
+}
+
+
+// @Summary Изменить порядок правил
+// @Description Задает порядок применения правил. Список должен содержать ID всех правил пользователя
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReorderFiltersRequest true "ID правил в новом порядке"
+// @Success 200 {array} models.FilterRule "Правила в новом порядке"
+// @Failure 400 {object} map[string]string "Список не совпадает с правилами пользователя"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters/order [put]
+func (fc *FilterController) ReorderRules(c *gin.Context) {
+	var req ReorderFiltersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	rules, err := models.ReorderFilterRules(fc.DB, c.GetUint("user_id"), req.IDs)
+	if err != nil {
+		respondFilterError(c, err, "не удалось изменить порядок правил")
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+
+// @Summary Пробный запуск правила
+// @Description Проверяет несохраненное правило на уже полученных письмах и возвращает письма, к которым оно применилось бы. Письма не изменяются
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body FilterRuleRequest true "Правило"
+// @Success 200 {object} FilterDryRunResponse "Подходящие письма"
+// @Failure 400 {object} map[string]string "Неверное правило"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters/dry-run [post]
+func (fc *FilterController) DryRun(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req FilterRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	rule, err := models.NewFilterRule(user, req.fields())
+	if err != nil {
+		respondFilterError(c, err, "не удалось проверить правило")
+		return
+	}
+
+	fc.respondDryRun(c, rule)
+}
+
+
+// @Summary Пробный запуск сохраненного правила
+// @Description Возвращает уже полученные письма, к которым применилось бы правило. Письма не изменяются
+// @Tags filters
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID правила"
+// @Success 200 {object} FilterDryRunResponse "Подходящие письма"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Правило не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters/{id}/dry-run [post]
+func (fc *FilterController) DryRunRule(c *gin.Context) {
+	rule, ok := fc.findRule(c)
+	if !ok {
+		return
+	}
+
+	fc.respondDryRun(c, rule)
+}
+
+
+// @Summary Применить правило к полученным письмам
+// @Description Применяет действия правила ко всем подходящим полученным письмам, кроме удаленных. Пересылка к старым письмам не применяется
+// @Tags filters
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID правила"
+// @Success 200 {object} map[string]int "Количество измененных писем"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Правило не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /filters/{id}/apply [post]
+func (fc *FilterController) ApplyRule(c *gin.Context) {
+	rule, ok := fc.findRule(c)
+	if !ok {
+		return
+	}
+
+	updated, err := models.ApplyFilterRule(fc.DB, rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось применить правило"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
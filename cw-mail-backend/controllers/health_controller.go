@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+
+// BrokerStatus сообщает, есть ли соединение с брокером сообщений.
+type BrokerStatus interface {
+	Ready() bool
+}
+
+
+type HealthController struct {
+	DB     *gorm.DB
+	Broker BrokerStatus
+}
+
+
+type ReadinessResponse struct {
+	Status   string `json:"status" example:"ready"`
+	Database string `json:"database" example:"up"`
+	Broker   string `json:"broker" example:"up"`
+}
+
+
+func NewHealthController(db *gorm.DB, broker BrokerStatus) *HealthController {
+	return &HealthController{
+		DB:     db,
+		Broker: broker,
+	}
+}
+
+
+// @Summary Проверка работоспособности
+// @Description Отвечает 200, пока процесс обрабатывает запросы
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string "Сервис работает"
+// @Router /health/live [get]
+func (hc *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+
+// @Summary Проверка готовности
+// @Description Отвечает 503, пока нет соединения с базой данных или RabbitMQ. Без брокера письма отправляются, но уведомления задерживаются в outbox до переподключения
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessResponse "Сервис готов"
+// @Failure 503 {object} ReadinessResponse "Нет соединения с базой данных или брокером"
+// @Router /health/ready [get]
+func (hc *HealthController) Ready(c *gin.Context) {
+	response := ReadinessResponse{Status: "ready", Database: "up", Broker: "up"}
+
+	if sqlDB, err := hc.DB.DB(); err != nil || sqlDB.PingContext(c.Request.Context()) != nil {
+		response.Database = "down"
+	}
+	if hc.Broker != nil && !hc.Broker.Ready() {
+		response.Broker = "down"
+	}
+
+	status := http.StatusOK
+	if response.Database != "up" || response.Broker != "up" {
+		response.Status = "not_ready"
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
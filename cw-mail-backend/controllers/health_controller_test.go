@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubBroker bool
+
+func (b stubBroker) Ready() bool {
+	return bool(b)
+}
+
+func TestHealthReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	for _, tc := range []struct {
+		broker stubBroker
+		status int
+		want   ReadinessResponse
+	}{
+		{true, http.StatusOK, ReadinessResponse{Status: "ready", Database: "up", Broker: "up"}},
+		{false, http.StatusServiceUnavailable, ReadinessResponse{Status: "not_ready", Database: "up", Broker: "down"}},
+	} {
+		hc := NewHealthController(db, tc.broker)
+		router := gin.New()
+		router.GET("/health/ready", hc.Ready)
+
+		w := performRequest(t, router, http.MethodGet, "/health/ready")
+		if w.Code != tc.status {
+			t.Errorf("Брокер %v: статус %d, ожидался %d", tc.broker, w.Code, tc.status)
+		}
+		var got ReadinessResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Ошибка разбора ответа: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("Брокер %v: ответ %+v, ожидался %+v", tc.broker, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/models"
+)
+
+
+// checkLoginAllowed отвечает 429, если для учетной записи или IP-адреса
+// действует задержка или блокировка. Ошибки хранилища не блокируют вход.
+func checkLoginAllowed(c *gin.Context, guard *lockout.Guard, account string) bool {
+	if guard == nil {
+		return true
+	}
+
+	decision, err := guard.Check(c.Request.Context(), account, c.ClientIP())
+	if err != nil {
+		log.Printf("Ошибка проверки блокировки входа: %v", err)
+		return true
+	}
+
+	if !decision.Allowed() {
+		respondLoginThrottled(c, decision)
+		return false
+	}
+
+	return true
+}
+
+
+// registerLoginFailure учитывает неудачную попытку входа, записывает ее в
+// журнал аудита и отвечает 401 (или 429, если учетная запись заблокирована).
+// user равен nil, если учетная запись с таким email не найдена.
+func registerLoginFailure(c *gin.Context, guard *lockout.Guard, auditLog *audit.Logger, account string, user *models.User, reason string) {
+	auditLoginFailure(c, auditLog, account, user, reason)
+
+	if guard != nil {
+		decision, err := guard.Failure(c.Request.Context(), account, c.ClientIP())
+		if err != nil {
+			log.Printf("Ошибка учета неудачной попытки входа: %v", err)
+		} else if decision.Locked {
+			respondLoginThrottled(c, decision)
+			return
+		} else if decision.RetryAfter > 0 {
+			c.Header("Retry-After", retryAfterSeconds(decision.RetryAfter))
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "неверные учетные данные"})
+}
+
+
+func registerLoginSuccess(c *gin.Context, guard *lockout.Guard, auditLog *audit.Logger, account string, user *models.User) {
+	auditLog.RecordRequest(c, audit.Event{
+		Action:     audit.ActionLoginSucceeded,
+		ActorID:    audit.ID(user.ID),
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+		Details:    gin.H{"mfa": user.MFAEnabled},
+	})
+
+	if guard == nil {
+		return
+	}
+
+	if err := guard.Success(c.Request.Context(), account); err != nil {
+		log.Printf("Ошибка сброса счетчика попыток входа: %v", err)
+	}
+}
+
+
+func auditLoginFailure(c *gin.Context, auditLog *audit.Logger, account string, user *models.User, reason string) {
+	event := audit.Event{
+		Action:  audit.ActionLoginFailed,
+		Details: gin.H{"email": account, "reason": reason},
+	}
+	if user != nil {
+		event.TargetType = audit.TargetUser
+		event.TargetID = audit.ID(user.ID)
+	}
+
+	auditLog.RecordRequest(c, event)
+}
+
+
+func respondLoginThrottled(c *gin.Context, decision lockout.Decision) {
+	c.Header("Retry-After", retryAfterSeconds(decision.RetryAfter))
+
+	if decision.Locked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "учетная запись временно заблокирована из-за неудачных попыток входа"})
+		return
+	}
+
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "слишком много неудачных попыток входа, повторите попытку позже"})
+}
+
+
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
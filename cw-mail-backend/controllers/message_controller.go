@@ -1,27 +1,43 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/middleware"
 	"github.com/mail-service/models"
 	"github.com/mail-service/queue"
+	"github.com/mail-service/scanner"
 	"gorm.io/gorm"
 )
 
 
 type MessageController struct {
-	DB          *gorm.DB
-	NotifyQueue *queue.NotificationQueue
+	DB      *gorm.DB
+	Config  *config.Config
+	Scanner *scanner.Hook
+	Audit   *audit.Logger
 }
 
 
 type SendMessageRequest struct {
-	ReceiverEmail string `json:"receiver_email" binding:"required,email" example:"receiver@example.com"`
-	Subject       string `json:"subject" binding:"required" example:"Важное сообщение"`
-	Body          string `json:"body" binding:"required" example:"Текст сообщения содержит важную информацию"`
-	ReadLimit     int    `json:"read_limit" example:"1"` // необязательное поле, 0 означает без ограничений
+	ReceiverEmail   string `json:"receiver_email" binding:"required,email" example:"receiver@example.com"`
+	Subject         string `json:"subject" binding:"required" example:"Важное сообщение"`
+	Body            string `json:"body" binding:"required" example:"Текст сообщения содержит важную информацию"`
+	ReadLimit       int    `json:"read_limit" example:"1"`                   // необязательное поле, 0 означает без ограничений
+	AppendSignature bool   `json:"append_signature" example:"true"`          // добавить подпись из профиля
+	FromAddress     string `json:"from_address" example:"alias@example.com"` // необязательное поле: псевдоним отправителя
+}
+
+
+type BlockMessageSenderRequest struct {
+	Domain bool `json:"domain" example:"false"` // заблокировать весь домен отправителя
 }
 
 
@@ -30,25 +46,42 @@ type UpdateLabelRequest struct {
 }
 
 
-func NewMessageController(db *gorm.DB, notifyQueue *queue.NotificationQueue, _ interface{}) *MessageController {
+type UpdateStarRequest struct {
+	Starred bool `json:"starred" example:"true"`
+}
+
+
+func NewMessageController(db *gorm.DB, cfg *config.Config, scan *scanner.Hook, auditLog *audit.Logger) *MessageController {
 	return &MessageController{
-		DB:          db,
-		NotifyQueue: notifyQueue,
+		DB:      db,
+		Config:  cfg,
+		Scanner: scan,
+		Audit:   auditLog,
 	}
 }
 
 
+// sendingPolicy — ограничения на отправку для неподтвержденных адресов
+// (EMAIL_VERIFICATION_RESTRICT_SENDING).
+func sendingPolicy(cfg *config.Config) models.SendingPolicy {
+	return models.SendingPolicy{RequireVerified: cfg.Verification.RestrictSending}
+}
+
+
 // @Summary Отправить сообщение
-// @Description Отправляет сообщение другому пользователю
+// @Description Отправляет сообщение другому пользователю (на основной адрес или псевдоним) или в список рассылки. from_address позволяет отправить письмо с псевдонима. Для списка рассылки каждый участник получает отдельную копию, а в ответе возвращается ListDeliveryResponse; копии писем с адресами участников в нем получает только тот, кто управляет списком. Если включена проверка содержимого, письмо может быть отклонено (422) или задержано в карантине до решения администратора (202, QuarantinedSendResponse). Письмо получателю, который заблокировал отправителя с действием reject, принимается (201), но не доставляется и не сохраняется
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body SendMessageRequest true "Данные для отправки сообщения"
-// @Success 201 {object} models.Message "Созданное сообщение"
-// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Success 201 {object} MessageResponse "Созданное сообщение"
+// @Success 202 {object} QuarantinedSendResponse "Письмо задержано в карантине"
+// @Failure 400 {object} map[string]string "Неверные данные запроса или в списке рассылки нет получателей"
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 403 {object} map[string]string "Нет прав на отправку в список рассылки, адрес отправителя не подтвержден или не принадлежит пользователю, или получатель отклонил письмо reject в Sieve-скрипте"
 // @Failure 404 {object} map[string]string "Получатель не найден"
+// @Failure 422 {object} map[string]string "Письмо отклонено проверкой содержимого"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /messages/send [post]
 func (mc *MessageController) SendMessage(c *gin.Context) {
@@ -58,8 +91,8 @@ func (mc *MessageController) SendMessage(c *gin.Context) {
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sender, err := middleware.GetCurrentUser(c)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
 		return
 	}
@@ -71,27 +104,245 @@ func (mc *MessageController) SendMessage(c *gin.Context) {
 	}
 
 
+	if req.AppendSignature && sender.Signature != "" {
+		req.Body += "\n\n-- \n" + sender.Signature
+	}
+
+
+	out := models.OutgoingMessage{
+		From:      req.FromAddress,
+		To:        req.ReceiverEmail,
+		Subject:   req.Subject,
+		Body:      req.Body,
+		ReadLimit: req.ReadLimit,
+	}
+
+
+	// Содержимое проверяется до доставки; вложений пока нет, поэтому
+	// сканируется только текст письма
+	scan := mc.Scanner.Check(c.Request.Context(), scanner.Content{
+		From:    sender.Email,
+		To:      req.ReceiverEmail,
+		Subject: req.Subject,
+		Parts:   []scanner.Part{{Name: "body", ContentType: "text/plain", Data: []byte(req.Body)}},
+	})
+	if scan.Verdict == scanner.VerdictReject {
+		if err := mc.enqueueScan(mc.DB, scan, sender.ID, out, 0); err != nil {
+			log.Printf("Ошибка записи вердикта сканера: %v", err)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "письмо отклонено проверкой содержимого"})
+		return
+	}
+
+
 	tx := mc.DB.Begin()
 
-	message, err := models.SendMessage(tx, userID.(uint), req.ReceiverEmail, req.Subject, req.Body, req.ReadLimit)
+	delivery, err := models.DeliverMessage(tx, sender, out, sendingPolicy(mc.Config))
 	if err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "не удалось отправить сообщение: получатель не найден"})
+		switch {
+		case errors.Is(err, models.ErrListPostForbidden),
+			errors.Is(err, models.ErrSenderAddressNotOwned),
+			errors.Is(err, models.ErrMessageRejected),
+			errors.Is(err, models.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrListNoRecipients):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "не удалось отправить сообщение: получатель не найден"})
+		}
 		return
 	}
 
 
-	err = mc.NotifyQueue.PublishNewMessageNotification(message.ID, message.SenderID, message.ReceiverID)
-	if err != nil {
+	// Задержанное письмо не доставляется: доставка выше только проверила
+	// адреса и политику получателей, а при выпуске из карантина повторится
+	if scan.Verdict == scanner.VerdictQuarantine {
+		tx.Rollback()
+
+		var quarantined *models.QuarantinedMessage
+		err := mc.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if quarantined, err = models.QuarantineMessage(tx, sender.ID, out, scan.Scanner, scan.Reason); err != nil {
+				return err
+			}
+			return mc.enqueueScan(tx, scan, sender.ID, out, quarantined.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось поместить письмо в карантин"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, QuarantinedSendResponse{QuarantineID: quarantined.ID, Status: quarantined.Status})
+		return
+	}
+
+
+	// Уведомления записываются в outbox в той же транзакции и публикуются
+	// после фиксации
+	if err := enqueueDelivery(tx, delivery); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить уведомление"})
+		return
+	}
+	if err := mc.enqueueScan(tx, scan, sender.ID, out, 0); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить уведомление"})
 		return
 	}
 
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить сообщение"})
+		return
+	}
+
+
+	// Письмо, отброшенное блокировкой получателя, есть только в отправленных:
+	// уведомлений о нем нет, но ответ не отличается от успешной отправки
+	message := delivery.Dropped
+	if message == nil {
+		message = &delivery.Messages[0]
+	}
+
+	// Адресат попадает в частые контакты отправителя; ошибка учета не мешает отправке
+	address, name := message.Receiver.Email, message.Receiver.DisplayName
+	if delivery.List != nil {
+		address, name = delivery.List.Address, delivery.List.Name
+	}
+	if err := models.RecordContactUsage(mc.DB, sender.ID, address, name); err != nil {
+		log.Printf("Ошибка учета адресата: %v", err)
+	}
+
+	if delivery.List != nil {
+		response := ListDeliveryResponse{
+			ListAddress: delivery.List.Address,
+			Recipients:  len(delivery.Messages),
+		}
+		if delivery.List.CanManage(sender) {
+			response.Messages = newMessageListResponse(delivery.Messages, sender.ID)
+		}
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	c.JSON(http.StatusCreated, newMessageResponse(message, sender.ID))
+}
 
-	c.JSON(http.StatusCreated, message)
+
+// enqueueScan записывает в outbox вердикт сканера, если он указан в
+// SCANNER_NOTIFY.
+func (mc *MessageController) enqueueScan(db *gorm.DB, scan scanner.Result, senderID uint, out models.OutgoingMessage, quarantineID uint) error {
+	if !mc.Scanner.Notifies(scan.Verdict) {
+		return nil
+	}
+
+	return models.EnqueueOutboxEvent(db, queue.ScanRoutingKeyPrefix+string(scan.Verdict), queue.ScanNotification{
+		Version:      queue.EventVersion,
+		Verdict:      string(scan.Verdict),
+		Scanner:      scan.Scanner,
+		Reason:       scan.Reason,
+		SenderID:     senderID,
+		To:           out.To,
+		Subject:      out.Subject,
+		QuarantineID: quarantineID,
+		Timestamp:    time.Now(),
+	})
+}
+
+
+// enqueueDelivery записывает в outbox уведомления о новых письмах доставки,
+// включая пересланные копии и автоответы.
+func enqueueDelivery(db *gorm.DB, delivery *models.Delivery) error {
+	for _, message := range append(append(delivery.Messages, delivery.Forwarded...), delivery.AutoReplies...) {
+		err := models.EnqueueOutboxEvent(db, queue.RoutingKey, queue.NewMessageNotification{
+			Version:    queue.EventVersion,
+			MessageID:  message.ID,
+			SenderID:   message.SenderID,
+			ReceiverID: message.ReceiverID,
+			Timestamp:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+// enqueueRead записывает в outbox первое прочтение письма получателем и, если
+// письмо удалено после последнего разрешенного прочтения, его удаление.
+func enqueueRead(db *gorm.DB, message *models.Message, destroyed bool) error {
+	now := time.Now()
+	err := models.EnqueueOutboxEvent(db, queue.RoutingKeyMessageRead, queue.MessageReadNotification{
+		Version:    queue.EventVersion,
+		MessageID:  message.ID,
+		SenderID:   message.SenderID,
+		ReceiverID: message.ReceiverID,
+		ReadCount:  message.ReadCount + 1,
+		ReadLimit:  message.ReadLimit,
+		Timestamp:  now,
+	})
+	if err != nil || !destroyed {
+		return err
+	}
+
+	return models.EnqueueOutboxEvent(db, queue.RoutingKeyMessageDestroyed, queue.MessageDestroyedNotification{
+		Version:    queue.EventVersion,
+		MessageID:  message.ID,
+		SenderID:   message.SenderID,
+		ReceiverID: message.ReceiverID,
+		ReadLimit:  message.ReadLimit,
+		Timestamp:  now,
+	})
+}
+
+
+// enqueueLabel записывает в outbox перенос письма в другую папку, а перенос
+// в корзину — еще и как удаление.
+func enqueueLabel(db *gorm.DB, messageID, userID uint, previous, label string) error {
+	if previous == label {
+		return nil
+	}
+
+	now := time.Now()
+	err := models.EnqueueOutboxEvent(db, queue.RoutingKeyMessageLabeled, queue.MessageLabeledNotification{
+		Version:   queue.EventVersion,
+		MessageID: messageID,
+		UserID:    userID,
+		From:      previous,
+		Label:     label,
+		Timestamp: now,
+	})
+	if err != nil || label != "trash" {
+		return err
+	}
+
+	return models.EnqueueOutboxEvent(db, queue.RoutingKeyMessageDeleted, queue.MessageDeletedNotification{
+		Version:   queue.EventVersion,
+		MessageID: messageID,
+		UserID:    userID,
+		Timestamp: now,
+	})
+}
+
+
+func enqueueExpired(db *gorm.DB, messages []models.Message) error {
+	now := time.Now()
+	for _, message := range messages {
+		err := models.EnqueueOutboxEvent(db, queue.RoutingKeyMessageExpired, queue.MessageExpiredNotification{
+			Version:    queue.EventVersion,
+			MessageID:  message.ID,
+			SenderID:   message.SenderID,
+			ReceiverID: message.ReceiverID,
+			ExpiresAt:  message.ExpiresAt,
+			Timestamp:  now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 
@@ -100,7 +351,8 @@ func (mc *MessageController) SendMessage(c *gin.Context) {
 // @Tags messages
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.Message "Список входящих сообщений"
+// @Param to query string false "Только письма, пришедшие на этот адрес (основной или псевдоним)"
+// @Success 200 {array} MessageResponse "Список входящих сообщений"
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /messages/inbox [get]
@@ -111,13 +363,13 @@ func (mc *MessageController) GetInbox(c *gin.Context) {
 		return
 	}
 
-	messages, err := models.GetInboxMessages(mc.DB, userID.(uint))
+	messages, err := models.GetInboxMessages(mc.DB.Scopes(models.AddressedTo(c.Query("to"))), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить входящие сообщения"})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, newMessageListResponse(messages, userID.(uint)))
 }
 
 
@@ -126,7 +378,7 @@ func (mc *MessageController) GetInbox(c *gin.Context) {
 // @Tags messages
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.Message "Список отправленных сообщений"
+// @Success 200 {array} MessageResponse "Список отправленных сообщений"
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /messages/sent [get]
@@ -143,7 +395,7 @@ func (mc *MessageController) GetSent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, newMessageListResponse(messages, userID.(uint)))
 }
 
 
@@ -152,7 +404,8 @@ func (mc *MessageController) GetSent(c *gin.Context) {
 // @Tags messages
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.Message "Список спам-сообщений"
+// @Param to query string false "Только письма, пришедшие на этот адрес (основной или псевдоним)"
+// @Success 200 {array} MessageResponse "Список спам-сообщений"
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /messages/spam [get]
@@ -163,13 +416,13 @@ func (mc *MessageController) GetSpam(c *gin.Context) {
 		return
 	}
 
-	messages, err := models.GetSpamMessages(mc.DB, userID.(uint))
+	messages, err := models.GetSpamMessages(mc.DB.Scopes(models.AddressedTo(c.Query("to"))), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить спам-сообщения"})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, newMessageListResponse(messages, userID.(uint)))
 }
 
 
@@ -178,7 +431,8 @@ func (mc *MessageController) GetSpam(c *gin.Context) {
 // @Tags messages
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.Message "Список удаленных сообщений"
+// @Param to query string false "Только письма, пришедшие на этот адрес (основной или псевдоним)"
+// @Success 200 {array} MessageResponse "Список удаленных сообщений"
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /messages/trash [get]
@@ -189,13 +443,13 @@ func (mc *MessageController) GetTrash(c *gin.Context) {
 		return
 	}
 
-	messages, err := models.GetTrashMessages(mc.DB, userID.(uint))
+	messages, err := models.GetTrashMessages(mc.DB.Scopes(models.AddressedTo(c.Query("to"))), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить удаленные сообщения"})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, newMessageListResponse(messages, userID.(uint)))
 }
 
 
@@ -234,19 +488,19 @@ func (mc *MessageController) UpdateLabel(c *gin.Context) {
 	}
 
 
-	validLabels := map[string]bool{
-		"inbox": true,
-		"spam":  true,
-		"trash": true,
-	}
-
-	if !validLabels[req.Label] {
+	if !models.IsValidLabel(req.Label) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "неверная метка"})
 		return
 	}
 
 
-	err = models.UpdateMessageLabel(mc.DB, uint(messageID), userID.(uint), req.Label)
+	err = mc.DB.Transaction(func(tx *gorm.DB) error {
+		previous, err := models.UpdateMessageLabel(tx, uint(messageID), userID.(uint), req.Label)
+		if err != nil {
+			return err
+		}
+		return enqueueLabel(tx, uint(messageID), userID.(uint), previous, req.Label)
+	})
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "сообщение не найдено или доступ запрещен"})
@@ -256,17 +510,145 @@ func (mc *MessageController) UpdateLabel(c *gin.Context) {
 		return
 	}
 
+	if req.Label == "trash" {
+		mc.Audit.RecordRequest(c, audit.Event{
+			Action:     audit.ActionMessageTrashed,
+			TargetType: audit.TargetMessage,
+			TargetID:   audit.ID(uint(messageID)),
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "метка успешно обновлена"})
 }
 
 
+// @Summary Отметить сообщение звездочкой
+// @Description Ставит или снимает отметку is_starred у полученного или отправленного сообщения. Отметки отправителя и получателя независимы: другая сторона их не видит
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID сообщения"
+// @Param request body UpdateStarRequest true "Отметка"
+// @Success 200 {object} map[string]string "Отметка изменена"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Сообщение не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /messages/{id}/star [put]
+func (mc *MessageController) UpdateStar(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	var req UpdateStarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.UpdateMessageStar(mc.DB, uint(messageID), c.GetUint("user_id"), req.Starred); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "сообщение не найдено или доступ запрещен"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось изменить отметку"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "отметка изменена"})
+}
+
+
+// @Summary Заблокировать отправителя сообщения
+// @Description Добавляет адрес отправителя (или весь его домен) в список блокировки получателя и переносит сообщение из входящих в спам
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID сообщения"
+// @Param request body BlockMessageSenderRequest false "Блокировать весь домен"
+// @Success 200 {object} models.BlockedSender "Запись списка блокировки"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 403 {object} map[string]string "Список блокировки заполнен"
+// @Failure 404 {object} map[string]string "Сообщение не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /messages/{id}/block-sender [post]
+func (mc *MessageController) BlockSender(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	// Тело необязательно: по умолчанию блокируется только адрес
+	var req BlockMessageSenderRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+			return
+		}
+	}
+
+	entry, err := models.BlockMessageSender(mc.DB, uint(messageID), c.GetUint("user_id"), req.Domain)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "сообщение не найдено или доступ запрещен"})
+		case errors.Is(err, models.ErrBlockListFull):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось заблокировать отправителя"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+
+// @Summary Не спам
+// @Description Возвращает сообщение из спама во входящие и обучает на нем спам-фильтр получателя как на обычном письме
+// @Tags messages
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID сообщения"
+// @Success 200 {object} map[string]string "Сообщение перенесено во входящие"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Сообщение не найдено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /messages/{id}/not-spam [post]
+func (mc *MessageController) NotSpam(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if _, err := models.MarkNotSpam(mc.DB, uint(messageID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "сообщение не найдено или доступ запрещен"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось перенести сообщение"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "сообщение перенесено во входящие"})
+}
+
+
 // @Summary Получить сообщение по ID
 // @Description Возвращает детали сообщения по его идентификатору
 // @Tags messages
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "ID сообщения"
-// @Success 200 {object} models.Message "Сообщение"
+// @Success 200 {object} MessageResponse "Сообщение; если оно удалено после последнего разрешенного прочтения — DestroyedMessageResponse"
 // @Failure 400 {object} map[string]string "Неверный ID"
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
 // @Failure 403 {object} map[string]string "Доступ запрещен"
@@ -286,14 +668,14 @@ func (mc *MessageController) GetMessageByID(c *gin.Context) {
 		return
 	}
 
-	var message models.Message
-	if err := mc.DB.First(&message, messageID).Error; err != nil {
+	message, err := models.GetMessageByID(mc.DB, uint(messageID))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "сообщение не найдено"})
 		return
 	}
 
 
-	if message.SenderID != userID.(uint) && message.ReceiverID != userID.(uint) {
+	if !message.VisibleTo(userID.(uint)) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "нет доступа к этому сообщению"})
 		return
 	}
@@ -303,10 +685,20 @@ func (mc *MessageController) GetMessageByID(c *gin.Context) {
 
 		if !message.IsRead {
 
-			mc.DB.Model(&message).Update("is_read", true)
-
-
-			shouldDelete, err := models.IncrementMessageReadCount(mc.DB, uint(messageID))
+			// Прочтение и событие о нем фиксируются вместе; письмо, удаленное
+			// после последнего прочтения, порождает еще и message.destroyed
+			var shouldDelete bool
+			err := mc.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&models.Message{ID: message.ID}).Update("is_read", true).Error; err != nil {
+					return err
+				}
+
+				var err error
+				if shouldDelete, err = models.IncrementMessageReadCount(tx, message.ID); err != nil {
+					return err
+				}
+				return enqueueRead(tx, message, shouldDelete)
+			})
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось обновить счетчик прочтений"})
 				return
@@ -314,23 +706,31 @@ func (mc *MessageController) GetMessageByID(c *gin.Context) {
 
 
 			if shouldDelete {
-				c.JSON(http.StatusOK, gin.H{
-					"message": "Это сообщение было прочитано последний раз и удалено",
-					"subject": message.Subject,
-					"deleted": true,
+				mc.Audit.RecordRequest(c, audit.Event{
+					Action:     audit.ActionMessageReadLimitDestroyed,
+					TargetType: audit.TargetMessage,
+					TargetID:   audit.ID(message.ID),
+					Details:    gin.H{"sender_id": message.SenderID, "read_limit": message.ReadLimit},
+				})
+
+				c.JSON(http.StatusOK, DestroyedMessageResponse{
+					Message: "Это сообщение было прочитано последний раз и удалено",
+					Subject: message.Subject,
+					Deleted: true,
 				})
 				return
 			}
 
 
-			if err := mc.DB.First(&message, messageID).Error; err != nil {
+			message, err = models.GetMessageByID(mc.DB, uint(messageID))
+			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "сообщение не найдено"})
 				return
 			}
 		}
 	}
 
-	c.JSON(http.StatusOK, message)
+	c.JSON(http.StatusOK, newMessageResponse(message, userID.(uint)))
 }
 
 
@@ -344,11 +744,19 @@ func (mc *MessageController) GetMessageByID(c *gin.Context) {
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /messages/cleanup [post]
 func (mc *MessageController) CleanupExpiredMessages(c *gin.Context) {
-	err := models.DeleteExpiredMessages(mc.DB)
+	err := mc.DB.Transaction(func(tx *gorm.DB) error {
+		expired, err := models.DeleteExpiredMessages(tx)
+		if err != nil {
+			return err
+		}
+		return enqueueExpired(tx, expired)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить просроченные сообщения"})
 		return
 	}
 
+	mc.Audit.RecordRequest(c, audit.Event{Action: audit.ActionMessagesExpired, TargetType: audit.TargetMessage})
+
 	c.JSON(http.StatusOK, gin.H{"message": "просроченные сообщения успешно удалены"})
 }
@@ -0,0 +1,459 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Контрактные тесты фиксируют форму JSON-ответов, на которую опирается клиент.
+// При изменении набора полей нужно обновить клиент и эти списки одновременно.
+// spam_score есть только в ответах получателю (receiverMessageFields).
+var (
+	messageContractFields = []string{
+		"body", "created_at", "id", "is_read", "is_starred", "label", "read_count", "read_limit",
+		"receiver", "receiver_email", "receiver_id", "receiver_name", "recipient_address",
+		"sender", "sender_address", "sender_email", "sender_id", "sender_name", "subject",
+	}
+	receiverMessageFields   = append([]string{"spam_score"}, messageContractFields...)
+	userCardContractFields  = []string{"display_name", "email", "id", "name"}
+	destroyedContractFields = []string{"deleted", "message", "subject"}
+)
+
+func setupControllerTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Ошибка получения соединения: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&models.User{}, &models.Message{}, &models.AuditLog{}, &models.Contact{}, &models.ContactGroup{},
+		&models.DistributionList{}, &models.DistributionListMember{}, &models.EmailAlias{}, &models.BlockedSender{}, &models.FilterRule{},
+		&models.SieveScript{}, &models.AutoReply{}, &models.VacationSettings{}, &models.SpamSettings{}, &models.SpamToken{}, &models.QuarantinedMessage{}, &models.OutboxEvent{}, &models.DeadLetter{}, &models.Webhook{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	return db
+}
+
+// asUser имитирует JWTAuthMiddleware для переданного пользователя.
+func asUser(user *models.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_email", user.Email)
+		c.Set("user_role", user.Role)
+		c.Set("user", *user)
+		c.Next()
+	}
+}
+
+func performRequest(t *testing.T, router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func jsonKeys(t *testing.T, raw json.RawMessage) []string {
+	t.Helper()
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatalf("Ответ не является JSON-объектом: %s", raw)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func assertKeys(t *testing.T, name string, raw json.RawMessage, want []string) {
+	t.Helper()
+
+	got := jsonKeys(t, raw)
+	want = append([]string(nil), want...)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Изменилась форма %s:\nполучено %v\nожидалось %v", name, got, want)
+	}
+}
+
+func TestMessageResponseContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+	name := "Отправитель"
+	models.UpdateProfile(db, sender, models.ProfileUpdate{DisplayName: &name})
+
+	if _, err := models.SendMessage(db, sender.ID, receiver.Email, "Тема", "Текст", 0); err != nil {
+		t.Fatalf("Ошибка отправки: %v", err)
+	}
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.GET("/inbox", asUser(receiver), mc.GetInbox)
+	router.GET("/sent", asUser(sender), mc.GetSent)
+
+	contracts := map[string][]string{"/inbox": receiverMessageFields, "/sent": messageContractFields}
+	for _, path := range []string{"/inbox", "/sent"} {
+		w := performRequest(t, router, http.MethodGet, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: ожидался статус 200, получено %d", path, w.Code)
+		}
+
+		var messages []json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &messages); err != nil || len(messages) != 1 {
+			t.Fatalf("%s: ожидался массив из одного сообщения: %s", path, w.Body.String())
+		}
+
+		assertKeys(t, "сообщения", messages[0], contracts[path])
+
+		var message struct {
+			Sender     json.RawMessage `json:"sender"`
+			Receiver   json.RawMessage `json:"receiver"`
+			SenderName string          `json:"sender_name"`
+		}
+		json.Unmarshal(messages[0], &message)
+		assertKeys(t, "карточки отправителя", message.Sender, userCardContractFields)
+		assertKeys(t, "карточки получателя", message.Receiver, userCardContractFields)
+
+		if message.SenderName != name {
+			t.Errorf("%s: ожидалось имя отправителя %q, получено %q", path, name, message.SenderName)
+		}
+		for _, leaked := range []string{"role", "encrypted_password", "mfa_enabled", "updated_at"} {
+			if strings.Contains(w.Body.String(), `"`+leaked+`"`) {
+				t.Errorf("%s: в ответ попало поле учетной записи %s", path, leaked)
+			}
+		}
+	}
+
+	// Пустой ящик — это пустой массив, а не null
+	router.GET("/spam", asUser(receiver), mc.GetSpam)
+	if w := performRequest(t, router, http.MethodGet, "/spam"); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("Пустой список должен сериализоваться как [], получено %s", w.Body.String())
+	}
+}
+
+func TestGetMessageByIDContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+
+	message, err := models.SendMessage(db, sender.ID, receiver.Email, "Один раз", "Текст", 1)
+	if err != nil {
+		t.Fatalf("Ошибка отправки: %v", err)
+	}
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	path := "/messages/" + strconv.FormatUint(uint64(message.ID), 10)
+
+	senderRouter := gin.New()
+	senderRouter.GET("/messages/:id", asUser(sender), mc.GetMessageByID)
+
+	w := performRequest(t, senderRouter, http.MethodGet, path)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+	assertKeys(t, "сообщения с лимитом прочтений", w.Body.Bytes(), append([]string{"expires_at"}, messageContractFields...))
+
+	receiverRouter := gin.New()
+	receiverRouter.GET("/messages/:id", asUser(receiver), mc.GetMessageByID)
+
+	w = performRequest(t, receiverRouter, http.MethodGet, path)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+	assertKeys(t, "удаленного сообщения", w.Body.Bytes(), destroyedContractFields)
+}
+
+func TestUserCardContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	user, _ := models.CreateUser(db, "card@example.com", "password123")
+	models.SetUserAvatar(db, user, "avatars/1-test.png")
+
+	uc := NewUserController(db, &config.Config{}, nil)
+	router := gin.New()
+	router.GET("/users/:id/card", asUser(user), uc.GetUserCard)
+
+	w := performRequest(t, router, http.MethodGet, "/users/"+strconv.FormatUint(uint64(user.ID), 10)+"/card")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d", w.Code)
+	}
+	assertKeys(t, "карточки пользователя", w.Body.Bytes(), append([]string{"avatar_url"}, userCardContractFields...))
+
+	if w := performRequest(t, router, http.MethodGet, "/users/999/card"); w.Code != http.StatusNotFound {
+		t.Errorf("Для несуществующего пользователя ожидался статус 404, получено %d", w.Code)
+	}
+
+	// Карточка несвязанного пользователя не отличается от несуществующей
+	stranger, _ := models.CreateUser(db, "stranger@example.com", "password123")
+	if w := performRequest(t, router, http.MethodGet, "/users/"+strconv.FormatUint(uint64(stranger.ID), 10)+"/card"); w.Code != http.StatusNotFound {
+		t.Errorf("Для несвязанного пользователя ожидался статус 404, получено %d", w.Code)
+	}
+}
+
+func TestMessageLifecycleEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+	once, _ := models.SendMessage(db, sender.ID, receiver.Email, "Один раз", "Текст", 1)
+	kept, _ := models.SendMessage(db, sender.ID, receiver.Email, "Обычное", "Текст", 0)
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.GET("/messages/:id", asUser(receiver), mc.GetMessageByID)
+	router.PUT("/messages/:id/label", asUser(receiver), mc.UpdateLabel)
+
+	performRequest(t, router, http.MethodGet, fmt.Sprintf("/messages/%d", once.ID))
+	performRequest(t, router, http.MethodGet, fmt.Sprintf("/messages/%d", kept.ID))
+	performRequest(t, router, http.MethodGet, fmt.Sprintf("/messages/%d", kept.ID))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/messages/%d/label", kept.ID), strings.NewReader(`{"label":"trash"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Перенос в корзину: статус %d: %s", w.Code, w.Body.String())
+	}
+
+	var events []models.OutboxEvent
+	db.Order("id").Find(&events)
+	var routingKeys []string
+	for _, event := range events {
+		routingKeys = append(routingKeys, event.RoutingKey)
+	}
+	want := "message.read,message.destroyed,message.read,message.labeled,message.deleted"
+	if strings.Join(routingKeys, ",") != want {
+		t.Fatalf("События в outbox: %v, ожидалось %s", routingKeys, want)
+	}
+
+	var labeled queue.MessageLabeledNotification
+	json.Unmarshal([]byte(events[3].Payload), &labeled)
+	if labeled.Version != queue.EventVersion || labeled.MessageID != kept.ID || labeled.UserID != receiver.ID || labeled.From != "inbox" || labeled.Label != "trash" {
+		t.Errorf("Неожиданное тело message.labeled: %+v", labeled)
+	}
+}
+
+func TestSendToListRefusedByAllMembers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	owner, _ := models.CreateUser(db, "owner@example.com", "password123")
+	member, _ := models.CreateUser(db, "member@example.com", "password123")
+	list, _ := models.CreateDistributionList(db, owner, models.DistributionListFields{Address: "team@example.com", PostPolicy: models.ListPostAnyone}, models.AddressPolicy{Domains: []string{"example.com"}})
+	models.AddDistributionListMember(db, list, member.Email)
+	for _, user := range []*models.User{owner, member} {
+		models.AddBlockedSender(db, user.ID, sender.Email)
+		models.SetBlockAction(db, user, models.BlockActionReject)
+	}
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.POST("/messages/send", asUser(sender), mc.SendMessage)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/messages/send", strings.NewReader(`{"receiver_email":"team@example.com","subject":"Всем","body":"Текст"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), models.ErrListNoRecipients.Error()) {
+		t.Fatalf("Ожидался статус 400 с ошибкой пустого списка, получено %d: %s", w.Code, w.Body.String())
+	}
+
+	var count int64
+	db.Model(&models.Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Сохранено %d писем, ожидалось 0", count)
+	}
+}
+
+func TestSendToListHidesMemberCopies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	owner, _ := models.CreateUser(db, "owner@example.com", "password123")
+	member, _ := models.CreateUser(db, "member@example.com", "password123")
+	list, _ := models.CreateDistributionList(db, owner, models.DistributionListFields{Address: "team@example.com", PostPolicy: models.ListPostAnyone}, models.AddressPolicy{Domains: []string{"example.com"}})
+	models.AddDistributionListMember(db, list, member.Email)
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.POST("/sender/send", asUser(sender), mc.SendMessage)
+	router.POST("/owner/send", asUser(owner), mc.SendMessage)
+
+	send := func(path string) ListDeliveryResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"receiver_email":"team@example.com","subject":"Всем","body":"Текст"}`))
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Ожидался статус 201, получено %d: %s", w.Code, w.Body.String())
+		}
+		if path == "/sender/send" && strings.Contains(w.Body.String(), member.Email) {
+			t.Errorf("Адреса участников не должны раскрываться отправителю: %s", w.Body.String())
+		}
+		var response ListDeliveryResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	if response := send("/sender/send"); response.Recipients != 2 || len(response.Messages) != 0 {
+		t.Errorf("Постороннему отправителю возвращается только число получателей: %+v", response)
+	}
+	// Себе отправитель копию не получает
+	if response := send("/owner/send"); response.Recipients != 1 || len(response.Messages) != 1 {
+		t.Errorf("Владелец списка получает копии писем: %+v", response)
+	}
+}
+
+func TestSendToBlockingRecipientLooksDelivered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+	models.AddBlockedSender(db, receiver.ID, sender.Email)
+	models.SetBlockAction(db, receiver, models.BlockActionReject)
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.POST("/messages/send", asUser(sender), mc.SendMessage)
+	router.GET("/sender/sent", asUser(sender), mc.GetSent)
+	router.GET("/receiver/inbox", asUser(receiver), mc.GetInbox)
+	router.GET("/receiver/messages/:id", asUser(receiver), mc.GetMessageByID)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/messages/send", strings.NewReader(`{"receiver_email":"receiver@example.com","subject":"Тема","body":"Текст"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated || strings.Contains(w.Body.String(), models.ErrSenderBlocked.Error()) {
+		t.Fatalf("Блокировка не должна раскрываться отправителю, получено %d: %s", w.Code, w.Body.String())
+	}
+	assertKeys(t, "ответ на отправку", w.Body.Bytes(), messageContractFields)
+
+	var sent MessageResponse
+	json.Unmarshal(w.Body.Bytes(), &sent)
+	if sent.ID == 0 {
+		t.Fatal("Отброшенное письмо должно сохраняться с настоящим ID")
+	}
+
+	var sentList []MessageResponse
+	json.Unmarshal(performRequest(t, router, http.MethodGet, "/sender/sent").Body.Bytes(), &sentList)
+	if len(sentList) != 1 || sentList[0].ID != sent.ID {
+		t.Errorf("Письмо должно быть в отправленных: %+v", sentList)
+	}
+
+	var inbox []MessageResponse
+	json.Unmarshal(performRequest(t, router, http.MethodGet, "/receiver/inbox").Body.Bytes(), &inbox)
+	if len(inbox) != 0 {
+		t.Errorf("Получатель не должен видеть отброшенное письмо: %+v", inbox)
+	}
+	if w := performRequest(t, router, http.MethodGet, "/receiver/messages/"+strconv.FormatUint(uint64(sent.ID), 10)); w.Code != http.StatusForbidden {
+		t.Errorf("Получатель не должен открывать отброшенное письмо, получено %d", w.Code)
+	}
+
+	var events int64
+	db.Model(&models.OutboxEvent{}).Where("routing_key = ?", queue.RoutingKey).Count(&events)
+	if events != 0 {
+		t.Errorf("Записано %d уведомлений о новом письме, ожидалось 0", events)
+	}
+}
+
+func TestStarIsPerParty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+	message, _ := models.SendMessage(db, sender.ID, receiver.Email, "Тема", "Текст", 0)
+
+	mc := NewMessageController(db, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.PUT("/sender/messages/:id/star", asUser(sender), mc.UpdateStar)
+	router.GET("/sender/sent", asUser(sender), mc.GetSent)
+	router.GET("/receiver/inbox", asUser(receiver), mc.GetInbox)
+
+	path := "/sender/messages/" + strconv.FormatUint(uint64(message.ID), 10) + "/star"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, strings.NewReader(`{"starred":true}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+
+	starred := func(path string) bool {
+		t.Helper()
+		var messages []MessageResponse
+		json.Unmarshal(performRequest(t, router, http.MethodGet, path).Body.Bytes(), &messages)
+		if len(messages) != 1 {
+			t.Fatalf("%s: ожидалось одно сообщение", path)
+		}
+		return messages[0].IsStarred
+	}
+	if !starred("/sender/sent") {
+		t.Error("Отметка должна появиться у отправителя")
+	}
+	if starred("/receiver/inbox") {
+		t.Error("Отметка отправителя не должна быть видна получателю")
+	}
+
+	if err := models.UpdateMessageStar(db, message.ID, receiver.ID, true); err != nil {
+		t.Fatalf("Ошибка отметки: %v", err)
+	}
+	models.UpdateMessageStar(db, message.ID, sender.ID, false)
+	if starred("/sender/sent") || !starred("/receiver/inbox") {
+		t.Error("Отметки отправителя и получателя должны меняться независимо")
+	}
+}
+
+func TestSendMessageRequiresVerifiedSender(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+
+	cfg := &config.Config{}
+	cfg.Verification.RestrictSending = true
+	mc := NewMessageController(db, cfg, nil, nil)
+	router := gin.New()
+	// Без RequireVerifiedEmail: проверка должна сработать при доставке
+	router.POST("/messages", asUser(sender), mc.SendMessage)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(`{"receiver_email":"`+receiver.Email+`","subject":"Тема","body":"Текст"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Ожидался статус 403, получено %d: %s", w.Code, w.Body.String())
+	}
+
+	var count int64
+	db.Model(&models.Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Письмо от неподтвержденного адреса не должно сохраняться, сообщений: %d", count)
+	}
+}
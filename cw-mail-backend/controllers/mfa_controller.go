@@ -0,0 +1,417 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"github.com/mail-service/totp"
+	"gorm.io/gorm"
+)
+
+
+type MFAController struct {
+	DB     *gorm.DB
+	Config *config.Config
+	Guard  *lockout.Guard
+	Audit  *audit.Logger
+}
+
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+
+type MFADisableRequest struct {
+	Password string `json:"password" binding:"required" example:"password123"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+
+type MFALoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required" example:"123456"`
+}
+
+
+type MFAChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+
+type MFAEnrollmentResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/CW%20Mail:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=CW+Mail"`
+}
+
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+
+type MFAEnrollmentCompleteResponse struct {
+	Token         string   `json:"token"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+
+func NewMFAController(db *gorm.DB, cfg *config.Config, guard *lockout.Guard, auditLog *audit.Logger) *MFAController {
+	return &MFAController{
+		DB:     db,
+		Config: cfg,
+		Guard:  guard,
+		Audit:  auditLog,
+	}
+}
+
+
+// @Summary Начать настройку двухфакторной аутентификации
+// @Description Генерирует TOTP-секрет и otpauth URI для приложения-аутентификатора
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MFAEnrollmentResponse "Секрет для приложения"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 409 {object} map[string]string "Двухфакторная аутентификация уже включена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/enroll [post]
+func (mc *MFAController) Enroll(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	mc.enroll(c, user)
+}
+
+
+// @Summary Подтвердить настройку двухфакторной аутентификации
+// @Description Включает двухфакторную аутентификацию после проверки кода из приложения и возвращает коды восстановления
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Код из приложения"
+// @Success 200 {object} RecoveryCodesResponse "Коды восстановления"
+// @Failure 400 {object} map[string]string "Неверный код"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 409 {object} map[string]string "Двухфакторная аутентификация уже включена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/confirm [post]
+func (mc *MFAController) Confirm(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	codes, err := models.ConfirmMFAEnrollment(mc.DB, user, req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	mc.auditUser(c, audit.ActionMFAEnabled, user)
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+
+// @Summary Отключить двухфакторную аутентификацию
+// @Description Отключает двухфакторную аутентификацию. Требует пароль и действующий код
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFADisableRequest true "Пароль и код"
+// @Success 200 {object} map[string]string "Двухфакторная аутентификация отключена"
+// @Failure 400 {object} map[string]string "Неверный код"
+// @Failure 401 {object} map[string]string "Неверный пароль"
+// @Failure 403 {object} map[string]string "Двухфакторная аутентификация обязательна для администраторов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/disable [post]
+func (mc *MFAController) Disable(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req MFADisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if user.IsAdmin() && mc.Config.MFA.RequireForAdmins {
+		c.JSON(http.StatusForbidden, gin.H{"error": "двухфакторная аутентификация обязательна для администраторов"})
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверные учетные данные"})
+		return
+	}
+
+	if err := models.VerifyMFACode(mc.DB, user, req.Code); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	if err := models.DisableMFA(mc.DB, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отключить двухфакторную аутентификацию"})
+		return
+	}
+
+	mc.auditUser(c, audit.ActionMFADisabled, user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "двухфакторная аутентификация отключена"})
+}
+
+
+// @Summary Перевыпустить коды восстановления
+// @Description Заменяет все коды восстановления новыми. Требует действующий код
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Код из приложения"
+// @Success 200 {object} RecoveryCodesResponse "Новые коды восстановления"
+// @Failure 400 {object} map[string]string "Неверный код"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/recovery-codes [post]
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.VerifyMFACode(mc.DB, user, req.Code); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(mc.DB, user)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+
+// @Summary Завершить вход с двухфакторной аутентификацией
+// @Description Обменивает токен подтверждения и код из приложения (или код восстановления) на JWT токен
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body MFALoginRequest true "Токен подтверждения и код"
+// @Success 200 {object} TokenResponse "JWT токен"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 401 {object} map[string]string "Неверный код или токен подтверждения"
+// @Failure 429 {object} map[string]string "Слишком много неудачных попыток входа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/login/mfa [post]
+func (mc *MFAController) Login(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	user, ok := mc.userFromChallenge(c, req.ChallengeToken, middleware.MFAPurposeLogin)
+	if !ok {
+		return
+	}
+
+	if !checkLoginAllowed(c, mc.Guard, user.Email) {
+		return
+	}
+
+	if err := models.VerifyMFACode(mc.DB, user, req.Code); err != nil {
+		if errors.Is(err, models.ErrMFAInvalidCode) {
+			registerLoginFailure(c, mc.Guard, mc.Audit, user.Email, user, "invalid_mfa_code")
+		} else {
+			respondMFAError(c, err)
+		}
+		return
+	}
+
+	registerLoginSuccess(c, mc.Guard, mc.Audit, user.Email, user)
+
+	token, err := middleware.GenerateToken(user, mc.Config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сгенерировать токен"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{Token: token})
+}
+
+
+// @Summary Начать обязательную настройку двухфакторной аутентификации при входе
+// @Description Используется, когда вход возвращает mfa_enrollment_required. Генерирует TOTP-секрет по токену подтверждения
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body MFAChallengeRequest true "Токен подтверждения"
+// @Success 200 {object} MFAEnrollmentResponse "Секрет для приложения"
+// @Failure 401 {object} map[string]string "Недействительный токен подтверждения"
+// @Failure 429 {object} map[string]string "Слишком много неудачных попыток входа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/login/mfa/enroll [post]
+func (mc *MFAController) LoginEnroll(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	user, ok := mc.userFromChallenge(c, req.ChallengeToken, middleware.MFAPurposeEnroll)
+	if !ok {
+		return
+	}
+
+	if !checkLoginAllowed(c, mc.Guard, user.Email) {
+		return
+	}
+
+	mc.enroll(c, user)
+}
+
+
+// @Summary Завершить обязательную настройку двухфакторной аутентификации при входе
+// @Description Включает двухфакторную аутентификацию и возвращает JWT токен и коды восстановления. Неверный код учитывается как неудачная попытка входа
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body MFALoginRequest true "Токен подтверждения и код"
+// @Success 200 {object} MFAEnrollmentCompleteResponse "JWT токен и коды восстановления"
+// @Failure 400 {object} map[string]string "Настройка не начата"
+// @Failure 401 {object} map[string]string "Неверный код или токен подтверждения"
+// @Failure 429 {object} map[string]string "Слишком много неудачных попыток входа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/login/mfa/enroll/confirm [post]
+func (mc *MFAController) LoginEnrollConfirm(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	user, ok := mc.userFromChallenge(c, req.ChallengeToken, middleware.MFAPurposeEnroll)
+	if !ok {
+		return
+	}
+
+	if !checkLoginAllowed(c, mc.Guard, user.Email) {
+		return
+	}
+
+	codes, err := models.ConfirmMFAEnrollment(mc.DB, user, req.Code)
+	if err != nil {
+		if errors.Is(err, models.ErrMFAInvalidCode) {
+			registerLoginFailure(c, mc.Guard, mc.Audit, user.Email, user, "invalid_mfa_code")
+		} else {
+			respondMFAError(c, err)
+		}
+		return
+	}
+
+	mc.auditUser(c, audit.ActionMFAEnabled, user)
+	registerLoginSuccess(c, mc.Guard, mc.Audit, user.Email, user)
+
+	token, err := middleware.GenerateToken(user, mc.Config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сгенерировать токен"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAEnrollmentCompleteResponse{
+		Token:         token,
+		RecoveryCodes: codes,
+	})
+}
+
+
+func (mc *MFAController) enroll(c *gin.Context, user *models.User) {
+	secret, err := models.BeginMFAEnrollment(mc.DB, user)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(mc.Config.MFA.Issuer, user.Email, secret),
+	})
+}
+
+
+func (mc *MFAController) userFromChallenge(c *gin.Context, challenge, purpose string) (*models.User, bool) {
+	claims, err := middleware.ParseMFAChallengeToken(challenge, purpose, mc.Config)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный токен подтверждения входа"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := mc.DB.First(&user, claims.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не найден"})
+		return nil, false
+	}
+
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись отключена"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+
+func (mc *MFAController) auditUser(c *gin.Context, action audit.Action, user *models.User) {
+	mc.Audit.RecordRequest(c, audit.Event{
+		Action:     action,
+		ActorID:    audit.ID(user.ID),
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+	})
+}
+
+
+func respondMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrMFAInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка двухфакторной аутентификации"})
+	}
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+)
+
+func TestLoginEnrollLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	if err := db.AutoMigrate(&models.MFARecoveryCode{}); err != nil {
+		t.Fatalf("Ошибка миграции: %v", err)
+	}
+	user, _ := models.CreateUser(db, "admin@example.com", "password123")
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiration = time.Hour
+	cfg.MFA.ChallengeTTL = time.Minute
+	challenge, err := middleware.GenerateMFAChallengeToken(user, middleware.MFAPurposeEnroll, cfg)
+	if err != nil {
+		t.Fatalf("Ошибка создания токена подтверждения: %v", err)
+	}
+
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), lockout.Policy{
+		MaxAccountFailures: 2,
+		MaxIPFailures:      100,
+		DelayAfter:         100,
+		Window:             time.Minute,
+		LockoutDuration:    time.Minute,
+	})
+	mc := NewMFAController(db, cfg, guard, nil)
+	router := gin.New()
+	router.POST("/enroll", mc.LoginEnroll)
+	router.POST("/confirm", mc.LoginEnrollConfirm)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := post("/enroll", `{"challenge_token":"`+challenge+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+
+	confirm := `{"challenge_token":"` + challenge + `","code":"000000"}`
+	for i := 0; i < 2; i++ {
+		if w := post("/confirm", confirm); w.Code != http.StatusUnauthorized && w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Попытка %d: неверный код должен учитываться как неудачный вход, получено %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	if w := post("/confirm", confirm); w.Code != http.StatusTooManyRequests {
+		t.Errorf("После лимита попыток подтверждение должно блокироваться, получено %d", w.Code)
+	}
+	if w := post("/enroll", `{"challenge_token":"`+challenge+`"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Заблокированная учетная запись не должна начинать настройку, получено %d", w.Code)
+	}
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type QuarantineController struct {
+	DB     *gorm.DB
+	Config *config.Config
+	Audit  *audit.Logger
+}
+
+
+type QuarantineListResponse struct {
+	Messages []models.QuarantinedMessage `json:"messages"`
+	Total    int64                       `json:"total" example:"3"`
+	Page     int                         `json:"page" example:"1"`
+	Limit    int                         `json:"limit" example:"20"`
+}
+
+
+func NewQuarantineController(db *gorm.DB, cfg *config.Config, auditLog *audit.Logger) *QuarantineController {
+	return &QuarantineController{
+		DB:     db,
+		Config: cfg,
+		Audit:  auditLog,
+	}
+}
+
+
+// @Summary Карантин
+// @Description Возвращает письма, задержанные проверкой содержимого, начиная с новых
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Статус (pending, released, deleted)"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Размер страницы" default(20)
+// @Success 200 {object} QuarantineListResponse "Письма в карантине"
+// @Failure 400 {object} map[string]string "Неверные параметры запроса"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/quarantine [get]
+func (qc *QuarantineController) ListQuarantine(c *gin.Context) {
+	filter := models.QuarantineFilter{Status: c.Query("status")}
+	switch filter.Status {
+	case "", models.QuarantinePending, models.QuarantineReleased, models.QuarantineDeleted:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимый статус"})
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if filter.Page < 1 || filter.Limit < 1 || filter.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные параметры страницы"})
+		return
+	}
+
+	messages, total, err := models.ListQuarantine(qc.DB, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить карантин"})
+		return
+	}
+
+	c.JSON(http.StatusOK, QuarantineListResponse{
+		Messages: messages,
+		Total:    total,
+		Page:     filter.Page,
+		Limit:    filter.Limit,
+	})
+}
+
+
+// @Summary Письмо в карантине
+// @Description Возвращает задержанное письмо вместе с текстом и причиной задержки
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID письма в карантине"
+// @Success 200 {object} models.QuarantinedMessage "Письмо в карантине"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Письмо не найдено"
+// @Router /admin/quarantine/{id} [get]
+func (qc *QuarantineController) GetQuarantinedMessage(c *gin.Context) {
+	id, ok := parseQuarantineID(c)
+	if !ok {
+		return
+	}
+
+	message, err := models.GetQuarantinedMessage(qc.DB, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "письмо в карантине не найдено"})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+
+// @Summary Выпустить письмо из карантина
+// @Description Доставляет задержанное письмо получателям от имени отправителя. Письмо проходит фильтры и спам-фильтр получателей, но повторно не сканируется
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID письма в карантине"
+// @Success 200 {object} models.QuarantinedMessage "Письмо выпущено"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа, адрес отправителя не подтвержден или получатель отклоняет письма отправителя"
+// @Failure 404 {object} map[string]string "Письмо, отправитель или получатель не найден"
+// @Failure 409 {object} map[string]string "Письмо уже выпущено или удалено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/quarantine/{id}/release [post]
+func (qc *QuarantineController) ReleaseMessage(c *gin.Context) {
+	id, ok := parseQuarantineID(c)
+	if !ok {
+		return
+	}
+
+	tx := qc.DB.Begin()
+
+	message, delivery, err := models.ReleaseQuarantinedMessage(tx, id, c.GetUint("user_id"), sendingPolicy(qc.Config))
+	if err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, models.ErrQuarantineResolved):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrListPostForbidden),
+			errors.Is(err, models.ErrSenderAddressNotOwned),
+			errors.Is(err, models.ErrSenderBlocked),
+			errors.Is(err, models.ErrMessageRejected),
+			errors.Is(err, models.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrListNoRecipients):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "письмо, отправитель или получатель не найден"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось выпустить письмо"})
+		}
+		return
+	}
+
+	if err := enqueueDelivery(tx, delivery); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить уведомление"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось выпустить письмо"})
+		return
+	}
+
+	qc.audit(c, audit.ActionQuarantineReleased, message)
+	c.JSON(http.StatusOK, message)
+}
+
+
+// @Summary Удалить письмо из карантина
+// @Description Отклоняет задержанное письмо: оно не будет доставлено, а его текст удаляется. Запись о письме остается в карантине со статусом deleted
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID письма в карантине"
+// @Success 200 {object} models.QuarantinedMessage "Письмо удалено"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 403 {object} map[string]string "Недостаточно прав доступа"
+// @Failure 404 {object} map[string]string "Письмо не найдено"
+// @Failure 409 {object} map[string]string "Письмо уже выпущено или удалено"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/quarantine/{id} [delete]
+func (qc *QuarantineController) DeleteMessage(c *gin.Context) {
+	id, ok := parseQuarantineID(c)
+	if !ok {
+		return
+	}
+
+	message, err := models.DeleteQuarantinedMessage(qc.DB, id, c.GetUint("user_id"))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "письмо в карантине не найдено"})
+		return
+	case errors.Is(err, models.ErrQuarantineResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить письмо"})
+		return
+	}
+
+	qc.audit(c, audit.ActionQuarantineDeleted, message)
+	c.JSON(http.StatusOK, message)
+}
+
+
+func (qc *QuarantineController) audit(c *gin.Context, action audit.Action, message *models.QuarantinedMessage) {
+	qc.Audit.RecordRequest(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetQuarantine,
+		TargetID:   &message.ID,
+		Details: gin.H{
+			"sender_id": message.SenderID,
+			"to":        message.ToAddress,
+			"scanner":   message.Scanner,
+			"reason":    message.Reason,
+		},
+	})
+}
+
+
+func parseQuarantineID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
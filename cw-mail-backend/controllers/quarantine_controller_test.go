@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/scanner"
+)
+
+type stubScanner struct {
+	result scanner.Result
+}
+
+func (s stubScanner) Name() string {
+	return "stub"
+}
+
+func (s stubScanner) Scan(ctx context.Context, content scanner.Content) (scanner.Result, error) {
+	return s.result, nil
+}
+
+func TestSendMessageScanVerdicts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+
+	sender, _ := models.CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := models.CreateUser(db, "receiver@example.com", "password123")
+	admin, _ := models.CreateUser(db, "admin@example.com", "password123")
+
+	hook := &scanner.Hook{Notify: map[scanner.Verdict]bool{scanner.VerdictQuarantine: true, scanner.VerdictReject: true}}
+	mc := NewMessageController(db, &config.Config{}, hook, nil)
+	router := gin.New()
+	router.POST("/messages", asUser(sender), mc.SendMessage)
+
+	send := func(to string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := `{"receiver_email":"` + to + `","subject":"Счет","body":"Вложение"}`
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body)))
+		return w
+	}
+
+	hook.Scanner = stubScanner{scanner.Result{Verdict: scanner.VerdictReject, Reason: "body: Eicar-Test-Signature"}}
+	if w := send(receiver.Email); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Отклоненное письмо: ожидался статус 422, получено %d: %s", w.Code, w.Body.String())
+	}
+
+	hook.Scanner = stubScanner{scanner.Result{Verdict: scanner.VerdictQuarantine, Reason: "body: Eicar-Test-Signature"}}
+	if w := send("missing@example.com"); w.Code != http.StatusNotFound {
+		t.Errorf("Письмо несуществующему получателю не попадает в карантин, получено %d", w.Code)
+	}
+
+	w := send(receiver.Email)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Задержанное письмо: ожидался статус 202, получено %d: %s", w.Code, w.Body.String())
+	}
+	var response QuarantinedSendResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	var count int64
+	db.Model(&models.Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Отклоненные и задержанные письма не доставляются, писем: %d", count)
+	}
+
+	quarantined, err := models.GetQuarantinedMessage(db, response.QuarantineID)
+	if err != nil || quarantined.Scanner != "stub" || quarantined.ToAddress != receiver.Email {
+		t.Fatalf("Письмо не сохранено в карантине: %+v, %v", quarantined, err)
+	}
+
+	qc := NewQuarantineController(db, &config.Config{}, nil)
+	adminRouter := gin.New()
+	adminRouter.DELETE("/admin/quarantine/:id", asUser(admin), qc.DeleteMessage)
+	path := "/admin/quarantine/" + strconv.FormatUint(uint64(quarantined.ID), 10)
+
+	if w := performRequest(t, adminRouter, http.MethodDelete, path); w.Code != http.StatusOK {
+		t.Errorf("Удаление из карантина: ожидался статус 200, получено %d: %s", w.Code, w.Body.String())
+	}
+	if w := performRequest(t, adminRouter, http.MethodDelete, path); w.Code != http.StatusConflict {
+		t.Errorf("Повторное удаление: ожидался статус 409, получено %d", w.Code)
+	}
+
+	hook.Scanner = stubScanner{scanner.Result{Verdict: scanner.VerdictClean}}
+	if w := send(receiver.Email); w.Code != http.StatusCreated {
+		t.Fatalf("Чистое письмо: ожидался статус 201, получено %d: %s", w.Code, w.Body.String())
+	}
+
+	// Вердикты и уведомление о доставке записываются в outbox
+	var routingKeys []string
+	db.Model(&models.OutboxEvent{}).Order("id").Pluck("routing_key", &routingKeys)
+	if strings.Join(routingKeys, ",") != "scan.reject,scan.quarantine,new_message" {
+		t.Errorf("Неожиданные события в outbox: %v", routingKeys)
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/realtime"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+
+type RealtimeController struct {
+	DB     *gorm.DB
+	Hub    *realtime.Hub
+	Config *config.Config
+}
+
+
+func NewRealtimeController(db *gorm.DB, hub *realtime.Hub, cfg *config.Config) *RealtimeController {
+	return &RealtimeController{
+		DB:     db,
+		Hub:    hub,
+		Config: cfg,
+	}
+}
+
+
+// @Summary Поток событий (SSE)
+// @Description Server-Sent Events с уведомлениями текущего пользователя, например new_message. Токен можно передать в параметре access_token, поскольку EventSource не задает заголовки. При переподключении EventSource сам передает Last-Event-ID, и клиент получает пропущенные события. Каждые REALTIME_HEARTBEAT_INTERVAL отправляется комментарий heartbeat и заново проверяется сессия: поток закрывается, когда истекает срок токена, сессии отзываются, токен доступа отзывается или учетная запись отключается
+// @Tags realtime
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param access_token query string false "Токен, если нельзя передать заголовок Authorization"
+// @Param types query string false "Типы событий через запятую (по умолчанию все)"
+// @Param last_event_id query string false "ID последнего полученного события, если нельзя передать заголовок Last-Event-ID"
+// @Success 200 {string} string "Поток событий"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Router /events/stream [get]
+func (rc *RealtimeController) Stream(c *gin.Context) {
+	sub := rc.subscribe(c, c.GetHeader("Last-Event-ID"))
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", rc.Config.Realtime.HeartbeatInterval.Milliseconds())
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(rc.Config.Realtime.HeartbeatInterval)
+	defer ticker.Stop()
+	expired, stop := tokenExpiry(c)
+	defer stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-expired:
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if event.ID != "" {
+				fmt.Fprintf(c.Writer, "id: %s\n", event.ID)
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+		case <-ticker.C:
+			if !middleware.SessionActive(c, rc.DB) {
+				return
+			}
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+
+// @Summary Поток событий (WebSocket)
+// @Description WebSocket с уведомлениями текущего пользователя: каждое сообщение — JSON {"id", "type", "data"}. Токен передается в параметре access_token. Для возобновления после переподключения передайте last_event_id. Каждые REALTIME_HEARTBEAT_INTERVAL приходит сообщение с типом heartbeat; сообщения клиента игнорируются. Соединение закрывается, когда истекает срок токена или сессия перестает действовать
+// @Tags realtime
+// @Security BearerAuth
+// @Param access_token query string false "Токен, если нельзя передать заголовок Authorization"
+// @Param types query string false "Типы событий через запятую (по умолчанию все)"
+// @Param last_event_id query string false "ID последнего полученного события"
+// @Success 101 {string} string "Соединение WebSocket установлено"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Router /events/ws [get]
+func (rc *RealtimeController) WebSocket(c *gin.Context) {
+	sub := rc.subscribe(c, "")
+	defer sub.Close()
+
+	// Клиент аутентифицирован токеном, а не cookie, поэтому Origin не проверяется
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// Чтение нужно только, чтобы заметить закрытие соединения клиентом
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var message string
+				for websocket.Message.Receive(ws, &message) == nil {
+				}
+			}()
+
+			ticker := time.NewTicker(rc.Config.Realtime.HeartbeatInterval)
+			defer ticker.Stop()
+			expired, stop := tokenExpiry(c)
+			defer stop()
+
+			for {
+				var err error
+				select {
+				case <-closed:
+					return
+				case <-expired:
+					return
+				case event, ok := <-sub.Events:
+					if !ok {
+						return
+					}
+					err = websocket.JSON.Send(ws, event)
+				case <-ticker.C:
+					if !middleware.SessionActive(c, rc.DB) {
+						return
+					}
+					err = websocket.JSON.Send(ws, realtime.Event{Type: "heartbeat"})
+				}
+				if err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+
+func (rc *RealtimeController) subscribe(c *gin.Context, lastEventID string) *realtime.Subscription {
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	var types []string
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	return rc.Hub.Subscribe(c.GetUint("user_id"), types, lastEventID)
+}
+
+
+// tokenExpiry возвращает канал, который срабатывает, когда истекает срок
+// токена подключения. Для бессрочных токенов канал никогда не срабатывает.
+func tokenExpiry(c *gin.Context) (<-chan time.Time, func()) {
+	expiresAt := c.GetTime("token_expires_at")
+	if expiresAt.IsZero() {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(time.Until(expiresAt))
+	return timer.C, func() { timer.Stop() }
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/realtime"
+	"golang.org/x/net/websocket"
+)
+
+func newRealtimeTestServer(t *testing.T, user *models.User, handlers ...gin.HandlerFunc) (*realtime.Hub, *httptest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db := setupControllerTestDB(t)
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Ошибка создания пользователя: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Realtime.HeartbeatInterval = 200 * time.Millisecond
+	hub := realtime.NewHub(10)
+	rc := NewRealtimeController(db, hub, cfg)
+
+	router := gin.New()
+	router.Use(asUser(user))
+	router.Use(handlers...)
+	router.GET("/events/stream", rc.Stream)
+	router.GET("/events/ws", rc.WebSocket)
+	router.POST("/disable", func(c *gin.Context) {
+		if err := models.SetUserDisabled(db, user.ID, true); err != nil {
+			t.Errorf("Ошибка отключения пользователя: %v", err)
+		}
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return hub, server
+}
+
+// waitForConnection ждет, пока обработчик подпишется на хаб.
+func waitForConnection(t *testing.T, hub *realtime.Hub, userID uint) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Connections(userID) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Клиент не подключился к хабу")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRealtimeStream(t *testing.T) {
+	user := &models.User{ID: 1, Email: "user@example.com", Role: models.RoleUser}
+	hub, server := newRealtimeTestServer(t, user)
+	hub.Publish(1, realtime.Event{ID: "4", Type: "new_message", Data: []byte(`{"message_id":1}`)})
+	hub.Publish(1, realtime.Event{ID: "5", Type: "new_message", Data: []byte(`{"message_id":2}`)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events/stream", nil)
+	req.Header.Set("Last-Event-ID", "4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Неожиданный Content-Type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	waitForConnection(t, hub, 1)
+	hub.Publish(1, realtime.Event{ID: "6", Type: "new_message", Data: []byte(`{"message_id":3}`)})
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != ": heartbeat" {
+		lines = append(lines, scanner.Text())
+	}
+	want := "retry: 200||id: 5|event: new_message|data: {\"message_id\":2}||id: 6|event: new_message|data: {\"message_id\":3}|"
+	if got := strings.Join(lines, "|"); got != want {
+		t.Errorf("Поток SSE:\n%s\nожидалось:\n%s", got, want)
+	}
+}
+
+func TestRealtimeWebSocket(t *testing.T) {
+	user := &models.User{ID: 1, Email: "user@example.com", Role: models.RoleUser}
+	hub, server := newRealtimeTestServer(t, user)
+	hub.Publish(1, realtime.Event{ID: "4", Type: "new_message", Data: []byte(`{"message_id":1}`)})
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/events/ws?last_event_id=3&types=new_message"
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	defer ws.Close()
+
+	waitForConnection(t, hub, 1)
+	hub.Publish(1, realtime.Event{ID: "5", Type: "message.read"})
+	hub.Publish(1, realtime.Event{ID: "6", Type: "new_message", Data: []byte(`{"message_id":2}`)})
+
+	var received []string
+	for len(received) < 3 {
+		var event realtime.Event
+		if err := websocket.JSON.Receive(ws, &event); err != nil {
+			t.Fatalf("Ошибка чтения: %v", err)
+		}
+		received = append(received, event.ID+":"+event.Type)
+	}
+	if got := strings.Join(received, ","); got != "4:new_message,6:new_message,:heartbeat" {
+		t.Errorf("Получены события %s", got)
+	}
+
+	ws.Close()
+	deadline := time.Now().Add(time.Second)
+	for hub.Connections(1) != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hub.Connections(1) != 0 {
+		t.Error("После закрытия соединения подписка должна удаляться")
+	}
+}
+
+// waitForDisconnect ждет, пока обработчик закроет поток сам.
+func waitForDisconnect(t *testing.T, hub *realtime.Hub, userID uint) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Connections(userID) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Поток должен закрываться, когда сессия перестает действовать")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRealtimeStreamClosesOnTokenExpiry(t *testing.T) {
+	user := &models.User{ID: 1, Email: "user@example.com", Role: models.RoleUser}
+	hub, server := newRealtimeTestServer(t, user, func(c *gin.Context) {
+		c.Set("token_expires_at", time.Now().Add(100*time.Millisecond))
+		c.Next()
+	})
+
+	resp, err := http.Get(server.URL + "/events/stream")
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	waitForConnection(t, hub, 1)
+	waitForDisconnect(t, hub, 1)
+}
+
+func TestRealtimeStreamClosesOnSessionRevocation(t *testing.T) {
+	user := &models.User{ID: 1, Email: "user@example.com", Role: models.RoleUser}
+	hub, server := newRealtimeTestServer(t, user)
+
+	resp, err := http.Get(server.URL + "/events/stream")
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/events/ws"
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	defer ws.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Connections(1) != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hub.Connections(1) != 2 {
+		t.Fatal("Клиенты не подключились к хабу")
+	}
+
+	if _, err := http.Post(server.URL+"/disable", "", nil); err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	waitForDisconnect(t, hub, 1)
+}
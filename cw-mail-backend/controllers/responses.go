@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mail-service/models"
+)
+
+
+// UserCard — публичное представление пользователя: только то, что видит
+// собеседник. Роль, статусы и служебные поля учетной записи сюда не попадают.
+type UserCard struct {
+	ID          uint   `json:"id" example:"2"`
+	Email       string `json:"email" example:"sender@example.com"`
+	DisplayName string `json:"display_name" example:"Иван Петров"`
+	Name        string `json:"name" example:"Иван Петров"`
+	AvatarURL   string `json:"avatar_url,omitempty" example:"/api/users/2/avatar"`
+}
+
+
+// MessageResponse — сообщение в ответах API. Поля sender_name, sender_email и
+// receiver_email дублируют карточки участников для совместимости с клиентом.
+// sender_address и recipient_address — адреса, с которого и на который
+// письмо было отправлено: основной адрес или псевдоним.
+type MessageResponse struct {
+	ID               uint       `json:"id" example:"10"`
+	SenderID         uint       `json:"sender_id" example:"2"`
+	ReceiverID       uint       `json:"receiver_id" example:"1"`
+	Subject          string     `json:"subject" example:"Важное сообщение"`
+	Body             string     `json:"body" example:"Текст сообщения"`
+	IsRead           bool       `json:"is_read" example:"false"`
+	IsStarred        bool       `json:"is_starred" example:"false"`
+	Label            string     `json:"label" example:"inbox"`
+	ReadLimit        int        `json:"read_limit" example:"0"`
+	ReadCount        int        `json:"read_count" example:"0"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Sender           UserCard   `json:"sender"`
+	Receiver         UserCard   `json:"receiver"`
+	SenderName       string     `json:"sender_name" example:"Иван Петров"`
+	SenderEmail      string     `json:"sender_email" example:"sender@example.com"`
+	ReceiverName     string     `json:"receiver_name" example:"receiver@example.com"`
+	ReceiverEmail    string     `json:"receiver_email" example:"receiver@example.com"`
+	SenderAddress    string     `json:"sender_address" example:"sender@example.com"`
+	RecipientAddress string     `json:"recipient_address" example:"receiver@example.com"`
+	ListAddress      string     `json:"list_address,omitempty" example:"team@example.com"`
+	AutoSubmitted    string     `json:"auto_submitted,omitempty" example:"auto-replied"`
+	SpamScore        *float64   `json:"spam_score,omitempty" example:"0.12"` // оценка спам-фильтра получателя от 0 до 1, только для получателя
+}
+
+
+// ListDeliveryResponse возвращается при отправке в список рассылки. Копии
+// писем с адресами участников видят только те, кто управляет списком;
+// остальным отправителям возвращается лишь число получателей.
+type ListDeliveryResponse struct {
+	ListAddress string            `json:"list_address" example:"team@example.com"`
+	Recipients  int               `json:"recipients" example:"5"`
+	Messages    []MessageResponse `json:"messages,omitempty"`
+}
+
+
+// QuarantinedSendResponse — ответ на отправку письма, задержанного сканером.
+// Письмо будет доставлено, если администратор выпустит его из карантина.
+type QuarantinedSendResponse struct {
+	QuarantineID uint   `json:"quarantine_id" example:"1"`
+	Status       string `json:"status" example:"pending"`
+}
+
+
+// DestroyedMessageResponse возвращается вместо сообщения, которое было
+// удалено после последнего разрешенного прочтения.
+type DestroyedMessageResponse struct {
+	Message string `json:"message" example:"Это сообщение было прочитано последний раз и удалено"`
+	Subject string `json:"subject" example:"Важное сообщение"`
+	Deleted bool   `json:"deleted" example:"true"`
+}
+
+
+func newUserCard(user *models.User) UserCard {
+	if user.ID == 0 {
+		return UserCard{}
+	}
+	return UserCard{
+		ID:          user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Name:        user.Name(),
+		AvatarURL:   avatarURL(user),
+	}
+}
+
+
+// newMessageResponse строит ответ для пользователя viewerID. Оценка
+// спам-фильтра относится к получателю, поэтому отправителю не показывается.
+func newMessageResponse(message *models.Message, viewerID uint) MessageResponse {
+	response := MessageResponse{
+		ID:         message.ID,
+		SenderID:   message.SenderID,
+		ReceiverID: message.ReceiverID,
+		Subject:    message.Subject,
+		Body:       message.Body,
+		IsRead:     message.IsRead,
+		Label:      message.Label,
+		ReadLimit:  message.ReadLimit,
+		ReadCount:  message.ReadCount,
+		CreatedAt:  message.CreatedAt,
+		Sender:     newUserCard(&message.Sender),
+		Receiver:   newUserCard(&message.Receiver),
+	}
+
+	if !message.ExpiresAt.IsZero() {
+		expiresAt := message.ExpiresAt
+		response.ExpiresAt = &expiresAt
+	}
+
+	response.SenderName = response.Sender.Name
+	response.SenderEmail = response.Sender.Email
+	response.ReceiverName = response.Receiver.Name
+	response.ReceiverEmail = response.Receiver.Email
+	response.IsStarred = message.StarredBy(viewerID)
+	response.SenderAddress = message.SenderAddress
+	response.RecipientAddress = message.RecipientAddress
+	response.ListAddress = message.ListAddress
+	response.AutoSubmitted = message.AutoSubmitted
+	if viewerID == message.ReceiverID {
+		spamScore := message.SpamScore
+		response.SpamScore = &spamScore
+	}
+
+	return response
+}
+
+
+func newMessageListResponse(messages []models.Message, viewerID uint) []MessageResponse {
+	response := make([]MessageResponse, 0, len(messages))
+	for i := range messages {
+		response = append(response, newMessageResponse(&messages[i], viewerID))
+	}
+	return response
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"github.com/mail-service/sieve"
+	"gorm.io/gorm"
+)
+
+
+type SieveController struct {
+	DB *gorm.DB
+}
+
+
+type SieveScriptRequest struct {
+	Name    string `json:"name" binding:"required" example:"main"`
+	Content string `json:"content" binding:"required" example:"require \"fileinto\";\nif header :contains \"subject\" \"[spam]\" { fileinto \"Junk\"; }"`
+	Active  bool   `json:"active" example:"true"` // только при создании: сразу сделать скрипт активным
+}
+
+
+type CheckSieveScriptRequest struct {
+	Content string `json:"content" binding:"required" example:"keep;"`
+}
+
+
+type SetActiveSieveScriptRequest struct {
+	ScriptID uint `json:"script_id" example:"3"` // 0 — отключить Sieve
+}
+
+
+func NewSieveController(db *gorm.DB) *SieveController {
+	return &SieveController{DB: db}
+}
+
+
+// respondSieveError отвечает на ошибку операции со скриптом. Для ошибки в
+// тексте скрипта возвращается номер строки, если он известен.
+func respondSieveError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidSieveScript):
+		response := gin.H{"error": err.Error(), "extensions": sieve.Extensions}
+		var scriptErr *sieve.Error
+		if errors.As(err, &scriptErr) && scriptErr.Line > 0 {
+			response["line"] = scriptErr.Line
+		}
+		c.JSON(http.StatusBadRequest, response)
+	case errors.Is(err, models.ErrInvalidSieveName),
+		errors.Is(err, models.ErrSieveScriptTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrSieveScriptExists),
+		errors.Is(err, models.ErrSieveScriptActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrSieveLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "скрипт не найден"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+
+func (sc *SieveController) findScript(c *gin.Context) (*models.SieveScript, bool) {
+	scriptID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return nil, false
+	}
+
+	script, err := models.GetSieveScript(sc.DB, uint(scriptID), c.GetUint("user_id"))
+	if err != nil {
+		respondSieveError(c, err, "не удалось получить скрипт")
+		return nil, false
+	}
+
+	return script, true
+}
+
+
+// @Summary Sieve-скрипты
+// @Description Возвращает Sieve-скрипты пользователя. При доставке выполняется только активный скрипт
+// @Tags sieve
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.SieveScript "Скрипты"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /sieve/scripts [get]
+func (sc *SieveController) ListScripts(c *gin.Context) {
+	scripts, err := models.ListSieveScripts(sc.DB, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить скрипты"})
+		return
+	}
+
+	c.JSON(http.StatusOK, scripts)
+}
+
+
+// @Summary Загрузить Sieve-скрипт
+// @Description Сохраняет скрипт после проверки синтаксиса. Поддерживаются расширения fileinto (папки INBOX, Spam, Junk, Trash), reject, envelope, body, vacation и copy
+// @Tags sieve
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SieveScriptRequest true "Скрипт"
+// @Success 201 {object} models.SieveScript "Созданный скрипт"
+// @Failure 400 {object} map[string]interface{} "Ошибка в скрипте (с номером строки) или недопустимое имя"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 403 {object} map[string]string "Достигнуто максимальное количество скриптов"
+// @Failure 409 {object} map[string]string "Скрипт с таким именем уже существует"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /sieve/scripts [post]
+func (sc *SieveController) CreateScript(c *gin.Context) {
+	var req SieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	script, err := models.CreateSieveScript(sc.DB, userID, req.Name, req.Content)
+	if err != nil {
+		respondSieveError(c, err, "не удалось сохранить скрипт")
+		return
+	}
+
+	if req.Active {
+		if err := models.ActivateSieveScript(sc.DB, userID, script.ID); err != nil {
+			respondSieveError(c, err, "не удалось активировать скрипт")
+			return
+		}
+		script.Active = true
+	}
+
+	c.JSON(http.StatusCreated, script)
+}
+
+
+// @Summary Проверить Sieve-скрипт
+// @Description Проверяет синтаксис скрипта без сохранения
+// @Tags sieve
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CheckSieveScriptRequest true "Текст скрипта"
+// @Success 200 {object} map[string]bool "Скрипт корректен"
+// @Failure 400 {object} map[string]interface{} "Ошибка в скрипте (с номером строки)"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Router /sieve/scripts/check [post]
+func (sc *SieveController) CheckScript(c *gin.Context) {
+	var req CheckSieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if _, err := models.ValidateSieveScript(req.Content); err != nil {
+		respondSieveError(c, err, "не удалось проверить скрипт")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true})
+}
+
+
+// @Summary Sieve-скрипт
+// @Description Возвращает скрипт по ID
+// @Tags sieve
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID скрипта"
+// @Success 200 {object} models.SieveScript "Скрипт"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Скрипт не найден"
+// @Router /sieve/scripts/{id} [get]
+func (sc *SieveController) GetScript(c *gin.Context) {
+	script, ok := sc.findScript(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, script)
+}
+
+
+// @Summary Изменить Sieve-скрипт
+// @Description Заменяет имя и текст скрипта после проверки синтаксиса. Активность скрипта не меняется
+// @Tags sieve
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID скрипта"
+// @Param request body SieveScriptRequest true "Скрипт"
+// @Success 200 {object} models.SieveScript "Измененный скрипт"
+// @Failure 400 {object} map[string]interface{} "Ошибка в скрипте (с номером строки) или недопустимое имя"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Скрипт не найден"
+// @Failure 409 {object} map[string]string "Скрипт с таким именем уже существует"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /sieve/scripts/{id} [put]
+func (sc *SieveController) UpdateScript(c *gin.Context) {
+	script, ok := sc.findScript(c)
+	if !ok {
+		return
+	}
+
+	var req SieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if err := models.UpdateSieveScript(sc.DB, script, req.Name, req.Content); err != nil {
+		respondSieveError(c, err, "не удалось изменить скрипт")
+		return
+	}
+
+	c.JSON(http.StatusOK, script)
+}
+
+
+// @Summary Удалить Sieve-скрипт
+// @Description Удаляет скрипт. Активный скрипт сначала нужно отключить
+// @Tags sieve
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID скрипта"
+// @Success 200 {object} map[string]string "Скрипт удален"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Скрипт не найден"
+// @Failure 409 {object} map[string]string "Скрипт активен"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /sieve/scripts/{id} [delete]
+func (sc *SieveController) DeleteScript(c *gin.Context) {
+	scriptID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if err := models.DeleteSieveScript(sc.DB, uint(scriptID), c.GetUint("user_id")); err != nil {
+		respondSieveError(c, err, "не удалось удалить скрипт")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "скрипт удален"})
+}
+
+
+// @Summary Активный Sieve-скрипт
+// @Description Делает скрипт активным (остальные отключаются). script_id = 0 отключает Sieve
+// @Tags sieve
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SetActiveSieveScriptRequest true "ID скрипта"
+// @Success 200 {array} models.SieveScript "Скрипты"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Скрипт не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /sieve/active [put]
+func (sc *SieveController) SetActiveScript(c *gin.Context) {
+	var req SetActiveSieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := models.ActivateSieveScript(sc.DB, userID, req.ScriptID); err != nil {
+		respondSieveError(c, err, "не удалось активировать скрипт")
+		return
+	}
+
+	sc.ListScripts(c)
+}
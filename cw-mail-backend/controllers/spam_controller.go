@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type SpamController struct {
+	DB *gorm.DB
+}
+
+
+type SpamSettingsRequest struct {
+	Enabled   bool    `json:"enabled" example:"true"`
+	Threshold float64 `json:"threshold" binding:"required" example:"0.9"` // от 0.5 до 1
+}
+
+
+func NewSpamController(db *gorm.DB) *SpamController {
+	return &SpamController{DB: db}
+}
+
+
+// @Summary Спам-фильтр
+// @Description Возвращает настройки спам-фильтра и число писем, на которых он обучен. Байесовская оценка учитывается после того, как пользователь отметит не меньше 5 писем как спам и 5 как не спам
+// @Tags spam
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SpamSettings "Настройки спам-фильтра"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/spam [get]
+func (sc *SpamController) GetSettings(c *gin.Context) {
+	settings, err := models.GetSpamSettings(sc.DB, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить настройки спам-фильтра"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+
+// @Summary Изменить спам-фильтр
+// @Description Включает или выключает спам-фильтр и задает порог: письмо с оценкой не ниже порога попадает в спам
+// @Tags spam
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SpamSettingsRequest true "Настройки спам-фильтра"
+// @Success 200 {object} models.SpamSettings "Сохраненные настройки"
+// @Failure 400 {object} map[string]string "Неверный порог"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/spam [put]
+func (sc *SpamController) UpdateSettings(c *gin.Context) {
+	var req SpamSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	settings, err := models.UpdateSpamSettings(sc.DB, c.GetUint("user_id"), req.Enabled, req.Threshold)
+	if errors.Is(err, models.ErrInvalidSpamThreshold) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить настройки спам-фильтра"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type TokenController struct {
+	DB    *gorm.DB
+	Audit *audit.Logger
+}
+
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100" example:"backup-script"`
+	Scopes        []string `json:"scopes" binding:"required,min=1" example:"messages:read"`
+	ExpiresInDays int      `json:"expires_in_days" example:"90"` // необязательное поле, 0 означает без срока действия
+}
+
+
+type APITokenResponse struct {
+	ID         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"backup-script"`
+	Prefix     string     `json:"prefix" example:"cwm_1a2b3c"`
+	Scopes     []string   `json:"scopes" example:"messages:read"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+
+type CreatedAPITokenResponse struct {
+	APITokenResponse
+	Token string `json:"token" example:"cwm_1a2b3c..."`
+}
+
+
+func NewTokenController(db *gorm.DB, auditLog *audit.Logger) *TokenController {
+	return &TokenController{
+		DB:    db,
+		Audit: auditLog,
+	}
+}
+
+
+func newAPITokenResponse(token *models.APIToken) APITokenResponse {
+	return APITokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+
+// @Summary Создать токен доступа
+// @Description Создает именованный токен с ограниченными областями доступа. Значение токена возвращается только один раз
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAPITokenRequest true "Параметры токена"
+// @Success 201 {object} CreatedAPITokenResponse "Созданный токен"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tokens [post]
+func (tc *TokenController) CreateToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "срок действия не может быть отрицательным"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	plain, token, err := models.CreateAPIToken(tc.DB, userID.(uint), req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "valid_scopes": models.ValidScopes})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось создать токен"})
+		}
+		return
+	}
+
+	tc.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionTokenCreated,
+		TargetType: audit.TargetToken,
+		TargetID:   audit.ID(token.ID),
+		Details:    gin.H{"name": token.Name, "prefix": token.Prefix, "scopes": token.ScopeList()},
+	})
+
+	c.JSON(http.StatusCreated, CreatedAPITokenResponse{
+		APITokenResponse: newAPITokenResponse(token),
+		Token:            plain,
+	})
+}
+
+
+// @Summary Список токенов доступа
+// @Description Возвращает токены доступа текущего пользователя, включая отозванные
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} APITokenResponse "Список токенов"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tokens [get]
+func (tc *TokenController) ListTokens(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	tokens, err := models.ListAPITokens(tc.DB, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить токены"})
+		return
+	}
+
+	response := make([]APITokenResponse, 0, len(tokens))
+	for i := range tokens {
+		response = append(response, newAPITokenResponse(&tokens[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Отозвать токен доступа
+// @Description Отзывает токен доступа. Отозванный токен больше не принимается
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID токена"
+// @Success 200 {object} map[string]string "Токен отозван"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Токен не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tokens/{id} [delete]
+func (tc *TokenController) RevokeToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	if err := models.RevokeAPIToken(tc.DB, uint(tokenID), userID.(uint)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "токен не найден"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отозвать токен"})
+		}
+		return
+	}
+
+	tc.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionTokenRevoked,
+		TargetType: audit.TargetToken,
+		TargetID:   audit.ID(uint(tokenID)),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "токен отозван"})
+}
@@ -1,32 +1,83 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
 	"gorm.io/gorm"
 )
 
 
 type UserController struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Config *config.Config
+	Audit  *audit.Logger
 }
 
 
 type UserResponse struct {
-	UserID uint `json:"user_id" example:"1"`
+	UserID                uint       `json:"user_id" example:"1"`
+	Email                 string     `json:"email" example:"user@example.com"`
+	DisplayName           string     `json:"display_name" example:"Иван Петров"`
+	AvatarURL             string     `json:"avatar_url,omitempty" example:"/api/users/1/avatar"`
+	EmailVerified         bool       `json:"email_verified" example:"true"`
+	MFAEnabled            bool       `json:"mfa_enabled" example:"false"`
+	PasswordResetRequired bool       `json:"password_reset_required" example:"false"`
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 
-func NewUserController(db *gorm.DB) *UserController {
+type ProfileResponse struct {
+	UserID      uint   `json:"user_id" example:"1"`
+	Email       string `json:"email" example:"user@example.com"`
+	DisplayName string `json:"display_name" example:"Иван Петров"`
+	AvatarURL   string `json:"avatar_url,omitempty" example:"/api/users/1/avatar"`
+	Timezone    string `json:"timezone" example:"Europe/Moscow"`
+	Locale      string `json:"locale" example:"ru"`
+	Signature   string `json:"signature" example:"С уважением, Иван"`
+}
+
+
+// UpdateProfileRequest — частичное обновление профиля: отсутствующие поля не меняются.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name" example:"Иван Петров"`
+	Timezone    *string `json:"timezone" example:"Europe/Moscow"`
+	Locale      *string `json:"locale" example:"ru"`
+	Signature   *string `json:"signature" example:"С уважением, Иван"`
+}
+
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required" example:"password123"`
+	NewPassword     string `json:"new_password" binding:"required,min=8" example:"newpassword456"`
+}
+
+
+func NewUserController(db *gorm.DB, cfg *config.Config, auditLog *audit.Logger) *UserController {
 	return &UserController{
-		DB: db,
+		DB:     db,
+		Config: cfg,
+		Audit:  auditLog,
 	}
 }
 
 
 // @Summary Получить информацию о текущем пользователе
-// @Description Возвращает идентификатор текущего пользователя
+// @Description Возвращает идентификатор, email и статус подтверждения email текущего пользователя
 // @Tags users
 // @Produce json
 // @Security BearerAuth
@@ -34,13 +85,368 @@ func NewUserController(db *gorm.DB) *UserController {
 // @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
 // @Router /users/me [get]
 func (uc *UserController) GetCurrentUser(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
 		return
 	}
 
 	c.JSON(http.StatusOK, UserResponse{
-		UserID: userID.(uint),
+		UserID:                user.ID,
+		Email:                 user.Email,
+		DisplayName:           user.DisplayName,
+		AvatarURL:             avatarURL(user),
+		EmailVerified:         user.EmailVerified,
+		MFAEnabled:            user.MFAEnabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		DeletionScheduledAt:   user.DeletionScheduledAt,
+	})
+}
+
+
+// @Summary Сменить пароль
+// @Description Меняет пароль текущего пользователя, отзывает остальные сессии и возвращает новый JWT токен
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePasswordRequest true "Текущий и новый пароль"
+// @Success 200 {object} TokenResponse "Новый JWT токен"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 401 {object} map[string]string "Неверный текущий пароль"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/password [put]
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	if !user.CheckPassword(req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверный текущий пароль"})
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "новый пароль должен отличаться от текущего"})
+		return
+	}
+
+	if err := models.ChangePassword(uc.DB, user, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сменить пароль"})
+		return
+	}
+
+	uc.Audit.RecordRequest(c, audit.Event{
+		Action:     audit.ActionPasswordChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+	})
+
+	token, err := middleware.GenerateToken(user, uc.Config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сгенерировать токен"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{Token: token})
+}
+
+
+// @Summary Получить профиль
+// @Description Возвращает профиль текущего пользователя: отображаемое имя, аватар, часовой пояс, язык и подпись
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ProfileResponse "Профиль"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Router /users/me/profile [get]
+func (uc *UserController) GetProfile(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+
+// @Summary Обновить профиль
+// @Description Обновляет переданные поля профиля текущего пользователя
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateProfileRequest true "Поля профиля"
+// @Success 200 {object} ProfileResponse "Обновленный профиль"
+// @Failure 400 {object} map[string]string "Неверные данные запроса"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/profile [put]
+func (uc *UserController) UpdateProfile(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	err = models.UpdateProfile(uc.DB, user, models.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Timezone:    req.Timezone,
+		Locale:      req.Locale,
+		Signature:   req.Signature,
 	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDisplayNameTooLong), errors.Is(err, models.ErrSignatureTooLong),
+			errors.Is(err, models.ErrInvalidTimezone), errors.Is(err, models.ErrInvalidLocale):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось обновить профиль"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+
+// @Summary Загрузить аватар
+// @Description Загружает изображение профиля (PNG, JPEG, GIF или WebP). Размер ограничен настройкой AVATAR_MAX_SIZE
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param avatar formData file true "Изображение"
+// @Success 200 {object} ProfileResponse "Обновленный профиль"
+// @Failure 400 {object} map[string]string "Файл не передан или имеет неподдерживаемый формат"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/avatar [post]
+func (uc *UserController) UploadAvatar(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "файл avatar не передан"})
+		return
+	}
+	if header.Size > uc.Config.Uploads.MaxAvatarSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "файл слишком большой"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не удалось прочитать файл"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, uc.Config.Uploads.MaxAvatarSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не удалось прочитать файл"})
+		return
+	}
+	if int64(len(data)) > uc.Config.Uploads.MaxAvatarSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "файл слишком большой"})
+		return
+	}
+
+	// Тип определяется по содержимому, а не по заголовку от клиента
+	ext, ok := avatarExtensions[http.DetectContentType(data)]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "поддерживаются только изображения PNG, JPEG, GIF и WebP"})
+		return
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить аватар"})
+		return
+	}
+	name := filepath.Join("avatars", fmt.Sprintf("%d-%s%s", user.ID, hex.EncodeToString(suffix), ext))
+
+	if err := uc.writeUpload(name, data); err != nil {
+		log.Printf("Ошибка сохранения аватара: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить аватар"})
+		return
+	}
+
+	previous, err := models.SetUserAvatar(uc.DB, user, name)
+	if err != nil {
+		uc.removeUpload(name)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить аватар"})
+		return
+	}
+	uc.removeUpload(previous)
+
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+
+// @Summary Удалить аватар
+// @Description Удаляет изображение профиля текущего пользователя
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ProfileResponse "Обновленный профиль"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/avatar [delete]
+func (uc *UserController) DeleteAvatar(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	previous, err := models.SetUserAvatar(uc.DB, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить аватар"})
+		return
+	}
+	uc.removeUpload(previous)
+
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+
+// @Summary Карточка пользователя
+// @Description Возвращает публичные данные пользователя: email, отображаемое имя и аватар. Карточка доступна, если текущий пользователь переписывался с ним, держит его в контактах или состоит с ним в одном списке рассылки; для остальных пользователь не найден
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} UserCard "Карточка пользователя"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/{id}/card [get]
+func (uc *UserController) GetUserCard(c *gin.Context) {
+	viewer, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	var user models.User
+	if err := uc.DB.Select("id", "email", "display_name", "avatar_path").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		return
+	}
+
+	// Несвязанному пользователю отвечаем так же, как на несуществующий ID
+	allowed, err := models.CanViewUserCard(uc.DB, viewer, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось загрузить карточку пользователя"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserCard(&user))
+}
+
+
+// @Summary Получить аватар пользователя
+// @Description Возвращает изображение профиля пользователя. Не требует аутентификации, чтобы его можно было использовать в теге img
+// @Tags users
+// @Produce image/png,image/jpeg,image/gif,image/webp
+// @Param id path int true "ID пользователя"
+// @Success 200 {file} file "Изображение"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Аватар не найден"
+// @Router /users/{id}/avatar [get]
+func (uc *UserController) GetAvatar(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return
+	}
+
+	var user models.User
+	if err := uc.DB.Select("id", "avatar_path").First(&user, userID).Error; err != nil || user.AvatarPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "аватар не найден"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.File(filepath.Join(uc.Config.Uploads.Dir, user.AvatarPath))
+}
+
+
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+
+func (uc *UserController) writeUpload(name string, data []byte) error {
+	path := filepath.Join(uc.Config.Uploads.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+
+func (uc *UserController) removeUpload(name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(uc.Config.Uploads.Dir, name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Ошибка удаления файла %s: %v", name, err)
+	}
+}
+
+
+func avatarURL(user *models.User) string {
+	if user.AvatarPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("/api/users/%d/avatar", user.ID)
+}
+
+
+func newProfileResponse(user *models.User) ProfileResponse {
+	return ProfileResponse{
+		UserID:      user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		AvatarURL:   avatarURL(user),
+		Timezone:    user.Timezone,
+		Locale:      user.Locale,
+		Signature:   user.Signature,
+	}
 }
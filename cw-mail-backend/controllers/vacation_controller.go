@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+type VacationController struct {
+	DB *gorm.DB
+}
+
+
+type VacationRequest struct {
+	Enabled      bool       `json:"enabled" example:"true"`
+	StartsAt     *time.Time `json:"starts_at" example:"2025-07-01T00:00:00Z"` // необязательно
+	EndsAt       *time.Time `json:"ends_at" example:"2025-07-15T00:00:00Z"`   // необязательно
+	Subject      string     `json:"subject" example:"В отпуске"`              // пусто — «Auto: » и тема письма
+	Body         string     `json:"body" example:"Я в отпуске до 15 июля, отвечу после возвращения."`
+	OnlyContacts bool       `json:"only_contacts" example:"false"` // отвечать только сохраненным контактам
+	IntervalDays int        `json:"interval_days" example:"7"`     // 1–30, по умолчанию 7
+}
+
+
+func NewVacationController(db *gorm.DB) *VacationController {
+	return &VacationController{DB: db}
+}
+
+
+// @Summary Автоответ
+// @Description Возвращает настройки автоответа «нет на месте»
+// @Tags vacation
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.VacationSettings "Настройки автоответа"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/vacation [get]
+func (vc *VacationController) GetVacation(c *gin.Context) {
+	settings, err := models.GetVacationSettings(vc.DB, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить настройки автоответа"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+
+// @Summary Изменить автоответ
+// @Description Сохраняет настройки автоответа. Ответ отправляется одному отправителю не чаще раза в interval_days дней и не отправляется на письма из списков рассылки, автоматические письма и спам. После изменения текста или периода ответ снова получат все отправители
+// @Tags vacation
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VacationRequest true "Настройки автоответа"
+// @Success 200 {object} models.VacationSettings "Сохраненные настройки"
+// @Failure 400 {object} map[string]string "Неверные настройки"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/me/vacation [put]
+func (vc *VacationController) UpdateVacation(c *gin.Context) {
+	var req VacationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return
+	}
+
+	settings, err := models.UpdateVacationSettings(vc.DB, c.GetUint("user_id"), models.VacationFields{
+		Enabled:      req.Enabled,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+		Subject:      req.Subject,
+		Body:         req.Body,
+		OnlyContacts: req.OnlyContacts,
+		IntervalDays: req.IntervalDays,
+	})
+	if errors.Is(err, models.ErrInvalidVacation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить настройки автоответа"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
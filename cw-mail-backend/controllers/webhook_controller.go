@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
+	"github.com/mail-service/webhook"
+	"gorm.io/gorm"
+)
+
+
+// WebhookController управляет вебхуками пользователя (Scope user) или
+// вебхуками администраторов (Scope admin). Маршруты обоих видов одинаковы и
+// отличаются префиксом /admin.
+type WebhookController struct {
+	DB      *gorm.DB
+	Service *webhook.Service
+	Config  *config.Config
+	Audit   *audit.Logger
+	Scope   string
+}
+
+
+type WebhookRequest struct {
+	URL         *string  `json:"url" binding:"omitempty,max=2048" example:"https://tools.example.com/hooks/mail"`
+	Description *string  `json:"description" binding:"omitempty,max=255" example:"Учет входящих"`
+	Events      []string `json:"events" example:"new_message,message.read"` // пустой список — все события
+	Active      *bool    `json:"active" example:"true"`
+}
+
+
+type WebhookResponse struct {
+	ID          uint      `json:"id" example:"1"`
+	UserID      uint      `json:"user_id" example:"1"`
+	Scope       string    `json:"scope" example:"user"`
+	URL         string    `json:"url" example:"https://tools.example.com/hooks/mail"`
+	Description string    `json:"description" example:"Учет входящих"`
+	Events      []string  `json:"events" example:"new_message,message.read"`
+	Active      bool      `json:"active" example:"true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+
+type CreatedWebhookResponse struct {
+	WebhookResponse
+	Secret string `json:"secret" example:"whsec_1a2b3c..."`
+}
+
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+	Total      int64                    `json:"total" example:"3"`
+	Page       int                      `json:"page" example:"1"`
+	Limit      int                      `json:"limit" example:"20"`
+}
+
+
+func NewWebhookController(db *gorm.DB, service *webhook.Service, cfg *config.Config, auditLog *audit.Logger, scope string) *WebhookController {
+	return &WebhookController{
+		DB:      db,
+		Service: service,
+		Config:  cfg,
+		Audit:   auditLog,
+		Scope:   scope,
+	}
+}
+
+
+func newWebhookResponse(hook *models.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:          hook.ID,
+		UserID:      hook.UserID,
+		Scope:       hook.Scope,
+		URL:         hook.URL,
+		Description: hook.Description,
+		Events:      hook.EventList(),
+		Active:      hook.Active,
+		CreatedAt:   hook.CreatedAt,
+		UpdatedAt:   hook.UpdatedAt,
+	}
+}
+
+
+// validEvents возвращает события, на которые можно подписать вебхук: вебхуку
+// пользователя — только события, касающиеся отдельных пользователей.
+func (wc *WebhookController) validEvents() []string {
+	if wc.Scope == models.WebhookScopeUser {
+		events := queue.UserRoutingKeys()
+		sort.Strings(events)
+		return events
+	}
+
+	events := make([]string, 0, len(queue.Catalog))
+	for _, eventType := range queue.Catalog {
+		events = append(events, eventType.RoutingKey)
+	}
+	return events
+}
+
+
+// normalizeEvents проверяет события и убирает повторы.
+func (wc *WebhookController) normalizeEvents(events []string) ([]string, bool) {
+	valid := make(map[string]bool)
+	for _, event := range wc.validEvents() {
+		valid[event] = true
+	}
+
+	unique := make(map[string]bool)
+	normalized := make([]string, 0, len(events))
+	for _, event := range events {
+		if !valid[event] {
+			return nil, false
+		}
+		if !unique[event] {
+			unique[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, true
+}
+
+
+func (wc *WebhookController) bindRequest(c *gin.Context) (models.WebhookInput, bool) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса"})
+		return models.WebhookInput{}, false
+	}
+
+	input := models.WebhookInput{URL: req.URL, Description: req.Description, Active: req.Active}
+	if req.Events != nil {
+		events, ok := wc.normalizeEvents(req.Events)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неизвестное событие", "valid_events": wc.validEvents()})
+			return models.WebhookInput{}, false
+		}
+		input.Events = events
+	}
+
+	if input.URL != nil {
+		err := wc.Service.CheckURL(c.Request.Context(), wc.Scope, *input.URL)
+		switch {
+		case errors.Is(err, webhook.ErrTargetNotAllowed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "адрес вебхука не разрешается или указывает на внутреннюю сеть"})
+			return models.WebhookInput{}, false
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return models.WebhookInput{}, false
+		}
+	}
+	return input, true
+}
+
+
+// @Summary Вебхуки
+// @Description Возвращает вебхуки пользователя или, для /admin/webhooks, вебхуки администраторов. Секрет не возвращается
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} WebhookResponse "Вебхуки"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /webhooks [get]
+// @Router /admin/webhooks [get]
+func (wc *WebhookController) ListWebhooks(c *gin.Context) {
+	hooks, err := models.ListWebhooks(wc.DB, wc.Scope, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить вебхуки"})
+		return
+	}
+
+	response := make([]WebhookResponse, 0, len(hooks))
+	for i := range hooks {
+		response = append(response, newWebhookResponse(&hooks[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+
+// @Summary Создать вебхук
+// @Description Подписывает URL на события. Вебхук пользователя получает события его почтового ящика, вебхук администратора — все события сервиса. URL не может указывать на loopback, частные и link-local адреса; вебхукам администраторов доступны внутренние сети из WEBHOOK_ADMIN_NETWORKS. Секрет для проверки подписи возвращается только один раз
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body WebhookRequest true "Параметры вебхука"
+// @Success 201 {object} CreatedWebhookResponse "Созданный вебхук"
+// @Failure 400 {object} map[string]string "Неверный URL или неизвестное событие"
+// @Failure 401 {object} map[string]string "Пользователь не аутентифицирован"
+// @Failure 409 {object} map[string]string "Достигнуто максимальное количество вебхуков"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /webhooks [post]
+// @Router /admin/webhooks [post]
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	input, ok := wc.bindRequest(c)
+	if !ok {
+		return
+	}
+
+	hook, err := models.CreateWebhook(wc.DB, c.GetUint("user_id"), wc.Scope, input, wc.Config.Webhooks.MaxPerUser)
+	switch {
+	case errors.Is(err, models.ErrWebhookURL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrWebhookQuotaExceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось создать вебхук"})
+		return
+	}
+
+	wc.audit(c, audit.ActionWebhookCreated, audit.ActionAdminWebhookCreated, hook)
+	c.JSON(http.StatusCreated, CreatedWebhookResponse{WebhookResponse: newWebhookResponse(hook), Secret: hook.Secret})
+}
+
+
+// @Summary Вебхук
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} WebhookResponse "Вебхук"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Вебхук не найден"
+// @Router /webhooks/{id} [get]
+// @Router /admin/webhooks/{id} [get]
+func (wc *WebhookController) GetWebhook(c *gin.Context) {
+	hook, ok := wc.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newWebhookResponse(hook))
+}
+
+
+// @Summary Изменить вебхук
+// @Description Изменяет URL, описание, события или включает и отключает вебхук. Незаданные поля не меняются. Доставки отключенного вебхука, ожидающие повтора, при следующей попытке отмечаются как неудачные
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID вебхука"
+// @Param request body WebhookRequest true "Изменяемые поля"
+// @Success 200 {object} WebhookResponse "Вебхук изменен"
+// @Failure 400 {object} map[string]string "Неверный URL или неизвестное событие"
+// @Failure 404 {object} map[string]string "Вебхук не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /webhooks/{id} [put]
+// @Router /admin/webhooks/{id} [put]
+func (wc *WebhookController) UpdateWebhook(c *gin.Context) {
+	hook, ok := wc.findWebhook(c)
+	if !ok {
+		return
+	}
+	input, ok := wc.bindRequest(c)
+	if !ok {
+		return
+	}
+
+	err := models.UpdateWebhook(wc.DB, hook, input)
+	switch {
+	case errors.Is(err, models.ErrWebhookURL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось изменить вебхук"})
+		return
+	}
+
+	wc.audit(c, audit.ActionWebhookUpdated, audit.ActionAdminWebhookUpdated, hook)
+	c.JSON(http.StatusOK, newWebhookResponse(hook))
+}
+
+
+// @Summary Удалить вебхук
+// @Description Удаляет вебхук вместе с журналом доставок
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} map[string]string "Вебхук удален"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Вебхук не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /webhooks/{id} [delete]
+// @Router /admin/webhooks/{id} [delete]
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	hook, ok := wc.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteWebhook(wc.DB, hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить вебхук"})
+		return
+	}
+
+	wc.audit(c, audit.ActionWebhookDeleted, audit.ActionAdminWebhookDeleted, hook)
+	c.JSON(http.StatusOK, gin.H{"message": "вебхук удален"})
+}
+
+
+// @Summary Журнал доставок вебхука
+// @Description Возвращает попытки доставки событий вебхуку, начиная с новых: статус, число попыток, код ответа получателя и последнюю ошибку. Начало тела ответа сохраняется только для вебхуков администраторов
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID вебхука"
+// @Param status query string false "Статус (pending, succeeded, failed)"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Размер страницы" default(20)
+// @Success 200 {object} WebhookDeliveryListResponse "Доставки"
+// @Failure 400 {object} map[string]string "Неверные параметры запроса"
+// @Failure 404 {object} map[string]string "Вебхук не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /webhooks/{id}/deliveries [get]
+// @Router /admin/webhooks/{id}/deliveries [get]
+func (wc *WebhookController) ListDeliveries(c *gin.Context) {
+	hook, ok := wc.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	filter := models.WebhookDeliveryFilter{Status: c.Query("status")}
+	switch filter.Status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимый статус"})
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if filter.Page < 1 || filter.Limit < 1 || filter.Limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные параметры страницы"})
+		return
+	}
+
+	deliveries, total, err := models.ListWebhookDeliveries(wc.DB, hook.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить журнал доставок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookDeliveryListResponse{
+		Deliveries: deliveries,
+		Total:      total,
+		Page:       filter.Page,
+		Limit:      filter.Limit,
+	})
+}
+
+
+// @Summary Отправить тестовое событие
+// @Description Сразу отправляет вебхуку событие webhook.test и возвращает результат доставки. Тестовое событие не повторяется при ошибке и отправляется и отключенному вебхуку
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} models.WebhookDelivery "Результат доставки (status succeeded или failed)"
+// @Failure 400 {object} map[string]string "Неверный ID"
+// @Failure 404 {object} map[string]string "Вебхук не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /webhooks/{id}/test [post]
+// @Router /admin/webhooks/{id}/test [post]
+func (wc *WebhookController) SendTestEvent(c *gin.Context) {
+	hook, ok := wc.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := wc.Service.SendTest(c.Request.Context(), hook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось отправить тестовое событие"})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+
+func (wc *WebhookController) findWebhook(c *gin.Context) (*models.Webhook, bool) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return nil, false
+	}
+
+	hook, err := models.GetWebhook(wc.DB, wc.Scope, c.GetUint("user_id"), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "вебхук не найден"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось получить вебхук"})
+		}
+		return nil, false
+	}
+	return hook, true
+}
+
+
+func (wc *WebhookController) audit(c *gin.Context, userAction, adminAction audit.Action, hook *models.Webhook) {
+	action := userAction
+	if wc.Scope == models.WebhookScopeAdmin {
+		action = adminAction
+	}
+
+	wc.Audit.RecordRequest(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetWebhook,
+		TargetID:   &hook.ID,
+		Details:    gin.H{"url": hook.URL, "events": hook.EventList(), "active": hook.Active},
+	})
+}
+
+
+func parseWebhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/webhook"
+)
+
+func TestWebhookCRUDAndTestEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupControllerTestDB(t)
+	alice, _ := models.CreateUser(db, "alice@example.com", "password123")
+	bob, _ := models.CreateUser(db, "bob@example.com", "password123")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	cfg := &config.Config{}
+	cfg.Webhooks.Timeout = time.Second
+	cfg.Webhooks.MaxPerUser = 1
+	cfg.Webhooks.AdminNetworks = []*net.IPNet{loopback}
+	service := webhook.NewService(db, cfg)
+
+	routes := func(user *models.User, scope string) *gin.Engine {
+		wc := NewWebhookController(db, service, cfg, nil, scope)
+		router := gin.New()
+		router.Use(asUser(user))
+		router.POST("/webhooks", wc.CreateWebhook)
+		router.GET("/webhooks/:id", wc.GetWebhook)
+		router.PUT("/webhooks/:id", wc.UpdateWebhook)
+		router.POST("/webhooks/:id/test", wc.SendTestEvent)
+		router.GET("/webhooks/:id/deliveries", wc.ListDeliveries)
+		return router
+	}
+	asAlice, asBob := routes(alice, models.WebhookScopeUser), routes(bob, models.WebhookScopeUser)
+	asAdmin := routes(alice, models.WebhookScopeAdmin)
+	// Адрес из документационной сети проверяется без DNS и не является внутренним
+	publicURL := "https://203.0.113.10/hooks/mail"
+
+	send := func(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Вебхук пользователя нельзя подписать на события администраторов
+	w := send(asAlice, http.MethodPost, "/webhooks", `{"url":"`+publicURL+`","events":["user.registered"]}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "valid_events") {
+		t.Errorf("Событие администратора: ожидался статус 400 со списком событий, получено %d: %s", w.Code, w.Body.String())
+	}
+	if w := send(asAlice, http.MethodPost, "/webhooks", `{"url":"not a url"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Неверный URL: ожидался статус 400, получено %d", w.Code)
+	}
+
+	// Вебхук пользователя не может обращаться к внутренним адресам
+	for _, url := range []string{server.URL, "http://169.254.169.254/latest/meta-data", "http://[::1]:5672/"} {
+		if w := send(asAlice, http.MethodPost, "/webhooks", `{"url":"`+url+`"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Внутренний адрес %s: ожидался статус 400, получено %d", url, w.Code)
+		}
+	}
+
+	w = send(asAlice, http.MethodPost, "/webhooks", `{"url":"`+publicURL+`","events":["message.read","new_message","message.read"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Создание: ожидался статус 201, получено %d: %s", w.Code, w.Body.String())
+	}
+	var created CreatedWebhookResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Secret, models.WebhookSecretPrefix) || strings.Join(created.Events, ",") != "message.read,new_message" {
+		t.Errorf("Созданный вебхук: %+v", created)
+	}
+	path := "/webhooks/" + strconv.FormatUint(uint64(created.ID), 10)
+
+	if w := send(asAlice, http.MethodPost, "/webhooks", `{"url":"`+publicURL+`"}`); w.Code != http.StatusConflict {
+		t.Errorf("Сверх квоты: ожидался статус 409, получено %d", w.Code)
+	}
+
+	// Секрет возвращается только при создании
+	w = send(asAlice, http.MethodGet, path, "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Secret) {
+		t.Errorf("Получение: статус %d, ответ %s", w.Code, w.Body.String())
+	}
+	if w := send(asBob, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Чужой вебхук: ожидался статус 404, получено %d", w.Code)
+	}
+
+	if w := send(asAlice, http.MethodPut, path, `{"url":"`+server.URL+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Смена адреса на внутренний: ожидался статус 400, получено %d", w.Code)
+	}
+	w = send(asAlice, http.MethodPut, path, `{"active":false}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":false`) {
+		t.Errorf("Отключение: статус %d, ответ %s", w.Code, w.Body.String())
+	}
+
+	// Вебхукам администраторов доступны сети из WEBHOOK_ADMIN_NETWORKS
+	w = send(asAdmin, http.MethodPost, "/webhooks", `{"url":"`+server.URL+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Вебхук администратора: ожидался статус 201, получено %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path = "/webhooks/" + strconv.FormatUint(uint64(created.ID), 10)
+
+	w = send(asAdmin, http.MethodPost, path+"/test", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"succeeded"`) {
+		t.Errorf("Тестовое событие: статус %d, ответ %s", w.Code, w.Body.String())
+	}
+
+	w = send(asAdmin, http.MethodGet, path+"/deliveries?status=succeeded", "")
+	var deliveries WebhookDeliveryListResponse
+	json.Unmarshal(w.Body.Bytes(), &deliveries)
+	if w.Code != http.StatusOK || deliveries.Total != 1 || deliveries.Deliveries[0].Event != models.WebhookTestEvent {
+		t.Errorf("Журнал доставок: статус %d, ответ %s", w.Code, w.Body.String())
+	}
+	if w := send(asAdmin, http.MethodGet, path+"/deliveries?status=unknown", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Неизвестный статус: ожидался статус 400, получено %d", w.Code)
+	}
+}
@@ -26,6 +26,28 @@ func Migrate(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Message{},
+		&models.EmailVerification{},
+		&models.MFARecoveryCode{},
+		&models.APIToken{},
+		&models.AuditLog{},
+		&models.DataExport{},
+		&models.Contact{},
+		&models.ContactGroup{},
+		&models.DistributionList{},
+		&models.DistributionListMember{},
+		&models.EmailAlias{},
+		&models.BlockedSender{},
+		&models.FilterRule{},
+		&models.SieveScript{},
+		&models.AutoReply{},
+		&models.VacationSettings{},
+		&models.SpamSettings{},
+		&models.SpamToken{},
+		&models.QuarantinedMessage{},
+		&models.OutboxEvent{},
+		&models.DeadLetter{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
 	)
 	if err != nil {
 		return fmt.Errorf("ошибка миграции базы данных: %w", err)
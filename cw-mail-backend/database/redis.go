@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/redis/go-redis/v9"
+)
+
+
+func InitRedis(cfg *config.Config) (*redis.Client, error) {
+	db, err := strconv.Atoi(cfg.Redis.DB)
+	if err != nil {
+		return nil, fmt.Errorf("неверный номер базы Redis: %w", err)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.GetRedisAddr(),
+		Password: cfg.Redis.Password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ошибка подключения к Redis: %w", err)
+	}
+
+	log.Println("Подключение к Redis успешно установлено")
+	return client, nil
+}
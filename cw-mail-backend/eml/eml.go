@@ -0,0 +1,76 @@
+package eml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+
+// Message — текстовое письмо в формате RFC 5322.
+type Message struct {
+	From      mail.Address
+	To        mail.Address
+	Subject   string
+	Date      time.Time
+	MessageID string
+	Body      string
+	Headers   map[string]string
+}
+
+
+// Write записывает письмо с CRLF-переводами строк. Тема кодируется по
+// RFC 2047, тело — quoted-printable, чтобы файл корректно открывался
+// почтовыми клиентами независимо от языка текста.
+func (m *Message) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header := func(name, value string) {
+		fmt.Fprintf(bw, "%s: %s\r\n", name, value)
+	}
+
+	header("From", m.From.String())
+	header("To", m.To.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", m.Date.Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		header("Message-ID", "<"+m.MessageID+">")
+	}
+
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(name, sanitizeHeader(m.Headers[name]))
+	}
+
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	bw.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(bw)
+	body := strings.ReplaceAll(m.Body, "\r\n", "\n")
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+
+func sanitizeHeader(value string) string {
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	return mime.QEncoding.Encode("utf-8", value)
+}
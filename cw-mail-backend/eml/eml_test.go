@@ -0,0 +1,65 @@
+package eml
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMessage(t *testing.T) {
+	msg := &Message{
+		From:      mail.Address{Name: "Иван Петров", Address: "ivan@example.com"},
+		To:        mail.Address{Address: "anna@example.com"},
+		Subject:   "Привет, мир",
+		Date:      time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC),
+		MessageID: "message-1@cw-mail",
+		Body:      "Первая строка\nВторая строка",
+		Headers:   map[string]string{"X-Label": "inbox\r\nBcc: evil@example.com"},
+	}
+
+	var buf bytes.Buffer
+	if err := msg.Write(&buf); err != nil {
+		t.Fatalf("Ошибка записи письма: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "\nBcc:") {
+		t.Fatal("Переводы строк в заголовках должны удаляться")
+	}
+	if strings.Contains(strings.ReplaceAll(buf.String(), "\r\n", ""), "\n") {
+		t.Error("Все строки должны заканчиваться CRLF")
+	}
+
+	parsed, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("Письмо не разбирается: %v", err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != msg.Subject {
+		t.Errorf("Ожидалась тема %q, получено %q", msg.Subject, subject)
+	}
+
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || from[0].Name != "Иван Петров" || from[0].Address != "ivan@example.com" {
+		t.Errorf("Неверный отправитель: %v (%v)", from, err)
+	}
+
+	if parsed.Header.Get("Message-Id") != "<message-1@cw-mail>" {
+		t.Errorf("Неверный Message-ID: %q", parsed.Header.Get("Message-Id"))
+	}
+
+	date, err := parsed.Header.Date()
+	if err != nil || !date.Equal(msg.Date) {
+		t.Errorf("Неверная дата: %v (%v)", date, err)
+	}
+
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if string(body) != "Первая строка\r\nВторая строка" {
+		t.Errorf("Неверное тело письма: %q", body)
+	}
+}
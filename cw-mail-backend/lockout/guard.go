@@ -0,0 +1,244 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mail-service/config"
+)
+
+
+type Policy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	DelayAfter         int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	Window             time.Duration
+	LockoutDuration    time.Duration
+}
+
+
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+
+type Event struct {
+	Scope    string    `json:"scope"`
+	Subject  string    `json:"subject"`
+	Failures int64     `json:"failures"`
+	Until    time.Time `json:"until"`
+	IP       string    `json:"ip,omitempty"`
+}
+
+
+// Decision описывает, можно ли сейчас проверять пароль.
+type Decision struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+
+func (d Decision) Allowed() bool {
+	return d.RetryAfter <= 0
+}
+
+
+// Guard отслеживает неудачные попытки входа по учетной записи и IP-адресу.
+// После DelayAfter ошибок каждая следующая попытка откладывается на
+// экспоненциально растущую задержку, а по достижении лимита субъект
+// блокируется на LockoutDuration.
+type Guard struct {
+	Store     Store
+	Policy    Policy
+	OnLockout func(ctx context.Context, event Event)
+}
+
+
+func NewGuard(store Store, policy Policy) *Guard {
+	return &Guard{
+		Store:  store,
+		Policy: policy,
+	}
+}
+
+
+func key(scope, subject, kind string) string {
+	return "lockout:" + scope + ":" + subject + ":" + kind
+}
+
+
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+
+func (g *Guard) Check(ctx context.Context, account, ip string) (Decision, error) {
+	var decision Decision
+
+	subjects := [][2]string{
+		{ScopeAccount, normalizeAccount(account)},
+		{ScopeIP, ip},
+	}
+
+	for _, s := range subjects {
+		if s[1] == "" {
+			continue
+		}
+
+		locked, err := g.Store.TTL(ctx, key(s[0], s[1], "lock"))
+		if err != nil {
+			return Decision{}, err
+		}
+		if locked > 0 {
+			decision.Locked = true
+			if locked > decision.RetryAfter {
+				decision.RetryAfter = locked
+			}
+			continue
+		}
+
+		delay, err := g.Store.TTL(ctx, key(s[0], s[1], "delay"))
+		if err != nil {
+			return Decision{}, err
+		}
+		if delay > decision.RetryAfter {
+			decision.RetryAfter = delay
+		}
+	}
+
+	return decision, nil
+}
+
+
+func (g *Guard) Failure(ctx context.Context, account, ip string) (Decision, error) {
+	account = normalizeAccount(account)
+
+	accountDecision, err := g.fail(ctx, ScopeAccount, account, g.Policy.MaxAccountFailures, ip)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if ip == "" {
+		return accountDecision, nil
+	}
+
+	ipDecision, err := g.fail(ctx, ScopeIP, ip, g.Policy.MaxIPFailures, ip)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if ipDecision.RetryAfter > accountDecision.RetryAfter {
+		accountDecision.RetryAfter = ipDecision.RetryAfter
+	}
+	accountDecision.Locked = accountDecision.Locked || ipDecision.Locked
+
+	return accountDecision, nil
+}
+
+
+// Success сбрасывает счетчик учетной записи. Счетчик IP намеренно не
+// сбрасывается: успешный вход в одну учетную запись не должен обнулять
+// перебор паролей к другим с того же адреса.
+func (g *Guard) Success(ctx context.Context, account string) error {
+	return g.Unlock(ctx, account)
+}
+
+
+func (g *Guard) Unlock(ctx context.Context, account string) error {
+	account = normalizeAccount(account)
+	return g.Store.Del(ctx,
+		key(ScopeAccount, account, "failures"),
+		key(ScopeAccount, account, "delay"),
+		key(ScopeAccount, account, "lock"),
+	)
+}
+
+
+func (g *Guard) Status(ctx context.Context, account string) (int64, time.Duration, error) {
+	account = normalizeAccount(account)
+
+	failures, err := g.Store.Get(ctx, key(ScopeAccount, account, "failures"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	locked, err := g.Store.TTL(ctx, key(ScopeAccount, account, "lock"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return failures, locked, nil
+}
+
+
+func (g *Guard) fail(ctx context.Context, scope, subject string, limit int, ip string) (Decision, error) {
+	failures, err := g.Store.Incr(ctx, key(scope, subject, "failures"), g.Policy.Window)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if limit > 0 && failures >= int64(limit) {
+		if err := g.Store.Set(ctx, key(scope, subject, "lock"), g.Policy.LockoutDuration); err != nil {
+			return Decision{}, err
+		}
+		if err := g.Store.Del(ctx, key(scope, subject, "failures"), key(scope, subject, "delay")); err != nil {
+			return Decision{}, err
+		}
+
+		if g.OnLockout != nil {
+			g.OnLockout(ctx, Event{
+				Scope:    scope,
+				Subject:  subject,
+				Failures: failures,
+				Until:    time.Now().Add(g.Policy.LockoutDuration),
+				IP:       ip,
+			})
+		}
+
+		return Decision{Locked: true, RetryAfter: g.Policy.LockoutDuration}, nil
+	}
+
+	delay := g.delayFor(failures)
+	if delay > 0 {
+		if err := g.Store.Set(ctx, key(scope, subject, "delay"), delay); err != nil {
+			return Decision{}, err
+		}
+	}
+
+	return Decision{RetryAfter: delay}, nil
+}
+
+
+func (g *Guard) delayFor(failures int64) time.Duration {
+	over := failures - int64(g.Policy.DelayAfter)
+	if g.Policy.BaseDelay <= 0 || over <= 0 {
+		return 0
+	}
+
+	delay := g.Policy.BaseDelay
+	for i := int64(1); i < over; i++ {
+		delay *= 2
+		if g.Policy.MaxDelay > 0 && delay >= g.Policy.MaxDelay {
+			return g.Policy.MaxDelay
+		}
+	}
+
+	return delay
+}
+
+
+func PolicyFromConfig(cfg *config.Config) Policy {
+	return Policy{
+		MaxAccountFailures: cfg.Lockout.MaxAccountFailures,
+		MaxIPFailures:      cfg.Lockout.MaxIPFailures,
+		DelayAfter:         cfg.Lockout.DelayAfter,
+		BaseDelay:          cfg.Lockout.BaseDelay,
+		MaxDelay:           cfg.Lockout.MaxDelay,
+		Window:             cfg.Lockout.Window,
+		LockoutDuration:    cfg.Lockout.Duration,
+	}
+}
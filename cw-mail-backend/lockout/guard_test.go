@@ -0,0 +1,112 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestGuard() (*Guard, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+
+	guard := NewGuard(store, Policy{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      8,
+		DelayAfter:         2,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+		Window:             15 * time.Minute,
+		LockoutDuration:    10 * time.Minute,
+	})
+
+	return guard, clock
+}
+
+func TestProgressiveDelay(t *testing.T) {
+	guard, clock := newTestGuard()
+	ctx := context.Background()
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second}
+	for i, want := range expected {
+		decision, err := guard.Failure(ctx, "user@example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("Ошибка регистрации попытки: %v", err)
+		}
+		if decision.RetryAfter != want {
+			t.Errorf("Попытка %d: ожидалась задержка %v, получена %v", i+1, want, decision.RetryAfter)
+		}
+		clock.now = clock.now.Add(want)
+	}
+
+	if _, err := guard.Failure(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	decision, _ := guard.Check(ctx, "USER@example.com ", "10.0.0.2")
+	if !decision.Locked || decision.RetryAfter != 10*time.Minute {
+		t.Errorf("После 5 ошибок учетная запись должна быть заблокирована: %+v", decision)
+	}
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	decision, _ = guard.Check(ctx, "user@example.com", "10.0.0.2")
+	if !decision.Allowed() {
+		t.Errorf("После окончания блокировки вход должен быть разрешен: %+v", decision)
+	}
+}
+
+func TestLockoutEventAndUnlock(t *testing.T) {
+	guard, _ := newTestGuard()
+	ctx := context.Background()
+
+	var events []Event
+	guard.OnLockout = func(ctx context.Context, event Event) {
+		events = append(events, event)
+	}
+
+	for i := 0; i < 5; i++ {
+		guard.Failure(ctx, "victim@example.com", "10.0.0.1")
+	}
+
+	if len(events) != 1 || events[0].Scope != ScopeAccount || events[0].Subject != "victim@example.com" {
+		t.Fatalf("Ожидалось одно событие блокировки учетной записи, получено %+v", events)
+	}
+
+	if err := guard.Unlock(ctx, "victim@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	decision, _ := guard.Check(ctx, "victim@example.com", "")
+	if !decision.Allowed() {
+		t.Errorf("После разблокировки вход должен быть разрешен: %+v", decision)
+	}
+}
+
+func TestIPLockoutAcrossAccounts(t *testing.T) {
+	guard, clock := newTestGuard()
+	ctx := context.Background()
+
+	for i := 0; i < 8; i++ {
+		guard.Failure(ctx, "account"+string(rune('a'+i))+"@example.com", "10.0.0.9")
+		clock.now = clock.now.Add(5 * time.Second)
+	}
+
+	decision, _ := guard.Check(ctx, "fresh@example.com", "10.0.0.9")
+	if !decision.Locked {
+		t.Errorf("IP-адрес должен быть заблокирован после перебора разных учетных записей: %+v", decision)
+	}
+
+	decision, _ = guard.Check(ctx, "fresh@example.com", "10.0.0.10")
+	if !decision.Allowed() {
+		t.Errorf("Другой IP-адрес не должен быть заблокирован: %+v", decision)
+	}
+}
@@ -0,0 +1,160 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+
+// Store хранит счетчики неудачных попыток и флаги блокировки с временем жизни.
+type Store interface {
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	Get(ctx context.Context, key string) (int64, error)
+	Set(ctx context.Context, key string, ttl time.Duration) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Del(ctx context.Context, keys ...string) error
+}
+
+
+type RedisStore struct {
+	Client *redis.Client
+}
+
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := s.Client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	value, err := s.Client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return value, err
+}
+
+
+func (s *RedisStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	return s.Client.Set(ctx, key, 1, ttl).Err()
+}
+
+
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.Client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+
+func (s *RedisStore) Del(ctx context.Context, keys ...string) error {
+	return s.Client.Del(ctx, keys...).Err()
+}
+
+
+type memoryEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+
+// MemoryStore хранит данные в памяти процесса. Подходит для тестов и
+// запуска одного экземпляра без Redis.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+
+func (s *MemoryStore) get(key string) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && !s.now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, ok
+}
+
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		entry = memoryEntry{expiresAt: s.now().Add(window)}
+	}
+	entry.value++
+	s.entries[key] = entry
+
+	return entry.value, nil
+}
+
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.get(key)
+	return entry.value, nil
+}
+
+
+func (s *MemoryStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryEntry{value: 1, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+
+func (s *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(s.now()), nil
+}
+
+
+func (s *MemoryStore) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+
+	"github.com/mail-service/config"
+)
+
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+
+// Mailer отправляет служебные письма (подтверждение email, уведомления и т.п.)
+type Mailer interface {
+	Send(msg Message) error
+}
+
+
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mail.Driver {
+	case "", "log":
+		return &LogMailer{}, nil
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер почты: %s", cfg.Mail.Driver)
+	}
+}
+
+
+// LogMailer выводит письма в лог вместо отправки. Используется в разработке.
+type LogMailer struct{}
+
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("[mailer] to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+
+func NewSMTPMailer(cfg *config.Config) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.Mail.SMTPUser != "" {
+		auth = smtp.PlainAuth("", cfg.Mail.SMTPUser, cfg.Mail.SMTPPassword, cfg.Mail.SMTPHost)
+	}
+
+	return &SMTPMailer{
+		Addr: fmt.Sprintf("%s:%s", cfg.Mail.SMTPHost, cfg.Mail.SMTPPort),
+		From: cfg.Mail.From,
+		Auth: auth,
+	}
+}
+
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package managesieve
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/mail-service/audit"
+	"github.com/mail-service/models"
+)
+
+
+var (
+	errInvalidCredentials = errors.New("неверные учетные данные")
+	errLoginThrottled     = errors.New("слишком много неудачных попыток входа, повторите попытку позже")
+)
+
+
+// login проверяет учетные данные с учетом блокировки после неудачных попыток
+// и записывает результат в журнал аудита, как вход через API.
+func (s *Server) login(ctx context.Context, account, password, ip string) (*models.User, error) {
+	account = strings.ToLower(strings.TrimSpace(account))
+
+	if s.Guard != nil {
+		decision, err := s.Guard.Check(ctx, account, ip)
+		if err != nil {
+			log.Printf("Ошибка проверки блокировки входа: %v", err)
+		} else if !decision.Allowed() {
+			return nil, errLoginThrottled
+		}
+	}
+
+	user, method, reason := s.checkCredentials(account, password)
+	if reason != "" {
+		event := audit.Event{
+			Action:  audit.ActionLoginFailed,
+			IP:      ip,
+			Details: map[string]string{"email": account, "reason": reason, "protocol": "managesieve"},
+		}
+		if user != nil {
+			event.TargetType = audit.TargetUser
+			event.TargetID = audit.ID(user.ID)
+		}
+		s.Audit.Record(ctx, event)
+
+		if s.Guard != nil {
+			decision, err := s.Guard.Failure(ctx, account, ip)
+			if err != nil {
+				log.Printf("Ошибка учета неудачной попытки входа: %v", err)
+			} else if decision.Locked {
+				return nil, errLoginThrottled
+			}
+		}
+		return nil, errInvalidCredentials
+	}
+
+	if s.Guard != nil {
+		if err := s.Guard.Success(ctx, account); err != nil {
+			log.Printf("Ошибка сброса счетчика неудачных попыток входа: %v", err)
+		}
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:     audit.ActionLoginSucceeded,
+		ActorID:    audit.ID(user.ID),
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(user.ID),
+		IP:         ip,
+		Details:    map[string]string{"protocol": "managesieve", "method": method},
+	})
+	return user, nil
+}
+
+
+// checkCredentials возвращает пользователя и способ входа или причину отказа
+// для журнала аудита. Паролем можно войти, только если для учетной записи не
+// требуется второй фактор; иначе нужен токен доступа с областью filters:write.
+func (s *Server) checkCredentials(account, password string) (*models.User, string, string) {
+	user, err := models.FindUserByEmail(s.DB, account)
+	if err != nil {
+		return nil, "", "unknown_user"
+	}
+
+	if strings.HasPrefix(password, models.APITokenPrefix) {
+		token, err := models.AuthenticateAPIToken(s.DB, password)
+		if err != nil || token.UserID != user.ID {
+			return user, "", "invalid_token"
+		}
+		if !token.HasScope(models.ScopeFiltersWrite) {
+			return user, "", "insufficient_scope"
+		}
+		if user.IsDisabled() {
+			return user, "", "disabled"
+		}
+		return user, "api_token", ""
+	}
+
+	if !user.CheckPassword(password) {
+		return user, "", "invalid_password"
+	}
+	if user.IsDisabled() {
+		return user, "", "disabled"
+	}
+	if user.MFAEnabled || (user.IsAdmin() && s.RequireMFAForAdmins) {
+		return user, "", "mfa_required"
+	}
+	return user, "password", ""
+}
@@ -0,0 +1,186 @@
+// Package managesieve реализует сервер протокола ManageSieve (RFC 5804) для
+// управления Sieve-скриптами из почтовых клиентов: Thunderbird, Roundcube,
+// sieve-connect и других.
+//
+// Поддерживаются команды CAPABILITY, STARTTLS, AUTHENTICATE (PLAIN), LOGOUT,
+// NOOP, HAVESPACE, PUTSCRIPT, CHECKSCRIPT, LISTSCRIPTS, SETACTIVE, GETSCRIPT,
+// DELETESCRIPT и RENAMESCRIPT. Вход выполняется паролем учетной записи или
+// токеном доступа с областью filters:write; при включенной двухфакторной
+// аутентификации подходит только токен.
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/lockout"
+	"gorm.io/gorm"
+)
+
+
+const (
+	Implementation = "CW Mail ManageSieve"
+
+	// maxLineLength ограничивает строку команды без литералов.
+	maxLineLength = 8 << 10
+)
+
+
+type Server struct {
+	DB    *gorm.DB
+	Guard *lockout.Guard
+	Audit *audit.Logger
+
+	// TLSConfig включает STARTTLS. Пока соединение не зашифровано, вход
+	// запрещен, чтобы пароль не передавался открытым текстом.
+	TLSConfig *tls.Config
+
+	// IdleTimeout — сколько ждать команды клиента до закрытия соединения.
+	IdleTimeout time.Duration
+
+	// RequireMFAForAdmins запрещает администраторам вход паролем, как и
+	// пользователям с включенной двухфакторной аутентификацией.
+	RequireMFAForAdmins bool
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    sync.WaitGroup
+}
+
+
+// NewServer создает сервер по настройкам cfg. Если указаны сертификат и ключ,
+// включается STARTTLS.
+func NewServer(db *gorm.DB, cfg *config.Config, guard *lockout.Guard, auditLog *audit.Logger) (*Server, error) {
+	server := &Server{
+		DB:                  db,
+		Guard:               guard,
+		Audit:               auditLog,
+		IdleTimeout:         cfg.ManageSieve.IdleTimeout,
+		RequireMFAForAdmins: cfg.MFA.RequireForAdmins,
+	}
+
+	if cfg.ManageSieve.TLSCert != "" || cfg.ManageSieve.TLSKey != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.ManageSieve.TLSCert, cfg.ManageSieve.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	return server, nil
+}
+
+
+// ListenAndServe принимает соединения на addr до отмены ctx.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+
+// Serve обслуживает соединения listener до отмены ctx. После отмены новые
+// соединения не принимаются, а Serve дожидается завершения текущих сессий.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			listener.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				s.conns.Wait()
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+
+// Addr возвращает адрес, на котором сервер принимает соединения.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	sess := newSession(s, conn)
+	defer func() { sess.conn.Close() }()
+
+	// Соединение закрывается при остановке сервера
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sess.conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := sess.run(ctx); err != nil && ctx.Err() == nil && !isClosed(err) {
+		log.Printf("ManageSieve: сессия %s завершена с ошибкой: %v", conn.RemoteAddr(), err)
+	}
+}
+
+
+// isClosed сообщает, что сессия завершилась из-за закрытия соединения или
+// простоя клиента, а не из-за ошибки.
+func isClosed(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+
+func newSession(s *Server, conn net.Conn) *session {
+	_, secure := conn.(*tls.Conn)
+	return &session{
+		server: s,
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, maxLineLength),
+		writer: bufio.NewWriter(conn),
+		secure: secure,
+	}
+}
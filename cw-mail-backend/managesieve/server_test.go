@@ -0,0 +1,239 @@
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startTestServer(t *testing.T) (*gorm.DB, string) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.APIToken{}, &models.SieveScript{}); err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.ManageSieve.IdleTimeout = time.Minute
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), lockout.Policy{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      100,
+		Window:             time.Hour,
+		LockoutDuration:    time.Hour,
+	})
+	server, err := NewServer(db, cfg, guard, nil)
+	if err != nil {
+		t.Fatalf("Ошибка создания сервера: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Ошибка запуска сервера: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.Serve(ctx, listener)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return db, listener.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	client := &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	client.response()
+	return client
+}
+
+// response читает строки до ответа OK, NO или BYE и возвращает их.
+func (c *testClient) response() []string {
+	c.t.Helper()
+
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Ошибка чтения ответа: %v (прочитано %q)", err, lines)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		// Литерал {N} читается целиком вместе с закрывающим переводом строки
+		var size int
+		if _, err := fmt.Sscanf(line, "{%d}", &size); err == nil && strings.HasSuffix(line, "}") {
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(c.reader, buf); err != nil {
+				c.t.Fatalf("Ошибка чтения литерала: %v", err)
+			}
+			lines = append(lines, strings.TrimSuffix(string(buf), "\r\n"))
+		}
+
+		if strings.HasPrefix(line, "OK") || strings.HasPrefix(line, "NO") || strings.HasPrefix(line, "BYE") {
+			return lines
+		}
+	}
+}
+
+func (c *testClient) command(line string) []string {
+	c.t.Helper()
+
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.t.Fatalf("Ошибка отправки команды: %v", err)
+	}
+	return c.response()
+}
+
+func status(lines []string) string {
+	return lines[len(lines)-1]
+}
+
+func plain(account, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte("\x00" + account + "\x00" + password))
+}
+
+func TestCapabilities(t *testing.T) {
+	_, addr := startTestServer(t)
+	client := dial(t, addr)
+
+	lines := client.command("CAPABILITY")
+	capabilities := strings.Join(lines, "\n")
+	for _, want := range []string{`"SASL" "PLAIN"`, `"SIEVE" "fileinto reject envelope body vacation copy"`, `"VERSION" "1.0"`} {
+		if !strings.Contains(capabilities, want) {
+			t.Errorf("В возможностях нет %s: %q", want, lines)
+		}
+	}
+	if strings.Contains(capabilities, "STARTTLS") {
+		t.Errorf("Без сертификата STARTTLS не объявляется: %q", lines)
+	}
+
+	if got := status(client.command("LISTSCRIPTS")); !strings.HasPrefix(got, "NO") {
+		t.Errorf("Без входа команды со скриптами недоступны: %q", got)
+	}
+	if got := status(client.command("LOGOUT")); !strings.HasPrefix(got, "OK") {
+		t.Errorf("Неверный ответ на LOGOUT: %q", got)
+	}
+}
+
+func TestScriptCommands(t *testing.T) {
+	db, addr := startTestServer(t)
+	user, _ := models.CreateUser(db, "user@example.com", "password123")
+	client := dial(t, addr)
+
+	if got := status(client.command("AUTHENTICATE \"PLAIN\" \"" + plain(user.Email, "wrong") + "\"")); !strings.HasPrefix(got, "NO") {
+		t.Errorf("Вход с неверным паролем должен отклоняться: %q", got)
+	}
+
+	// Учетные данные после пустого запроса сервера
+	if _, err := client.conn.Write([]byte("AUTHENTICATE \"PLAIN\"\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := client.reader.ReadString('\n'); line != "\"\"\r\n" {
+		t.Fatalf("Ожидался пустой запрос сервера: %q", line)
+	}
+	if got := status(client.command("\"" + plain(user.Email, "password123") + "\"")); !strings.HasPrefix(got, "OK") {
+		t.Fatalf("Вход должен быть выполнен: %q", got)
+	}
+
+	script := "require \"fileinto\";\r\nif header :contains \"subject\" \"sale\" {\r\n  fileinto \"Junk\";\r\n}\r\n"
+	if got := status(client.command(fmt.Sprintf("PUTSCRIPT \"main\" {%d+}\r\n%s", len(script), script))); !strings.HasPrefix(got, "OK") {
+		t.Fatalf("Скрипт должен быть сохранен: %q", got)
+	}
+	invalid := "fileinto \"Junk\";"
+	if got := status(client.command(fmt.Sprintf("CHECKSCRIPT {%d+}\r\n%s", len(invalid), invalid))); !strings.HasPrefix(got, "NO") {
+		t.Errorf("Скрипт без require должен отклоняться: %q", got)
+	}
+	if got := status(client.command("HAVESPACE \"other\" 100000000")); !strings.HasPrefix(got, "NO (QUOTA/MAXSIZE)") {
+		t.Errorf("Ожидался отказ QUOTA/MAXSIZE: %q", got)
+	}
+
+	if got := status(client.command("SETACTIVE \"main\"")); !strings.HasPrefix(got, "OK") {
+		t.Fatalf("Скрипт должен стать активным: %q", got)
+	}
+	if lines := client.command("LISTSCRIPTS"); len(lines) != 2 || lines[0] != `"main" ACTIVE` {
+		t.Errorf("Неверный список скриптов: %q", lines)
+	}
+	if lines := client.command("GETSCRIPT \"main\""); len(lines) != 3 || lines[1] != script {
+		t.Errorf("Неверный текст скрипта: %q", lines)
+	}
+	if got := status(client.command("DELETESCRIPT \"main\"")); !strings.HasPrefix(got, "NO (ACTIVE)") {
+		t.Errorf("Активный скрипт нельзя удалить: %q", got)
+	}
+	if got := status(client.command("RENAMESCRIPT \"main\" \"filters\"")); !strings.HasPrefix(got, "OK") {
+		t.Errorf("Скрипт должен быть переименован: %q", got)
+	}
+	if got := status(client.command("GETSCRIPT \"main\"")); !strings.HasPrefix(got, "NO (NONEXISTENT)") {
+		t.Errorf("Ожидался ответ NONEXISTENT: %q", got)
+	}
+
+	active, _ := models.ActiveSieveScript(db, user.ID)
+	if active == nil || active.Name != "filters" {
+		t.Errorf("Переименованный скрипт должен остаться активным: %+v", active)
+	}
+}
+
+func TestLoginRequiresTokenWithMFA(t *testing.T) {
+	db, addr := startTestServer(t)
+	user, _ := models.CreateUser(db, "user@example.com", "password123")
+	db.Model(user).Update("mfa_enabled", true)
+	token, _, _ := models.CreateAPIToken(db, user.ID, "Thunderbird", []string{models.ScopeFiltersRead, models.ScopeFiltersWrite}, nil)
+	readOnly, _, _ := models.CreateAPIToken(db, user.ID, "Чтение", []string{models.ScopeFiltersRead}, nil)
+	client := dial(t, addr)
+
+	if got := status(client.command("AUTHENTICATE \"PLAIN\" \"" + plain("other@example.com", token) + "\"")); !strings.HasPrefix(got, "NO") {
+		t.Errorf("Токен подходит только для своей учетной записи: %q", got)
+	}
+	if got := status(client.command("AUTHENTICATE \"PLAIN\" \"" + plain(user.Email, token) + "\"")); !strings.HasPrefix(got, "OK") {
+		t.Fatalf("Вход с токеном должен быть выполнен: %q", got)
+	}
+
+	client = dial(t, addr)
+	if got := status(client.command("AUTHENTICATE \"PLAIN\" \"" + plain(user.Email, "password123") + "\"")); !strings.HasPrefix(got, "NO") {
+		t.Errorf("При включенной 2FA вход паролем запрещен: %q", got)
+	}
+	if got := status(client.command("AUTHENTICATE \"PLAIN\" \"" + plain(user.Email, readOnly) + "\"")); !strings.HasPrefix(got, "NO") {
+		t.Errorf("Токену нужна область filters:write: %q", got)
+	}
+
+	// Третья неудачная попытка подряд блокирует учетную запись
+	if got := status(client.command("AUTHENTICATE \"PLAIN\" \"" + plain(user.Email, "wrong") + "\"")); !strings.HasPrefix(got, "NO (TRYLATER)") {
+		t.Errorf("Ожидался ответ TRYLATER: %q", got)
+	}
+}
@@ -0,0 +1,564 @@
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mail-service/models"
+	"github.com/mail-service/sieve"
+	"gorm.io/gorm"
+)
+
+
+// maxLiteralSize ограничивает литерал {N+}: скрипт максимального размера с
+// запасом. На литерал большего размера сервер отвечает BYE.
+const maxLiteralSize = models.MaxSieveScriptSize + 1024
+
+
+// protocolError — ошибка в синтаксисе команды. На нее отвечают NO, сессия
+// продолжается.
+type protocolError string
+
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+
+var errLiteralTooLarge = errors.New("литерал превышает допустимый размер")
+
+
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	secure bool
+	user   *models.User
+}
+
+
+func (s *session) run(ctx context.Context) error {
+	s.writeCapabilities()
+	s.ok("", "ManageSieve готов к работе")
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		if s.server.IdleTimeout > 0 {
+			s.conn.SetDeadline(time.Now().Add(s.server.IdleTimeout))
+		}
+
+		words, err := s.readCommand()
+		var syntaxErr protocolError
+		switch {
+		case errors.As(err, &syntaxErr):
+			s.no("", syntaxErr.Error())
+		case errors.Is(err, errLiteralTooLarge):
+			s.bye("", err.Error())
+			return s.writer.Flush()
+		case err != nil:
+			return err
+		case len(words) == 0:
+			s.no("", "пустая команда")
+		default:
+			done, err := s.dispatch(ctx, strings.ToUpper(words[0]), words[1:])
+			if err != nil {
+				return err
+			}
+			if done {
+				return s.writer.Flush()
+			}
+		}
+
+		if err := s.writer.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+
+// dispatch выполняет команду и сообщает, нужно ли закрыть соединение.
+func (s *session) dispatch(ctx context.Context, name string, args []string) (bool, error) {
+	switch name {
+	case "CAPABILITY":
+		if s.checkArgs(args, 0) {
+			s.writeCapabilities()
+			s.ok("", "готово")
+		}
+		return false, nil
+	case "LOGOUT":
+		s.ok("", "до свидания")
+		return true, nil
+	case "NOOP":
+		if len(args) == 1 {
+			s.ok("TAG "+quote(args[0]), "готово")
+		} else if s.checkArgs(args, 0) {
+			s.ok("", "готово")
+		}
+		return false, nil
+	case "STARTTLS":
+		return false, s.startTLS(args)
+	case "AUTHENTICATE":
+		return false, s.authenticate(ctx, args)
+	}
+
+	if s.user == nil {
+		s.no("", "сначала выполните вход командой AUTHENTICATE")
+		return false, nil
+	}
+
+	db := s.server.DB.WithContext(ctx)
+	switch name {
+	case "LISTSCRIPTS":
+		s.listScripts(db, args)
+	case "GETSCRIPT":
+		s.getScript(db, args)
+	case "PUTSCRIPT":
+		if s.checkArgs(args, 2) {
+			_, err := models.PutSieveScript(db, s.user.ID, args[0], args[1])
+			s.respond(err, "скрипт сохранен")
+		}
+	case "CHECKSCRIPT":
+		if s.checkArgs(args, 1) {
+			_, err := models.ValidateSieveScript(args[0])
+			s.respond(err, "скрипт корректен")
+		}
+	case "HAVESPACE":
+		s.haveSpace(db, args)
+	case "SETACTIVE":
+		s.setActive(db, args)
+	case "DELETESCRIPT":
+		if s.checkArgs(args, 1) {
+			script, err := models.FindSieveScript(db, s.user.ID, args[0])
+			if err == nil {
+				err = models.DeleteSieveScript(db, script.ID, s.user.ID)
+			}
+			s.respond(err, "скрипт удален")
+		}
+	case "RENAMESCRIPT":
+		if s.checkArgs(args, 2) {
+			script, err := models.FindSieveScript(db, s.user.ID, args[0])
+			if err == nil {
+				err = models.UpdateSieveScript(db, script, args[1], script.Content)
+			}
+			s.respond(err, "скрипт переименован")
+		}
+	default:
+		s.no("", "неизвестная команда "+name)
+	}
+	return false, nil
+}
+
+
+func (s *session) checkArgs(args []string, count int) bool {
+	if len(args) != count {
+		s.no("", "неверное количество аргументов")
+		return false
+	}
+	return true
+}
+
+
+func (s *session) capabilities() [][2]string {
+	sasl := "PLAIN"
+	if s.server.TLSConfig != nil && !s.secure {
+		sasl = ""
+	}
+
+	capabilities := [][2]string{
+		{"IMPLEMENTATION", Implementation},
+		{"SIEVE", strings.Join(sieve.Extensions, " ")},
+		{"SASL", sasl},
+	}
+	if s.server.TLSConfig != nil && !s.secure {
+		capabilities = append(capabilities, [2]string{"STARTTLS", ""})
+	}
+	capabilities = append(capabilities,
+		[2]string{"MAXREDIRECTS", strconv.Itoa(sieve.MaxRedirects)},
+		[2]string{"VERSION", "1.0"},
+	)
+	if s.user != nil {
+		capabilities = append(capabilities, [2]string{"OWNER", s.user.Email})
+	}
+	return capabilities
+}
+
+
+func (s *session) writeCapabilities() {
+	for _, capability := range s.capabilities() {
+		if capability[1] == "" && capability[0] != "SASL" {
+			s.writeLine(quote(capability[0]))
+			continue
+		}
+		s.writeLine(quote(capability[0]) + " " + quote(capability[1]))
+	}
+}
+
+
+// startTLS переводит соединение на TLS и заново отправляет возможности
+// сервера (RFC 5804, 2.2).
+func (s *session) startTLS(args []string) error {
+	if !s.checkArgs(args, 0) {
+		return nil
+	}
+	if s.server.TLSConfig == nil || s.secure {
+		s.no("", "STARTTLS недоступен")
+		return nil
+	}
+
+	s.ok("", "начинайте согласование TLS")
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	conn := tls.Server(s.conn, s.server.TLSConfig)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReaderSize(conn, maxLineLength)
+	s.writer = bufio.NewWriter(conn)
+	s.secure = true
+
+	s.writeCapabilities()
+	s.ok("", "TLS установлен")
+	return nil
+}
+
+
+// authenticate выполняет вход механизмом SASL PLAIN (RFC 4616). Начальный
+// ответ клиента может прийти вместе с командой или после пустого запроса
+// сервера.
+func (s *session) authenticate(ctx context.Context, args []string) error {
+	if s.user != nil {
+		s.no("", "вход уже выполнен")
+		return nil
+	}
+	if s.server.TLSConfig != nil && !s.secure {
+		s.no("ENCRYPT-NEEDED", "сначала выполните STARTTLS")
+		return nil
+	}
+	if len(args) == 0 || len(args) > 2 {
+		s.no("", "неверное количество аргументов")
+		return nil
+	}
+	if !strings.EqualFold(args[0], "PLAIN") {
+		s.no("", "поддерживается только механизм PLAIN")
+		return nil
+	}
+
+	encoded := ""
+	if len(args) == 2 {
+		encoded = args[1]
+	} else {
+		s.writeLine(`""`)
+		if err := s.writer.Flush(); err != nil {
+			return err
+		}
+
+		words, err := s.readCommand()
+		var syntaxErr protocolError
+		if errors.As(err, &syntaxErr) || (err == nil && len(words) != 1) {
+			s.no("", "неверный ответ клиента")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		encoded = words[0]
+	}
+	if encoded == "*" {
+		s.no("", "вход отменен")
+		return nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	parts := strings.Split(string(raw), "\x00")
+	if err != nil || len(parts) != 3 {
+		s.no("", "неверный формат учетных данных")
+		return nil
+	}
+	authzid, authcid, password := parts[0], parts[1], parts[2]
+	if authzid != "" && !strings.EqualFold(authzid, authcid) {
+		s.no("", "вход от имени другого пользователя не поддерживается")
+		return nil
+	}
+
+	ip, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	user, err := s.server.login(ctx, authcid, password, ip)
+	switch {
+	case errors.Is(err, errLoginThrottled):
+		s.no("TRYLATER", err.Error())
+	case errors.Is(err, errInvalidCredentials):
+		s.no("", err.Error())
+	case err != nil:
+		log.Printf("ManageSieve: ошибка входа: %v", err)
+		s.no("", "внутренняя ошибка сервера")
+	default:
+		s.user = user
+		s.ok("", "вход выполнен")
+	}
+	return nil
+}
+
+
+func (s *session) listScripts(db *gorm.DB, args []string) {
+	if !s.checkArgs(args, 0) {
+		return
+	}
+
+	scripts, err := models.ListSieveScripts(db, s.user.ID)
+	if err != nil {
+		s.respond(err, "")
+		return
+	}
+	for _, script := range scripts {
+		line := quote(script.Name)
+		if script.Active {
+			line += " ACTIVE"
+		}
+		s.writeLine(line)
+	}
+	s.ok("", "готово")
+}
+
+
+func (s *session) getScript(db *gorm.DB, args []string) {
+	if !s.checkArgs(args, 1) {
+		return
+	}
+
+	script, err := models.FindSieveScript(db, s.user.ID, args[0])
+	if err != nil {
+		s.respond(err, "")
+		return
+	}
+	s.writeLine(literal(script.Content))
+	s.ok("", "готово")
+}
+
+
+func (s *session) haveSpace(db *gorm.DB, args []string) {
+	if !s.checkArgs(args, 2) {
+		return
+	}
+
+	size, err := strconv.Atoi(args[1])
+	if err != nil || size < 0 {
+		s.no("", "неверный размер скрипта")
+		return
+	}
+	s.respond(models.CheckSieveSpace(db, s.user.ID, args[0], size), "место есть")
+}
+
+
+// setActive делает скрипт активным; пустое имя отключает все скрипты.
+func (s *session) setActive(db *gorm.DB, args []string) {
+	if !s.checkArgs(args, 1) {
+		return
+	}
+
+	var scriptID uint
+	if args[0] != "" {
+		script, err := models.FindSieveScript(db, s.user.ID, args[0])
+		if err != nil {
+			s.respond(err, "")
+			return
+		}
+		scriptID = script.ID
+	}
+	s.respond(models.ActivateSieveScript(db, s.user.ID, scriptID), "активный скрипт изменен")
+}
+
+
+// respond отвечает OK или NO с кодом ответа, соответствующим ошибке.
+func (s *session) respond(err error, message string) {
+	switch {
+	case err == nil:
+		s.ok("", message)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		s.no("NONEXISTENT", "скрипт не найден")
+	case errors.Is(err, models.ErrSieveScriptExists):
+		s.no("ALREADYEXISTS", err.Error())
+	case errors.Is(err, models.ErrSieveScriptActive):
+		s.no("ACTIVE", err.Error())
+	case errors.Is(err, models.ErrSieveLimitReached):
+		s.no("QUOTA/MAXSCRIPTS", err.Error())
+	case errors.Is(err, models.ErrSieveScriptTooLarge):
+		s.no("QUOTA/MAXSIZE", err.Error())
+	case errors.Is(err, models.ErrInvalidSieveScript),
+		errors.Is(err, models.ErrInvalidSieveName):
+		s.no("", err.Error())
+	default:
+		log.Printf("ManageSieve: ошибка команды: %v", err)
+		s.no("", "внутренняя ошибка сервера")
+	}
+}
+
+
+func (s *session) ok(code, message string) {
+	s.status("OK", code, message)
+}
+
+
+func (s *session) no(code, message string) {
+	s.status("NO", code, message)
+}
+
+
+func (s *session) bye(code, message string) {
+	s.status("BYE", code, message)
+}
+
+
+func (s *session) status(kind, code, message string) {
+	line := kind
+	if code != "" {
+		line += " (" + code + ")"
+	}
+	if message != "" {
+		line += " " + quote(message)
+	}
+	s.writeLine(line)
+}
+
+
+func (s *session) writeLine(line string) {
+	s.writer.WriteString(line)
+	s.writer.WriteString("\r\n")
+}
+
+
+// quote записывает строку в кавычках или литералом, если в ней есть переводы
+// строк.
+func quote(value string) string {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return literal(value)
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+
+func literal(value string) string {
+	return fmt.Sprintf("{%d}\r\n%s", len(value), value)
+}
+
+
+// readLine читает строку до CRLF. Слишком длинная строка пропускается.
+func (s *session) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = s.reader.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", protocolError("слишком длинная строка команды")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+
+// readCommand читает команду: атомы, строки в кавычках и литералы {N+}
+// (RFC 5804, 4). Синхронизирующие литералы {N} тоже принимаются, но
+// продолжение сервер не отправляет.
+func (s *session) readCommand() ([]string, error) {
+	line, err := s.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return words, nil
+		}
+
+		switch line[0] {
+		case '"':
+			value, rest, err := parseQuoted(line)
+			if err != nil {
+				return nil, err
+			}
+			words = append(words, value)
+			line = rest
+
+		case '{':
+			size, err := parseLiteralSize(line)
+			if err != nil {
+				return nil, err
+			}
+			if size > maxLiteralSize {
+				return nil, errLiteralTooLarge
+			}
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(s.reader, buf); err != nil {
+				return nil, err
+			}
+			words = append(words, string(buf))
+
+			if line, err = s.readLine(); err != nil {
+				return nil, err
+			}
+
+		default:
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			words = append(words, line[:end])
+			line = line[end:]
+		}
+	}
+}
+
+
+func parseQuoted(line string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(line); i++ {
+		switch c := line[i]; c {
+		case '"':
+			return b.String(), line[i+1:], nil
+		case '\\':
+			i++
+			if i < len(line) {
+				b.WriteByte(line[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", protocolError("незакрытая строка в кавычках")
+}
+
+
+// parseLiteralSize разбирает заголовок литерала, которым должна
+// заканчиваться строка: {N+} или {N}.
+func parseLiteralSize(line string) (int, error) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, protocolError("неверный литерал")
+	}
+	digits := strings.TrimSuffix(strings.TrimSuffix(line[1:], "}"), "+")
+	size, err := strconv.Atoi(digits)
+	if err != nil || size < 0 {
+		return 0, protocolError("неверный литерал")
+	}
+	return size, nil
+}
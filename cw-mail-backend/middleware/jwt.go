@@ -14,6 +14,11 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	AuthTypeJWT      = "jwt"
+	AuthTypeAPIToken = "api_token"
+)
+
 type JWTClaims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
@@ -38,6 +43,12 @@ func JWTAuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+
+		if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			authenticateAPIToken(c, db, tokenString)
+			return
+		}
+
 		claims := &JWTClaims{}
 
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -57,7 +68,7 @@ func JWTAuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if !token.Valid {
+		if !token.Valid || len(claims.Audience) > 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный токен"})
 			c.Abort()
 			return
@@ -82,10 +93,145 @@ func JWTAuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if user.IsDisabled() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись отключена"})
+			c.Abort()
+			return
+		}
+
+		if claims.IssuedAt == nil || !user.SessionValidAt(claims.IssuedAt.Time) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "сессия отозвана, войдите снова"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_role", claims.Role)
 		c.Set("user", user)
+		c.Set("auth_type", AuthTypeJWT)
+		c.Set("token_issued_at", claims.IssuedAt.Time)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
+
+		c.Next()
+	}
+}
+
+func authenticateAPIToken(c *gin.Context, db *gorm.DB, tokenString string) {
+	apiToken, err := models.AuthenticateAPIToken(db, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный токен"})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, apiToken.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не найден"})
+		c.Abort()
+		return
+	}
+
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись отключена"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("user_email", user.Email)
+	c.Set("user_role", user.Role)
+	c.Set("user", user)
+	c.Set("auth_type", AuthTypeAPIToken)
+	c.Set("api_token", *apiToken)
+	if apiToken.ExpiresAt != nil {
+		c.Set("token_expires_at", *apiToken.ExpiresAt)
+	}
+
+	c.Next()
+}
+
+// SessionActive повторно проверяет учетные данные уже аутентифицированного
+// запроса: срок токена не истек, сессии не отозваны, токен доступа не отозван,
+// учетная запись не отключена и не требует смены пароля. Нужна долгим
+// соединениям, которые проходят JWTAuthMiddleware только при подключении.
+func SessionActive(c *gin.Context, db *gorm.DB) bool {
+	if expiresAt := c.GetTime("token_expires_at"); !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return false
+	}
+
+	var user models.User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		return false
+	}
+	if user.IsDisabled() || user.PasswordResetRequired || user.Role != c.GetString("user_role") {
+		return false
+	}
+
+	switch c.GetString("auth_type") {
+	case AuthTypeJWT:
+		return user.SessionValidAt(c.GetTime("token_issued_at"))
+	case AuthTypeAPIToken:
+		value, _ := c.Get("api_token")
+		apiToken, ok := value.(models.APIToken)
+		if !ok {
+			return false
+		}
+		var current models.APIToken
+		if err := db.First(&current, apiToken.ID).Error; err != nil {
+			return false
+		}
+		return current.IsActive()
+	}
+	return true
+}
+
+// TokenFromQuery переносит токен из параметра запроса в заголовок
+// Authorization, если заголовок не задан. Нужен для WebSocket и EventSource:
+// браузер не позволяет задать для них заголовки. Чтобы токен не попадал в
+// журнал запросов, используйте RedactedLogger с тем же параметром.
+func TokenFromQuery(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query(param); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope пропускает запросы с JWT без ограничений, а для токенов
+// доступа требует наличия указанной области.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_type") != AuthTypeAPIToken {
+			c.Next()
+			return
+		}
+
+		value, _ := c.Get("api_token")
+		apiToken, ok := value.(models.APIToken)
+		if !ok || !apiToken.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "токен не имеет доступа к этому ресурсу", "required_scope": scope})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSessionAuth запрещает доступ по токенам доступа. Используется для
+// управления учетной записью и самими токенами.
+func RequireSessionAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_type") == AuthTypeAPIToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "действие недоступно для токенов доступа"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
@@ -119,6 +265,26 @@ func RequireRole(allowedRoles ...string) gin.HandlerFunc {
 	}
 }
 
+// RequirePasswordCurrent блокирует доступ, пока администратор требует смены пароля.
+func RequirePasswordCurrent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetCurrentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+			c.Abort()
+			return
+		}
+
+		if user.PasswordResetRequired {
+			c.JSON(http.StatusForbidden, gin.H{"error": "необходимо сменить пароль", "password_reset_required": true})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func RequireAdmin() gin.HandlerFunc {
 	return RequireRole(models.RoleAdmin)
 }
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RedactedLogger пишет журнал запросов в формате gin.Logger, заменяя значения
+// перечисленных параметров запроса. Токены, переданные в URL (access_token
+// для EventSource и WebSocket), иначе попадали бы в журнал открытым текстом.
+func RedactedLogger(params ...string) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: func(param gin.LogFormatterParams) string {
+			if param.Latency > time.Minute {
+				param.Latency = param.Latency.Truncate(time.Second)
+			}
+			return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+				param.StatusCode,
+				param.Latency,
+				param.ClientIP,
+				param.Method,
+				redactQuery(param.Path, params),
+				param.ErrorMessage,
+			)
+		},
+	})
+}
+
+func redactQuery(path string, params []string) string {
+	base, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Параметры не разобрать надежно, поэтому строка запроса не пишется целиком
+		return base
+	}
+
+	redacted := false
+	for _, param := range params {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return path
+	}
+	return base + "?" + query.Encode()
+}
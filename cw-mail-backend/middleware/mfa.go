@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+)
+
+const (
+	MFAChallengeAudience = "mfa_challenge"
+
+	MFAPurposeLogin  = "login"
+	MFAPurposeEnroll = "enroll"
+)
+
+// MFAChallengeClaims описывает промежуточный токен, который выдается после
+// проверки пароля. Его нельзя использовать для доступа к API, только для
+// обмена на полноценный JWT вместе с кодом второго фактора.
+type MFAChallengeClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+func GenerateMFAChallengeToken(user *models.User, purpose string, cfg *config.Config) (string, error) {
+	now := time.Now()
+
+	claims := &MFAChallengeClaims{
+		UserID:  user.ID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{MFAChallengeAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.MFA.ChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(cfg.JWT.Secret))
+}
+
+func ParseMFAChallengeToken(tokenString, purpose string, cfg *config.Config) (*MFAChallengeClaims, error) {
+	claims := &MFAChallengeClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
+		}
+		return []byte(cfg.JWT.Secret), nil
+	}, jwt.WithAudience(MFAChallengeAudience))
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, errors.New("недействительный токен подтверждения входа")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail запрещает действие пользователям с неподтвержденным email.
+// При enabled == false middleware ничего не проверяет.
+func RequireVerifiedEmail(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		user, err := GetCurrentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+			c.Abort()
+			return
+		}
+
+		if !user.EmailVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "необходимо подтвердить адрес электронной почты"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Уже зарегистрированные пользователи считаются подтвержденными
+UPDATE users SET email_verified = TRUE, email_verified_at = now();
+
+CREATE TABLE email_verifications (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash VARCHAR(64) UNIQUE NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_email_verifications_user_id ON email_verifications(user_id);
+CREATE INDEX idx_email_verifications_created_at ON email_verifications(created_at);
+
+-- +goose Down
+DROP TABLE email_verifications;
+ALTER TABLE users
+  DROP COLUMN email_verified,
+  DROP COLUMN email_verified_at;
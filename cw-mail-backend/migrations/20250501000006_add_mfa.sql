@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN mfa_secret VARCHAR(64) DEFAULT '',
+  ADD COLUMN mfa_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE mfa_recovery_codes (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+-- +goose Down
+DROP TABLE mfa_recovery_codes;
+ALTER TABLE users
+  DROP COLUMN mfa_enabled,
+  DROP COLUMN mfa_secret,
+  DROP COLUMN mfa_last_step;
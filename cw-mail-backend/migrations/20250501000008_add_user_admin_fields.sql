@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN sessions_revoked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE audit_logs (
+  id SERIAL PRIMARY KEY,
+  actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+  action VARCHAR(100) NOT NULL,
+  target_type VARCHAR(50),
+  target_id INT,
+  details TEXT,
+  ip VARCHAR(64),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_audit_logs_actor_id ON audit_logs(actor_id);
+CREATE INDEX idx_audit_logs_action ON audit_logs(action);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
+
+-- +goose Down
+DROP TABLE audit_logs;
+ALTER TABLE users
+  DROP COLUMN disabled_at,
+  DROP COLUMN password_reset_required,
+  DROP COLUMN sessions_revoked_at;
@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE audit_logs
+  ADD COLUMN user_agent TEXT;
+
+-- Журнал должен сохранять ID пользователя и после удаления учетной записи
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS audit_logs_actor_id_fkey;
+
+CREATE INDEX idx_audit_logs_target ON audit_logs(target_type, target_id);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_logs_no_update_delete
+  BEFORE UPDATE OR DELETE ON audit_logs
+  FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+
+CREATE TRIGGER audit_logs_no_truncate
+  BEFORE TRUNCATE ON audit_logs
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only();
+
+-- +goose Down
+DROP TRIGGER audit_logs_no_truncate ON audit_logs;
+DROP TRIGGER audit_logs_no_update_delete ON audit_logs;
+DROP FUNCTION audit_logs_append_only();
+DROP INDEX idx_audit_logs_target;
+ALTER TABLE audit_logs
+  ADD CONSTRAINT audit_logs_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE audit_logs
+  DROP COLUMN user_agent;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN avatar_path VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT 'ru',
+  ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+  DROP COLUMN display_name,
+  DROP COLUMN avatar_path,
+  DROP COLUMN timezone,
+  DROP COLUMN locale,
+  DROP COLUMN signature;
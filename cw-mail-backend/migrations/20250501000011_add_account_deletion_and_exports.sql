@@ -0,0 +1,41 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN deletion_scheduled_at TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN anonymized_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Учетные записи больше не удаляются, а анонимизируются. Каскадное удаление
+-- стерло бы письма, которые пользователь отправил другим, поэтому запрещаем его.
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_sender_id_fkey;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_receiver_id_fkey;
+ALTER TABLE messages
+  ADD CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE RESTRICT,
+  ADD CONSTRAINT messages_receiver_id_fkey FOREIGN KEY (receiver_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+CREATE TABLE data_exports (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  file_path VARCHAR(255),
+  size BIGINT,
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  completed_at TIMESTAMP WITH TIME ZONE,
+  expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id);
+CREATE INDEX idx_data_exports_expires_at ON data_exports(expires_at);
+
+-- +goose Down
+DROP TABLE data_exports;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_sender_id_fkey;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_receiver_id_fkey;
+ALTER TABLE messages
+  ADD CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+  ADD CONSTRAINT messages_receiver_id_fkey FOREIGN KEY (receiver_id) REFERENCES users(id) ON DELETE CASCADE;
+DROP INDEX idx_users_deletion_scheduled_at;
+ALTER TABLE users
+  DROP COLUMN deletion_scheduled_at,
+  DROP COLUMN anonymized_at;
@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE contacts (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  email VARCHAR(255) NOT NULL,
+  name VARCHAR(200) NOT NULL DEFAULT '',
+  phone VARCHAR(50) NOT NULL DEFAULT '',
+  organization VARCHAR(200) NOT NULL DEFAULT '',
+  notes TEXT NOT NULL DEFAULT '',
+  auto BOOLEAN NOT NULL DEFAULT FALSE,
+  contact_count INT NOT NULL DEFAULT 0,
+  last_contacted_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_contacts_user_email ON contacts(user_id, email);
+CREATE INDEX idx_contacts_user_count ON contacts(user_id, contact_count DESC);
+
+CREATE TABLE contact_groups (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_contact_groups_user_name ON contact_groups(user_id, name);
+
+CREATE TABLE contact_group_members (
+  contact_id INT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+  contact_group_id INT NOT NULL REFERENCES contact_groups(id) ON DELETE CASCADE,
+  PRIMARY KEY (contact_id, contact_group_id)
+);
+
+CREATE INDEX idx_contact_group_members_group ON contact_group_members(contact_group_id);
+
+-- +goose Down
+DROP TABLE contact_group_members;
+DROP TABLE contact_groups;
+DROP TABLE contacts;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE distribution_lists (
+  id SERIAL PRIMARY KEY,
+  address VARCHAR(255) UNIQUE NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  post_policy VARCHAR(20) NOT NULL DEFAULT 'members',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_distribution_lists_owner_id ON distribution_lists(owner_id);
+
+CREATE TABLE distribution_list_members (
+  list_id INT NOT NULL REFERENCES distribution_lists(id) ON DELETE CASCADE,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX idx_distribution_list_members_user_id ON distribution_list_members(user_id);
+
+-- Копии писем, доставленные через список рассылки
+ALTER TABLE messages ADD COLUMN list_address VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX idx_messages_list_address ON messages(list_address);
+
+-- +goose Down
+DROP INDEX idx_messages_list_address;
+ALTER TABLE messages DROP COLUMN list_address;
+DROP TABLE distribution_list_members;
+DROP TABLE distribution_lists;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE email_aliases (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  address VARCHAR(255) UNIQUE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_email_aliases_user_id ON email_aliases(user_id);
+
+-- Индивидуальная квота псевдонимов; NULL означает значение по умолчанию
+ALTER TABLE users ADD COLUMN alias_quota INT;
+
+-- Адреса, с которого и на который отправлено письмо (основной или псевдоним)
+ALTER TABLE messages ADD COLUMN sender_address VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN recipient_address VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX idx_messages_recipient_address ON messages(recipient_address);
+
+UPDATE messages SET sender_address = users.email FROM users WHERE users.id = messages.sender_id;
+UPDATE messages SET recipient_address = CASE
+    WHEN messages.list_address <> '' THEN messages.list_address
+    ELSE LOWER(users.email)
+  END
+  FROM users WHERE users.id = messages.receiver_id;
+
+-- +goose Down
+DROP INDEX idx_messages_recipient_address;
+ALTER TABLE messages DROP COLUMN recipient_address;
+ALTER TABLE messages DROP COLUMN sender_address;
+ALTER TABLE users DROP COLUMN alias_quota;
+DROP TABLE email_aliases;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE blocked_senders (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  pattern VARCHAR(255) NOT NULL,
+  kind VARCHAR(10) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_blocked_senders_user_pattern ON blocked_senders(user_id, pattern);
+
+-- Письма от заблокированных отправителей: spam — в спам, reject — отказ
+ALTER TABLE users ADD COLUMN block_action VARCHAR(10) NOT NULL DEFAULT 'spam';
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN block_action;
+DROP TABLE blocked_senders;
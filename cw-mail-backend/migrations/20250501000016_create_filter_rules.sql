@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE filter_rules (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  position INT NOT NULL DEFAULT 0,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  match_all BOOLEAN NOT NULL DEFAULT TRUE,
+  stop_processing BOOLEAN NOT NULL DEFAULT FALSE,
+  conditions TEXT NOT NULL,
+  actions TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_filter_rules_user_id ON filter_rules(user_id);
+
+ALTER TABLE messages ADD COLUMN is_starred BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN is_starred;
+DROP TABLE filter_rules;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE sieve_scripts (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(128) NOT NULL,
+  content TEXT NOT NULL,
+  active BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_sieve_scripts_user_name ON sieve_scripts(user_id, name);
+CREATE UNIQUE INDEX idx_sieve_scripts_user_active ON sieve_scripts(user_id) WHERE active;
+
+CREATE TABLE auto_replies (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  sender VARCHAR(255) NOT NULL,
+  handle VARCHAR(255) NOT NULL,
+  sent_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_auto_replies_user_sender_handle ON auto_replies(user_id, sender, handle);
+
+ALTER TABLE messages ADD COLUMN auto_submitted VARCHAR(50) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN auto_submitted;
+DROP TABLE auto_replies;
+DROP TABLE sieve_scripts;
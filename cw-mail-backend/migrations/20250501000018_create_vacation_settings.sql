@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE vacation_settings (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  starts_at TIMESTAMP WITH TIME ZONE,
+  ends_at TIMESTAMP WITH TIME ZONE,
+  subject VARCHAR(200) NOT NULL DEFAULT '',
+  body TEXT NOT NULL DEFAULT '',
+  only_contacts BOOLEAN NOT NULL DEFAULT FALSE,
+  interval_days INT NOT NULL DEFAULT 7,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE vacation_settings;
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE spam_settings (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  threshold DOUBLE PRECISION NOT NULL DEFAULT 0.9,
+  spam_messages INT NOT NULL DEFAULT 0,
+  ham_messages INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE spam_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token VARCHAR(255) NOT NULL,
+  spam INT NOT NULL DEFAULT 0,
+  ham INT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX idx_spam_tokens_user_token ON spam_tokens(user_id, token);
+
+ALTER TABLE messages ADD COLUMN spam_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN spam_trained VARCHAR(10) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN spam_trained;
+ALTER TABLE messages DROP COLUMN spam_score;
+DROP TABLE spam_tokens;
+DROP TABLE spam_settings;
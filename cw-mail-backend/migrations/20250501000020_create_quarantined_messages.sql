@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE quarantined_messages (
+  id SERIAL PRIMARY KEY,
+  sender_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  from_address VARCHAR(255) NOT NULL DEFAULT '',
+  to_address VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL DEFAULT '',
+  body TEXT NOT NULL DEFAULT '',
+  read_limit INT NOT NULL DEFAULT 0,
+  scanner VARCHAR(50) NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  reviewed_by_id INT REFERENCES users(id) ON DELETE SET NULL,
+  reviewed_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_quarantined_messages_sender_id ON quarantined_messages(sender_id);
+CREATE INDEX idx_quarantined_messages_status ON quarantined_messages(status);
+
+-- +goose Down
+DROP TABLE quarantined_messages;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE outbox_events (
+  id BIGSERIAL PRIMARY KEY,
+  routing_key VARCHAR(255) NOT NULL,
+  payload TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  published_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_outbox_events_next_attempt_at ON outbox_events(next_attempt_at);
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at);
+
+-- +goose Down
+DROP TABLE outbox_events;
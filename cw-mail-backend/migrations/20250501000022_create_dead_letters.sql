@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE dead_letters (
+  id SERIAL PRIMARY KEY,
+  queue VARCHAR(255) NOT NULL,
+  routing_key VARCHAR(255) NOT NULL,
+  message_id VARCHAR(255) NOT NULL DEFAULT '',
+  payload TEXT NOT NULL DEFAULT '',
+  reason VARCHAR(50) NOT NULL DEFAULT '',
+  last_error TEXT NOT NULL DEFAULT '',
+  attempts INT NOT NULL DEFAULT 0,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  resolved_by_id INT REFERENCES users(id) ON DELETE SET NULL,
+  resolved_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_dead_letters_queue ON dead_letters(queue);
+CREATE INDEX idx_dead_letters_message_id ON dead_letters(message_id);
+CREATE INDEX idx_dead_letters_status ON dead_letters(status);
+
+-- +goose Down
+DROP TABLE dead_letters;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Отметка отправителя хранится отдельно от отметки получателя (is_starred).
+-- Прежняя общая отметка копируется обеим сторонам, чтобы никто ее не потерял
+ALTER TABLE messages ADD COLUMN sender_starred BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE messages SET sender_starred = is_starred;
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN sender_starred;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Письмо заблокированного отправителя при действии reject сохраняется только
+-- для отправителя: оно есть в его отправленных, но получатель его не видит
+ALTER TABLE messages ADD COLUMN dropped BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN dropped;
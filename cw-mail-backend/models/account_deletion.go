@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+const DeletedUserName = "Удаленный пользователь"
+
+
+var (
+	ErrDeletionAlreadyScheduled = errors.New("удаление учетной записи уже запланировано")
+	ErrDeletionNotScheduled     = errors.New("удаление учетной записи не запланировано")
+)
+
+
+func (u *User) IsAnonymized() bool {
+	return u.AnonymizedAt != nil
+}
+
+
+func ScheduleAccountDeletion(db *gorm.DB, user *User, grace time.Duration) error {
+	if user.DeletionScheduledAt != nil {
+		return ErrDeletionAlreadyScheduled
+	}
+
+	at := time.Now().Add(grace)
+	if err := db.Model(user).Update("deletion_scheduled_at", at).Error; err != nil {
+		return err
+	}
+
+	user.DeletionScheduledAt = &at
+	return nil
+}
+
+
+func CancelAccountDeletion(db *gorm.DB, user *User) error {
+	if user.DeletionScheduledAt == nil {
+		return ErrDeletionNotScheduled
+	}
+
+	if err := db.Model(user).Update("deletion_scheduled_at", nil).Error; err != nil {
+		return err
+	}
+
+	user.DeletionScheduledAt = nil
+	return nil
+}
+
+
+// DueAccountDeletions возвращает учетные записи, у которых истек период
+// ожидания удаления.
+func DueAccountDeletions(db *gorm.DB, now time.Time) ([]User, error) {
+	var users []User
+	err := db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ? AND anonymized_at IS NULL", now).
+		Find(&users).Error
+	return users, err
+}
+
+
+// AnonymizeUser удаляет персональные данные пользователя, сохраняя строку
+// учетной записи, чтобы письма, которые он отправил другим, остались у
+// получателей с отправителем «Удаленный пользователь». Письмо хранится одной
+// строкой у отправителя и получателя, поэтому полученные пользователем письма
+// остаются в «Отправленных» у авторов с получателем «Удаленный пользователь»;
+// удаляются только письма, у которых не осталось других владельцев.
+// Адресная книга, списки рассылки, токены, коды, выгрузки и вебхуки удаляются.
+// Последнего действующего администратора удалить нельзя: ErrLastAdmin
+// проверяется в той же транзакции.
+// Возвращает состояние учетной записи до анонимизации, чтобы вызывающий код
+// мог удалить файлы (аватар, архивы выгрузок).
+func AnonymizeUser(db *gorm.DB, userID uint) (*User, error) {
+	var previous User
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&previous, userID).Error; err != nil {
+			return err
+		}
+		if previous.IsAnonymized() {
+			return gorm.ErrRecordNotFound
+		}
+		if err := EnsureAdminRemains(tx, userID); err != nil {
+			return err
+		}
+
+		if err := detachUserMessages(tx, userID); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&EmailVerification{}, &MFARecoveryCode{}, &APIToken{}, &DataExport{}, &EmailAlias{}, &BlockedSender{}, &FilterRule{}, &SieveScript{}, &AutoReply{}, &VacationSettings{}, &SpamSettings{}, &SpamToken{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("sender_id = ?", userID).Delete(&QuarantinedMessage{}).Error; err != nil {
+			return err
+		}
+		if err := deleteUserContacts(tx, userID); err != nil {
+			return err
+		}
+		if err := deleteUserDistributionLists(tx, userID); err != nil {
+			return err
+		}
+		if err := deleteUserWebhooks(tx, userID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		email := deletedUserEmail(userID)
+		return tx.Model(&User{ID: userID}).Updates(map[string]interface{}{
+			"email":                   email,
+			"encrypted_password":      "!",
+			"role":                    RoleUser,
+			"email_verified":          false,
+			"email_verified_at":       nil,
+			"mfa_enabled":             false,
+			"mfa_secret":              "",
+			"display_name":            DeletedUserName,
+			"avatar_path":             "",
+			"signature":               "",
+			"password_reset_required": false,
+			"disabled_at":             now,
+			"sessions_revoked_at":     now,
+			"deletion_scheduled_at":   nil,
+			"anonymized_at":           now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &previous, nil
+}
+
+
+func deletedUserEmail(userID uint) string {
+	return fmt.Sprintf("deleted-%d@deleted.invalid", userID)
+}
+
+
+// detachUserMessages удаляет письма, которые после удаления пользователя
+// никому не принадлежат (письма самому себе, переписку с уже удаленными
+// пользователями и его письма, отброшенные блокировкой), а в остальных заменяет его адрес заглушкой. Оценка
+// спам-фильтра получателя — его данные — сбрасывается.
+func detachUserMessages(tx *gorm.DB, userID uint) error {
+	anonymized := tx.Model(&User{}).Select("id").Where("anonymized_at IS NOT NULL")
+	err := tx.Where("(sender_id = ? AND (receiver_id = ? OR receiver_id IN (?) OR dropped = ?)) OR (receiver_id = ? AND sender_id IN (?))",
+		userID, userID, anonymized, true, userID, anonymized).
+		Delete(&Message{}).Error
+	if err != nil {
+		return err
+	}
+
+	email := deletedUserEmail(userID)
+	if err := tx.Model(&Message{}).Where("sender_id = ?", userID).Update("sender_address", email).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Message{}).Where("receiver_id = ?", userID).Updates(map[string]interface{}{
+		"recipient_address": email,
+		"spam_score":        0,
+		"spam_trained":      "",
+	}).Error
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestScheduleAccountDeletion(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "leaving@example.com", "password123")
+
+	if err := CancelAccountDeletion(db, user); !errors.Is(err, ErrDeletionNotScheduled) {
+		t.Errorf("Ожидалась ошибка ErrDeletionNotScheduled, получено %v", err)
+	}
+
+	if err := ScheduleAccountDeletion(db, user, time.Hour); err != nil {
+		t.Fatalf("Ошибка планирования удаления: %v", err)
+	}
+	if err := ScheduleAccountDeletion(db, user, time.Hour); !errors.Is(err, ErrDeletionAlreadyScheduled) {
+		t.Errorf("Повторное планирование должно возвращать ошибку, получено %v", err)
+	}
+
+	due, _ := DueAccountDeletions(db, time.Now())
+	if len(due) != 0 {
+		t.Errorf("До окончания периода ожидания удалять нечего, получено %d", len(due))
+	}
+	due, _ = DueAccountDeletions(db, time.Now().Add(2*time.Hour))
+	if len(due) != 1 || due[0].ID != user.ID {
+		t.Errorf("После периода ожидания учетная запись должна быть к удалению, получено %v", due)
+	}
+
+	if err := CancelAccountDeletion(db, user); err != nil {
+		t.Fatalf("Ошибка отмены удаления: %v", err)
+	}
+	due, _ = DueAccountDeletions(db, time.Now().Add(2*time.Hour))
+	if len(due) != 0 {
+		t.Error("Отмененное удаление не должно выполняться")
+	}
+}
+
+func TestAnonymizeUserKeepsMessagesOfOthers(t *testing.T) {
+	db := setupTestDB(t)
+
+	alice, _ := CreateUser(db, "alice@example.com", "password123")
+	bob, _ := CreateUser(db, "bob@example.com", "password123")
+	toBob, _ := SendMessage(db, alice.ID, bob.Email, "hi", "body", 0)
+	toAlice, _ := SendMessage(db, bob.ID, alice.Email, "re: hi", "body", 0)
+	SendMessage(db, alice.ID, alice.Email, "note", "body", 0)
+	CreateAPIToken(db, alice.ID, "script", []string{ScopeMessagesRead}, nil)
+	SetUserAvatar(db, alice, "avatars/alice.png")
+
+	previous, err := AnonymizeUser(db, alice.ID)
+	if err != nil {
+		t.Fatalf("Ошибка удаления: %v", err)
+	}
+	if previous.Email != "alice@example.com" || previous.AvatarPath != "avatars/alice.png" {
+		t.Errorf("Должно возвращаться состояние до удаления: %+v", previous)
+	}
+
+	inbox, _ := GetInboxMessages(db, bob.ID)
+	if len(inbox) != 1 || inbox[0].ID != toBob.ID {
+		t.Fatalf("Письмо, полученное Бобом, должно сохраниться, получено %d", len(inbox))
+	}
+	if inbox[0].Sender.Name() != DeletedUserName {
+		t.Errorf("Отправитель должен отображаться как удаленный, получено %q", inbox[0].Sender.Name())
+	}
+
+	// Письмо Алисе остается у Боба в отправленных, без ее адреса
+	sent, _ := GetSentMessages(db, bob.ID)
+	if len(sent) != 1 || sent[0].ID != toAlice.ID {
+		t.Fatalf("Письмо, отправленное Бобом, должно сохраниться, получено %d", len(sent))
+	}
+	if sent[0].RecipientAddress == "alice@example.com" || sent[0].Receiver.Name() != DeletedUserName {
+		t.Errorf("Получатель должен отображаться как удаленный: %q, %q", sent[0].RecipientAddress, sent[0].Receiver.Name())
+	}
+
+	var count int64
+	db.Model(&Message{}).Where("sender_id = ? AND receiver_id = ?", alice.ID, alice.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Письма самому себе должны быть удалены, осталось %d", count)
+	}
+
+	// Когда удаляется и Боб, переписка больше никому не принадлежит
+	if _, err := AnonymizeUser(db, bob.ID); err != nil {
+		t.Fatalf("Ошибка удаления: %v", err)
+	}
+	db.Model(&Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Письма без владельцев должны быть удалены, осталось %d", count)
+	}
+	db.Model(&APIToken{}).Where("user_id = ?", alice.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Токены удаленного пользователя должны быть удалены, осталось %d", count)
+	}
+
+	var stored User
+	db.First(&stored, alice.ID)
+	if !stored.IsAnonymized() || !stored.IsDisabled() || stored.AvatarPath != "" {
+		t.Errorf("Учетная запись должна быть анонимизирована и отключена: %+v", stored)
+	}
+	if stored.CheckPassword("password123") {
+		t.Error("Вход в удаленную учетную запись должен быть невозможен")
+	}
+
+	// Адрес освобождается для новой регистрации
+	if _, err := CreateUser(db, "alice@example.com", "password123"); err != nil {
+		t.Errorf("Email удаленного пользователя должен быть свободен: %v", err)
+	}
+
+	if _, err := AnonymizeUser(db, alice.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Повторное удаление должно возвращать ErrRecordNotFound, получено %v", err)
+	}
+}
+
+func TestAnonymizeUserKeepsLastAdmin(t *testing.T) {
+	db := setupTestDB(t)
+
+	root, _ := CreateUserWithRole(db, "root@example.com", "password123", RoleAdmin)
+
+	// Удаление по расписанию проходит через ту же проверку, что и ручное
+	if _, err := AnonymizeUser(db, root.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("Ожидалась ErrLastAdmin, получено %v", err)
+	}
+
+	var reloaded User
+	db.First(&reloaded, root.ID)
+	if reloaded.IsAnonymized() || !reloaded.IsAdmin() {
+		t.Error("Последний администратор не должен быть анонимизирован")
+	}
+}
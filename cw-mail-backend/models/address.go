@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+
+var (
+	ErrAddressDomainNotAllowed = errors.New("адрес должен принадлежать домену сервиса")
+	ErrAddressReserved         = errors.New("адрес зарезервирован")
+)
+
+
+// reservedLocalParts — служебные имена (RFC 2142 и адреса администрирования).
+// Письма на них должны получать администраторы сервиса, а не тот, кто первым
+// занял адрес.
+var reservedLocalParts = map[string]bool{
+	"abuse":         true,
+	"admin":         true,
+	"administrator": true,
+	"hostmaster":    true,
+	"mailer-daemon": true,
+	"no-reply":      true,
+	"noc":           true,
+	"noreply":       true,
+	"postmaster":    true,
+	"root":          true,
+	"security":      true,
+	"webmaster":     true,
+}
+
+
+// AddressPolicy ограничивает адреса, которые пользователи создают себе сами:
+// списки рассылки и псевдонимы. Без нее любой пользователь мог бы занять
+// адрес в чужом домене или служебный адрес и получать на него письма.
+// Администраторы могут создавать любые адреса.
+type AddressPolicy struct {
+	Domains []string
+}
+
+
+// Check проверяет, может ли пользователь занять адрес. Адрес должен быть уже
+// нормализован.
+func (p AddressPolicy) Check(user *User, address string) error {
+	if user.IsAdmin() {
+		return nil
+	}
+
+	if IsReservedAddress(address) {
+		return ErrAddressReserved
+	}
+
+	domain := addressDomain(address)
+	for _, allowed := range p.Domains {
+		if domain == allowed {
+			return nil
+		}
+	}
+	return ErrAddressDomainNotAllowed
+}
+
+
+// IsReservedAddress сообщает, является ли адрес служебным. Подадрес
+// (admin+tag@) считается тем же адресом.
+func IsReservedAddress(address string) bool {
+	local := address
+	if at := strings.LastIndex(local, "@"); at >= 0 {
+		local = local[:at]
+	}
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	return reservedLocalParts[local]
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+var (
+	ErrInvalidAliasAddress   = errors.New("неверный адрес псевдонима")
+	ErrAliasQuotaExceeded    = errors.New("достигнуто максимальное количество псевдонимов")
+	ErrInvalidAliasQuota     = errors.New("квота псевдонимов не может быть отрицательной")
+	ErrSenderAddressNotOwned = errors.New("нельзя отправлять письма с чужого адреса")
+)
+
+
+// EmailAlias — дополнительный адрес пользователя. Письма на него попадают в
+// тот же почтовый ящик, с него же можно отправлять.
+type EmailAlias struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	Address   string    `json:"address" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+
+// EffectiveAliasQuota возвращает квоту пользователя: назначенную
+// администратором или значение по умолчанию.
+func (u *User) EffectiveAliasQuota(defaultQuota int) int {
+	if u.AliasQuota != nil {
+		return *u.AliasQuota
+	}
+	return defaultQuota
+}
+
+
+// CreateAlias добавляет псевдоним, если адрес свободен. При enforceQuota
+// (пользователь создает псевдоним сам) учитываются квота пользователя и
+// policy; администратор может назначить любой адрес сверх квоты.
+func CreateAlias(db *gorm.DB, user *User, address string, quota int, enforceQuota bool, policy AddressPolicy) (*EmailAlias, error) {
+	address, err := normalizeContactEmail(address)
+	if err != nil {
+		return nil, ErrInvalidAliasAddress
+	}
+	if enforceQuota {
+		if err := policy.Check(user, address); err != nil {
+			return nil, err
+		}
+	}
+
+	alias := &EmailAlias{UserID: user.ID, Address: address}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if enforceQuota {
+			var count int64
+			if err := tx.Model(&EmailAlias{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(quota) {
+				return ErrAliasQuotaExceeded
+			}
+		}
+
+		inUse, err := AddressInUse(tx, address)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrAddressInUse
+		}
+
+		return tx.Create(alias).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return alias, nil
+}
+
+
+func ListAliases(db *gorm.DB, userID uint) ([]EmailAlias, error) {
+	var aliases []EmailAlias
+	err := db.Where("user_id = ?", userID).Order("address ASC").Find(&aliases).Error
+	return aliases, err
+}
+
+
+func DeleteAlias(db *gorm.DB, aliasID, userID uint) (*EmailAlias, error) {
+	var alias EmailAlias
+	if err := db.Where("id = ? AND user_id = ?", aliasID, userID).First(&alias).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Delete(&alias).Error; err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+
+// SetAliasQuota назначает пользователю квоту псевдонимов. nil возвращает
+// значение по умолчанию. Уже созданные псевдонимы сверх квоты сохраняются.
+func SetAliasQuota(db *gorm.DB, user *User, quota *int) error {
+	if quota != nil && *quota < 0 {
+		return ErrInvalidAliasQuota
+	}
+	if err := db.Model(user).Update("alias_quota", quota).Error; err != nil {
+		return err
+	}
+	user.AliasQuota = quota
+	return nil
+}
+
+
+// FindUserByAddress находит владельца адреса: по основному адресу или по
+// псевдониму.
+func FindUserByAddress(db *gorm.DB, address string) (*User, error) {
+	address = normalizeAddress(address)
+
+	var user User
+	err := db.Where("LOWER(email) = ?", address).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = db.Where("id = (?)", db.Model(&EmailAlias{}).Select("user_id").Where("address = ?", address)).
+		First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+
+// ResolveSenderAddress проверяет адрес, с которого пользователь хочет
+// отправить письмо. Пустой адрес означает основной.
+func ResolveSenderAddress(db *gorm.DB, user *User, address string) (string, error) {
+	address = normalizeAddress(address)
+	if address == "" || address == normalizeAddress(user.Email) {
+		return user.Email, nil
+	}
+
+	var count int64
+	err := db.Model(&EmailAlias{}).Where("user_id = ? AND address = ?", user.ID, address).Count(&count).Error
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", ErrSenderAddressNotOwned
+	}
+	return address, nil
+}
+
+
+// AddressedTo ограничивает выборку писем адресом, на который они пришли.
+func AddressedTo(address string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if address = normalizeAddress(address); address == "" {
+			return db
+		}
+		return db.Where("recipient_address = ?", address)
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateAlias(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+	other, _ := CreateUser(db, "other@example.com", "password123")
+	CreateDistributionList(db, other, DistributionListFields{Address: "team@example.com"}, testAddressPolicy)
+
+	alias, err := CreateAlias(db, user, " Sales@Example.com ", 2, true, testAddressPolicy)
+	if err != nil {
+		t.Fatalf("Ошибка создания псевдонима: %v", err)
+	}
+	if alias.Address != "sales@example.com" || alias.UserID != user.ID {
+		t.Errorf("Неверный псевдоним: %+v", alias)
+	}
+
+	tests := map[string]struct {
+		address string
+		want    error
+	}{
+		"псевдоним":          {"sales@example.com", ErrAddressInUse},
+		"адрес пользователя": {"OTHER@example.com", ErrAddressInUse},
+		"адрес списка":       {"team@example.com", ErrAddressInUse},
+		"неверный адрес":     {"sales", ErrInvalidAliasAddress},
+		"чужой домен":        {"ceo@bank.example", ErrAddressDomainNotAllowed},
+		"служебный адрес":    {"postmaster@example.com", ErrAddressReserved},
+		"служебный подадрес": {"Admin+mail@example.com", ErrAddressReserved},
+	}
+	for name, tt := range tests {
+		if _, err := CreateAlias(db, user, tt.address, 2, true, testAddressPolicy); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ожидалась ошибка %v, получено %v", name, tt.want, err)
+		}
+	}
+
+	if _, err := CreateAlias(db, user, "postmaster@example.com", 0, false, AddressPolicy{}); err != nil {
+		t.Errorf("Администратор может назначить служебный адрес: %v", err)
+	}
+
+	if inUse, _ := AddressInUse(db, "Sales@example.com"); !inUse {
+		t.Error("Адрес псевдонима должен считаться занятым при регистрации")
+	}
+}
+
+func TestAliasQuota(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+
+	if _, err := CreateAlias(db, user, "one@example.com", 1, true, testAddressPolicy); err != nil {
+		t.Fatalf("Ошибка создания псевдонима: %v", err)
+	}
+	if _, err := CreateAlias(db, user, "two@example.com", 1, true, testAddressPolicy); !errors.Is(err, ErrAliasQuotaExceeded) {
+		t.Errorf("Ожидалась ошибка квоты, получено %v", err)
+	}
+	if _, err := CreateAlias(db, user, "two@example.com", 1, false, AddressPolicy{}); err != nil {
+		t.Errorf("Администратор может превысить квоту: %v", err)
+	}
+
+	quota := 10
+	if err := SetAliasQuota(db, user, &quota); err != nil {
+		t.Fatalf("Ошибка изменения квоты: %v", err)
+	}
+	var stored User
+	db.First(&stored, user.ID)
+	if stored.EffectiveAliasQuota(1) != 10 {
+		t.Errorf("Ожидалась квота 10, получено %d", stored.EffectiveAliasQuota(1))
+	}
+
+	negative := -1
+	if err := SetAliasQuota(db, user, &negative); !errors.Is(err, ErrInvalidAliasQuota) {
+		t.Errorf("Ожидалась ошибка отрицательной квоты, получено %v", err)
+	}
+	if err := SetAliasQuota(db, user, nil); err != nil || user.EffectiveAliasQuota(3) != 3 {
+		t.Errorf("Квота должна вернуться к значению по умолчанию: %v", err)
+	}
+}
+
+func TestDeliverMessageToAlias(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	CreateAlias(db, sender, "support@example.com", 5, true, testAddressPolicy)
+	CreateAlias(db, receiver, "sales@example.com", 5, true, testAddressPolicy)
+
+	delivery, err := DeliverMessage(db, sender, OutgoingMessage{From: "Support@example.com", To: "SALES@example.com", Subject: "Тема", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка отправки на псевдоним: %v", err)
+	}
+	message := delivery.Messages[0]
+	if message.ReceiverID != receiver.ID || message.SenderAddress != "support@example.com" || message.RecipientAddress != "sales@example.com" {
+		t.Errorf("Письмо должно прийти владельцу псевдонима с адресами псевдонимов: %+v", message)
+	}
+
+	if _, err := DeliverMessage(db, sender, OutgoingMessage{From: "sales@example.com", To: receiver.Email, Subject: "Тема", Body: "Текст"}, SendingPolicy{}); !errors.Is(err, ErrSenderAddressNotOwned) {
+		t.Errorf("Нельзя отправлять с чужого псевдонима, получено %v", err)
+	}
+
+	direct, err := SendMessage(db, sender.ID, receiver.Email, "Тема", "Текст", 0)
+	if err != nil {
+		t.Fatalf("Ошибка отправки: %v", err)
+	}
+	if direct.SenderAddress != sender.Email || direct.RecipientAddress != receiver.Email {
+		t.Errorf("Без псевдонимов должны использоваться основные адреса: %+v", direct)
+	}
+
+	all, _ := GetInboxMessages(db, receiver.ID)
+	filtered, _ := GetInboxMessages(db.Scopes(AddressedTo("sales@example.com")), receiver.ID)
+	if len(all) != 2 || len(filtered) != 1 || filtered[0].ID != message.ID {
+		t.Errorf("Фильтр по адресу должен оставить одно письмо: всего %d, отфильтровано %d", len(all), len(filtered))
+	}
+}
+
+func TestAnonymizeUserDeletesAliases(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+	other, _ := CreateUser(db, "other@example.com", "password123")
+	CreateAlias(db, user, "alias@example.com", 5, true, testAddressPolicy)
+	DeliverMessage(db, user, OutgoingMessage{From: "alias@example.com", To: other.Email, Subject: "Тема", Body: "Текст"}, SendingPolicy{})
+
+	if _, err := AnonymizeUser(db, user.ID); err != nil {
+		t.Fatalf("Ошибка анонимизации: %v", err)
+	}
+
+	if aliases, _ := ListAliases(db, user.ID); len(aliases) != 0 {
+		t.Errorf("Псевдонимы должны быть удалены, осталось %d", len(aliases))
+	}
+	if inUse, _ := AddressInUse(db, "alias@example.com"); inUse {
+		t.Error("Адрес удаленного псевдонима должен освободиться")
+	}
+
+	messages, _ := GetInboxMessages(db, other.ID)
+	if len(messages) != 1 || messages[0].SenderAddress == "alias@example.com" {
+		t.Errorf("В письмах не должно остаться адреса удаленного пользователя: %+v", messages)
+	}
+}
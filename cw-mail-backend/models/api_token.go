@@ -0,0 +1,181 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	APITokenPrefix = "cwm_"
+
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesSend  = "messages:send"
+	ScopeMessagesWrite = "messages:write"
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeContactsRead  = "contacts:read"
+	ScopeContactsWrite = "contacts:write"
+	ScopeListsRead     = "lists:read"
+	ScopeListsWrite    = "lists:write"
+	ScopeFiltersRead   = "filters:read"
+	ScopeFiltersWrite  = "filters:write"
+)
+
+
+var ValidScopes = []string{ScopeMessagesRead, ScopeMessagesSend, ScopeMessagesWrite, ScopeProfileRead, ScopeProfileWrite,
+	ScopeContactsRead, ScopeContactsWrite, ScopeListsRead, ScopeListsWrite, ScopeFiltersRead, ScopeFiltersWrite}
+
+
+var (
+	ErrAPITokenInvalid = errors.New("недействительный токен доступа")
+	ErrInvalidScope    = errors.New("недопустимая область доступа")
+)
+
+
+// APIToken — именованный долгоживущий токен для скриптов и интеграций.
+// Открытое значение показывается один раз при создании, в базе хранится хеш.
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"-" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+
+func IsValidScope(scope string) bool {
+	for _, validScope := range ValidScopes {
+		if scope == validScope {
+			return true
+		}
+	}
+	return false
+}
+
+
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+
+func (t *APIToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+
+func CreateAPIToken(db *gorm.DB, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *APIToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+
+	unique := make(map[string]bool)
+	for _, scope := range scopes {
+		if !IsValidScope(scope) {
+			return "", nil, ErrInvalidScope
+		}
+		unique[scope] = true
+	}
+
+	normalized := make([]string, 0, len(unique))
+	for scope := range unique {
+		normalized = append(normalized, scope)
+	}
+	sort.Strings(normalized)
+
+	secret, err := generateToken(20)
+	if err != nil {
+		return "", nil, err
+	}
+	plain := APITokenPrefix + secret
+
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:len(APITokenPrefix)+6],
+		TokenHash: hashToken(plain),
+		Scopes:    strings.Join(normalized, ","),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := db.Create(token).Error; err != nil {
+		return "", nil, err
+	}
+
+	return plain, token, nil
+}
+
+
+func ListAPITokens(db *gorm.DB, userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+
+func RevokeAPIToken(db *gorm.DB, tokenID uint, userID uint) error {
+	result := db.Model(&APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+
+// AuthenticateAPIToken находит активный токен по открытому значению и
+// отмечает время последнего использования.
+func AuthenticateAPIToken(db *gorm.DB, plain string) (*APIToken, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, ErrAPITokenInvalid
+	}
+
+	var token APIToken
+	if err := db.Where("token_hash = ?", hashToken(plain)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPITokenInvalid
+		}
+		return nil, err
+	}
+
+	if !token.IsActive() {
+		return nil, ErrAPITokenInvalid
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		db.Model(&token).Update("last_used_at", now)
+		token.LastUsedAt = &now
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "script@example.com", "password123")
+
+	plain, token, err := CreateAPIToken(db, user.ID, "backup", []string{ScopeMessagesSend, ScopeMessagesRead, ScopeMessagesRead}, nil)
+	if err != nil {
+		t.Fatalf("Ошибка создания токена: %v", err)
+	}
+
+	if !strings.HasPrefix(plain, APITokenPrefix) || !strings.HasPrefix(plain, token.Prefix) {
+		t.Errorf("Неверный формат токена: %s (префикс %s)", plain, token.Prefix)
+	}
+	if token.TokenHash == plain {
+		t.Error("Токен не должен храниться в открытом виде")
+	}
+	if token.Scopes != "messages:read,messages:send" {
+		t.Errorf("Области доступа должны быть нормализованы, получено %q", token.Scopes)
+	}
+
+	found, err := AuthenticateAPIToken(db, plain)
+	if err != nil {
+		t.Fatalf("Ошибка аутентификации: %v", err)
+	}
+	if !found.HasScope(ScopeMessagesRead) || found.HasScope(ScopeMessagesWrite) {
+		t.Errorf("Неверные области доступа: %v", found.ScopeList())
+	}
+	if found.LastUsedAt == nil {
+		t.Error("Время последнего использования должно обновляться")
+	}
+
+	if err := RevokeAPIToken(db, token.ID, user.ID+1); err == nil {
+		t.Error("Чужой токен не должен отзываться")
+	}
+	if err := RevokeAPIToken(db, token.ID, user.ID); err != nil {
+		t.Fatalf("Ошибка отзыва: %v", err)
+	}
+
+	if _, err := AuthenticateAPIToken(db, plain); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Errorf("Отозванный токен не должен приниматься, получено %v", err)
+	}
+}
+
+func TestAPITokenValidation(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "scopes@example.com", "password123")
+
+	if _, _, err := CreateAPIToken(db, user.ID, "bad", []string{"admin"}, nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Недопустимая область должна отклоняться, получено %v", err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	plain, _, err := CreateAPIToken(db, user.ID, "old", []string{ScopeMessagesRead}, &expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthenticateAPIToken(db, plain); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Errorf("Просроченный токен не должен приниматься, получено %v", err)
+	}
+
+	if _, err := AuthenticateAPIToken(db, "eyJhbGciOi"); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Errorf("Строка без префикса не должна приниматься, получено %v", err)
+	}
+}
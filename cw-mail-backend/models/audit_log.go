@@ -0,0 +1,153 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+var ErrAuditLogImmutable = errors.New("записи журнала аудита нельзя изменять или удалять")
+
+
+// AuditLog — запись журнала аудита. Журнал только дополняется: хуки запрещают
+// изменение и удаление записей через ORM, а миграция добавляет такой же
+// запрет на уровне базы данных.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ActorID    *uint     `json:"actor_id,omitempty" gorm:"index"`
+	Action     string    `json:"action" gorm:"index;not null"`
+	TargetType string    `json:"target_type,omitempty"`
+	TargetID   *uint     `json:"target_id,omitempty"`
+	Details    string    `json:"details,omitempty" gorm:"type:text"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+
+type AuditLogFilter struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   *uint
+	From       *time.Time
+	To         *time.Time
+	Page       int
+	Limit      int
+}
+
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+
+// MarshalJSON отдает details как вложенный JSON-объект, а не строку.
+func (a AuditLog) MarshalJSON() ([]byte, error) {
+	type plain AuditLog
+
+	var details json.RawMessage
+	if a.Details != "" && json.Valid([]byte(a.Details)) {
+		details = json.RawMessage(a.Details)
+	}
+
+	return json.Marshal(struct {
+		plain
+		Details json.RawMessage `json:"details,omitempty"`
+	}{
+		plain:   plain(a),
+		Details: details,
+	})
+}
+
+
+func RecordAuditLog(db *gorm.DB, entry *AuditLog, details interface{}) error {
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		entry.Details = string(raw)
+	}
+
+	return db.Create(entry).Error
+}
+
+
+func auditLogQuery(db *gorm.DB, filter AuditLogFilter) *gorm.DB {
+	query := db.Model(&AuditLog{})
+
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		// "user.*" выбирает все действия с префиксом "user."
+		if len(filter.Action) > 1 && filter.Action[len(filter.Action)-1] == '*' {
+			query = query.Where("action LIKE ?", filter.Action[:len(filter.Action)-1]+"%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	return query
+}
+
+
+func FindAuditLogs(db *gorm.DB, filter AuditLogFilter) ([]AuditLog, int64, error) {
+	query := auditLogQuery(db, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var entries []AuditLog
+	err := query.Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&entries).Error
+	return entries, total, err
+}
+
+
+// EachAuditLog обходит все записи по фильтру в хронологическом порядке
+// пачками, не загружая журнал в память целиком.
+func EachAuditLog(db *gorm.DB, filter AuditLogFilter, fn func(entry *AuditLog) error) error {
+	var batch []AuditLog
+	result := auditLogQuery(db, filter).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result.Error
+}
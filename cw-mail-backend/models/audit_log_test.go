@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuditLogFilters(t *testing.T) {
+	db := setupTestDB(t)
+
+	actor := uint(1)
+	other := uint(2)
+	target := uint(7)
+
+	entries := []AuditLog{
+		{ActorID: &actor, Action: "auth.login.succeeded"},
+		{ActorID: &actor, Action: "auth.login.failed", TargetType: "user", TargetID: &target},
+		{ActorID: &other, Action: "admin.user.disabled", TargetType: "user", TargetID: &target},
+	}
+	for i := range entries {
+		if err := RecordAuditLog(db, &entries[i], map[string]int{"n": i}); err != nil {
+			t.Fatalf("Ошибка записи в журнал: %v", err)
+		}
+	}
+
+	found, total, err := FindAuditLogs(db, AuditLogFilter{ActorID: &actor})
+	if err != nil {
+		t.Fatalf("Ошибка поиска: %v", err)
+	}
+	if total != 2 || len(found) != 2 {
+		t.Errorf("Ожидалось 2 записи пользователя, получено %d", total)
+	}
+	if found[0].Action != "auth.login.failed" {
+		t.Errorf("Новые записи должны идти первыми, получено %s", found[0].Action)
+	}
+
+	_, total, _ = FindAuditLogs(db, AuditLogFilter{Action: "auth.*"})
+	if total != 2 {
+		t.Errorf("Фильтр по префиксу должен вернуть 2 записи, получено %d", total)
+	}
+
+	_, total, _ = FindAuditLogs(db, AuditLogFilter{Action: "auth.login.failed"})
+	if total != 1 {
+		t.Errorf("Точный фильтр должен вернуть 1 запись, получено %d", total)
+	}
+
+	_, total, _ = FindAuditLogs(db, AuditLogFilter{TargetType: "user", TargetID: &target})
+	if total != 2 {
+		t.Errorf("Фильтр по объекту должен вернуть 2 записи, получено %d", total)
+	}
+
+	future := time.Now().Add(time.Hour)
+	_, total, _ = FindAuditLogs(db, AuditLogFilter{From: &future})
+	if total != 0 {
+		t.Errorf("Записей из будущего быть не должно, получено %d", total)
+	}
+
+	var exported []string
+	err = EachAuditLog(db, AuditLogFilter{}, func(entry *AuditLog) error {
+		exported = append(exported, entry.Action)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Ошибка обхода журнала: %v", err)
+	}
+	if len(exported) != 3 || exported[0] != "auth.login.succeeded" {
+		t.Errorf("Выгрузка должна идти в хронологическом порядке, получено %v", exported)
+	}
+}
+
+func TestAuditLogImmutable(t *testing.T) {
+	db := setupTestDB(t)
+
+	entry := &AuditLog{Action: "auth.lockout"}
+	if err := RecordAuditLog(db, entry, nil); err != nil {
+		t.Fatalf("Ошибка записи в журнал: %v", err)
+	}
+
+	entry.Action = "changed"
+	if err := db.Save(entry).Error; !errors.Is(err, ErrAuditLogImmutable) {
+		t.Errorf("Изменение записи должно быть запрещено, получено %v", err)
+	}
+
+	if err := db.Delete(entry).Error; !errors.Is(err, ErrAuditLogImmutable) {
+		t.Errorf("Удаление записи должно быть запрещено, получено %v", err)
+	}
+
+	var count int64
+	db.Model(&AuditLog{}).Where("action = ?", "auth.lockout").Count(&count)
+	if count != 1 {
+		t.Errorf("Запись должна сохраниться без изменений, найдено %d", count)
+	}
+}
+
+func TestAuditLogJSONDetails(t *testing.T) {
+	entry := AuditLog{Action: "admin.user.role_changed", Details: `{"from":"user","to":"admin"}`}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Ошибка сериализации: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+
+	details, ok := decoded["details"].(map[string]interface{})
+	if !ok || details["to"] != "admin" {
+		t.Errorf("details должны выводиться как объект, получено %s", raw)
+	}
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+// Значение Message.AutoSubmitted для автоответов (RFC 3834). На такие письма
+// автоответ не отправляется, что исключает зацикливание.
+const AutoSubmittedReplied = "auto-replied"
+
+
+// AutoReply — отметка о последнем автоответе отправителю. Handle различает
+// независимые автоответы одного пользователя.
+type AutoReply struct {
+	ID     uint      `json:"id" gorm:"primaryKey"`
+	UserID uint      `json:"user_id" gorm:"uniqueIndex:idx_auto_replies_user_sender_handle;not null"`
+	Sender string    `json:"sender" gorm:"uniqueIndex:idx_auto_replies_user_sender_handle;not null"`
+	Handle string    `json:"handle" gorm:"uniqueIndex:idx_auto_replies_user_sender_handle;not null"`
+	SentAt time.Time `json:"sent_at" gorm:"not null"`
+}
+
+
+// canAutoReply проверяет общие правила автоответов: не отвечать на
+// автоматические письма, письма из списков рассылки и самому себе.
+func canAutoReply(original *Message, owner User) bool {
+	return original.AutoSubmitted == "" &&
+		original.ListAddress == "" &&
+		original.SenderID != owner.ID &&
+		original.SenderAddress != ""
+}
+
+
+// claimAutoReply отмечает автоответ отправителю и сообщает, можно ли его
+// отправить: предыдущий ответ с тем же handle должен быть старше interval.
+func claimAutoReply(db *gorm.DB, userID uint, sender, handle string, interval time.Duration) (bool, error) {
+	sender = normalizeAddress(sender)
+	now := time.Now()
+
+	var entry AutoReply
+	err := db.Where("user_id = ? AND sender = ? AND handle = ?", userID, sender, handle).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, db.Create(&AutoReply{UserID: userID, Sender: sender, Handle: handle, SentAt: now}).Error
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if now.Sub(entry.SentAt) < interval {
+		return false, nil
+	}
+	return true, db.Model(&entry).Update("sent_at", now).Error
+}
+
+
+// sendAutoReply отправляет автоответ на письмо от имени его получателя с
+// адреса from. Отказ отправителя исходного письма принимать почту не
+// считается ошибкой.
+func sendAutoReply(db *gorm.DB, original *Message, owner User, from, subject, body string) (*Message, error) {
+	var sender User
+	if err := db.First(&sender, original.SenderID).Error; err != nil {
+		return nil, err
+	}
+
+	reply := newMessage(owner.ID, sender.ID, subject, body, 0)
+	reply.SenderAddress = from
+	reply.RecipientAddress = normalizeAddress(original.SenderAddress)
+	reply.AutoSubmitted = AutoSubmittedReplied
+
+	_, _, err := deliverCopy(db, reply, sender, false, from, owner.Email)
+	if isDeliveryRefused(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
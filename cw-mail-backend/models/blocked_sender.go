@@ -0,0 +1,259 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	// Что делать с письмом от заблокированного отправителя: переместить в
+	// спам или отклонить.
+	BlockActionSpam   = "spam"
+	BlockActionReject = "reject"
+
+	BlockKindAddress = "address"
+	BlockKindDomain  = "domain"
+
+	MaxBlockedSenders = 500
+)
+
+
+var ValidBlockActions = []string{BlockActionSpam, BlockActionReject}
+
+
+var (
+	ErrInvalidBlockPattern = errors.New("укажите адрес или домен отправителя")
+	ErrInvalidBlockAction  = errors.New("недопустимое действие для заблокированных отправителей")
+	ErrAlreadyBlocked      = errors.New("отправитель уже заблокирован")
+	ErrBlockListFull       = errors.New("достигнуто максимальное количество заблокированных отправителей")
+	ErrSenderBlocked       = errors.New("получатель не принимает сообщения от этого отправителя")
+)
+
+
+// BlockedSender — запись списка блокировки: конкретный адрес
+// (spam@example.com) или весь домен (example.com).
+type BlockedSender struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_blocked_senders_user_pattern;not null"`
+	Pattern   string    `json:"pattern" gorm:"uniqueIndex:idx_blocked_senders_user_pattern;not null"`
+	Kind      string    `json:"kind" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+
+func IsValidBlockAction(action string) bool {
+	for _, valid := range ValidBlockActions {
+		if action == valid {
+			return true
+		}
+	}
+	return false
+}
+
+
+// normalizeBlockPattern разбирает адрес или домен. Домен можно указать с
+// ведущей @: "@example.com".
+func normalizeBlockPattern(pattern string) (string, string, error) {
+	pattern = normalizeAddress(pattern)
+	if strings.HasPrefix(pattern, "@") {
+		pattern = pattern[1:]
+	}
+
+	if strings.Contains(pattern, "@") {
+		address, err := normalizeContactEmail(pattern)
+		if err != nil {
+			return "", "", ErrInvalidBlockPattern
+		}
+		return address, BlockKindAddress, nil
+	}
+
+	if !isValidDomain(pattern) {
+		return "", "", ErrInvalidBlockPattern
+	}
+	return pattern, BlockKindDomain, nil
+}
+
+
+func isValidDomain(domain string) bool {
+	if len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+
+func addressDomain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return address[at+1:]
+	}
+	return ""
+}
+
+
+func ListBlockedSenders(db *gorm.DB, userID uint) ([]BlockedSender, error) {
+	var entries []BlockedSender
+	err := db.Where("user_id = ?", userID).Order("kind ASC, pattern ASC").Find(&entries).Error
+	return entries, err
+}
+
+
+func AddBlockedSender(db *gorm.DB, userID uint, pattern string) (*BlockedSender, error) {
+	pattern, kind, err := normalizeBlockPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &BlockedSender{UserID: userID, Pattern: pattern, Kind: kind}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&BlockedSender{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxBlockedSenders {
+			return ErrBlockListFull
+		}
+
+		var existing int64
+		if err := tx.Model(&BlockedSender{}).Where("user_id = ? AND pattern = ?", userID, pattern).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyBlocked
+		}
+
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+
+func DeleteBlockedSender(db *gorm.DB, entryID, userID uint) error {
+	result := db.Where("id = ? AND user_id = ?", entryID, userID).Delete(&BlockedSender{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+
+func SetBlockAction(db *gorm.DB, user *User, action string) error {
+	if !IsValidBlockAction(action) {
+		return ErrInvalidBlockAction
+	}
+	if err := db.Model(user).Update("block_action", action).Error; err != nil {
+		return err
+	}
+	user.BlockAction = action
+	return nil
+}
+
+
+// IsSenderBlocked проверяет, заблокирован ли у пользователя любой из адресов
+// отправителя или их домены.
+func IsSenderBlocked(db *gorm.DB, userID uint, addresses ...string) (bool, error) {
+	patterns := make([]string, 0, len(addresses)*2)
+	for _, address := range addresses {
+		if address = normalizeAddress(address); address == "" {
+			continue
+		}
+		patterns = append(patterns, address)
+		if domain := addressDomain(address); domain != "" {
+			patterns = append(patterns, domain)
+		}
+	}
+	if len(patterns) == 0 {
+		return false, nil
+	}
+
+	var count int64
+	err := db.Model(&BlockedSender{}).Where("user_id = ? AND pattern IN ?", userID, patterns).Count(&count).Error
+	return count > 0, err
+}
+
+
+// screenBlockedSender применяет к письму список блокировки получателя: письмо
+// от заблокированного отправителя попадает в спам или отклоняется в
+// зависимости от настройки получателя. Блокировка важнее фильтров, поэтому
+// проверяется после них.
+func screenBlockedSender(db *gorm.DB, message *Message, addresses ...string) (bool, error) {
+	blocked, err := IsSenderBlocked(db, message.ReceiverID, addresses...)
+	if err != nil || !blocked {
+		return false, err
+	}
+
+	var receiver User
+	if err := db.Select("block_action").First(&receiver, message.ReceiverID).Error; err != nil {
+		return true, err
+	}
+	if receiver.BlockAction == BlockActionReject {
+		return true, ErrSenderBlocked
+	}
+
+	message.Label = "spam"
+	return true, nil
+}
+
+
+// BlockMessageSender блокирует отправителя полученного письма (адрес или
+// весь домен) и переносит письмо из входящих в спам.
+func BlockMessageSender(db *gorm.DB, messageID, userID uint, wholeDomain bool) (*BlockedSender, error) {
+	var message Message
+	if err := db.First(&message, messageID).Error; err != nil {
+		return nil, err
+	}
+	if message.ReceiverID != userID || message.Dropped {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	address := message.SenderAddress
+	if address == "" {
+		var sender User
+		if err := db.Select("email").First(&sender, message.SenderID).Error; err != nil {
+			return nil, err
+		}
+		address = sender.Email
+	}
+
+	pattern := normalizeAddress(address)
+	if wholeDomain {
+		pattern = addressDomain(pattern)
+	}
+
+	entry, err := AddBlockedSender(db, userID, pattern)
+	if errors.Is(err, ErrAlreadyBlocked) {
+		entry = &BlockedSender{}
+		err = db.Where("user_id = ? AND pattern = ?", userID, pattern).First(entry).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Label == "inbox" {
+		if err := db.Model(&message).Update("label", "spam").Error; err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
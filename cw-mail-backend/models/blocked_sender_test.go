@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddBlockedSender(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+
+	tests := []struct {
+		pattern, want, kind string
+	}{
+		{" Spam@Example.com ", "spam@example.com", BlockKindAddress},
+		{"@Ads.example.org", "ads.example.org", BlockKindDomain},
+		{"example.net", "example.net", BlockKindDomain},
+	}
+	for _, tt := range tests {
+		entry, err := AddBlockedSender(db, user.ID, tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: ошибка блокировки: %v", tt.pattern, err)
+		}
+		if entry.Pattern != tt.want || entry.Kind != tt.kind {
+			t.Errorf("%q: ожидалось %s (%s), получено %s (%s)", tt.pattern, tt.want, tt.kind, entry.Pattern, entry.Kind)
+		}
+	}
+
+	if _, err := AddBlockedSender(db, user.ID, "spam@example.com"); !errors.Is(err, ErrAlreadyBlocked) {
+		t.Errorf("Ожидалась ошибка повторной блокировки, получено %v", err)
+	}
+	for _, pattern := range []string{"", "localhost", "bad domain.com", "-x.com", "a@"} {
+		if _, err := AddBlockedSender(db, user.ID, pattern); !errors.Is(err, ErrInvalidBlockPattern) {
+			t.Errorf("%q: ожидалась ошибка формата, получено %v", pattern, err)
+		}
+	}
+
+	if blocked, _ := IsSenderBlocked(db, user.ID, "anyone@example.net"); !blocked {
+		t.Error("Адрес из заблокированного домена должен считаться заблокированным")
+	}
+	if blocked, _ := IsSenderBlocked(db, user.ID, "other@example.com"); blocked {
+		t.Error("Блокировка адреса не должна распространяться на домен")
+	}
+}
+
+func TestBlockedSenderDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	CreateAlias(db, sender, "promo@example.com", 5, true, testAddressPolicy)
+
+	AddBlockedSender(db, receiver.ID, "sender@example.com")
+
+	// Блокировка основного адреса действует и при отправке с псевдонима
+	delivery, err := DeliverMessage(db, sender, OutgoingMessage{From: "promo@example.com", To: receiver.Email, Subject: "Тема", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка отправки: %v", err)
+	}
+	if delivery.Messages[0].Label != "spam" {
+		t.Errorf("Письмо заблокированного отправителя должно попасть в спам, метка %q", delivery.Messages[0].Label)
+	}
+
+	if err := SetBlockAction(db, receiver, "ignore"); !errors.Is(err, ErrInvalidBlockAction) {
+		t.Errorf("Ожидалась ошибка недопустимого действия, получено %v", err)
+	}
+	SetBlockAction(db, receiver, BlockActionReject)
+
+	if _, err := SendMessage(db, sender.ID, receiver.Email, "Тема", "Текст", 0); !errors.Is(err, ErrSenderBlocked) {
+		t.Errorf("Письмо должно быть отклонено, получено %v", err)
+	}
+
+	// При отправке пользователем письмо молча отбрасывается
+	delivery, err = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Скрыто", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Отправка заблокированным отправителем должна выглядеть успешной: %v", err)
+	}
+	if delivery.Dropped == nil || len(delivery.Messages) != 0 || delivery.Dropped.Label != "inbox" || delivery.Dropped.ID == 0 {
+		t.Errorf("Письмо должно быть отброшено без следов блокировки: %+v", delivery)
+	}
+	if sent, _ := GetSentMessages(db, sender.ID); len(sent) == 0 || sent[0].ID != delivery.Dropped.ID {
+		t.Error("Отброшенное письмо должно быть в отправленных")
+	}
+	if inbox, _ := GetInboxMessages(db, receiver.ID); len(inbox) != 0 {
+		t.Errorf("Получатель не должен видеть отброшенное письмо: %d во входящих", len(inbox))
+	}
+	if stats, _ := GetMailboxStats(db, receiver.ID); stats.Received != 1 {
+		t.Errorf("Отброшенное письмо не должно учитываться у получателя: %+v", stats)
+	}
+
+	// В списке рассылки отклоняющий участник просто не получает копию
+	other, _ := CreateUser(db, "other@example.com", "password123")
+	list, _ := CreateDistributionList(db, other, DistributionListFields{Address: "team@example.com", PostPolicy: ListPostAnyone}, testAddressPolicy)
+	AddDistributionListMember(db, list, receiver.Email)
+
+	delivery, err = DeliverMessage(db, sender, OutgoingMessage{To: list.Address, Subject: "Всем", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка отправки в список: %v", err)
+	}
+	if len(delivery.Messages) != 1 || delivery.Messages[0].ReceiverID != other.ID {
+		t.Errorf("Копию должен получить только владелец списка: %+v", delivery.Messages)
+	}
+
+	// Если письмо отклонили все участники, доставлять некому
+	AddBlockedSender(db, other.ID, "sender@example.com")
+	SetBlockAction(db, other, BlockActionReject)
+	if _, err := DeliverMessage(db, sender, OutgoingMessage{To: list.Address, Subject: "Всем", Body: "Текст"}, SendingPolicy{}); !errors.Is(err, ErrListNoRecipients) {
+		t.Errorf("Ожидалась ошибка пустого списка, получено %v", err)
+	}
+}
+
+func TestBlockMessageSender(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "sender@spam.example", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+
+	message, _ := SendMessage(db, sender.ID, receiver.Email, "Тема", "Текст", 0)
+
+	if _, err := BlockMessageSender(db, message.ID, sender.ID, false); err == nil {
+		t.Error("Заблокировать отправителя может только получатель")
+	}
+
+	entry, err := BlockMessageSender(db, message.ID, receiver.ID, true)
+	if err != nil {
+		t.Fatalf("Ошибка блокировки: %v", err)
+	}
+	if entry.Pattern != "spam.example" || entry.Kind != BlockKindDomain {
+		t.Errorf("Должен быть заблокирован домен отправителя: %+v", entry)
+	}
+
+	stored, _ := GetMessageByID(db, message.ID)
+	if stored.Label != "spam" {
+		t.Errorf("Письмо должно быть перенесено в спам, метка %q", stored.Label)
+	}
+
+	// Повторная блокировка возвращает существующую запись
+	again, err := BlockMessageSender(db, message.ID, receiver.ID, true)
+	if err != nil || again.ID != entry.ID {
+		t.Errorf("Ожидалась существующая запись: %+v, %v", again, err)
+	}
+}
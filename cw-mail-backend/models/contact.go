@@ -0,0 +1,630 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mail-service/vcard"
+	"gorm.io/gorm"
+)
+
+
+const (
+	MaxContactNameLength  = 200
+	MaxContactNotesLength = 2000
+	MaxContactGroupLength = 100
+
+	DefaultContactSuggestions = 10
+	MaxContactSuggestions     = 50
+)
+
+
+var (
+	ErrInvalidContactEmail  = errors.New("неверный адрес электронной почты")
+	ErrContactExists        = errors.New("контакт с таким адресом уже существует")
+	ErrContactFieldTooLong  = errors.New("одно из полей контакта слишком длинное")
+	ErrContactGroupName     = errors.New("неверное название группы")
+	ErrContactGroupExists   = errors.New("группа с таким названием уже существует")
+	ErrContactGroupNotFound = errors.New("группа контактов не найдена")
+)
+
+
+// Contact — запись адресной книги пользователя. Контакты с Auto = true
+// созданы автоматически при отправке писем и не показываются в списке
+// контактов, пока пользователь их не сохранит, но участвуют в подсказках.
+type Contact struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	UserID          uint           `json:"-" gorm:"not null;uniqueIndex:idx_contacts_user_email"`
+	Email           string         `json:"email" gorm:"not null;uniqueIndex:idx_contacts_user_email"`
+	Name            string         `json:"name"`
+	Phone           string         `json:"phone"`
+	Organization    string         `json:"organization"`
+	Notes           string         `json:"notes"`
+	Auto            bool           `json:"-" gorm:"not null;default:false"`
+	ContactCount    int            `json:"contact_count" gorm:"not null;default:0"`
+	LastContactedAt *time.Time     `json:"last_contacted_at,omitempty"`
+	CreatedAt       time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	Groups          []ContactGroup `json:"groups" gorm:"many2many:contact_group_members"`
+}
+
+
+type ContactGroup struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"not null;uniqueIndex:idx_contact_groups_user_name"`
+	Name      string    `json:"name" gorm:"not null;uniqueIndex:idx_contact_groups_user_name"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+
+// ContactFields — редактируемые поля контакта. GroupIDs заменяет членство
+// в группах целиком.
+type ContactFields struct {
+	Email        string
+	Name         string
+	Phone        string
+	Organization string
+	Notes        string
+	GroupIDs     []uint
+}
+
+
+type ContactFilter struct {
+	GroupID uint
+	Query   string
+}
+
+
+// ContactImport — контакт из импортируемого файла. Группы указываются по
+// названию и создаются, если их еще нет.
+type ContactImport struct {
+	ContactFields
+	Groups []string
+}
+
+
+type ContactImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+
+// ContactGroupSummary — группа с количеством сохраненных контактов.
+type ContactGroupSummary struct {
+	ContactGroup
+	Members int64 `json:"members"`
+}
+
+
+func normalizeContactEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrInvalidContactEmail
+	}
+	return email, nil
+}
+
+
+func (f *ContactFields) normalize() error {
+	email, err := normalizeContactEmail(f.Email)
+	if err != nil {
+		return err
+	}
+	f.Email = email
+	f.Name = strings.TrimSpace(f.Name)
+	f.Phone = strings.TrimSpace(f.Phone)
+	f.Organization = strings.TrimSpace(f.Organization)
+
+	if utf8.RuneCountInString(f.Name) > MaxContactNameLength ||
+		utf8.RuneCountInString(f.Organization) > MaxContactNameLength ||
+		utf8.RuneCountInString(f.Phone) > 50 ||
+		utf8.RuneCountInString(f.Notes) > MaxContactNotesLength {
+		return ErrContactFieldTooLong
+	}
+	return nil
+}
+
+
+func (f *ContactFields) apply(contact *Contact) {
+	contact.Email = f.Email
+	contact.Name = f.Name
+	contact.Phone = f.Phone
+	contact.Organization = f.Organization
+	contact.Notes = f.Notes
+	contact.Auto = false
+}
+
+
+func findContactByEmail(db *gorm.DB, userID uint, email string) (*Contact, error) {
+	var contact Contact
+	if err := db.Where("user_id = ? AND email = ?", userID, email).First(&contact).Error; err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+
+// CreateContact сохраняет контакт. Если адрес уже отслеживался
+// автоматически, запись становится обычным контактом со своей статистикой.
+func CreateContact(db *gorm.DB, userID uint, fields ContactFields) (*Contact, error) {
+	if err := fields.normalize(); err != nil {
+		return nil, err
+	}
+
+	var contact *Contact
+	err := db.Transaction(func(tx *gorm.DB) error {
+		groups, err := findContactGroups(tx, userID, fields.GroupIDs)
+		if err != nil {
+			return err
+		}
+
+		existing, err := findContactByEmail(tx, userID, fields.Email)
+		switch {
+		case err == nil && !existing.Auto:
+			return ErrContactExists
+		case err == nil:
+			contact = existing
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			contact = &Contact{UserID: userID}
+		default:
+			return err
+		}
+
+		fields.apply(contact)
+		if err := tx.Save(contact).Error; err != nil {
+			return err
+		}
+		return replaceContactGroups(tx, contact, groups)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return contact, nil
+}
+
+
+func GetContact(db *gorm.DB, contactID, userID uint) (*Contact, error) {
+	var contact Contact
+	err := db.Preload("Groups").
+		Where("id = ? AND user_id = ? AND auto = ?", contactID, userID, false).
+		First(&contact).Error
+	if err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+
+func ListContacts(db *gorm.DB, userID uint, filter ContactFilter) ([]Contact, error) {
+	query := db.Preload("Groups").Where("contacts.user_id = ? AND contacts.auto = ?", userID, false)
+
+	if filter.GroupID != 0 {
+		query = query.Where("contacts.id IN (?)",
+			db.Table("contact_group_members").Select("contact_id").Where("contact_group_id = ?", filter.GroupID))
+	}
+	if q := strings.ToLower(strings.TrimSpace(filter.Query)); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where("(LOWER(contacts.email) LIKE ? ESCAPE '\\' OR LOWER(contacts.name) LIKE ? ESCAPE '\\')", pattern, pattern)
+	}
+
+	var contacts []Contact
+	err := query.Order("contacts.name ASC, contacts.email ASC").Find(&contacts).Error
+	return contacts, err
+}
+
+
+func UpdateContact(db *gorm.DB, contact *Contact, fields ContactFields) error {
+	if err := fields.normalize(); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		groups, err := findContactGroups(tx, contact.UserID, fields.GroupIDs)
+		if err != nil {
+			return err
+		}
+
+		if fields.Email != contact.Email {
+			existing, err := findContactByEmail(tx, contact.UserID, fields.Email)
+			if err == nil && !existing.Auto {
+				return ErrContactExists
+			}
+			if err == nil {
+				// Статистика автоматической записи переходит к контакту
+				contact.ContactCount += existing.ContactCount
+				if err := tx.Delete(existing).Error; err != nil {
+					return err
+				}
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		fields.apply(contact)
+		if err := tx.Omit("Groups").Save(contact).Error; err != nil {
+			return err
+		}
+		return replaceContactGroups(tx, contact, groups)
+	})
+}
+
+
+func DeleteContact(db *gorm.DB, contactID, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		contact, err := GetContact(tx, contactID, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(contact).Association("Groups").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(contact).Error
+	})
+}
+
+
+// RecordContactUsage учитывает отправку письма на адрес: увеличивает счетчик
+// контакта или создает автоматическую запись для нового адресата.
+func RecordContactUsage(db *gorm.DB, userID uint, email, name string) error {
+	email, err := normalizeContactEmail(email)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := db.Model(&Contact{}).
+		Where("user_id = ? AND email = ?", userID, email).
+		Updates(map[string]interface{}{
+			"contact_count":     gorm.Expr("contact_count + 1"),
+			"last_contacted_at": now,
+		})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+
+	return db.Create(&Contact{
+		UserID:          userID,
+		Email:           email,
+		Name:            name,
+		Auto:            true,
+		ContactCount:    1,
+		LastContactedAt: &now,
+	}).Error
+}
+
+
+// FrequentContacts возвращает адресатов, которым пользователь пишет чаще
+// всего, включая еще не сохраненных.
+func FrequentContacts(db *gorm.DB, userID uint, limit int) ([]Contact, error) {
+	var contacts []Contact
+	err := db.Where("user_id = ? AND contact_count > 0", userID).
+		Order("contact_count DESC, last_contacted_at DESC").
+		Limit(clampSuggestions(limit)).
+		Find(&contacts).Error
+	return contacts, err
+}
+
+
+// AutocompleteContacts подбирает адресатов по началу адреса, имени или
+// любого слова в имени. Частые адресаты идут первыми.
+func AutocompleteContacts(db *gorm.DB, userID uint, prefix string, limit int) ([]Contact, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return []Contact{}, nil
+	}
+
+	start := escapeLike(prefix) + "%"
+	word := "% " + start
+
+	var contacts []Contact
+	err := db.Where("user_id = ?", userID).
+		Where("(LOWER(email) LIKE ? ESCAPE '\\' OR LOWER(name) LIKE ? ESCAPE '\\' OR LOWER(name) LIKE ? ESCAPE '\\')", start, start, word).
+		Order("contact_count DESC, name ASC, email ASC").
+		Limit(clampSuggestions(limit)).
+		Find(&contacts).Error
+	return contacts, err
+}
+
+
+func clampSuggestions(limit int) int {
+	if limit <= 0 {
+		return DefaultContactSuggestions
+	}
+	if limit > MaxContactSuggestions {
+		return MaxContactSuggestions
+	}
+	return limit
+}
+
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+
+// ImportContacts добавляет контакты из импортируемого файла. Существующие
+// контакты дополняются непустыми полями, группы объединяются. Записи без
+// корректного адреса пропускаются.
+func ImportContacts(db *gorm.DB, userID uint, entries []ContactImport) (*ContactImportResult, error) {
+	result := &ContactImportResult{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		groupsByName := map[string]*ContactGroup{}
+
+		for _, entry := range entries {
+			if err := entry.normalize(); err != nil {
+				result.Skipped++
+				continue
+			}
+
+			contact, err := findContactByEmail(tx, userID, entry.Email)
+			switch {
+			case err == nil:
+				mergeContactFields(contact, entry.ContactFields)
+				result.Updated++
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				contact = &Contact{UserID: userID}
+				entry.apply(contact)
+				result.Created++
+			default:
+				return err
+			}
+
+			if err := tx.Save(contact).Error; err != nil {
+				return err
+			}
+
+			var groups []ContactGroup
+			for _, name := range entry.Groups {
+				group, err := importContactGroup(tx, userID, name, groupsByName)
+				if err != nil {
+					return err
+				}
+				if group != nil {
+					groups = append(groups, *group)
+				}
+			}
+			if len(groups) > 0 {
+				if err := tx.Model(contact).Association("Groups").Append(groups); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+
+func mergeContactFields(contact *Contact, fields ContactFields) {
+	if fields.Name != "" {
+		contact.Name = fields.Name
+	}
+	if fields.Phone != "" {
+		contact.Phone = fields.Phone
+	}
+	if fields.Organization != "" {
+		contact.Organization = fields.Organization
+	}
+	if fields.Notes != "" {
+		contact.Notes = fields.Notes
+	}
+	contact.Auto = false
+}
+
+
+func importContactGroup(db *gorm.DB, userID uint, name string, cache map[string]*ContactGroup) (*ContactGroup, error) {
+	name, err := normalizeContactGroupName(name)
+	if err != nil {
+		return nil, nil
+	}
+	if group, ok := cache[name]; ok {
+		return group, nil
+	}
+
+	group := &ContactGroup{}
+	err = db.Where(ContactGroup{UserID: userID, Name: name}).FirstOrCreate(group).Error
+	if err != nil {
+		return nil, err
+	}
+	cache[name] = group
+	return group, nil
+}
+
+
+func normalizeContactGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxContactGroupLength {
+		return "", ErrContactGroupName
+	}
+	return name, nil
+}
+
+
+func findContactGroups(db *gorm.DB, userID uint, ids []uint) ([]ContactGroup, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var groups []ContactGroup
+	if err := db.Where("user_id = ? AND id IN ?", userID, ids).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	unique := map[uint]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(groups) != len(unique) {
+		return nil, ErrContactGroupNotFound
+	}
+	return groups, nil
+}
+
+
+func replaceContactGroups(db *gorm.DB, contact *Contact, groups []ContactGroup) error {
+	if err := db.Model(contact).Association("Groups").Replace(groups); err != nil {
+		return err
+	}
+	contact.Groups = groups
+	if contact.Groups == nil {
+		contact.Groups = []ContactGroup{}
+	}
+	return nil
+}
+
+
+func CreateContactGroup(db *gorm.DB, userID uint, name string) (*ContactGroup, error) {
+	name, err := normalizeContactGroupName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := db.Model(&ContactGroup{}).Where("user_id = ? AND name = ?", userID, name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrContactGroupExists
+	}
+
+	group := &ContactGroup{UserID: userID, Name: name}
+	if err := db.Create(group).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+
+func GetContactGroup(db *gorm.DB, groupID, userID uint) (*ContactGroup, error) {
+	var group ContactGroup
+	if err := db.Where("id = ? AND user_id = ?", groupID, userID).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+
+func ListContactGroups(db *gorm.DB, userID uint) ([]ContactGroupSummary, error) {
+	var groups []ContactGroupSummary
+	err := db.Model(&ContactGroup{}).
+		Select("contact_groups.*, COUNT(contacts.id) AS members").
+		Joins("LEFT JOIN contact_group_members ON contact_group_members.contact_group_id = contact_groups.id").
+		Joins("LEFT JOIN contacts ON contacts.id = contact_group_members.contact_id AND contacts.auto = ?", false).
+		Where("contact_groups.user_id = ?", userID).
+		Group("contact_groups.id").
+		Order("contact_groups.name ASC").
+		Scan(&groups).Error
+	return groups, err
+}
+
+
+func RenameContactGroup(db *gorm.DB, group *ContactGroup, name string) error {
+	name, err := normalizeContactGroupName(name)
+	if err != nil {
+		return err
+	}
+	if name == group.Name {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&ContactGroup{}).Where("user_id = ? AND name = ?", group.UserID, name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrContactGroupExists
+	}
+
+	if err := db.Model(group).Update("name", name).Error; err != nil {
+		return err
+	}
+	group.Name = name
+	return nil
+}
+
+
+// DeleteContactGroup удаляет группу, оставляя входившие в нее контакты.
+func DeleteContactGroup(db *gorm.DB, groupID, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		group, err := GetContactGroup(tx, groupID, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM contact_group_members WHERE contact_group_id = ?", group.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
+
+
+// deleteUserContacts удаляет адресную книгу пользователя целиком.
+func deleteUserContacts(db *gorm.DB, userID uint) error {
+	err := db.Exec("DELETE FROM contact_group_members WHERE contact_id IN (SELECT id FROM contacts WHERE user_id = ?)", userID).Error
+	if err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&Contact{}, &ContactGroup{}} {
+		if err := db.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+// ContactImportFromCard берет из карточки первый адрес и первый телефон,
+// категории становятся группами.
+func ContactImportFromCard(card *vcard.Card) ContactImport {
+	entry := ContactImport{
+		ContactFields: ContactFields{
+			Name:         card.Name(),
+			Organization: card.Organization,
+			Notes:        card.Note,
+		},
+		Groups: card.Categories,
+	}
+	if len(card.Emails) > 0 {
+		entry.Email = card.Emails[0]
+	}
+	if len(card.Phones) > 0 {
+		entry.Phone = card.Phones[0]
+	}
+	return entry
+}
+
+
+// ContactCards преобразует контакты в карточки vCard. Группы становятся
+// категориями, поэтому контакты должны быть загружены вместе с ними.
+func ContactCards(contacts []Contact) []vcard.Card {
+	cards := make([]vcard.Card, 0, len(contacts))
+	for _, contact := range contacts {
+		card := vcard.Card{
+			UID:           fmt.Sprintf("cw-mail-contact-%d", contact.ID),
+			FormattedName: contact.Name,
+			Emails:        []string{contact.Email},
+			Organization:  contact.Organization,
+			Note:          contact.Notes,
+		}
+		if contact.Phone != "" {
+			card.Phones = []string{contact.Phone}
+		}
+		for _, group := range contact.Groups {
+			card.Categories = append(card.Categories, group.Name)
+		}
+		cards = append(cards, card)
+	}
+	return cards
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateContact(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+
+	group, err := CreateContactGroup(db, user.ID, "Работа")
+	if err != nil {
+		t.Fatalf("Ошибка создания группы: %v", err)
+	}
+
+	contact, err := CreateContact(db, user.ID, ContactFields{
+		Email:    " Ivan@Example.com ",
+		Name:     "Иван",
+		GroupIDs: []uint{group.ID},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка создания контакта: %v", err)
+	}
+	if contact.Email != "ivan@example.com" {
+		t.Errorf("Адрес должен приводиться к нижнему регистру, получено %q", contact.Email)
+	}
+
+	stored, err := GetContact(db, contact.ID, user.ID)
+	if err != nil {
+		t.Fatalf("Контакт не найден: %v", err)
+	}
+	if len(stored.Groups) != 1 || stored.Groups[0].ID != group.ID {
+		t.Errorf("Контакт должен входить в группу, получено %+v", stored.Groups)
+	}
+
+	if _, err := CreateContact(db, user.ID, ContactFields{Email: "ivan@example.com"}); !errors.Is(err, ErrContactExists) {
+		t.Errorf("Ожидалась ошибка дубликата, получено %v", err)
+	}
+	if _, err := CreateContact(db, user.ID, ContactFields{Email: "not-an-email"}); !errors.Is(err, ErrInvalidContactEmail) {
+		t.Errorf("Ожидалась ошибка адреса, получено %v", err)
+	}
+
+	other, _ := CreateUser(db, "other@example.com", "password123")
+	if _, err := CreateContact(db, other.ID, ContactFields{Email: "ivan@example.com", GroupIDs: []uint{group.ID}}); !errors.Is(err, ErrContactGroupNotFound) {
+		t.Errorf("Чужая группа не должна быть доступна, получено %v", err)
+	}
+	if _, err := GetContact(db, contact.ID, other.ID); err == nil {
+		t.Error("Чужой контакт не должен быть доступен")
+	}
+}
+
+func TestContactUsageTracking(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+
+	for i := 0; i < 3; i++ {
+		RecordContactUsage(db, user.ID, "often@example.com", "Частый")
+	}
+	RecordContactUsage(db, user.ID, "rare@example.com", "")
+
+	frequent, err := FrequentContacts(db, user.ID, 0)
+	if err != nil {
+		t.Fatalf("Ошибка получения частых контактов: %v", err)
+	}
+	if len(frequent) != 2 || frequent[0].Email != "often@example.com" || frequent[0].ContactCount != 3 {
+		t.Errorf("Неверный список частых контактов: %+v", frequent)
+	}
+
+	// Автоматические записи не видны в адресной книге
+	contacts, _ := ListContacts(db, user.ID, ContactFilter{})
+	if len(contacts) != 0 {
+		t.Errorf("Автоматические записи не должны попадать в список контактов: %+v", contacts)
+	}
+
+	// Сохранение адреса превращает автоматическую запись в контакт со статистикой
+	contact, err := CreateContact(db, user.ID, ContactFields{Email: "often@example.com", Name: "Коллега"})
+	if err != nil {
+		t.Fatalf("Ошибка сохранения контакта: %v", err)
+	}
+	if contact.ContactCount != 3 || contact.Name != "Коллега" {
+		t.Errorf("Статистика должна сохраниться: %+v", contact)
+	}
+
+	suggestions, _ := AutocompleteContacts(db, user.ID, "r", 0)
+	if len(suggestions) != 1 || suggestions[0].Email != "rare@example.com" {
+		t.Errorf("Неверные подсказки: %+v", suggestions)
+	}
+}
+
+func TestAutocompleteContacts(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+
+	CreateContact(db, user.ID, ContactFields{Email: "john.doe@example.com", Name: "John Doe"})
+	CreateContact(db, user.ID, ContactFields{Email: "jane@example.com", Name: "Jane Roe"})
+	CreateContact(db, user.ID, ContactFields{Email: "percent%@example.com", Name: "Percent"})
+	RecordContactUsage(db, user.ID, "jane@example.com", "")
+
+	tests := map[string][]string{
+		"j":    {"jane@example.com", "john.doe@example.com"},
+		"DOE":  {"john.doe@example.com"},
+		"roe":  {"jane@example.com"},
+		"%":    {},
+		"perc": {"percent%@example.com"},
+		"":     {},
+		"oe":   {},
+	}
+
+	for prefix, want := range tests {
+		got, err := AutocompleteContacts(db, user.ID, prefix, 0)
+		if err != nil {
+			t.Fatalf("Ошибка подсказок для %q: %v", prefix, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%q: ожидалось %v, получено %+v", prefix, want, got)
+			continue
+		}
+		for i := range want {
+			if got[i].Email != want[i] {
+				t.Errorf("%q: ожидалось %v, получено %+v", prefix, want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestUpdateAndDeleteContact(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+	group, _ := CreateContactGroup(db, user.ID, "Друзья")
+
+	first, _ := CreateContact(db, user.ID, ContactFields{Email: "a@example.com", GroupIDs: []uint{group.ID}})
+	CreateContact(db, user.ID, ContactFields{Email: "b@example.com"})
+
+	if err := UpdateContact(db, first, ContactFields{Email: "b@example.com"}); !errors.Is(err, ErrContactExists) {
+		t.Errorf("Ожидалась ошибка дубликата при смене адреса, получено %v", err)
+	}
+
+	if err := UpdateContact(db, first, ContactFields{Email: "c@example.com", Name: "Новое имя"}); err != nil {
+		t.Fatalf("Ошибка обновления контакта: %v", err)
+	}
+	stored, _ := GetContact(db, first.ID, user.ID)
+	if stored.Email != "c@example.com" || stored.Name != "Новое имя" || len(stored.Groups) != 0 {
+		t.Errorf("Контакт обновлен неверно: %+v", stored)
+	}
+
+	groups, _ := ListContactGroups(db, user.ID)
+	if len(groups) != 1 || groups[0].Members != 0 {
+		t.Errorf("Неверное число участников группы: %+v", groups)
+	}
+
+	if err := DeleteContact(db, first.ID, user.ID); err != nil {
+		t.Fatalf("Ошибка удаления контакта: %v", err)
+	}
+	if _, err := GetContact(db, first.ID, user.ID); err == nil {
+		t.Error("Контакт должен быть удален")
+	}
+}
+
+func TestContactGroups(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+
+	work, _ := CreateContactGroup(db, user.ID, "Работа")
+	CreateContactGroup(db, user.ID, "Семья")
+	if _, err := CreateContactGroup(db, user.ID, " Работа "); !errors.Is(err, ErrContactGroupExists) {
+		t.Errorf("Ожидалась ошибка дубликата группы, получено %v", err)
+	}
+	if _, err := CreateContactGroup(db, user.ID, "  "); !errors.Is(err, ErrContactGroupName) {
+		t.Errorf("Ожидалась ошибка названия, получено %v", err)
+	}
+	if err := RenameContactGroup(db, work, "Семья"); !errors.Is(err, ErrContactGroupExists) {
+		t.Errorf("Ожидалась ошибка дубликата при переименовании, получено %v", err)
+	}
+
+	contact, _ := CreateContact(db, user.ID, ContactFields{Email: "a@example.com", GroupIDs: []uint{work.ID}})
+	CreateContact(db, user.ID, ContactFields{Email: "b@example.com"})
+
+	inGroup, _ := ListContacts(db, user.ID, ContactFilter{GroupID: work.ID})
+	if len(inGroup) != 1 || inGroup[0].ID != contact.ID {
+		t.Errorf("Фильтр по группе работает неверно: %+v", inGroup)
+	}
+
+	if err := DeleteContactGroup(db, work.ID, user.ID); err != nil {
+		t.Fatalf("Ошибка удаления группы: %v", err)
+	}
+	stored, err := GetContact(db, contact.ID, user.ID)
+	if err != nil || len(stored.Groups) != 0 {
+		t.Errorf("Контакт должен остаться без группы: %+v, %v", stored, err)
+	}
+}
+
+func TestImportContacts(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+	CreateContact(db, user.ID, ContactFields{Email: "known@example.com", Name: "Старое имя", Phone: "123"})
+
+	result, err := ImportContacts(db, user.ID, []ContactImport{
+		{ContactFields: ContactFields{Email: "Known@example.com", Name: "Новое имя"}, Groups: []string{"Импорт"}},
+		{ContactFields: ContactFields{Email: "new@example.com"}, Groups: []string{"Импорт", "Другое"}},
+		{ContactFields: ContactFields{Email: ""}},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка импорта: %v", err)
+	}
+	if *result != (ContactImportResult{Created: 1, Updated: 1, Skipped: 1}) {
+		t.Errorf("Неверный результат импорта: %+v", result)
+	}
+
+	contacts, _ := ListContacts(db, user.ID, ContactFilter{Query: "known"})
+	if len(contacts) != 1 || contacts[0].Name != "Новое имя" || contacts[0].Phone != "123" {
+		t.Errorf("Существующий контакт должен дополниться: %+v", contacts)
+	}
+
+	groups, _ := ListContactGroups(db, user.ID)
+	if len(groups) != 2 || groups[1].Name != "Импорт" || groups[1].Members != 2 {
+		t.Errorf("Группы должны создаваться по названию: %+v", groups)
+	}
+}
+
+func TestAnonymizeUserDeletesContacts(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "owner@example.com", "password123")
+	group, _ := CreateContactGroup(db, user.ID, "Работа")
+	CreateContact(db, user.ID, ContactFields{Email: "a@example.com", GroupIDs: []uint{group.ID}})
+
+	if _, err := AnonymizeUser(db, user.ID); err != nil {
+		t.Fatalf("Ошибка анонимизации: %v", err)
+	}
+
+	var contacts, groups, members int64
+	db.Model(&Contact{}).Where("user_id = ?", user.ID).Count(&contacts)
+	db.Model(&ContactGroup{}).Where("user_id = ?", user.ID).Count(&groups)
+	db.Table("contact_group_members").Count(&members)
+	if contacts+groups+members != 0 {
+		t.Errorf("Адресная книга должна быть удалена: контакты %d, группы %d, связи %d", contacts, groups, members)
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+)
+
+
+var ErrExportInProgress = errors.New("выгрузка данных уже выполняется")
+
+
+// DataExport — запрос пользователя на выгрузку персональных данных. Архив
+// собирается в фоне и хранится ограниченное время.
+type DataExport struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"-" gorm:"index;not null"`
+	Status      string     `json:"status" gorm:"not null;default:pending"`
+	FilePath    string     `json:"-"`
+	Size        int64      `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" gorm:"index"`
+}
+
+
+func (e *DataExport) IsReady() bool {
+	return e.Status == ExportStatusReady && e.FilePath != ""
+}
+
+
+func CreateDataExport(db *gorm.DB, userID uint) (*DataExport, error) {
+	var active int64
+	err := db.Model(&DataExport{}).
+		Where("user_id = ? AND status IN ?", userID, []string{ExportStatusPending, ExportStatusProcessing}).
+		Count(&active).Error
+	if err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, ErrExportInProgress
+	}
+
+	export := &DataExport{UserID: userID, Status: ExportStatusPending}
+	if err := db.Create(export).Error; err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+
+func GetDataExport(db *gorm.DB, exportID, userID uint) (*DataExport, error) {
+	var export DataExport
+	if err := db.Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+
+func ListDataExports(db *gorm.DB, userID uint) ([]DataExport, error) {
+	var exports []DataExport
+	err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&exports).Error
+	return exports, err
+}
+
+
+// PendingDataExports возвращает незавершенные выгрузки, например прерванные
+// перезапуском сервера.
+func PendingDataExports(db *gorm.DB) ([]DataExport, error) {
+	var exports []DataExport
+	err := db.Where("status IN ?", []string{ExportStatusPending, ExportStatusProcessing}).
+		Order("id ASC").
+		Find(&exports).Error
+	return exports, err
+}
+
+
+func ExpiredDataExports(db *gorm.DB, now time.Time) ([]DataExport, error) {
+	var exports []DataExport
+	err := db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&exports).Error
+	return exports, err
+}
+
+
+func MarkDataExportProcessing(db *gorm.DB, export *DataExport) error {
+	export.Status = ExportStatusProcessing
+	return db.Model(export).Update("status", ExportStatusProcessing).Error
+}
+
+
+func CompleteDataExport(db *gorm.DB, export *DataExport, path string, size int64, ttl time.Duration) error {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	export.Status = ExportStatusReady
+	export.FilePath = path
+	export.Size = size
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+
+	return db.Model(export).Updates(map[string]interface{}{
+		"status":       ExportStatusReady,
+		"file_path":    path,
+		"size":         size,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+
+func FailDataExport(db *gorm.DB, export *DataExport, reason string) error {
+	now := time.Now()
+
+	export.Status = ExportStatusFailed
+	export.Error = reason
+	export.CompletedAt = &now
+
+	return db.Model(export).Updates(map[string]interface{}{
+		"status":       ExportStatusFailed,
+		"error":        reason,
+		"completed_at": now,
+	}).Error
+}
+
+
+func DeleteDataExport(db *gorm.DB, exportID uint) error {
+	return db.Delete(&DataExport{}, exportID).Error
+}
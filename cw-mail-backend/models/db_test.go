@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Ошибка получения соединения: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&User{}, &Message{}, &EmailVerification{}, &MFARecoveryCode{}, &APIToken{}, &AuditLog{}, &DataExport{}, &Contact{}, &ContactGroup{},
+		&DistributionList{}, &DistributionListMember{}, &EmailAlias{}, &BlockedSender{}, &FilterRule{},
+		&SieveScript{}, &AutoReply{}, &VacationSettings{}, &SpamSettings{}, &SpamToken{}, &QuarantinedMessage{}, &OutboxEvent{}, &DeadLetter{}, &Webhook{}, &WebhookDelivery{}); err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	return db
+}
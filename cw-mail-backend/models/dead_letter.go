@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	DeadLetterPending   = "pending"
+	DeadLetterReplayed  = "replayed"
+	DeadLetterDiscarded = "discarded"
+)
+
+
+var ErrDeadLetterResolved = errors.New("сообщение уже отправлено повторно или удалено")
+
+
+// DeadLetter — событие, которое потребитель очереди не смог обработать
+// после всех повторов. Хранится до решения администратора: повторно
+// отправить его в исходную очередь или удалить.
+type DeadLetter struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Queue        string     `json:"queue" gorm:"index;not null"`
+	RoutingKey   string     `json:"routing_key" gorm:"not null"`
+	MessageID    string     `json:"message_id,omitempty" gorm:"index"`
+	Payload      string     `json:"payload,omitempty" gorm:"type:text"`
+	Reason       string     `json:"reason"`
+	LastError    string     `json:"last_error,omitempty"`
+	Attempts     int        `json:"attempts" gorm:"not null"`
+	Status       string     `json:"status" gorm:"index;not null"`
+	ResolvedByID *uint      `json:"resolved_by_id,omitempty"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+
+// SaveDeadLetter сохраняет недоставленное сообщение. Брокер может передать
+// сообщение повторно, если подтверждение потерялось, поэтому сообщение с
+// тем же message_id, еще ожидающее решения, не дублируется.
+func SaveDeadLetter(db *gorm.DB, letter *DeadLetter) error {
+	letter.Status = DeadLetterPending
+	if letter.MessageID != "" {
+		var existing DeadLetter
+		err := db.Where("queue = ? AND message_id = ? AND status = ?", letter.Queue, letter.MessageID, DeadLetterPending).
+			First(&existing).Error
+		if err == nil {
+			*letter = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return db.Create(letter).Error
+}
+
+
+type DeadLetterFilter struct {
+	Queue  string
+	Status string
+	Page   int
+	Limit  int
+}
+
+
+func ListDeadLetters(db *gorm.DB, filter DeadLetterFilter) ([]DeadLetter, int64, error) {
+	query := db.Model(&DeadLetter{})
+	if filter.Queue != "" {
+		query = query.Where("queue = ?", filter.Queue)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var letters []DeadLetter
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&letters).Error
+	return letters, total, err
+}
+
+
+func GetDeadLetter(db *gorm.DB, id uint) (*DeadLetter, error) {
+	var letter DeadLetter
+	if err := db.First(&letter, id).Error; err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+
+// ReplayDeadLetter отмечает сообщение как отправленное повторно. Вызывается
+// в транзакции, чтобы при ошибке публикации отметка откатилась.
+func ReplayDeadLetter(db *gorm.DB, id, adminID uint) (*DeadLetter, error) {
+	letter, err := GetDeadLetter(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if letter.Status != DeadLetterPending {
+		return nil, ErrDeadLetterResolved
+	}
+
+	if err := resolveDeadLetter(db, letter, DeadLetterReplayed, adminID, nil); err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
+
+
+// DiscardDeadLetter удаляет сообщение без повторной отправки. Запись
+// остается для истории, но тело события стирается.
+func DiscardDeadLetter(db *gorm.DB, id, adminID uint) (*DeadLetter, error) {
+	letter, err := GetDeadLetter(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if letter.Status != DeadLetterPending {
+		return nil, ErrDeadLetterResolved
+	}
+
+	if err := resolveDeadLetter(db, letter, DeadLetterDiscarded, adminID, map[string]interface{}{"payload": ""}); err != nil {
+		return nil, err
+	}
+	letter.Payload = ""
+	return letter, nil
+}
+
+
+func resolveDeadLetter(db *gorm.DB, letter *DeadLetter, status string, adminID uint, updates map[string]interface{}) error {
+	now := time.Now()
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["status"] = status
+	updates["resolved_by_id"] = adminID
+	updates["resolved_at"] = now
+
+	result := db.Model(&DeadLetter{}).
+		Where("id = ? AND status = ?", letter.ID, DeadLetterPending).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeadLetterResolved
+	}
+
+	letter.Status = status
+	letter.ResolvedByID = &adminID
+	letter.ResolvedAt = &now
+	return nil
+}
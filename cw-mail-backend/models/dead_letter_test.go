@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeadLetterReplayAndDiscard(t *testing.T) {
+	db := setupTestDB(t)
+	admin, _ := CreateUser(db, "admin@example.com", "password123")
+
+	first := &DeadLetter{Queue: "domain_events", RoutingKey: "message.read", MessageID: "12", Payload: `{"message_id":5}`, Reason: "failed", Attempts: 4}
+	if err := SaveDeadLetter(db, first); err != nil || first.Status != DeadLetterPending {
+		t.Fatalf("Ошибка сохранения: %+v, %v", first, err)
+	}
+
+	// Повторная доставка того же сообщения брокером не создает дубликат
+	duplicate := &DeadLetter{Queue: "domain_events", RoutingKey: "message.read", MessageID: "12", Payload: `{"message_id":5}`}
+	if err := SaveDeadLetter(db, duplicate); err != nil || duplicate.ID != first.ID {
+		t.Errorf("Повтор должен вернуть сохраненную запись %d, получено %d, %v", first.ID, duplicate.ID, err)
+	}
+
+	second := &DeadLetter{Queue: "scan_verdicts", RoutingKey: "scan.reject", Payload: `{}`, Reason: "rejected"}
+	SaveDeadLetter(db, second)
+
+	letters, total, err := ListDeadLetters(db, DeadLetterFilter{Queue: "domain_events"})
+	if err != nil || total != 1 || letters[0].ID != first.ID {
+		t.Fatalf("Фильтр по очереди: %+v, %d, %v", letters, total, err)
+	}
+
+	replayed, err := ReplayDeadLetter(db, first.ID, admin.ID)
+	if err != nil || replayed.Status != DeadLetterReplayed || replayed.ResolvedByID == nil || *replayed.ResolvedByID != admin.ID {
+		t.Fatalf("Ошибка повторной отправки: %+v, %v", replayed, err)
+	}
+	if replayed.Payload == "" {
+		t.Error("При повторной отправке тело события сохраняется")
+	}
+	if _, err := DiscardDeadLetter(db, first.ID, admin.ID); !errors.Is(err, ErrDeadLetterResolved) {
+		t.Errorf("Удаление обработанного сообщения должно возвращать ErrDeadLetterResolved, получено %v", err)
+	}
+
+	discarded, err := DiscardDeadLetter(db, second.ID, admin.ID)
+	if err != nil || discarded.Status != DeadLetterDiscarded || discarded.Payload != "" {
+		t.Fatalf("Ошибка удаления: %+v, %v", discarded, err)
+	}
+	stored, _ := GetDeadLetter(db, second.ID)
+	if stored.Payload != "" || stored.RoutingKey != "scan.reject" {
+		t.Errorf("У удаленного сообщения стирается только тело: %+v", stored)
+	}
+
+	_, total, _ = ListDeadLetters(db, DeadLetterFilter{Status: DeadLetterPending})
+	if total != 0 {
+		t.Errorf("Ожидающих сообщений: %d, ожидалось 0", total)
+	}
+}
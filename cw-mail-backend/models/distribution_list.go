@@ -0,0 +1,418 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	// Кто может писать в список рассылки. Владелец и администраторы могут
+	// писать в любой список.
+	ListPostAnyone  = "anyone"
+	ListPostMembers = "members"
+	ListPostOwner   = "owner"
+
+	MaxDistributionListsPerUser = 20
+	MaxListNameLength           = 100
+	MaxListDescriptionLength    = 500
+)
+
+
+var ValidListPostPolicies = []string{ListPostAnyone, ListPostMembers, ListPostOwner}
+
+
+var (
+	ErrAddressInUse        = errors.New("адрес уже занят")
+	ErrInvalidListAddress  = errors.New("неверный адрес списка рассылки")
+	ErrInvalidPostPolicy   = errors.New("недопустимая политика отправки")
+	ErrListFieldTooLong    = errors.New("название или описание списка слишком длинное")
+	ErrListLimitReached    = errors.New("достигнуто максимальное количество списков рассылки")
+	ErrListPostForbidden   = errors.New("нет прав на отправку в этот список рассылки")
+	ErrListNoRecipients    = errors.New("в списке рассылки нет получателей")
+	ErrAlreadyListMember   = errors.New("пользователь уже состоит в списке рассылки")
+	ErrListOwnerMembership = errors.New("владельца нельзя исключить из списка рассылки")
+)
+
+
+// DistributionList — групповой адрес (например team@example.com). Письмо на
+// него доставляется каждому участнику отдельной копией.
+type DistributionList struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Address     string    `json:"address" gorm:"uniqueIndex;not null"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	OwnerID     uint      `json:"owner_id" gorm:"index;not null"`
+	PostPolicy  string    `json:"post_policy" gorm:"not null;default:members"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	Owner       User      `json:"-" gorm:"foreignKey:OwnerID"`
+}
+
+
+type DistributionListMember struct {
+	ListID    uint      `json:"list_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	User      User      `json:"-" gorm:"foreignKey:UserID"`
+}
+
+
+type DistributionListFields struct {
+	Address     string
+	Name        string
+	Description string
+	PostPolicy  string
+}
+
+
+func IsValidListPostPolicy(policy string) bool {
+	for _, valid := range ValidListPostPolicies {
+		if policy == valid {
+			return true
+		}
+	}
+	return false
+}
+
+
+func (f *DistributionListFields) normalize() error {
+	address, err := normalizeContactEmail(f.Address)
+	if err != nil {
+		return ErrInvalidListAddress
+	}
+	f.Address = address
+	f.Name = strings.TrimSpace(f.Name)
+	f.Description = strings.TrimSpace(f.Description)
+
+	if f.Name == "" {
+		f.Name = address
+	}
+	if f.PostPolicy == "" {
+		f.PostPolicy = ListPostMembers
+	}
+	if !IsValidListPostPolicy(f.PostPolicy) {
+		return ErrInvalidPostPolicy
+	}
+	if utf8.RuneCountInString(f.Name) > MaxListNameLength || utf8.RuneCountInString(f.Description) > MaxListDescriptionLength {
+		return ErrListFieldTooLong
+	}
+	return nil
+}
+
+
+// AddressInUse проверяет, занят ли адрес пользователем, псевдонимом или
+// списком рассылки.
+func AddressInUse(db *gorm.DB, address string) (bool, error) {
+	address = normalizeAddress(address)
+
+	checks := []struct {
+		model interface{}
+		query string
+	}{
+		{&User{}, "LOWER(email) = ?"},
+		{&EmailAlias{}, "address = ?"},
+		{&DistributionList{}, "address = ?"},
+	}
+
+	for _, check := range checks {
+		var count int64
+		if err := db.Model(check.model).Where(check.query, address).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+
+// CanManage — управлять списком (настройки, участники) могут владелец и
+// администраторы.
+func (l *DistributionList) CanManage(user *User) bool {
+	return l.OwnerID == user.ID || user.IsAdmin()
+}
+
+
+// CanPost проверяет право пользователя писать в список по его политике.
+func (l *DistributionList) CanPost(db *gorm.DB, user *User) (bool, error) {
+	if l.CanManage(user) {
+		return true, nil
+	}
+
+	switch l.PostPolicy {
+	case ListPostAnyone:
+		return true, nil
+	case ListPostMembers:
+		return IsDistributionListMember(db, l.ID, user.ID)
+	default:
+		return false, nil
+	}
+}
+
+
+// CreateDistributionList создает список, владелец становится его участником.
+// Обычный пользователь может владеть ограниченным числом списков и только
+// адресами, разрешенными policy.
+func CreateDistributionList(db *gorm.DB, owner *User, fields DistributionListFields, policy AddressPolicy) (*DistributionList, error) {
+	if err := fields.normalize(); err != nil {
+		return nil, err
+	}
+	if err := policy.Check(owner, fields.Address); err != nil {
+		return nil, err
+	}
+
+	list := &DistributionList{
+		Address:     fields.Address,
+		Name:        fields.Name,
+		Description: fields.Description,
+		OwnerID:     owner.ID,
+		PostPolicy:  fields.PostPolicy,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !owner.IsAdmin() {
+			var owned int64
+			if err := tx.Model(&DistributionList{}).Where("owner_id = ?", owner.ID).Count(&owned).Error; err != nil {
+				return err
+			}
+			if owned >= MaxDistributionListsPerUser {
+				return ErrListLimitReached
+			}
+		}
+
+		inUse, err := AddressInUse(tx, list.Address)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrAddressInUse
+		}
+
+		if err := tx.Create(list).Error; err != nil {
+			return err
+		}
+		return tx.Create(&DistributionListMember{ListID: list.ID, UserID: owner.ID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+
+func GetDistributionList(db *gorm.DB, listID uint) (*DistributionList, error) {
+	var list DistributionList
+	if err := db.Preload("Owner", selectParticipantColumns).First(&list, listID).Error; err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+
+func FindDistributionListByAddress(db *gorm.DB, address string) (*DistributionList, error) {
+	var list DistributionList
+	err := db.Where("address = ?", normalizeAddress(address)).First(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+
+// ListUserDistributionLists возвращает списки, которыми пользователь владеет
+// или в которых состоит.
+func ListUserDistributionLists(db *gorm.DB, userID uint) ([]DistributionList, error) {
+	var lists []DistributionList
+	err := db.Preload("Owner", selectParticipantColumns).
+		Where("owner_id = ? OR id IN (?)", userID,
+			db.Model(&DistributionListMember{}).Select("list_id").Where("user_id = ?", userID)).
+		Order("address ASC").
+		Find(&lists).Error
+	return lists, err
+}
+
+
+func ListAllDistributionLists(db *gorm.DB) ([]DistributionList, error) {
+	var lists []DistributionList
+	err := db.Preload("Owner", selectParticipantColumns).Order("address ASC").Find(&lists).Error
+	return lists, err
+}
+
+
+// UpdateDistributionList меняет настройки списка. Новый адрес проверяется
+// по policy для пользователя editor.
+func UpdateDistributionList(db *gorm.DB, list *DistributionList, editor *User, fields DistributionListFields, policy AddressPolicy) error {
+	if err := fields.normalize(); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if fields.Address != list.Address {
+			if err := policy.Check(editor, fields.Address); err != nil {
+				return err
+			}
+			inUse, err := AddressInUse(tx, fields.Address)
+			if err != nil {
+				return err
+			}
+			if inUse {
+				return ErrAddressInUse
+			}
+		}
+
+		list.Address = fields.Address
+		list.Name = fields.Name
+		list.Description = fields.Description
+		list.PostPolicy = fields.PostPolicy
+
+		return tx.Model(list).Updates(map[string]interface{}{
+			"address":     list.Address,
+			"name":        list.Name,
+			"description": list.Description,
+			"post_policy": list.PostPolicy,
+		}).Error
+	})
+}
+
+
+// DeleteDistributionList удаляет список и членство в нем. Уже доставленные
+// письма остаются у получателей.
+func DeleteDistributionList(db *gorm.DB, listID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", listID).Delete(&DistributionListMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&DistributionList{}, listID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+
+func IsDistributionListMember(db *gorm.DB, listID, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&DistributionListMember{}).Where("list_id = ? AND user_id = ?", listID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+
+// DistributionListMemberCounts возвращает количество участников для
+// каждого из переданных списков.
+func DistributionListMemberCounts(db *gorm.DB, listIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(listIDs))
+	if len(listIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ListID uint
+		Count  int64
+	}
+	err := db.Model(&DistributionListMember{}).
+		Select("list_id, COUNT(*) AS count").
+		Where("list_id IN ?", listIDs).
+		Group("list_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ListID] = row.Count
+	}
+	return counts, nil
+}
+
+
+func ListDistributionListMembers(db *gorm.DB, listID uint) ([]DistributionListMember, error) {
+	var members []DistributionListMember
+	err := db.Preload("User", selectParticipantColumns).
+		Where("list_id = ?", listID).
+		Order("created_at ASC").
+		Find(&members).Error
+	return members, err
+}
+
+
+// AddDistributionListMember добавляет в список зарегистрированного
+// пользователя по адресу.
+func AddDistributionListMember(db *gorm.DB, list *DistributionList, email string) (*DistributionListMember, error) {
+	var user User
+	err := db.Select(participantColumns).
+		Where("email = ? AND anonymized_at IS NULL", normalizeAddress(email)).
+		First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := IsDistributionListMember(db, list.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member {
+		return nil, ErrAlreadyListMember
+	}
+
+	entry := &DistributionListMember{ListID: list.ID, UserID: user.ID}
+	if err := db.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	entry.User = user
+	return entry, nil
+}
+
+
+func RemoveDistributionListMember(db *gorm.DB, list *DistributionList, userID uint) error {
+	if userID == list.OwnerID {
+		return ErrListOwnerMembership
+	}
+
+	result := db.Where("list_id = ? AND user_id = ?", list.ID, userID).Delete(&DistributionListMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+
+// distributionListRecipients возвращает активных участников списка, кроме
+// отправителя: свое письмо он увидит в отправленных.
+func distributionListRecipients(db *gorm.DB, listID, senderID uint) ([]User, error) {
+	// email_verified нужен, чтобы проверить SendingPolicy для пересылок и
+	// автоответов участников
+	columns := append([]string{"email_verified"}, participantColumns...)
+
+	var users []User
+	err := db.Select(columns).
+		Where("id IN (?)", db.Model(&DistributionListMember{}).Select("user_id").Where("list_id = ?", listID)).
+		Where("id <> ? AND disabled_at IS NULL AND anonymized_at IS NULL", senderID).
+		Order("id ASC").
+		Find(&users).Error
+	return users, err
+}
+
+
+// deleteUserDistributionLists удаляет списки пользователя и его членство в
+// чужих списках.
+func deleteUserDistributionLists(db *gorm.DB, userID uint) error {
+	owned := db.Model(&DistributionList{}).Select("id").Where("owner_id = ?", userID)
+	if err := db.Where("user_id = ? OR list_id IN (?)", userID, owned).Delete(&DistributionListMember{}).Error; err != nil {
+		return err
+	}
+	return db.Where("owner_id = ?", userID).Delete(&DistributionList{}).Error
+}
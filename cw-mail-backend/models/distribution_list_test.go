@@ -0,0 +1,241 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+var testAddressPolicy = AddressPolicy{Domains: []string{"example.com"}}
+
+type listFixture struct {
+	db       *gorm.DB
+	list     *DistributionList
+	owner    *User
+	member   *User
+	outsider *User
+}
+
+func createListFixture(t *testing.T, policy string) listFixture {
+	t.Helper()
+
+	db := setupTestDB(t)
+	owner, _ := CreateUser(db, "owner@example.com", "password123")
+	member, _ := CreateUser(db, "member@example.com", "password123")
+	outsider, _ := CreateUser(db, "outsider@example.com", "password123")
+
+	list, err := CreateDistributionList(db, owner, DistributionListFields{Address: "Team@Example.com", PostPolicy: policy}, testAddressPolicy)
+	if err != nil {
+		t.Fatalf("Ошибка создания списка: %v", err)
+	}
+	if _, err := AddDistributionListMember(db, list, member.Email); err != nil {
+		t.Fatalf("Ошибка добавления участника: %v", err)
+	}
+
+	return listFixture{db: db, list: list, owner: owner, member: member, outsider: outsider}
+}
+
+func TestCreateDistributionList(t *testing.T) {
+	db := setupTestDB(t)
+	owner, _ := CreateUser(db, "owner@example.com", "password123")
+
+	list, err := CreateDistributionList(db, owner, DistributionListFields{Address: " Team@Example.com "}, testAddressPolicy)
+	if err != nil {
+		t.Fatalf("Ошибка создания списка: %v", err)
+	}
+	if list.Address != "team@example.com" || list.Name != "team@example.com" || list.PostPolicy != ListPostMembers {
+		t.Errorf("Неверные значения по умолчанию: %+v", list)
+	}
+	if member, _ := IsDistributionListMember(db, list.ID, owner.ID); !member {
+		t.Error("Владелец должен стать участником списка")
+	}
+
+	tests := map[string]struct {
+		fields DistributionListFields
+		want   error
+	}{
+		"адрес списка":       {DistributionListFields{Address: "team@example.com"}, ErrAddressInUse},
+		"адрес пользователя": {DistributionListFields{Address: "OWNER@example.com"}, ErrAddressInUse},
+		"неверный адрес":     {DistributionListFields{Address: "team"}, ErrInvalidListAddress},
+		"неверная политика":  {DistributionListFields{Address: "x@example.com", PostPolicy: "nobody"}, ErrInvalidPostPolicy},
+	}
+	for name, tt := range tests {
+		if _, err := CreateDistributionList(db, owner, tt.fields, testAddressPolicy); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ожидалась ошибка %v, получено %v", name, tt.want, err)
+		}
+	}
+
+	if inUse, _ := AddressInUse(db, "team@example.com"); !inUse {
+		t.Error("Адрес списка должен считаться занятым при регистрации")
+	}
+}
+
+func TestDistributionListAddressPolicy(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+	admin, _ := CreateUserWithRole(db, "admin@example.com", "password123", RoleAdmin)
+
+	if _, err := CreateDistributionList(db, user, DistributionListFields{Address: "ceo@bank.example"}, testAddressPolicy); !errors.Is(err, ErrAddressDomainNotAllowed) {
+		t.Errorf("Пользователь не должен занимать адрес в чужом домене, получено %v", err)
+	}
+	if _, err := CreateDistributionList(db, user, DistributionListFields{Address: "abuse@example.com"}, testAddressPolicy); !errors.Is(err, ErrAddressReserved) {
+		t.Errorf("Пользователь не должен занимать служебный адрес, получено %v", err)
+	}
+	if _, err := CreateDistributionList(db, user, DistributionListFields{Address: "team@example.com"}, AddressPolicy{}); !errors.Is(err, ErrAddressDomainNotAllowed) {
+		t.Errorf("Без доменов сервиса пользователь не может создавать списки, получено %v", err)
+	}
+
+	list, err := CreateDistributionList(db, user, DistributionListFields{Address: "team@example.com"}, testAddressPolicy)
+	if err != nil {
+		t.Fatalf("Ошибка создания списка: %v", err)
+	}
+	err = UpdateDistributionList(db, list, user, DistributionListFields{Address: "team@bank.example", Name: "Другое"}, testAddressPolicy)
+	if !errors.Is(err, ErrAddressDomainNotAllowed) {
+		t.Errorf("Адрес нельзя перенести в чужой домен, получено %v", err)
+	}
+	if err := UpdateDistributionList(db, list, admin, DistributionListFields{Address: "team@bank.example"}, testAddressPolicy); err != nil {
+		t.Errorf("Администратор может менять адрес на любой домен: %v", err)
+	}
+	if err := UpdateDistributionList(db, list, user, DistributionListFields{Address: "team@bank.example", Name: "Команда"}, testAddressPolicy); err != nil {
+		t.Errorf("Без смены адреса проверка домена не нужна: %v", err)
+	}
+
+	if _, err := CreateDistributionList(db, admin, DistributionListFields{Address: "ceo@bank.example"}, testAddressPolicy); err != nil {
+		t.Errorf("Администратор может создать список в любом домене: %v", err)
+	}
+}
+
+func TestDistributionListLimit(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+	admin, _ := CreateUserWithRole(db, "admin@example.com", "password123", RoleAdmin)
+
+	for i := 0; i < MaxDistributionListsPerUser; i++ {
+		address := "list" + string(rune('a'+i)) + "@example.com"
+		if _, err := CreateDistributionList(db, user, DistributionListFields{Address: address}, testAddressPolicy); err != nil {
+			t.Fatalf("Ошибка создания списка %d: %v", i, err)
+		}
+	}
+	if _, err := CreateDistributionList(db, user, DistributionListFields{Address: "extra@example.com"}, testAddressPolicy); !errors.Is(err, ErrListLimitReached) {
+		t.Errorf("Ожидалась ошибка лимита, получено %v", err)
+	}
+	if _, err := CreateDistributionList(db, admin, DistributionListFields{Address: "extra@example.com"}, testAddressPolicy); err != nil {
+		t.Errorf("На администраторов лимит не распространяется: %v", err)
+	}
+}
+
+func TestDeliverMessageToList(t *testing.T) {
+	f := createListFixture(t, ListPostMembers)
+	db, list, owner, member, outsider := f.db, f.list, f.owner, f.member, f.outsider
+	third, _ := CreateUser(db, "third@example.com", "password123")
+	AddDistributionListMember(db, list, third.Email)
+	SetUserDisabled(db, third.ID, true)
+
+	delivery, err := DeliverMessage(db, member, OutgoingMessage{To: "team@example.com", Subject: "Всем", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка отправки в список: %v", err)
+	}
+	if delivery.List == nil || delivery.List.ID != list.ID {
+		t.Fatalf("Доставка должна быть через список: %+v", delivery)
+	}
+
+	// Отправитель и отключенный участник копию не получают
+	if len(delivery.Messages) != 1 || delivery.Messages[0].ReceiverID != owner.ID {
+		t.Fatalf("Ожидалась одна копия владельцу, получено %+v", delivery.Messages)
+	}
+	if delivery.Messages[0].ListAddress != list.Address || delivery.Messages[0].Receiver.Email != owner.Email {
+		t.Errorf("Копия должна быть помечена адресом списка: %+v", delivery.Messages[0])
+	}
+
+	if _, err := DeliverMessage(db, outsider, OutgoingMessage{To: "team@example.com", Subject: "Спам", Body: "Текст"}, SendingPolicy{}); !errors.Is(err, ErrListPostForbidden) {
+		t.Errorf("Посторонний не может писать в список участников, получено %v", err)
+	}
+
+	// Обычный адрес доставляется как раньше
+	direct, err := DeliverMessage(db, outsider, OutgoingMessage{To: member.Email, Subject: "Лично", Body: "Текст"}, SendingPolicy{})
+	if err != nil || direct.List != nil || len(direct.Messages) != 1 {
+		t.Errorf("Письмо пользователю должно доставляться напрямую: %+v, %v", direct, err)
+	}
+}
+
+func TestDistributionListPostPolicies(t *testing.T) {
+	tests := []struct {
+		policy                   string
+		member, outsider, admins bool
+	}{
+		{ListPostAnyone, true, true, true},
+		{ListPostMembers, true, false, true},
+		{ListPostOwner, false, false, true},
+	}
+
+	for _, tt := range tests {
+		f := createListFixture(t, tt.policy)
+		db, list, owner, member, outsider := f.db, f.list, f.owner, f.member, f.outsider
+		admin, _ := CreateUserWithRole(db, "admin@example.com", "password123", RoleAdmin)
+
+		for name, check := range map[string]struct {
+			user *User
+			want bool
+		}{
+			"владелец":      {owner, true},
+			"участник":      {member, tt.member},
+			"посторонний":   {outsider, tt.outsider},
+			"администратор": {admin, tt.admins},
+		} {
+			if allowed, _ := list.CanPost(db, check.user); allowed != check.want {
+				t.Errorf("%s, %s: ожидалось %v, получено %v", tt.policy, name, check.want, allowed)
+			}
+		}
+	}
+}
+
+func TestDistributionListMembership(t *testing.T) {
+	f := createListFixture(t, ListPostMembers)
+	db, list, owner, member, outsider := f.db, f.list, f.owner, f.member, f.outsider
+
+	if _, err := AddDistributionListMember(db, list, member.Email); !errors.Is(err, ErrAlreadyListMember) {
+		t.Errorf("Ожидалась ошибка повторного добавления, получено %v", err)
+	}
+	if err := RemoveDistributionListMember(db, list, owner.ID); !errors.Is(err, ErrListOwnerMembership) {
+		t.Errorf("Владельца нельзя исключить, получено %v", err)
+	}
+
+	lists, _ := ListUserDistributionLists(db, member.ID)
+	if len(lists) != 1 {
+		t.Errorf("Участник должен видеть список, получено %d", len(lists))
+	}
+	if lists, _ := ListUserDistributionLists(db, outsider.ID); len(lists) != 0 {
+		t.Errorf("Посторонний не должен видеть список, получено %d", len(lists))
+	}
+
+	if err := RemoveDistributionListMember(db, list, member.ID); err != nil {
+		t.Fatalf("Ошибка исключения участника: %v", err)
+	}
+	if _, err := DeliverMessage(db, owner, OutgoingMessage{To: list.Address, Subject: "Тема", Body: "Текст"}, SendingPolicy{}); !errors.Is(err, ErrListNoRecipients) {
+		t.Errorf("Ожидалась ошибка пустого списка, получено %v", err)
+	}
+
+	counts, _ := DistributionListMemberCounts(db, []uint{list.ID})
+	if counts[list.ID] != 1 {
+		t.Errorf("Должен остаться только владелец, получено %d", counts[list.ID])
+	}
+}
+
+func TestAnonymizeUserDeletesDistributionLists(t *testing.T) {
+	f := createListFixture(t, ListPostMembers)
+	db, list, owner, member := f.db, f.list, f.owner, f.member
+	other, _ := CreateDistributionList(db, member, DistributionListFields{Address: "other@example.com"}, testAddressPolicy)
+	AddDistributionListMember(db, other, owner.Email)
+
+	if _, err := AnonymizeUser(db, owner.ID); err != nil {
+		t.Fatalf("Ошибка анонимизации: %v", err)
+	}
+
+	if _, err := GetDistributionList(db, list.ID); err == nil {
+		t.Error("Список удаленного владельца должен быть удален")
+	}
+	if isMember, _ := IsDistributionListMember(db, other.ID, owner.ID); isMember {
+		t.Error("Удаленный пользователь должен быть исключен из чужих списков")
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+var (
+	ErrVerificationTokenInvalid = errors.New("недействительный токен подтверждения")
+	ErrVerificationTokenExpired = errors.New("срок действия токена подтверждения истек")
+	ErrEmailNotVerified         = errors.New("необходимо подтвердить адрес электронной почты")
+)
+
+
+// SendingPolicy ограничивает отправку писем от учетных записей с
+// неподтвержденным адресом. Проверяется при доставке, поэтому действует и на
+// пересылки, redirect и автоответы получателей, а не только на письма,
+// отправленные через API.
+type SendingPolicy struct {
+	RequireVerified bool
+}
+
+
+// Allows сообщает, может ли user отправлять письма от своего имени.
+func (p SendingPolicy) Allows(user *User) bool {
+	return !p.RequireVerified || user.EmailVerified
+}
+
+
+type EmailVerification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+
+func generateToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+
+// CreateEmailVerification выпускает новый токен подтверждения. В базе хранится
+// только хеш токена, сам токен возвращается для отправки пользователю.
+func CreateEmailVerification(db *gorm.DB, userID uint, ttl time.Duration) (string, error) {
+	token, err := generateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	verification := &EmailVerification{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := db.Create(verification).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+
+func VerifyEmailToken(db *gorm.DB, token string) (*User, error) {
+	var user User
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var verification EmailVerification
+		if err := tx.Where("token_hash = ? AND used_at IS NULL", hashToken(token)).First(&verification).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVerificationTokenInvalid
+			}
+			return err
+		}
+
+		if time.Now().After(verification.ExpiresAt) {
+			return ErrVerificationTokenExpired
+		}
+
+		if err := tx.First(&user, verification.UserID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		if err := tx.Model(&EmailVerification{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+
+// VerificationResendWait возвращает, сколько нужно подождать перед повторной
+// отправкой письма. Ноль означает, что отправка разрешена.
+func VerificationResendWait(db *gorm.DB, userID uint, interval time.Duration, maxPerDay int) (time.Duration, error) {
+	var recent []EmailVerification
+	err := db.Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-24*time.Hour)).
+		Order("created_at ASC").
+		Find(&recent).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if len(recent) == 0 {
+		return 0, nil
+	}
+
+	if maxPerDay > 0 && len(recent) >= maxPerDay {
+		return time.Until(recent[len(recent)-maxPerDay].CreatedAt.Add(24 * time.Hour)), nil
+	}
+
+	last := recent[len(recent)-1].CreatedAt
+	if wait := time.Until(last.Add(interval)); wait > 0 {
+		return wait, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyEmailToken(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, err := CreateUser(db, "new@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Ошибка создания пользователя: %v", err)
+	}
+	if user.EmailVerified {
+		t.Fatal("Новый пользователь не должен быть подтвержден")
+	}
+
+	token, err := CreateEmailVerification(db, user.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Ошибка создания токена: %v", err)
+	}
+
+	var stored EmailVerification
+	db.First(&stored)
+	if stored.TokenHash == token {
+		t.Error("Токен не должен храниться в открытом виде")
+	}
+
+	verified, err := VerifyEmailToken(db, token)
+	if err != nil {
+		t.Fatalf("Ошибка подтверждения: %v", err)
+	}
+	if !verified.EmailVerified || verified.EmailVerifiedAt == nil {
+		t.Error("Пользователь должен стать подтвержденным")
+	}
+
+	if _, err := VerifyEmailToken(db, token); !errors.Is(err, ErrVerificationTokenInvalid) {
+		t.Errorf("Повторное использование токена должно быть запрещено, получено %v", err)
+	}
+}
+
+func TestVerifyEmailTokenExpired(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "late@example.com", "password123")
+	token, _ := CreateEmailVerification(db, user.ID, -time.Minute)
+
+	if _, err := VerifyEmailToken(db, token); !errors.Is(err, ErrVerificationTokenExpired) {
+		t.Errorf("Ожидалась ошибка истекшего токена, получено %v", err)
+	}
+
+	if _, err := VerifyEmailToken(db, "unknown"); !errors.Is(err, ErrVerificationTokenInvalid) {
+		t.Errorf("Ожидалась ошибка недействительного токена, получено %v", err)
+	}
+}
+
+func TestVerificationResendWait(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "resend@example.com", "password123")
+
+	wait, err := VerificationResendWait(db, user.ID, time.Minute, 3)
+	if err != nil || wait != 0 {
+		t.Fatalf("Первая отправка должна быть разрешена: wait=%v err=%v", wait, err)
+	}
+
+	CreateEmailVerification(db, user.ID, time.Hour)
+
+	wait, _ = VerificationResendWait(db, user.ID, time.Minute, 3)
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("Ожидалось ожидание до минуты, получено %v", wait)
+	}
+
+	CreateEmailVerification(db, user.ID, time.Hour)
+	CreateEmailVerification(db, user.ID, time.Hour)
+
+	wait, _ = VerificationResendWait(db, user.ID, 0, 3)
+	if wait <= time.Hour {
+		t.Errorf("После исчерпания дневного лимита ожидание должно быть долгим, получено %v", wait)
+	}
+}
+
+func TestSendingPolicyOnDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	archive, _ := CreateUser(db, "archive@example.com", "password123")
+	policy := SendingPolicy{RequireVerified: true}
+
+	out := OutgoingMessage{To: receiver.Email, Subject: "Вопрос", Body: "Текст"}
+	if _, err := DeliverMessage(db, sender, out, policy); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("Ожидалась ErrEmailNotVerified, получено %v", err)
+	}
+	var count int64
+	db.Model(&Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Письмо от неподтвержденного адреса не должно сохраняться, сообщений: %d", count)
+	}
+
+	// Пересылка и автоответ отправляются от имени получателя, поэтому тоже
+	// требуют подтвержденного адреса
+	CreateFilterRule(db, receiver, FilterRuleFields{
+		Name:       "Пересылка",
+		Enabled:    true,
+		Conditions: []FilterCondition{{FilterFieldSubject, FilterOpContains, "Вопрос"}},
+		Actions:    []FilterAction{{Type: FilterActionForward, Value: archive.Email}},
+	})
+	UpdateVacationSettings(db, receiver.ID, VacationFields{Enabled: true, Body: "Я в отпуске"})
+	db.Model(sender).Update("email_verified", true)
+
+	delivery, err := DeliverMessage(db, sender, out, policy)
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.Messages) != 1 || len(delivery.Forwarded) != 0 || len(delivery.AutoReplies) != 0 {
+		t.Errorf("Неподтвержденный получатель не должен пересылать письма и отвечать автоответом: %+v", delivery)
+	}
+
+	db.Model(receiver).Update("email_verified", true)
+	delivery, err = DeliverMessage(db, sender, out, policy)
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.Forwarded) != 1 || len(delivery.AutoReplies) != 1 {
+		t.Errorf("После подтверждения адреса пересылка и автоответ работают: %+v", delivery)
+	}
+}
+
+func TestSendingPolicyOnListDelivery(t *testing.T) {
+	f := createListFixture(t, ListPostMembers)
+	archive, _ := CreateUser(f.db, "archive@example.com", "password123")
+	policy := SendingPolicy{RequireVerified: true}
+
+	CreateFilterRule(f.db, f.member, FilterRuleFields{
+		Name:       "Пересылка",
+		Enabled:    true,
+		Conditions: []FilterCondition{{FilterFieldSubject, FilterOpContains, "Планерка"}},
+		Actions:    []FilterAction{{Type: FilterActionForward, Value: archive.Email}},
+	})
+	f.db.Model(f.owner).Update("email_verified", true)
+
+	out := OutgoingMessage{To: f.list.Address, Subject: "Планерка", Body: "Текст"}
+	delivery, err := DeliverMessage(f.db, f.owner, out, policy)
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.Messages) != 1 || len(delivery.Forwarded) != 0 {
+		t.Errorf("Неподтвержденный участник не должен пересылать письма из списка: %+v", delivery)
+	}
+
+	f.db.Model(f.member).Update("email_verified", true)
+	delivery, err = DeliverMessage(f.db, f.owner, out, policy)
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.Forwarded) != 1 {
+		t.Errorf("Подтвержденный участник пересылает письма из списка: %+v", delivery)
+	}
+}
@@ -0,0 +1,539 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	FilterFieldFrom    = "from"
+	FilterFieldTo      = "to"
+	FilterFieldSubject = "subject"
+	FilterFieldBody    = "body"
+
+	FilterOpContains    = "contains"
+	FilterOpNotContains = "not_contains"
+	FilterOpEquals      = "equals"
+	FilterOpStartsWith  = "starts_with"
+	FilterOpEndsWith    = "ends_with"
+	FilterOpMatches     = "matches"
+
+	FilterActionLabel    = "label"
+	FilterActionMarkRead = "mark_read"
+	FilterActionStar     = "star"
+	FilterActionForward  = "forward"
+	FilterActionDelete   = "delete"
+
+	MaxFilterRulesPerUser  = 100
+	MaxFilterConditions    = 20
+	MaxFilterActions       = 10
+	MaxFilterNameLength    = 100
+	MaxFilterValueLength   = 500
+	MaxFilterDryRunMatches = 100
+	filterRetroactiveBatch = 200
+)
+
+
+var (
+	ValidFilterFields    = []string{FilterFieldFrom, FilterFieldTo, FilterFieldSubject, FilterFieldBody}
+	ValidFilterOperators = []string{FilterOpContains, FilterOpNotContains, FilterOpEquals, FilterOpStartsWith, FilterOpEndsWith, FilterOpMatches}
+	ValidFilterActions   = []string{FilterActionLabel, FilterActionMarkRead, FilterActionStar, FilterActionForward, FilterActionDelete}
+	ValidLabels          = []string{"inbox", "spam", "trash"}
+)
+
+
+var (
+	ErrInvalidFilterRule  = errors.New("неверное правило фильтрации")
+	ErrFilterLimitReached = errors.New("достигнуто максимальное количество правил фильтрации")
+	ErrInvalidFilterOrder = errors.New("порядок должен содержать все правила пользователя ровно по одному разу")
+)
+
+
+// FilterCondition — условие правила: поле письма, оператор и значение.
+// Сравнение не зависит от регистра.
+type FilterCondition struct {
+	Field    string `json:"field" example:"from"`
+	Operator string `json:"operator" example:"contains"`
+	Value    string `json:"value" example:"@example.com"`
+}
+
+
+// FilterAction — действие правила. Value нужно для label (метка) и forward
+// (адрес пересылки).
+type FilterAction struct {
+	Type  string `json:"type" example:"label"`
+	Value string `json:"value,omitempty" example:"spam"`
+}
+
+
+// FilterRule — правило фильтрации, которое применяется к входящим письмам
+// при доставке. Правила проверяются по возрастанию Position; после
+// сработавшего правила со StopProcessing остальные не проверяются.
+type FilterRule struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	UserID         uint              `json:"user_id" gorm:"index;not null"`
+	Name           string            `json:"name" gorm:"not null"`
+	Position       int               `json:"position" gorm:"not null;default:0"`
+	Enabled        bool              `json:"enabled" gorm:"not null"`
+	MatchAll       bool              `json:"match_all" gorm:"not null"`
+	StopProcessing bool              `json:"stop_processing" gorm:"not null;default:false"`
+	Conditions     []FilterCondition `json:"conditions" gorm:"type:text;serializer:json"`
+	Actions        []FilterAction    `json:"actions" gorm:"type:text;serializer:json"`
+	CreatedAt      time.Time         `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time         `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+
+type FilterRuleFields struct {
+	Name           string
+	Enabled        bool
+	MatchAll       bool
+	StopProcessing bool
+	Conditions     []FilterCondition
+	Actions        []FilterAction
+}
+
+
+// FilterOutcome — суммарный результат правил для одного письма.
+type FilterOutcome struct {
+	Label   string   `json:"label,omitempty"`
+	Read    bool     `json:"read"`
+	Starred bool     `json:"starred"`
+	Forward []string `json:"forward,omitempty"`
+	Rules   []uint   `json:"rules"`
+}
+
+
+func IsValidLabel(label string) bool {
+	return containsString(ValidLabels, label)
+}
+
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+
+func invalidFilterRule(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidFilterRule, reason)
+}
+
+
+func (f *FilterRuleFields) normalize(owner *User) error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" || utf8.RuneCountInString(f.Name) > MaxFilterNameLength {
+		return invalidFilterRule("название правила обязательно и не длиннее 100 символов")
+	}
+
+	if len(f.Conditions) == 0 || len(f.Conditions) > MaxFilterConditions {
+		return invalidFilterRule("нужно от 1 до 20 условий")
+	}
+	for i := range f.Conditions {
+		condition := &f.Conditions[i]
+		if !containsString(ValidFilterFields, condition.Field) {
+			return invalidFilterRule("недопустимое поле условия: " + condition.Field)
+		}
+		if !containsString(ValidFilterOperators, condition.Operator) {
+			return invalidFilterRule("недопустимый оператор условия: " + condition.Operator)
+		}
+		if condition.Value == "" || utf8.RuneCountInString(condition.Value) > MaxFilterValueLength {
+			return invalidFilterRule("значение условия обязательно и не длиннее 500 символов")
+		}
+		if condition.Operator == FilterOpMatches {
+			if _, err := regexp.Compile(condition.Value); err != nil {
+				return invalidFilterRule("неверное регулярное выражение: " + condition.Value)
+			}
+		}
+	}
+
+	if len(f.Actions) == 0 || len(f.Actions) > MaxFilterActions {
+		return invalidFilterRule("нужно от 1 до 10 действий")
+	}
+	for i := range f.Actions {
+		action := &f.Actions[i]
+		switch action.Type {
+		case FilterActionLabel:
+			if !IsValidLabel(action.Value) {
+				return invalidFilterRule("недопустимая метка: " + action.Value)
+			}
+		case FilterActionForward:
+			address, err := normalizeContactEmail(action.Value)
+			if err != nil {
+				return invalidFilterRule("неверный адрес пересылки: " + action.Value)
+			}
+			if address == normalizeAddress(owner.Email) {
+				return invalidFilterRule("нельзя пересылать письма самому себе")
+			}
+			action.Value = address
+		case FilterActionMarkRead, FilterActionStar, FilterActionDelete:
+			action.Value = ""
+		default:
+			return invalidFilterRule("недопустимое действие: " + action.Type)
+		}
+	}
+	return nil
+}
+
+
+// filterFieldValue возвращает значение поля письма, с которым сравнивается
+// условие.
+func filterFieldValue(message *Message, field string) string {
+	switch field {
+	case FilterFieldFrom:
+		if message.SenderAddress != "" {
+			return message.SenderAddress
+		}
+		return message.Sender.Email
+	case FilterFieldTo:
+		if message.RecipientAddress != "" {
+			return message.RecipientAddress
+		}
+		return message.Receiver.Email
+	case FilterFieldSubject:
+		return message.Subject
+	case FilterFieldBody:
+		return message.Body
+	}
+	return ""
+}
+
+
+func (c FilterCondition) matches(message *Message) bool {
+	value := strings.ToLower(filterFieldValue(message, c.Field))
+	expected := strings.ToLower(c.Value)
+
+	switch c.Operator {
+	case FilterOpContains:
+		return strings.Contains(value, expected)
+	case FilterOpNotContains:
+		return !strings.Contains(value, expected)
+	case FilterOpEquals:
+		return value == expected
+	case FilterOpStartsWith:
+		return strings.HasPrefix(value, expected)
+	case FilterOpEndsWith:
+		return strings.HasSuffix(value, expected)
+	case FilterOpMatches:
+		re, err := regexp.Compile("(?i)" + c.Value)
+		return err == nil && re.MatchString(value)
+	}
+	return false
+}
+
+
+// Matches проверяет условия правила: все при MatchAll, иначе любое.
+func (r *FilterRule) Matches(message *Message) bool {
+	for _, condition := range r.Conditions {
+		matched := condition.matches(message)
+		if matched && !r.MatchAll {
+			return true
+		}
+		if !matched && r.MatchAll {
+			return false
+		}
+	}
+	return r.MatchAll && len(r.Conditions) > 0
+}
+
+
+func (o *FilterOutcome) apply(rule *FilterRule) {
+	o.Rules = append(o.Rules, rule.ID)
+	for _, action := range rule.Actions {
+		switch action.Type {
+		case FilterActionLabel:
+			o.Label = action.Value
+		case FilterActionMarkRead:
+			o.Read = true
+		case FilterActionStar:
+			o.Starred = true
+		case FilterActionForward:
+			if !containsString(o.Forward, action.Value) {
+				o.Forward = append(o.Forward, action.Value)
+			}
+		case FilterActionDelete:
+			o.Label = "trash"
+		}
+	}
+}
+
+
+// EvaluateFilters применяет включенные правила по порядку и возвращает
+// результат. Письмо не изменяется.
+func EvaluateFilters(rules []FilterRule, message *Message) FilterOutcome {
+	outcome := FilterOutcome{Rules: []uint{}}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !rule.Matches(message) {
+			continue
+		}
+		outcome.apply(rule)
+		if rule.StopProcessing {
+			break
+		}
+	}
+	return outcome
+}
+
+
+func (o FilterOutcome) applyTo(message *Message) {
+	if o.Label != "" {
+		message.Label = o.Label
+	}
+	if o.Read {
+		message.IsRead = true
+	}
+	if o.Starred {
+		message.IsStarred = true
+	}
+}
+
+
+// applyFilters применяет правила получателя к еще не сохраненному письму.
+func applyFilters(db *gorm.DB, message *Message) (FilterOutcome, error) {
+	rules, err := ListFilterRules(db, message.ReceiverID)
+	if err != nil {
+		return FilterOutcome{}, err
+	}
+
+	outcome := EvaluateFilters(rules, message)
+	outcome.applyTo(message)
+	return outcome, nil
+}
+
+
+func ListFilterRules(db *gorm.DB, userID uint) ([]FilterRule, error) {
+	var rules []FilterRule
+	err := db.Where("user_id = ?", userID).Order("position ASC, id ASC").Find(&rules).Error
+	return rules, err
+}
+
+
+func GetFilterRule(db *gorm.DB, ruleID, userID uint) (*FilterRule, error) {
+	var rule FilterRule
+	if err := db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+
+// NewFilterRule проверяет поля и возвращает несохраненное правило, например
+// для пробного запуска.
+func NewFilterRule(owner *User, fields FilterRuleFields) (*FilterRule, error) {
+	if err := fields.normalize(owner); err != nil {
+		return nil, err
+	}
+
+	return &FilterRule{
+		UserID:         owner.ID,
+		Name:           fields.Name,
+		Enabled:        fields.Enabled,
+		MatchAll:       fields.MatchAll,
+		StopProcessing: fields.StopProcessing,
+		Conditions:     fields.Conditions,
+		Actions:        fields.Actions,
+	}, nil
+}
+
+
+// CreateFilterRule добавляет правило в конец списка правил пользователя.
+func CreateFilterRule(db *gorm.DB, owner *User, fields FilterRuleFields) (*FilterRule, error) {
+	rule, err := NewFilterRule(owner, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&FilterRule{}).Where("user_id = ?", owner.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxFilterRulesPerUser {
+			return ErrFilterLimitReached
+		}
+
+		var last struct{ Position *int }
+		if err := tx.Model(&FilterRule{}).Select("MAX(position) AS position").Where("user_id = ?", owner.ID).Scan(&last).Error; err != nil {
+			return err
+		}
+		if last.Position != nil {
+			rule.Position = *last.Position + 1
+		}
+
+		return tx.Create(rule).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+
+func UpdateFilterRule(db *gorm.DB, rule *FilterRule, owner *User, fields FilterRuleFields) error {
+	updated, err := NewFilterRule(owner, fields)
+	if err != nil {
+		return err
+	}
+
+	rule.Name = updated.Name
+	rule.Enabled = updated.Enabled
+	rule.MatchAll = updated.MatchAll
+	rule.StopProcessing = updated.StopProcessing
+	rule.Conditions = updated.Conditions
+	rule.Actions = updated.Actions
+
+	return db.Model(rule).Select("name", "enabled", "match_all", "stop_processing", "conditions", "actions").Updates(rule).Error
+}
+
+
+func DeleteFilterRule(db *gorm.DB, ruleID, userID uint) error {
+	result := db.Where("id = ? AND user_id = ?", ruleID, userID).Delete(&FilterRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+
+// ReorderFilterRules задает новый порядок правил. ids должен содержать все
+// правила пользователя.
+func ReorderFilterRules(db *gorm.DB, userID uint, ids []uint) ([]FilterRule, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		rules, err := ListFilterRules(tx, userID)
+		if err != nil {
+			return err
+		}
+		if len(ids) != len(rules) {
+			return ErrInvalidFilterOrder
+		}
+
+		owned := make(map[uint]bool, len(rules))
+		for _, rule := range rules {
+			owned[rule.ID] = true
+		}
+		for position, id := range ids {
+			if !owned[id] {
+				return ErrInvalidFilterOrder
+			}
+			delete(owned, id)
+			if err := tx.Model(&FilterRule{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ListFilterRules(db, userID)
+}
+
+
+// FilterMatch — письмо, подходящее под правило при пробном запуске.
+type FilterMatch struct {
+	Message Message
+	Outcome FilterOutcome
+}
+
+
+// eachReceivedMessage обходит полученные пользователем письма, кроме
+// удаленных, от новых к старым.
+func eachReceivedMessage(db *gorm.DB, userID uint, fn func(message *Message) (bool, error)) error {
+	var batch []Message
+	stop := errors.New("stop")
+	result := preloadParticipants(db).
+		Where("receiver_id = ? AND label <> ? AND dropped = ?", userID, "trash", false).
+		Order("id DESC").
+		FindInBatches(&batch, filterRetroactiveBatch, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				more, err := fn(&batch[i])
+				if err != nil {
+					return err
+				}
+				if !more {
+					return stop
+				}
+			}
+			return nil
+		})
+	if errors.Is(result.Error, stop) {
+		return nil
+	}
+	return result.Error
+}
+
+
+// DryRunFilterRule возвращает письма, к которым правило применилось бы, не
+// изменяя их. Учитываются не более MaxFilterDryRunMatches последних писем.
+func DryRunFilterRule(db *gorm.DB, rule *FilterRule) ([]FilterMatch, error) {
+	matches := []FilterMatch{}
+	err := eachReceivedMessage(db, rule.UserID, func(message *Message) (bool, error) {
+		if rule.Matches(message) {
+			var outcome FilterOutcome
+			outcome.apply(rule)
+			matches = append(matches, FilterMatch{Message: *message, Outcome: outcome})
+		}
+		return len(matches) < MaxFilterDryRunMatches, nil
+	})
+	return matches, err
+}
+
+
+// ApplyFilterRule применяет правило к уже полученным письмам (кроме
+// удаленных) и возвращает число измененных писем. Пересылка к старым письмам
+// не применяется.
+func ApplyFilterRule(db *gorm.DB, rule *FilterRule) (int, error) {
+	var matched []Message
+	err := eachReceivedMessage(db, rule.UserID, func(message *Message) (bool, error) {
+		if rule.Matches(message) {
+			matched = append(matched, *message)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var outcome FilterOutcome
+	outcome.apply(rule)
+
+	changed := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range matched {
+			message := &matched[i]
+			before := *message
+			outcome.applyTo(message)
+			if message.Label == before.Label && message.IsRead == before.IsRead && message.IsStarred == before.IsStarred {
+				continue
+			}
+			err := tx.Model(&Message{ID: message.ID}).Updates(map[string]interface{}{
+				"label":      message.Label,
+				"is_read":    message.IsRead,
+				"is_starred": message.IsStarred,
+			}).Error
+			if err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
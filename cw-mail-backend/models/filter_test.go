@@ -0,0 +1,132 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func newsletterRule(stop bool) FilterRuleFields {
+	return FilterRuleFields{
+		Name:           "Рассылки",
+		Enabled:        true,
+		MatchAll:       true,
+		StopProcessing: stop,
+		Conditions:     []FilterCondition{{Field: FilterFieldSubject, Operator: FilterOpContains, Value: "РАССЫЛКА"}},
+		Actions:        []FilterAction{{Type: FilterActionMarkRead}, {Type: FilterActionLabel, Value: "spam"}},
+	}
+}
+
+func TestFilterRuleValidation(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+
+	tests := map[string]func(f *FilterRuleFields){
+		"без названия":    func(f *FilterRuleFields) { f.Name = " " },
+		"без условий":     func(f *FilterRuleFields) { f.Conditions = nil },
+		"неверное поле":   func(f *FilterRuleFields) { f.Conditions[0].Field = "cc" },
+		"неверный regexp": func(f *FilterRuleFields) { f.Conditions[0] = FilterCondition{FilterFieldBody, FilterOpMatches, "("} },
+		"неверная метка":  func(f *FilterRuleFields) { f.Actions[1].Value = "archive" },
+		"пересылка себе": func(f *FilterRuleFields) {
+			f.Actions = []FilterAction{{Type: FilterActionForward, Value: "USER@example.com"}}
+		},
+		"без действий": func(f *FilterRuleFields) { f.Actions = nil },
+	}
+	for name, mutate := range tests {
+		fields := newsletterRule(false)
+		mutate(&fields)
+		if _, err := CreateFilterRule(db, user, fields); !errors.Is(err, ErrInvalidFilterRule) {
+			t.Errorf("%s: ожидалась ошибка правила, получено %v", name, err)
+		}
+	}
+}
+
+func TestFiltersOnDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "news@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	archive, _ := CreateUser(db, "archive@example.com", "password123")
+
+	first, err := CreateFilterRule(db, receiver, newsletterRule(true))
+	if err != nil {
+		t.Fatalf("Ошибка создания правила: %v", err)
+	}
+	second, _ := CreateFilterRule(db, receiver, FilterRuleFields{
+		Name:       "Звезда и пересылка",
+		Enabled:    true,
+		Conditions: []FilterCondition{{FilterFieldFrom, FilterOpEndsWith, "@example.com"}, {FilterFieldBody, FilterOpMatches, `^срочно`}},
+		Actions:    []FilterAction{{Type: FilterActionStar}, {Type: FilterActionForward, Value: archive.Email}},
+	})
+	if first.Position != 0 || second.Position != 1 {
+		t.Errorf("Правила должны добавляться в конец: %d, %d", first.Position, second.Position)
+	}
+
+	// Первое правило останавливает обработку
+	delivery, _ := DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Рассылка недели", Body: "Срочно"}, SendingPolicy{})
+	message := delivery.Messages[0]
+	if message.Label != "spam" || !message.IsRead || message.IsStarred || len(delivery.Forwarded) != 0 {
+		t.Errorf("Должно сработать только первое правило: %+v", message)
+	}
+
+	// Второе правило срабатывает при любом условии (MatchAll=false)
+	delivery, _ = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Привет", Body: "Текст"}, SendingPolicy{})
+	message = delivery.Messages[0]
+	if message.Label != "inbox" || !message.IsStarred {
+		t.Errorf("Должно сработать второе правило: %+v", message)
+	}
+	if len(delivery.Forwarded) != 1 || delivery.Forwarded[0].ReceiverID != archive.ID || delivery.Forwarded[0].Subject != "Fwd: Привет" {
+		t.Fatalf("Письмо должно быть переслано: %+v", delivery.Forwarded)
+	}
+	if delivery.Forwarded[0].SenderID != receiver.ID {
+		t.Errorf("Пересланное письмо отправляется от имени получателя: %+v", delivery.Forwarded[0])
+	}
+
+	// Новый порядок: второе правило проверяется первым
+	if _, err := ReorderFilterRules(db, receiver.ID, []uint{second.ID}); !errors.Is(err, ErrInvalidFilterOrder) {
+		t.Errorf("Неполный порядок должен отклоняться, получено %v", err)
+	}
+	rules, err := ReorderFilterRules(db, receiver.ID, []uint{second.ID, first.ID})
+	if err != nil || rules[0].ID != second.ID {
+		t.Fatalf("Ошибка изменения порядка: %v", err)
+	}
+	delivery, _ = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Рассылка", Body: "Текст"}, SendingPolicy{})
+	if message := delivery.Messages[0]; !message.IsStarred || message.Label != "spam" {
+		t.Errorf("Оба правила должны сработать: %+v", message)
+	}
+}
+
+func TestFilterRuleDryRunAndApply(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "news@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+
+	SendMessage(db, sender.ID, receiver.Email, "Рассылка 1", "Текст", 0)
+	SendMessage(db, sender.ID, receiver.Email, "Личное", "Текст", 0)
+	SendMessage(db, sender.ID, receiver.Email, "рассылка 2", "Текст", 0)
+
+	rule, err := NewFilterRule(receiver, newsletterRule(false))
+	if err != nil {
+		t.Fatalf("Ошибка проверки правила: %v", err)
+	}
+	matches, err := DryRunFilterRule(db, rule)
+	if err != nil || len(matches) != 2 {
+		t.Fatalf("Ожидалось два подходящих письма, получено %d (%v)", len(matches), err)
+	}
+	if matches[0].Outcome.Label != "spam" || !matches[0].Outcome.Read {
+		t.Errorf("Неверный результат пробного запуска: %+v", matches[0].Outcome)
+	}
+	if inbox, _ := GetInboxMessages(db, receiver.ID); len(inbox) != 3 {
+		t.Errorf("Пробный запуск не должен менять письма, во входящих %d", len(inbox))
+	}
+
+	rule, _ = CreateFilterRule(db, receiver, newsletterRule(false))
+	updated, err := ApplyFilterRule(db, rule)
+	if err != nil || updated != 2 {
+		t.Fatalf("Ожидалось два измененных письма, получено %d (%v)", updated, err)
+	}
+	if spam, _ := GetSpamMessages(db, receiver.ID); len(spam) != 2 || !spam[0].IsRead {
+		t.Errorf("Письма должны быть перенесены в спам и прочитаны: %+v", spam)
+	}
+	if updated, _ := ApplyFilterRule(db, rule); updated != 0 {
+		t.Errorf("Повторное применение не должно ничего менять, изменено %d", updated)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,31 +9,57 @@ import (
 
 
 type Message struct {
-	ID         uint      `json:"id" gorm:"primaryKey"`
-	SenderID   uint      `json:"sender_id" gorm:"index"`
-	ReceiverID uint      `json:"receiver_id" gorm:"index"`
-	Subject    string    `json:"subject"`
-	Body       string    `json:"body"`
-	IsRead     bool      `json:"is_read" gorm:"default:false"`
-	Label      string    `json:"label" gorm:"default:'inbox'"`
-	ReadLimit  int       `json:"read_limit" gorm:"default:0"`
-	ReadCount  int       `json:"read_count" gorm:"default:0"`
-	ExpiresAt  time.Time `json:"expires_at,omitempty" gorm:"index"`
-	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
-	Sender     User      `json:"sender" gorm:"foreignKey:SenderID"`
-	Receiver   User      `json:"receiver" gorm:"foreignKey:ReceiverID"`
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	SenderID         uint      `json:"sender_id" gorm:"index"`
+	ReceiverID       uint      `json:"receiver_id" gorm:"index"`
+	Subject          string    `json:"subject"`
+	Body             string    `json:"body"`
+	IsRead           bool      `json:"is_read" gorm:"default:false"`
+	IsStarred        bool      `json:"is_starred" gorm:"not null;default:false"` // отметка получателя
+	SenderStarred    bool      `json:"-" gorm:"not null;default:false"`          // отметка отправителя
+	Dropped          bool      `json:"-" gorm:"not null;default:false"`          // отклонено блокировкой, видно только отправителю
+	Label            string    `json:"label" gorm:"default:'inbox'"`
+	ReadLimit        int       `json:"read_limit" gorm:"default:0"`
+	ReadCount        int       `json:"read_count" gorm:"default:0"`
+	ExpiresAt        time.Time `json:"expires_at,omitempty" gorm:"index"`
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+	SenderAddress    string    `json:"sender_address"`
+	RecipientAddress string    `json:"recipient_address" gorm:"index"`
+	ListAddress      string    `json:"list_address,omitempty" gorm:"index"`
+	AutoSubmitted    string    `json:"auto_submitted,omitempty"`
+	SpamScore        float64   `json:"spam_score" gorm:"not null;default:0"`
+	SpamTrained      string    `json:"-" gorm:"not null;default:''"`
+	Sender           User      `json:"-" gorm:"foreignKey:SenderID"`
+	Receiver         User      `json:"-" gorm:"foreignKey:ReceiverID"`
 }
 	
 
 func SendMessage(db *gorm.DB, senderID uint, receiverEmail, subject, body string, readLimit int) (*Message, error) {
-	var receiver User
-	if err := db.Where("email = ?", receiverEmail).First(&receiver).Error; err != nil {
+	receiver, err := FindUserByAddress(db, receiverEmail)
+	if err != nil {
 		return nil, err
 	}
 
+	var sender User
+	if err := db.Select("email").First(&sender, senderID).Error; err != nil {
+		return nil, err
+	}
+
+	message := newMessage(senderID, receiver.ID, subject, body, readLimit)
+	message.SenderAddress = sender.Email
+	message.RecipientAddress = normalizeAddress(receiverEmail)
+	if _, _, err := deliverCopy(db, message, *receiver, true, sender.Email); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+
+func newMessage(senderID, receiverID uint, subject, body string, readLimit int) *Message {
 	message := &Message{
 		SenderID:   senderID,
-		ReceiverID: receiver.ID,
+		ReceiverID: receiverID,
 		Subject:    subject,
 		Body:       body,
 		IsRead:     false,
@@ -47,18 +74,294 @@ func SendMessage(db *gorm.DB, senderID uint, receiverEmail, subject, body string
 		message.ExpiresAt = time.Now().Add(24 * time.Hour)
 	}
 
+	return message
+}
+
+
+func createMessage(db *gorm.DB, message *Message, receiver User) error {
 	if err := db.Create(message).Error; err != nil {
+		return err
+	}
+
+	message.Receiver = receiver
+	return db.Select(participantColumns).First(&message.Sender, message.SenderID).Error
+}
+
+
+// deliverCopy доставляет письмо одному получателю: оценивает его
+// спам-фильтром, применяет фильтры, Sieve-скрипт и список блокировки,
+// сохраняет письмо, выполняет пересылки (фильтры и redirect) и отправляет
+// автоответ: команду vacation скрипта или автоответ из настроек пользователя.
+// Пересланные копии и автоответы возвращаются. allowForward == false
+// отключает пересылки и автоответы: так доставляются сами пересланные копии и
+// письма получателям, которым SendingPolicy запрещает отправку.
+func deliverCopy(db *gorm.DB, message *Message, receiver User, allowForward bool, senderAddresses ...string) ([]Message, []Message, error) {
+	if err := scoreSpam(db, message); err != nil {
+		return nil, nil, err
+	}
+
+	outcome, err := applyFilters(db, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	script, err := applySieve(db, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocked, err := screenBlockedSender(db, message, senderAddresses...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := createMessage(db, message, receiver); err != nil {
+		return nil, nil, err
+	}
+
+	if !allowForward || blocked {
+		return nil, nil, nil
+	}
+
+	var forwarded []Message
+	for _, address := range outcome.Forward {
+		sent, err := forwardMessage(db, message, receiver, address)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sent != nil {
+			forwarded = append(forwarded, *sent)
+		}
+	}
+	for _, address := range script.Redirect {
+		sent, err := redirectMessage(db, message, receiver, address)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sent != nil {
+			forwarded = append(forwarded, *sent)
+		}
+	}
+
+	// Команда vacation активного скрипта заменяет автоответ из настроек
+	var reply *Message
+	if script.Vacation != nil {
+		reply, err = sendVacationReply(db, message, receiver, script.Vacation)
+	} else {
+		reply, err = sendVacationSettingsReply(db, message, receiver)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var replies []Message
+	if reply != nil {
+		replies = append(replies, *reply)
+	}
+	return forwarded, replies, nil
+}
+
+
+// isDeliveryRefused сообщает, что получатель отказался принять письмо:
+// заблокировал отправителя или отклонил письмо Sieve-скриптом.
+func isDeliveryRefused(err error) bool {
+	return errors.Is(err, ErrSenderBlocked) || errors.Is(err, ErrMessageRejected)
+}
+
+
+// forwardMessage пересылает полученное письмо от имени получателя.
+// Неизвестный адрес и отказ получателя пропускаются: пересылка не должна
+// мешать доставке исходного письма.
+func forwardMessage(db *gorm.DB, original *Message, owner User, address string) (*Message, error) {
+	target, err := FindUserByAddress(db, address)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && target.ID == owner.ID) {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
 
+	message := newMessage(owner.ID, target.ID, "Fwd: "+original.Subject, original.Body, original.ReadLimit)
+	message.SenderAddress = owner.Email
+	message.RecipientAddress = normalizeAddress(address)
+
+	_, _, err = deliverCopy(db, message, *target, false, owner.Email)
+	if isDeliveryRefused(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	return message, nil
 }
 
 
+// OutgoingMessage — письмо, которое пользователь отправляет на адрес. From —
+// основной адрес отправителя или его псевдоним, пустое значение означает
+// основной.
+type OutgoingMessage struct {
+	From      string
+	To        string
+	Subject   string
+	Body      string
+	ReadLimit int
+}
+
+
+// Delivery — результат отправки на адрес. Для списка рассылки List заполнен,
+// а Messages содержит по копии на каждого участника с ListAddress списка.
+// Forwarded — копии, пересланные фильтрами и Sieve-скриптами получателей,
+// AutoReplies — автоответы получателей отправителю. Dropped заполнен вместо
+// Messages, если получатель заблокировал отправителя с действием reject:
+// письмо сохранено с отметкой Dropped и есть в отправленных, но получатель
+// его не видит и уведомления о нем не получает.
+type Delivery struct {
+	List        *DistributionList
+	Messages    []Message
+	Forwarded   []Message
+	AutoReplies []Message
+	Dropped     *Message
+}
+
+
+// DeliverMessage отправляет письмо на адрес пользователя (основной или
+// псевдоним) или списка рассылки. Письмо в список проверяется по политике
+// списка и раскрывается в отдельные копии для участников. К каждой копии
+// применяются фильтры, Sieve-скрипт и список блокировки получателя. Если
+// policy запрещает отправку отправителю, возвращается ErrEmailNotVerified;
+// получатели, которым она запрещена, не пересылают письмо и не отвечают на
+// него автоответом.
+func DeliverMessage(db *gorm.DB, sender *User, out OutgoingMessage, policy SendingPolicy) (*Delivery, error) {
+	if !policy.Allows(sender) {
+		return nil, ErrEmailNotVerified
+	}
+
+	from, err := ResolveSenderAddress(db, sender, out.From)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := FindDistributionListByAddress(db, out.To)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		receiver, err := FindUserByAddress(db, out.To)
+		if err != nil {
+			return nil, err
+		}
+
+		message := newMessage(sender.ID, receiver.ID, out.Subject, out.Body, out.ReadLimit)
+		message.SenderAddress = from
+		message.RecipientAddress = normalizeAddress(out.To)
+		forwarded, replies, err := deliverCopy(db, message, *receiver, policy.Allows(receiver), from, sender.Email)
+		if errors.Is(err, ErrSenderBlocked) {
+			// Отправитель не должен узнать о блокировке. Копия собирается
+			// заново, чтобы в ней не было следов фильтров получателя
+			dropped := newMessage(sender.ID, receiver.ID, out.Subject, out.Body, out.ReadLimit)
+			dropped.SenderAddress = from
+			dropped.RecipientAddress = message.RecipientAddress
+			dropped.Dropped = true
+			if err := createMessage(db, dropped, *receiver); err != nil {
+				return nil, err
+			}
+			return &Delivery{Dropped: dropped}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Delivery{Messages: []Message{*message}, Forwarded: forwarded, AutoReplies: replies}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := list.CanPost(db, sender)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrListPostForbidden
+	}
+
+	recipients, err := distributionListRecipients(db, list.ID, sender.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, ErrListNoRecipients
+	}
+
+	delivery := &Delivery{List: list, Messages: make([]Message, 0, len(recipients))}
+	for _, recipient := range recipients {
+		message := newMessage(sender.ID, recipient.ID, out.Subject, out.Body, out.ReadLimit)
+		message.SenderAddress = from
+		message.RecipientAddress = list.Address
+		message.ListAddress = list.Address
+
+		// Участник, отклоняющий письма отправителя, просто не получает копию
+		forwarded, replies, err := deliverCopy(db, message, recipient, policy.Allows(&recipient), from, sender.Email)
+		if isDeliveryRefused(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		delivery.Messages = append(delivery.Messages, *message)
+		delivery.Forwarded = append(delivery.Forwarded, forwarded...)
+		delivery.AutoReplies = append(delivery.AutoReplies, replies...)
+	}
+	if len(delivery.Messages) == 0 {
+		return nil, ErrListNoRecipients
+	}
+
+	return delivery, nil
+}
+
+
+// participantColumns — поля участников переписки, которые нужны для
+// отображения сообщения. Остальные данные учетной записи не загружаются.
+var participantColumns = []string{"id", "email", "display_name", "avatar_path"}
+
+
+func selectParticipantColumns(tx *gorm.DB) *gorm.DB {
+	return tx.Select(participantColumns)
+}
+
+
+func preloadParticipants(db *gorm.DB) *gorm.DB {
+	return db.Preload("Sender", selectParticipantColumns).Preload("Receiver", selectParticipantColumns)
+}
+
+
+func GetMessageByID(db *gorm.DB, messageID uint) (*Message, error) {
+	var message Message
+	if err := preloadParticipants(db).First(&message, messageID).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+
+// EachUserMessage обходит все сообщения, где пользователь отправитель или
+// получатель, пачками в порядке создания.
+func EachUserMessage(db *gorm.DB, userID uint, fn func(message *Message) error) error {
+	var batch []Message
+	result := preloadParticipants(db).
+		Where("sender_id = ? OR (receiver_id = ? AND dropped = ?)", userID, userID, false).
+		FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := fn(&batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	return result.Error
+}
+
+
 func GetInboxMessages(db *gorm.DB, userID uint) ([]Message, error) {
 	var messages []Message
-	err := db.Preload("Sender").Preload("Receiver").
-		Where("receiver_id = ? AND label = ?", userID, "inbox").
+	err := preloadParticipants(db).
+		Where("receiver_id = ? AND label = ? AND dropped = ?", userID, "inbox", false).
 		Order("created_at DESC").
 		Find(&messages).Error
 	return messages, err
@@ -67,7 +370,7 @@ func GetInboxMessages(db *gorm.DB, userID uint) ([]Message, error) {
 
 func GetSentMessages(db *gorm.DB, userID uint) ([]Message, error) {
 	var messages []Message
-	err := db.Preload("Sender").Preload("Receiver").
+	err := preloadParticipants(db).
 		Where("sender_id = ?", userID).
 		Order("created_at DESC").
 		Find(&messages).Error
@@ -77,8 +380,8 @@ func GetSentMessages(db *gorm.DB, userID uint) ([]Message, error) {
 
 func GetSpamMessages(db *gorm.DB, userID uint) ([]Message, error) {
 	var messages []Message
-	err := db.Preload("Sender").Preload("Receiver").
-		Where("receiver_id = ? AND label = ?", userID, "spam").
+	err := preloadParticipants(db).
+		Where("receiver_id = ? AND label = ? AND dropped = ?", userID, "spam", false).
 		Order("created_at DESC").
 		Find(&messages).Error
 	return messages, err
@@ -87,28 +390,82 @@ func GetSpamMessages(db *gorm.DB, userID uint) ([]Message, error) {
 
 func GetTrashMessages(db *gorm.DB, userID uint) ([]Message, error) {
 	var messages []Message
-	err := db.Preload("Sender").Preload("Receiver").
-		Where("(receiver_id = ? OR sender_id = ?) AND label = ?", userID, userID, "trash").
+	err := preloadParticipants(db).
+		Where("((receiver_id = ? AND dropped = ?) OR sender_id = ?) AND label = ?", userID, false, userID, "trash").
 		Order("created_at DESC").
 		Find(&messages).Error
 	return messages, err
 }
 
 
-func UpdateMessageLabel(db *gorm.DB, messageID uint, userID uint, label string) error {
+// UpdateMessageLabel переносит письмо в папку label и возвращает прежнюю метку.
+func UpdateMessageLabel(db *gorm.DB, messageID uint, userID uint, label string) (string, error) {
 
 	var message Message
 	if err := db.First(&message, messageID).Error; err != nil {
-		return err
+		return "", err
 	}
 
 
-	if message.SenderID != userID && message.ReceiverID != userID {
-		return gorm.ErrRecordNotFound
+	if !message.VisibleTo(userID) {
+		return "", gorm.ErrRecordNotFound
 	}
 
 
-	return db.Model(&message).Update("label", label).Error
+	// Перенос в спам и из спама во входящие обучает спам-фильтр получателя
+	if message.ReceiverID == userID {
+		class := ""
+		if label == "spam" {
+			class = spamClassSpam
+		} else if label == "inbox" && message.Label == "spam" {
+			class = spamClassHam
+		}
+		if class != "" {
+			if err := trainSpam(db, &message, class); err != nil {
+				return "", err
+			}
+		}
+	}
+
+
+	previous := message.Label
+	return previous, db.Model(&message).Update("label", label).Error
+}
+
+
+// VisibleTo сообщает, видит ли письмо пользователь userID: отправитель видит
+// его всегда, получатель — если письмо не отброшено блокировкой.
+func (m *Message) VisibleTo(userID uint) bool {
+	return m.SenderID == userID || (m.ReceiverID == userID && !m.Dropped)
+}
+
+
+// StarredBy возвращает отметку звездочкой пользователя userID: у
+// отправителя и получателя они независимы.
+func (m *Message) StarredBy(userID uint) bool {
+	if userID != m.ReceiverID && userID == m.SenderID {
+		return m.SenderStarred
+	}
+	return m.IsStarred
+}
+
+
+// UpdateMessageStar ставит или снимает отметку пользователя. Отметка
+// отправителя не видна получателю и наоборот.
+func UpdateMessageStar(db *gorm.DB, messageID, userID uint, starred bool) error {
+	var message Message
+	err := db.Select("id", "sender_id", "receiver_id").
+		Where("id = ? AND (sender_id = ? OR (receiver_id = ? AND dropped = ?))", messageID, userID, userID, false).
+		First(&message).Error
+	if err != nil {
+		return err
+	}
+
+	column := "is_starred"
+	if message.ReceiverID != userID {
+		column = "sender_starred"
+	}
+	return db.Model(&message).Update(column, starred).Error
 }
 
 
@@ -131,6 +488,55 @@ func IncrementMessageReadCount(db *gorm.DB, messageID uint) (bool, error) {
 }
 
 
-func DeleteExpiredMessages(db *gorm.DB) error {
-	return db.Where("expires_at < ? AND expires_at IS NOT NULL", time.Now()).Delete(&Message{}).Error
+// DeleteExpiredMessages удаляет просроченные сообщения и возвращает их.
+func DeleteExpiredMessages(db *gorm.DB) ([]Message, error) {
+	var messages []Message
+	if err := db.Where("expires_at < ? AND expires_at IS NOT NULL", time.Now()).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	return messages, db.Where("id IN ?", ids).Delete(&Message{}).Error
+}
+
+
+type MailboxStats struct {
+	Inbox    int64 `json:"inbox"`
+	Unread   int64 `json:"unread"`
+	Spam     int64 `json:"spam"`
+	Trash    int64 `json:"trash"`
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+
+func GetMailboxStats(db *gorm.DB, userID uint) (*MailboxStats, error) {
+	stats := &MailboxStats{}
+
+	counters := []struct {
+		target *int64
+		query  string
+		args   []interface{}
+	}{
+		{&stats.Inbox, "receiver_id = ? AND label = ? AND dropped = ?", []interface{}{userID, "inbox", false}},
+		{&stats.Unread, "receiver_id = ? AND label = ? AND is_read = ? AND dropped = ?", []interface{}{userID, "inbox", false, false}},
+		{&stats.Spam, "receiver_id = ? AND label = ? AND dropped = ?", []interface{}{userID, "spam", false}},
+		{&stats.Trash, "((receiver_id = ? AND dropped = ?) OR sender_id = ?) AND label = ?", []interface{}{userID, false, userID, "trash"}},
+		{&stats.Sent, "sender_id = ?", []interface{}{userID}},
+		{&stats.Received, "receiver_id = ? AND dropped = ?", []interface{}{userID, false}},
+	}
+
+	for _, counter := range counters {
+		if err := db.Model(&Message{}).Where(counter.query, counter.args...).Count(counter.target).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
 }
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mail-service/totp"
+	"gorm.io/gorm"
+)
+
+
+const (
+	RecoveryCodeCount = 10
+	totpSkew          = 1
+)
+
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("двухфакторная аутентификация уже включена")
+	ErrMFANotEnrolled    = errors.New("двухфакторная аутентификация не настроена")
+	ErrMFAInvalidCode    = errors.New("неверный код подтверждения")
+)
+
+
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+
+// BeginMFAEnrollment генерирует новый секрет. До подтверждения кодом
+// секрет хранится у пользователя, но двухфакторная аутентификация не включена.
+func BeginMFAEnrollment(db *gorm.DB, user *User) (string, error) {
+	if user.MFAEnabled {
+		return "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"mfa_secret":    secret,
+		"mfa_last_step": 0,
+	}).Error; err != nil {
+		return "", err
+	}
+
+	user.MFASecret = secret
+	return secret, nil
+}
+
+
+func ConfirmMFAEnrollment(db *gorm.DB, user *User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := useTOTPCode(tx, user, code); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.MFAEnabled = true
+	return codes, nil
+}
+
+
+func DisableMFA(db *gorm.DB, user *User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled":   false,
+			"mfa_secret":    "",
+			"mfa_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		user.MFAEnabled = false
+		user.MFASecret = ""
+		return nil
+	})
+}
+
+
+func RegenerateRecoveryCodes(db *gorm.DB, user *User) ([]string, error) {
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+
+// VerifyMFACode принимает либо TOTP-код, либо одноразовый код восстановления.
+func VerifyMFACode(db *gorm.DB, user *User, code string) error {
+	if !user.MFAEnabled || user.MFASecret == "" {
+		return ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if strings.Contains(code, "-") {
+		return useRecoveryCode(db, user.ID, code)
+	}
+
+	return useTOTPCode(db, user, code)
+}
+
+
+// useTOTPCode принимает код только если его шаг больше последнего
+// использованного, поэтому один и тот же код нельзя предъявить дважды.
+func useTOTPCode(db *gorm.DB, user *User, code string) error {
+	step, ok := totp.Validate(user.MFASecret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrMFAInvalidCode
+	}
+
+	result := db.Model(&User{}).
+		Where("id = ? AND mfa_last_step < ?", user.ID, step).
+		Update("mfa_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFAInvalidCode
+	}
+
+	user.MFALastStep = step
+	return nil
+}
+
+
+func useRecoveryCode(db *gorm.DB, userID uint, code string) error {
+	var candidates []MFARecoveryCode
+	if err := db.Where("user_id = ? AND used_at IS NULL", userID).Find(&candidates).Error; err != nil {
+		return err
+	}
+
+	hash := hashToken(strings.ToLower(code))
+	for _, candidate := range candidates {
+		if subtle.ConstantTimeCompare([]byte(candidate.CodeHash), []byte(hash)) != 1 {
+			continue
+		}
+
+		result := db.Model(&MFARecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", candidate.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMFAInvalidCode
+		}
+		return nil
+	}
+
+	return ErrMFAInvalidCode
+}
+
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw, err := generateToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+
+		if err := tx.Create(&MFARecoveryCode{UserID: userID, CodeHash: hashToken(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mail-service/totp"
+)
+
+func TestMFAEnrollmentAndVerification(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "mfa@example.com", "password123")
+
+	secret, err := BeginMFAEnrollment(db, user)
+	if err != nil {
+		t.Fatalf("Ошибка начала настройки: %v", err)
+	}
+
+	if _, err := ConfirmMFAEnrollment(db, user, "000000"); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("Неверный код должен отклоняться, получено %v", err)
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	recovery, err := ConfirmMFAEnrollment(db, user, code)
+	if err != nil {
+		t.Fatalf("Ошибка подтверждения: %v", err)
+	}
+	if len(recovery) != RecoveryCodeCount {
+		t.Errorf("Ожидалось %d кодов восстановления, получено %d", RecoveryCodeCount, len(recovery))
+	}
+
+	var stored User
+	db.First(&stored, user.ID)
+	if !stored.MFAEnabled {
+		t.Fatal("Двухфакторная аутентификация должна быть включена")
+	}
+
+	if err := VerifyMFACode(db, &stored, code); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("Повторное использование TOTP-кода должно отклоняться, получено %v", err)
+	}
+
+	if err := VerifyMFACode(db, &stored, recovery[0]); err != nil {
+		t.Errorf("Код восстановления должен приниматься: %v", err)
+	}
+	if err := VerifyMFACode(db, &stored, recovery[0]); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("Код восстановления должен быть одноразовым, получено %v", err)
+	}
+}
+
+func TestDisableMFA(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "off@example.com", "password123")
+	secret, _ := BeginMFAEnrollment(db, user)
+	code, _ := totp.GenerateCode(secret, time.Now())
+	ConfirmMFAEnrollment(db, user, code)
+
+	if err := DisableMFA(db, user); err != nil {
+		t.Fatalf("Ошибка отключения: %v", err)
+	}
+
+	var count int64
+	db.Model(&MFARecoveryCode{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Коды восстановления должны быть удалены, осталось %d", count)
+	}
+
+	var stored User
+	db.First(&stored, user.ID)
+	if stored.MFAEnabled || stored.MFASecret != "" {
+		t.Error("Секрет и флаг должны быть сброшены")
+	}
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+// OutboxEvent — уведомление, ожидающее публикации в брокер. Записывается в
+// той же транзакции, что и изменение, о котором оно сообщает, поэтому
+// уведомление уходит только после фиксации и не теряется, если брокер
+// недоступен. Публикует события outbox.Relay.
+type OutboxEvent struct {
+	ID            uint       `gorm:"primaryKey"`
+	RoutingKey    string     `gorm:"not null"`
+	Payload       string     `gorm:"type:text;not null"`
+	Attempts      int        `gorm:"not null"`
+	LastError     string     `gorm:"not null"`
+	NextAttemptAt time.Time  `gorm:"index;not null"`
+	PublishedAt   *time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+
+// EnqueueOutboxEvent сохраняет событие с телом payload в формате JSON.
+func EnqueueOutboxEvent(db *gorm.DB, routingKey string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return db.Create(&OutboxEvent{
+		RoutingKey:    routingKey,
+		Payload:       string(body),
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+
+// PendingOutboxEvents возвращает неопубликованные события, время повторной
+// попытки которых наступило, в порядке записи.
+func PendingOutboxEvents(db *gorm.DB, now time.Time, limit int) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := db.Where("published_at IS NULL AND next_attempt_at <= ?", now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+
+func MarkOutboxEventPublished(db *gorm.DB, event *OutboxEvent, at time.Time) error {
+	event.PublishedAt = &at
+	return db.Model(event).Updates(map[string]interface{}{
+		"published_at": at,
+		"attempts":     event.Attempts + 1,
+		"last_error":   "",
+	}).Error
+}
+
+
+// MarkOutboxEventFailed откладывает следующую попытку до next.
+func MarkOutboxEventFailed(db *gorm.DB, event *OutboxEvent, cause error, next time.Time) error {
+	event.Attempts++
+	event.LastError = cause.Error()
+	event.NextAttemptAt = next
+	return db.Model(event).Updates(map[string]interface{}{
+		"attempts":        event.Attempts,
+		"last_error":      event.LastError,
+		"next_attempt_at": next,
+	}).Error
+}
+
+
+// DeletePublishedOutboxEvents удаляет события, опубликованные до before.
+func DeletePublishedOutboxEvents(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("published_at IS NOT NULL AND published_at < ?", before).Delete(&OutboxEvent{})
+	return result.RowsAffected, result.Error
+}
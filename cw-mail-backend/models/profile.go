@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	MaxDisplayNameLength = 100
+	MaxSignatureLength   = 2000
+)
+
+
+var (
+	ErrDisplayNameTooLong = errors.New("отображаемое имя слишком длинное")
+	ErrSignatureTooLong   = errors.New("подпись слишком длинная")
+	ErrInvalidTimezone    = errors.New("неизвестный часовой пояс")
+	ErrInvalidLocale      = errors.New("недопустимый код языка")
+)
+
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+
+// ProfileUpdate описывает частичное обновление профиля: nil-поля не меняются.
+type ProfileUpdate struct {
+	DisplayName *string
+	Timezone    *string
+	Locale      *string
+	Signature   *string
+}
+
+
+func (p ProfileUpdate) validate() error {
+	if p.DisplayName != nil && utf8.RuneCountInString(strings.TrimSpace(*p.DisplayName)) > MaxDisplayNameLength {
+		return ErrDisplayNameTooLong
+	}
+	if p.Signature != nil && utf8.RuneCountInString(*p.Signature) > MaxSignatureLength {
+		return ErrSignatureTooLong
+	}
+	if p.Timezone != nil {
+		if *p.Timezone == "" || strings.EqualFold(*p.Timezone, "local") {
+			return ErrInvalidTimezone
+		}
+		if _, err := time.LoadLocation(*p.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	if p.Locale != nil && !localePattern.MatchString(*p.Locale) {
+		return ErrInvalidLocale
+	}
+	return nil
+}
+
+
+func UpdateProfile(db *gorm.DB, user *User, update ProfileUpdate) error {
+	if err := update.validate(); err != nil {
+		return err
+	}
+
+	changes := map[string]interface{}{}
+	if update.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*update.DisplayName)
+		changes["display_name"] = user.DisplayName
+	}
+	if update.Timezone != nil {
+		user.Timezone = *update.Timezone
+		changes["timezone"] = user.Timezone
+	}
+	if update.Locale != nil {
+		user.Locale = *update.Locale
+		changes["locale"] = user.Locale
+	}
+	if update.Signature != nil {
+		user.Signature = *update.Signature
+		changes["signature"] = user.Signature
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return db.Model(user).Updates(changes).Error
+}
+
+
+// SetUserAvatar сохраняет путь к новому аватару и возвращает путь к
+// предыдущему, чтобы вызывающий код мог удалить старый файл.
+func SetUserAvatar(db *gorm.DB, user *User, path string) (string, error) {
+	previous := user.AvatarPath
+
+	if err := db.Model(user).Update("avatar_path", path).Error; err != nil {
+		return "", err
+	}
+
+	user.AvatarPath = path
+	return previous, nil
+}
+
+
+// CanViewUserCard сообщает, может ли viewer видеть карточку target. Карточка
+// доступна самому пользователю, администраторам и тем, кто связан с target:
+// переписывался с ним, держит его в контактах (или сам есть в его контактах)
+// или состоит с ним в одном списке рассылки. Иначе перебором ID можно было бы
+// выгрузить адреса всех учетных записей.
+func CanViewUserCard(db *gorm.DB, viewer, target *User) (bool, error) {
+	if viewer.ID == target.ID || viewer.IsAdmin() {
+		return true, nil
+	}
+
+	checks := []*gorm.DB{
+		db.Model(&Message{}).
+			Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ? AND dropped = ?)", viewer.ID, target.ID, target.ID, viewer.ID, false),
+		db.Model(&Contact{}).
+			Where("(user_id = ? AND email = LOWER(?)) OR (user_id = ? AND email = LOWER(?))", viewer.ID, target.Email, target.ID, viewer.Email),
+		db.Table("distribution_list_members AS a").
+			Joins("JOIN distribution_list_members AS b ON b.list_id = a.list_id").
+			Where("a.user_id = ? AND b.user_id = ?", viewer.ID, target.ID),
+		db.Model(&DistributionList{}).
+			Joins("JOIN distribution_list_members ON distribution_list_members.list_id = distribution_lists.id").
+			Where("(distribution_lists.owner_id = ? AND distribution_list_members.user_id = ?) OR (distribution_lists.owner_id = ? AND distribution_list_members.user_id = ?)", viewer.ID, target.ID, target.ID, viewer.ID),
+	}
+	for _, check := range checks {
+		var count int64
+		if err := check.Limit(1).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
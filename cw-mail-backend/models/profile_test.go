@@ -0,0 +1,142 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestUpdateProfile(t *testing.T) {
+	db := setupTestDB(t)
+
+	user, _ := CreateUser(db, "profile@example.com", "password123")
+
+	if user.Name() != "profile@example.com" {
+		t.Errorf("Без отображаемого имени должен использоваться email, получено %q", user.Name())
+	}
+
+	err := UpdateProfile(db, user, ProfileUpdate{
+		DisplayName: strPtr("  Иван Петров "),
+		Timezone:    strPtr("Europe/Moscow"),
+		Locale:      strPtr("en-US"),
+	})
+	if err != nil {
+		t.Fatalf("Ошибка обновления профиля: %v", err)
+	}
+
+	var stored User
+	db.First(&stored, user.ID)
+	if stored.DisplayName != "Иван Петров" || stored.Timezone != "Europe/Moscow" || stored.Locale != "en-US" {
+		t.Errorf("Профиль сохранен неверно: %+v", stored)
+	}
+	if stored.Name() != "Иван Петров" {
+		t.Errorf("Ожидалось отображаемое имя, получено %q", stored.Name())
+	}
+
+	// Поля, которые не переданы, не меняются
+	if err := UpdateProfile(db, user, ProfileUpdate{Signature: strPtr("С уважением")}); err != nil {
+		t.Fatalf("Ошибка обновления подписи: %v", err)
+	}
+	db.First(&stored, user.ID)
+	if stored.DisplayName != "Иван Петров" || stored.Signature != "С уважением" {
+		t.Errorf("Частичное обновление затронуло другие поля: %+v", stored)
+	}
+
+	cases := []struct {
+		update ProfileUpdate
+		want   error
+	}{
+		{ProfileUpdate{Timezone: strPtr("Mars/Olympus")}, ErrInvalidTimezone},
+		{ProfileUpdate{Timezone: strPtr("Local")}, ErrInvalidTimezone},
+		{ProfileUpdate{Locale: strPtr("russian")}, ErrInvalidLocale},
+		{ProfileUpdate{DisplayName: strPtr(strings.Repeat("я", MaxDisplayNameLength+1))}, ErrDisplayNameTooLong},
+		{ProfileUpdate{Signature: strPtr(strings.Repeat("a", MaxSignatureLength+1))}, ErrSignatureTooLong},
+	}
+	for _, tc := range cases {
+		if err := UpdateProfile(db, user, tc.update); !errors.Is(err, tc.want) {
+			t.Errorf("Ожидалась ошибка %v, получено %v", tc.want, err)
+		}
+	}
+}
+
+func TestMessageParticipants(t *testing.T) {
+	db := setupTestDB(t)
+
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	UpdateProfile(db, sender, ProfileUpdate{DisplayName: strPtr("Отправитель")})
+
+	sent, err := SendMessage(db, sender.ID, receiver.Email, "Тема", "Текст", 0)
+	if err != nil {
+		t.Fatalf("Ошибка отправки: %v", err)
+	}
+	if sent.Sender.Name() != "Отправитель" || sent.Receiver.Email != receiver.Email {
+		t.Errorf("Участники не заполнены при отправке: %+v / %+v", sent.Sender, sent.Receiver)
+	}
+
+	inbox, err := GetInboxMessages(db, receiver.ID)
+	if err != nil || len(inbox) != 1 {
+		t.Fatalf("Ошибка получения входящих: %v", err)
+	}
+
+	message := inbox[0]
+	if message.Sender.Name() != "Отправитель" || message.Sender.Email != sender.Email {
+		t.Errorf("Неверный отправитель: %+v", message.Sender)
+	}
+	if message.Sender.EncryptedPassword != "" || message.Sender.Role != "" {
+		t.Error("Для участников должны загружаться только публичные поля")
+	}
+
+	raw, _ := json.Marshal(message)
+	if strings.Contains(string(raw), `"sender":`) || strings.Contains(string(raw), "encrypted_password") {
+		t.Errorf("Учетная запись отправителя не должна сериализоваться вместе с сообщением: %s", raw)
+	}
+}
+
+func TestCanViewUserCard(t *testing.T) {
+	db := setupTestDB(t)
+
+	viewer, _ := CreateUser(db, "viewer@example.com", "password123")
+	correspondent, _ := CreateUser(db, "correspondent@example.com", "password123")
+	contact, _ := CreateUser(db, "Contact@example.com", "password123")
+	colleague, _ := CreateUser(db, "colleague@example.com", "password123")
+	stranger, _ := CreateUser(db, "stranger@example.com", "password123")
+	admin, _ := CreateUser(db, "admin@example.com", "password123")
+	admin.Role = RoleAdmin
+
+	SendMessage(db, correspondent.ID, viewer.Email, "Тема", "Текст", 0)
+	CreateContact(db, viewer.ID, ContactFields{Email: "contact@example.com"})
+	list, err := CreateDistributionList(db, colleague, DistributionListFields{Address: "team@example.com", Name: "Команда"}, testAddressPolicy)
+	if err != nil {
+		t.Fatalf("Ошибка создания списка: %v", err)
+	}
+	AddDistributionListMember(db, list, viewer.Email)
+
+	for _, tc := range []struct {
+		viewer, target *User
+		want           bool
+	}{
+		{viewer, viewer, true},
+		{viewer, correspondent, true},
+		{correspondent, viewer, true},
+		{viewer, contact, true},
+		{contact, viewer, true},
+		{viewer, colleague, true},
+		{viewer, stranger, false},
+		{stranger, viewer, false},
+		{admin, stranger, true},
+	} {
+		got, err := CanViewUserCard(db, tc.viewer, tc.target)
+		if err != nil {
+			t.Fatalf("Ошибка проверки доступа: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("%s видит карточку %s: %v, ожидалось %v", tc.viewer.Email, tc.target.Email, got, tc.want)
+		}
+	}
+}
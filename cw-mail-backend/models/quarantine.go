@@ -0,0 +1,184 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+
+const (
+	QuarantinePending  = "pending"
+	QuarantineReleased = "released"
+	QuarantineDeleted  = "deleted"
+)
+
+
+var ErrQuarantineResolved = errors.New("письмо уже выпущено или удалено из карантина")
+
+
+// QuarantinedMessage — письмо, которое сканер задержал до решения
+// администратора. Хранится в том виде, в каком его отправил пользователь,
+// и при выпуске доставляется заново от его имени.
+type QuarantinedMessage struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	SenderID     uint       `json:"sender_id" gorm:"index;not null"`
+	FromAddress  string     `json:"from_address,omitempty"`
+	ToAddress    string     `json:"to_address" gorm:"not null"`
+	Subject      string     `json:"subject"`
+	Body         string     `json:"body,omitempty"`
+	ReadLimit    int        `json:"read_limit,omitempty" gorm:"not null"`
+	Scanner      string     `json:"scanner" gorm:"not null"`
+	Reason       string     `json:"reason"`
+	Status       string     `json:"status" gorm:"index;not null"`
+	ReviewedByID *uint      `json:"reviewed_by_id,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+
+func (q *QuarantinedMessage) Outgoing() OutgoingMessage {
+	return OutgoingMessage{From: q.FromAddress, To: q.ToAddress, Subject: q.Subject, Body: q.Body, ReadLimit: q.ReadLimit}
+}
+
+
+func QuarantineMessage(db *gorm.DB, senderID uint, out OutgoingMessage, scanner, reason string) (*QuarantinedMessage, error) {
+	message := &QuarantinedMessage{
+		SenderID:    senderID,
+		FromAddress: out.From,
+		ToAddress:   out.To,
+		Subject:     out.Subject,
+		Body:        out.Body,
+		ReadLimit:   out.ReadLimit,
+		Scanner:     scanner,
+		Reason:      reason,
+		Status:      QuarantinePending,
+	}
+	if err := db.Create(message).Error; err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+
+type QuarantineFilter struct {
+	Status string
+	Page   int
+	Limit  int
+}
+
+
+func ListQuarantine(db *gorm.DB, filter QuarantineFilter) ([]QuarantinedMessage, int64, error) {
+	query := db.Model(&QuarantinedMessage{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var messages []QuarantinedMessage
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&messages).Error
+	return messages, total, err
+}
+
+
+func GetQuarantinedMessage(db *gorm.DB, id uint) (*QuarantinedMessage, error) {
+	var message QuarantinedMessage
+	if err := db.First(&message, id).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+
+// ReleaseQuarantinedMessage доставляет задержанное письмо от имени
+// отправителя. Повторно письмо не сканируется, но проходит фильтры,
+// спам-фильтр и Sieve-скрипты получателей. Вызывается в транзакции, чтобы
+// уведомления о доставке можно было опубликовать до фиксации. policy
+// проверяется так же, как при обычной отправке.
+func ReleaseQuarantinedMessage(db *gorm.DB, id, adminID uint, policy SendingPolicy) (*QuarantinedMessage, *Delivery, error) {
+	message, err := GetQuarantinedMessage(db, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message.Status != QuarantinePending {
+		return nil, nil, ErrQuarantineResolved
+	}
+
+	var sender User
+	if err := db.First(&sender, message.SenderID).Error; err != nil {
+		return nil, nil, err
+	}
+	delivery, err := DeliverMessage(db, &sender, message.Outgoing(), policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Администратор должен знать, что письмо не будет доставлено
+	if delivery.Dropped != nil {
+		return nil, nil, ErrSenderBlocked
+	}
+
+	if err := resolveQuarantine(db, message, QuarantineReleased, adminID, nil); err != nil {
+		return nil, nil, err
+	}
+	return message, delivery, nil
+}
+
+
+// DeleteQuarantinedMessage отклоняет задержанное письмо. Запись остается для
+// истории, но текст письма удаляется.
+func DeleteQuarantinedMessage(db *gorm.DB, id, adminID uint) (*QuarantinedMessage, error) {
+	message, err := GetQuarantinedMessage(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if message.Status != QuarantinePending {
+		return nil, ErrQuarantineResolved
+	}
+
+	if err := resolveQuarantine(db, message, QuarantineDeleted, adminID, map[string]interface{}{"body": ""}); err != nil {
+		return nil, err
+	}
+	message.Body = ""
+	return message, nil
+}
+
+
+func resolveQuarantine(db *gorm.DB, message *QuarantinedMessage, status string, adminID uint, updates map[string]interface{}) error {
+	now := time.Now()
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["status"] = status
+	updates["reviewed_by_id"] = adminID
+	updates["reviewed_at"] = now
+
+	result := db.Model(&QuarantinedMessage{}).
+		Where("id = ? AND status = ?", message.ID, QuarantinePending).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrQuarantineResolved
+	}
+
+	message.Status = status
+	message.ReviewedByID = &adminID
+	message.ReviewedAt = &now
+	return nil
+}
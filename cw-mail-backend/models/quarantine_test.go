@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuarantineRelease(t *testing.T) {
+	db := setupTestDB(t)
+	admin, _ := CreateUser(db, "admin@example.com", "password123")
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+
+	out := OutgoingMessage{To: receiver.Email, Subject: "Счет", Body: "Текст", ReadLimit: 2}
+	quarantined, err := QuarantineMessage(db, sender.ID, out, "clamav", "body: Eicar-Test-Signature")
+	if err != nil || quarantined.Status != QuarantinePending {
+		t.Fatalf("Ошибка помещения в карантин: %+v, %v", quarantined, err)
+	}
+
+	var count int64
+	db.Model(&Message{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("Письмо в карантине не должно доставляться, писем: %d", count)
+	}
+
+	released, delivery, err := ReleaseQuarantinedMessage(db, quarantined.ID, admin.ID, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка выпуска из карантина: %v", err)
+	}
+	if released.Status != QuarantineReleased || released.ReviewedByID == nil || *released.ReviewedByID != admin.ID {
+		t.Errorf("Письмо должно получить статус released: %+v", released)
+	}
+	if message := delivery.Messages[0]; message.SenderID != sender.ID || message.ReceiverID != receiver.ID || message.ReadLimit != 2 {
+		t.Errorf("Письмо доставлено не от имени отправителя: %+v", message)
+	}
+
+	if _, _, err := ReleaseQuarantinedMessage(db, quarantined.ID, admin.ID, SendingPolicy{}); !errors.Is(err, ErrQuarantineResolved) {
+		t.Errorf("Повторный выпуск должен возвращать ErrQuarantineResolved, получено %v", err)
+	}
+}
+
+func TestQuarantineDeleteAndList(t *testing.T) {
+	db := setupTestDB(t)
+	admin, _ := CreateUser(db, "admin@example.com", "password123")
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+
+	first, _ := QuarantineMessage(db, sender.ID, OutgoingMessage{To: "a@example.com", Subject: "Первое", Body: "Текст"}, "clamav", "")
+	QuarantineMessage(db, sender.ID, OutgoingMessage{To: "b@example.com", Subject: "Второе", Body: "Текст"}, "clamav", "")
+
+	deleted, err := DeleteQuarantinedMessage(db, first.ID, admin.ID)
+	if err != nil || deleted.Status != QuarantineDeleted || deleted.Body != "" {
+		t.Fatalf("Ошибка удаления: %+v, %v", deleted, err)
+	}
+	stored, _ := GetQuarantinedMessage(db, first.ID)
+	if stored.Body != "" || stored.Subject != "Первое" {
+		t.Errorf("У удаленного письма стирается только текст: %+v", stored)
+	}
+	if _, err := DeleteQuarantinedMessage(db, first.ID, admin.ID); !errors.Is(err, ErrQuarantineResolved) {
+		t.Errorf("Повторное удаление должно возвращать ErrQuarantineResolved, получено %v", err)
+	}
+
+	pending, total, err := ListQuarantine(db, QuarantineFilter{Status: QuarantinePending})
+	if err != nil || total != 1 || len(pending) != 1 || pending[0].Subject != "Второе" {
+		t.Errorf("Фильтр по статусу: %+v, %d, %v", pending, total, err)
+	}
+	all, total, _ := ListQuarantine(db, QuarantineFilter{Limit: 1, Page: 2})
+	if total != 2 || len(all) != 1 || all[0].ID != first.ID {
+		t.Errorf("Карантин сортируется от новых писем к старым: %+v, %d", all, total)
+	}
+}
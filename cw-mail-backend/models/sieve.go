@@ -0,0 +1,412 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mail-service/sieve"
+	"gorm.io/gorm"
+)
+
+
+const (
+	MaxSieveScripts       = 20
+	MaxSieveScriptSize    = 64 << 10
+	MaxSieveScriptNameLen = 128
+)
+
+
+var (
+	ErrInvalidSieveScript  = errors.New("ошибка в Sieve-скрипте")
+	ErrInvalidSieveName    = errors.New("недопустимое имя скрипта")
+	ErrSieveScriptExists   = errors.New("скрипт с таким именем уже существует")
+	ErrSieveScriptActive   = errors.New("нельзя удалить активный скрипт")
+	ErrSieveScriptTooLarge = errors.New("скрипт превышает допустимый размер")
+	ErrSieveLimitReached   = errors.New("достигнуто максимальное количество скриптов")
+	ErrMessageRejected     = errors.New("получатель отклонил письмо")
+)
+
+
+// sieveMailboxes — папки для fileinto (без учета регистра) и метки, которые
+// им соответствуют.
+var sieveMailboxes = map[string]string{
+	"inbox": "inbox",
+	"spam":  "spam",
+	"junk":  "spam",
+	"trash": "trash",
+}
+
+
+// SieveScript — Sieve-скрипт пользователя (RFC 5228). Скриптов может быть
+// несколько, при доставке выполняется только активный.
+type SieveScript struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_sieve_scripts_user_name;not null"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_sieve_scripts_user_name;not null"`
+	Content   string    `json:"content" gorm:"type:text;not null"`
+	Active    bool      `json:"active" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+
+// SieveMailboxLabel возвращает метку для папки из команды fileinto.
+func SieveMailboxLabel(mailbox string) (string, bool) {
+	label, ok := sieveMailboxes[strings.ToLower(mailbox)]
+	return label, ok
+}
+
+
+// ValidateSieveScript разбирает скрипт и проверяет, что fileinto использует
+// только существующие папки.
+func ValidateSieveScript(content string) (*sieve.Script, error) {
+	if len(content) > MaxSieveScriptSize {
+		return nil, ErrSieveScriptTooLarge
+	}
+
+	script, err := sieve.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSieveScript, err)
+	}
+	for _, mailbox := range script.Mailboxes() {
+		if _, ok := SieveMailboxLabel(mailbox); !ok {
+			return nil, fmt.Errorf("%w: неизвестная папка %q (доступны INBOX, Spam, Junk, Trash)", ErrInvalidSieveScript, mailbox)
+		}
+	}
+	return script, nil
+}
+
+
+// validateSieveName проверяет имя скрипта по правилам ManageSieve (RFC 5804,
+// 1.6): непустая строка UTF-8 без управляющих символов.
+func validateSieveName(name string) error {
+	if name == "" || !utf8.ValidString(name) || utf8.RuneCountInString(name) > MaxSieveScriptNameLen {
+		return ErrInvalidSieveName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || r == ' ' || r == ' ' {
+			return ErrInvalidSieveName
+		}
+	}
+	return nil
+}
+
+
+func ListSieveScripts(db *gorm.DB, userID uint) ([]SieveScript, error) {
+	var scripts []SieveScript
+	err := db.Where("user_id = ?", userID).Order("name ASC").Find(&scripts).Error
+	return scripts, err
+}
+
+
+func GetSieveScript(db *gorm.DB, scriptID, userID uint) (*SieveScript, error) {
+	var script SieveScript
+	if err := db.Where("id = ? AND user_id = ?", scriptID, userID).First(&script).Error; err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+
+func FindSieveScript(db *gorm.DB, userID uint, name string) (*SieveScript, error) {
+	var script SieveScript
+	if err := db.Where("user_id = ? AND name = ?", userID, name).First(&script).Error; err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+
+// ActiveSieveScript возвращает активный скрипт пользователя или nil, если
+// активного скрипта нет.
+func ActiveSieveScript(db *gorm.DB, userID uint) (*SieveScript, error) {
+	var script SieveScript
+	err := db.Where("user_id = ? AND active = ?", userID, true).First(&script).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+
+// CheckSieveSpace проверяет, поместится ли скрипт с таким именем и размером
+// в квоту пользователя. Замена существующего скрипта не увеличивает их число.
+func CheckSieveSpace(db *gorm.DB, userID uint, name string, size int) error {
+	if size > MaxSieveScriptSize {
+		return ErrSieveScriptTooLarge
+	}
+
+	var count, existing int64
+	if err := db.Model(&SieveScript{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&SieveScript{}).Where("user_id = ? AND name = ?", userID, name).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing == 0 && count >= MaxSieveScripts {
+		return ErrSieveLimitReached
+	}
+	return nil
+}
+
+
+func CreateSieveScript(db *gorm.DB, userID uint, name, content string) (*SieveScript, error) {
+	if err := validateSieveName(name); err != nil {
+		return nil, err
+	}
+	if _, err := ValidateSieveScript(content); err != nil {
+		return nil, err
+	}
+
+	script := &SieveScript{UserID: userID, Name: name, Content: content}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&SieveScript{}).Where("user_id = ? AND name = ?", userID, name).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrSieveScriptExists
+		}
+		if err := CheckSieveSpace(tx, userID, name, len(content)); err != nil {
+			return err
+		}
+		return tx.Create(script).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
+
+
+// UpdateSieveScript заменяет имя и текст скрипта. Активность не меняется.
+func UpdateSieveScript(db *gorm.DB, script *SieveScript, name, content string) error {
+	if err := validateSieveName(name); err != nil {
+		return err
+	}
+	if _, err := ValidateSieveScript(content); err != nil {
+		return err
+	}
+
+	if name != script.Name {
+		var existing int64
+		if err := db.Model(&SieveScript{}).Where("user_id = ? AND name = ?", script.UserID, name).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrSieveScriptExists
+		}
+	}
+
+	script.Name = name
+	script.Content = content
+	return db.Model(script).Select("name", "content", "updated_at").Updates(script).Error
+}
+
+
+// PutSieveScript сохраняет скрипт под именем name, заменяя существующий
+// (команда PUTSCRIPT протокола ManageSieve).
+func PutSieveScript(db *gorm.DB, userID uint, name, content string) (*SieveScript, error) {
+	script, err := FindSieveScript(db, userID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return CreateSieveScript(db, userID, name, content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := UpdateSieveScript(db, script, name, content); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+
+func DeleteSieveScript(db *gorm.DB, scriptID, userID uint) error {
+	script, err := GetSieveScript(db, scriptID, userID)
+	if err != nil {
+		return err
+	}
+	if script.Active {
+		return ErrSieveScriptActive
+	}
+	return db.Delete(script).Error
+}
+
+
+// ActivateSieveScript делает скрипт активным, снимая активность с остальных.
+// scriptID = 0 отключает Sieve для пользователя.
+func ActivateSieveScript(db *gorm.DB, userID, scriptID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&SieveScript{}).Where("user_id = ? AND active = ?", userID, true).Update("active", false).Error; err != nil {
+			return err
+		}
+		if scriptID == 0 {
+			return nil
+		}
+
+		result := tx.Model(&SieveScript{}).Where("id = ? AND user_id = ?", scriptID, userID).Update("active", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+
+// sieveMessage представляет письмо в виде, который понимает интерпретатор:
+// адреса конверта и заголовки From, To, Subject, Date, List-Id и
+// Auto-Submitted.
+func sieveMessage(message *Message) *sieve.Message {
+	header := sieve.Header{}
+	header.Add("From", message.SenderAddress)
+	header.Add("To", message.RecipientAddress)
+	header.Add("Subject", message.Subject)
+	header.Add("Date", time.Now().Format(time.RFC1123Z))
+	if message.ListAddress != "" {
+		header.Add("List-Id", "<"+message.ListAddress+">")
+	}
+	if message.AutoSubmitted != "" {
+		header.Add("Auto-Submitted", message.AutoSubmitted)
+	}
+	header.Add("X-Spam-Score", strconv.FormatFloat(message.SpamScore, 'f', 2, 64))
+	if message.Label == "spam" {
+		header.Add("X-Spam-Flag", "YES")
+	}
+
+	return &sieve.Message{
+		EnvelopeFrom: message.SenderAddress,
+		EnvelopeTo:   message.RecipientAddress,
+		Header:       header,
+		Body:         message.Body,
+	}
+}
+
+
+// sieveOutcome — действия Sieve-скрипта, которые выполняются после
+// сохранения письма.
+type sieveOutcome struct {
+	Redirect []string
+	Vacation *sieve.Vacation
+}
+
+
+// applySieve выполняет активный скрипт получателя. fileinto задает метку
+// письма; письмо, для которого отменено неявное сохранение (discard, redirect
+// без :copy), попадает в корзину, потому что у отправителя остается та же
+// запись. reject отклоняет доставку. Ошибка выполнения скрипта не мешает
+// доставке: письмо сохраняется как обычно (RFC 5228, 2.10.6).
+func applySieve(db *gorm.DB, message *Message) (sieveOutcome, error) {
+	stored, err := ActiveSieveScript(db, message.ReceiverID)
+	if err != nil || stored == nil {
+		return sieveOutcome{}, err
+	}
+
+	script, err := sieve.Parse(stored.Content)
+	if err != nil {
+		return sieveOutcome{}, nil
+	}
+	result, err := script.Execute(sieveMessage(message))
+	if err != nil {
+		return sieveOutcome{}, nil
+	}
+
+	if result.Rejected {
+		reason := strings.TrimSpace(result.RejectReason)
+		if reason == "" {
+			return sieveOutcome{}, ErrMessageRejected
+		}
+		return sieveOutcome{}, fmt.Errorf("%w: %s", ErrMessageRejected, reason)
+	}
+
+	if len(result.FileInto) > 0 {
+		if label, ok := SieveMailboxLabel(result.FileInto[0]); ok {
+			message.Label = label
+		}
+	} else if !result.Keep {
+		message.Label = "trash"
+	}
+
+	return sieveOutcome{Redirect: result.Redirect, Vacation: result.Vacation}, nil
+}
+
+
+// redirectMessage перенаправляет письмо на другой адрес без изменений: в
+// отличие от пересылки, адресом отправителя остается адрес автора. Копия
+// принадлежит перенаправившему пользователю: автор не должен видеть в
+// «Отправленных» письмо, которого не отправлял, и узнавать адрес, на который
+// получатель перенаправляет почту.
+func redirectMessage(db *gorm.DB, original *Message, owner User, address string) (*Message, error) {
+	target, err := FindUserByAddress(db, address)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && target.ID == owner.ID) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	message := newMessage(owner.ID, target.ID, original.Subject, original.Body, original.ReadLimit)
+	message.SenderAddress = original.SenderAddress
+	message.RecipientAddress = normalizeAddress(address)
+
+	_, _, err = deliverCopy(db, message, *target, false, original.SenderAddress)
+	if isDeliveryRefused(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+
+// sendVacationReply отправляет автоответ команды vacation. Ответ уходит, только
+// если письмо пришло на адрес пользователя или на один из :addresses, и не
+// чаще раза в Days дней одному отправителю.
+func sendVacationReply(db *gorm.DB, original *Message, owner User, vacation *sieve.Vacation) (*Message, error) {
+	if !canAutoReply(original, owner) {
+		return nil, nil
+	}
+
+	recipient, err := ResolveSenderAddress(db, &owner, original.RecipientAddress)
+	if errors.Is(err, ErrSenderAddressNotOwned) {
+		if !containsString(vacation.Addresses, normalizeAddress(original.RecipientAddress)) {
+			return nil, nil
+		}
+		recipient = owner.Email
+	} else if err != nil {
+		return nil, err
+	}
+
+	interval := time.Duration(vacation.Days) * 24 * time.Hour
+	due, err := claimAutoReply(db, owner.ID, original.SenderAddress, "sieve:"+vacation.Handle, interval)
+	if err != nil || !due {
+		return nil, err
+	}
+
+	from := recipient
+	if vacation.From != "" {
+		if owned, err := ResolveSenderAddress(db, &owner, vacation.From); err == nil {
+			from = owned
+		}
+	}
+	subject := vacation.Subject
+	if subject == "" {
+		subject = "Auto: " + original.Subject
+	}
+
+	return sendAutoReply(db, original, owner, from, subject, vacation.Reason)
+}
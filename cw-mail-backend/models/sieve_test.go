@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSieveScriptStorage(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+
+	if _, err := CreateSieveScript(db, user.ID, "main", "if true { fileinto \"Junk\"; }"); !errors.Is(err, ErrInvalidSieveScript) {
+		t.Errorf("Скрипт без require \"fileinto\" должен отклоняться, получено %v", err)
+	}
+	if _, err := CreateSieveScript(db, user.ID, "main", "require \"fileinto\";\nfileinto \"Archive\";"); !errors.Is(err, ErrInvalidSieveScript) {
+		t.Errorf("Неизвестная папка должна отклоняться, получено %v", err)
+	}
+	if _, err := CreateSieveScript(db, user.ID, "bad\nname", "keep;"); !errors.Is(err, ErrInvalidSieveName) {
+		t.Errorf("Имя с переводом строки должно отклоняться, получено %v", err)
+	}
+
+	first, err := CreateSieveScript(db, user.ID, "main", "keep;")
+	if err != nil {
+		t.Fatalf("Ошибка создания скрипта: %v", err)
+	}
+	if _, err := CreateSieveScript(db, user.ID, "main", "keep;"); !errors.Is(err, ErrSieveScriptExists) {
+		t.Errorf("Ожидалась ошибка повторного имени, получено %v", err)
+	}
+	second, _ := CreateSieveScript(db, user.ID, "other", "discard;")
+
+	if err := ActivateSieveScript(db, user.ID, first.ID); err != nil {
+		t.Fatalf("Ошибка активации: %v", err)
+	}
+	if err := ActivateSieveScript(db, user.ID, second.ID); err != nil {
+		t.Fatalf("Ошибка активации: %v", err)
+	}
+	active, _ := ActiveSieveScript(db, user.ID)
+	if active == nil || active.ID != second.ID {
+		t.Errorf("Активным должен быть только второй скрипт: %+v", active)
+	}
+	if err := DeleteSieveScript(db, second.ID, user.ID); !errors.Is(err, ErrSieveScriptActive) {
+		t.Errorf("Активный скрипт нельзя удалить, получено %v", err)
+	}
+
+	if err := ActivateSieveScript(db, user.ID, 0); err != nil {
+		t.Fatalf("Ошибка отключения: %v", err)
+	}
+	if active, _ := ActiveSieveScript(db, user.ID); active != nil {
+		t.Errorf("После отключения активного скрипта быть не должно: %+v", active)
+	}
+	if err := DeleteSieveScript(db, second.ID, user.ID); err != nil {
+		t.Errorf("Ошибка удаления: %v", err)
+	}
+
+	if _, err := PutSieveScript(db, user.ID, "main", "discard;"); err != nil {
+		t.Fatalf("Ошибка замены скрипта: %v", err)
+	}
+	stored, _ := FindSieveScript(db, user.ID, "main")
+	if stored.ID != first.ID || stored.Content != "discard;" {
+		t.Errorf("PUTSCRIPT должен заменить существующий скрипт: %+v", stored)
+	}
+}
+
+func TestSieveOnDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "boss@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	assistant, _ := CreateUser(db, "assistant@example.com", "password123")
+
+	script, err := CreateSieveScript(db, receiver.ID, "main", `require ["fileinto", "reject", "copy"];
+if header :contains "subject" "sale" {
+  fileinto "Junk";
+} elsif header :contains "subject" "casino" {
+  reject "Не пишите мне";
+} elsif address :is "from" "boss@example.com" {
+  redirect :copy "assistant@example.com";
+}`)
+	if err != nil {
+		t.Fatalf("Ошибка создания скрипта: %v", err)
+	}
+	if err := ActivateSieveScript(db, receiver.ID, script.ID); err != nil {
+		t.Fatalf("Ошибка активации: %v", err)
+	}
+
+	delivery, err := DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Big SALE", Body: "Текст"}, SendingPolicy{})
+	if err != nil || delivery.Messages[0].Label != "spam" {
+		t.Errorf("fileinto \"Junk\" должен перемещать письмо в спам: %+v, %v", delivery, err)
+	}
+
+	if _, err := DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Online Casino", Body: "Текст"}, SendingPolicy{}); !errors.Is(err, ErrMessageRejected) {
+		t.Errorf("Ожидался отказ в доставке, получено %v", err)
+	}
+
+	delivery, err = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Отчет", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if delivery.Messages[0].Label != "inbox" {
+		t.Errorf("redirect :copy не должен отменять доставку: %+v", delivery.Messages[0])
+	}
+	if len(delivery.Forwarded) != 1 || delivery.Forwarded[0].ReceiverID != assistant.ID || delivery.Forwarded[0].SenderAddress != sender.Email {
+		t.Errorf("Письмо должно быть перенаправлено с адресом автора: %+v", delivery.Forwarded)
+	}
+
+	// Перенаправленная копия не попадает в отправленные автора
+	sent, _ := GetSentMessages(db, sender.ID)
+	for _, message := range sent {
+		if message.ReceiverID == assistant.ID {
+			t.Errorf("Автор видит перенаправленную копию в отправленных: %+v", message)
+		}
+	}
+	if stats, _ := GetMailboxStats(db, sender.ID); stats.Sent != int64(len(sent)) || len(sent) != 2 {
+		t.Errorf("Отправленных у автора: %d (%d в статистике), ожидалось 2", len(sent), stats.Sent)
+	}
+}
+
+func TestSieveVacation(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+
+	script, _ := CreateSieveScript(db, receiver.ID, "vacation", `require "vacation";
+vacation :days 3 :subject "В отпуске" "Вернусь через неделю";`)
+	ActivateSieveScript(db, receiver.ID, script.ID)
+	script, _ = CreateSieveScript(db, sender.ID, "vacation", `require "vacation";
+vacation "Меня нет на месте";`)
+	ActivateSieveScript(db, sender.ID, script.ID)
+
+	delivery, err := DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Вопрос", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.AutoReplies) != 1 {
+		t.Fatalf("Ожидался один автоответ: %+v", delivery.AutoReplies)
+	}
+	reply := delivery.AutoReplies[0]
+	if reply.SenderID != receiver.ID || reply.ReceiverID != sender.ID || reply.Subject != "В отпуске" || reply.AutoSubmitted != AutoSubmittedReplied {
+		t.Errorf("Неверный автоответ: %+v", reply)
+	}
+
+	// Повторно тому же отправителю в течение :days ответ не отправляется
+	delivery, _ = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Еще вопрос", Body: "Текст"}, SendingPolicy{})
+	if len(delivery.AutoReplies) != 0 {
+		t.Errorf("Автоответ не должен повторяться: %+v", delivery.AutoReplies)
+	}
+
+	// Отправитель тоже в отпуске, но на автоответ автоответ не отправляется
+	var count int64
+	db.Model(&Message{}).Where("receiver_id = ?", receiver.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("Получатель должен получить только два письма, получено %d", count)
+	}
+}
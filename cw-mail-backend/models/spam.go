@@ -0,0 +1,244 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mail-service/spamfilter"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+
+const (
+	DefaultSpamThreshold = 0.9
+	MinSpamThreshold     = 0.5
+	MaxSpamThreshold     = 1.0
+)
+
+
+// Классы, на которых обучено письмо (Message.SpamTrained).
+const (
+	spamClassSpam = "spam"
+	spamClassHam  = "ham"
+)
+
+
+var ErrInvalidSpamThreshold = fmt.Errorf("порог должен быть от %.1f до %.1f", MinSpamThreshold, MaxSpamThreshold)
+
+
+// SpamSettings — настройки спам-фильтра пользователя и размер обучающей
+// выборки. Письмо с оценкой не ниже Threshold попадает в спам.
+type SpamSettings struct {
+	ID           uint    `json:"-" gorm:"primaryKey"`
+	UserID       uint    `json:"-" gorm:"uniqueIndex;not null"`
+	Enabled      bool    `json:"enabled" gorm:"not null"`
+	Threshold    float64 `json:"threshold" gorm:"not null"`
+	SpamMessages int     `json:"spam_messages" gorm:"not null"`
+	HamMessages  int     `json:"ham_messages" gorm:"not null"`
+}
+
+
+// SpamToken — сколько писем со словом пользователь отметил как спам и как не
+// спам.
+type SpamToken struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"uniqueIndex:idx_spam_tokens_user_token;not null"`
+	Token  string `gorm:"uniqueIndex:idx_spam_tokens_user_token;not null"`
+	Spam   int    `gorm:"not null"`
+	Ham    int    `gorm:"not null"`
+}
+
+
+func defaultSpamSettings(userID uint) *SpamSettings {
+	return &SpamSettings{UserID: userID, Enabled: true, Threshold: DefaultSpamThreshold}
+}
+
+
+// GetSpamSettings возвращает настройки спам-фильтра. По умолчанию фильтр
+// включен с порогом DefaultSpamThreshold.
+func GetSpamSettings(db *gorm.DB, userID uint) (*SpamSettings, error) {
+	var settings SpamSettings
+	err := db.Where("user_id = ?", userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultSpamSettings(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+
+func UpdateSpamSettings(db *gorm.DB, userID uint, enabled bool, threshold float64) (*SpamSettings, error) {
+	if threshold < MinSpamThreshold || threshold > MaxSpamThreshold {
+		return nil, ErrInvalidSpamThreshold
+	}
+
+	settings, err := GetSpamSettings(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	settings.Enabled = enabled
+	settings.Threshold = threshold
+	if err := db.Save(settings).Error; err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+
+func spamMessage(message *Message) spamfilter.Message {
+	return spamfilter.Message{From: message.SenderAddress, Subject: message.Subject, Body: message.Body}
+}
+
+
+// ClassifySpam оценивает письмо по модели получателя.
+func ClassifySpam(db *gorm.DB, message *Message) (spamfilter.Result, error) {
+	settings, err := GetSpamSettings(db, message.ReceiverID)
+	if err != nil {
+		return spamfilter.Result{}, err
+	}
+	return classifySpam(db, message, settings)
+}
+
+
+func classifySpam(db *gorm.DB, message *Message, settings *SpamSettings) (spamfilter.Result, error) {
+	content := spamMessage(message)
+	corpus := spamfilter.Counts{Spam: settings.SpamMessages, Ham: settings.HamMessages}
+
+	stats := make(map[string]spamfilter.Counts)
+	if corpus.Spam >= spamfilter.MinTrainingMessages && corpus.Ham >= spamfilter.MinTrainingMessages {
+		var tokens []SpamToken
+		err := db.Where("user_id = ? AND token IN ?", message.ReceiverID, spamfilter.Tokens(content)).Find(&tokens).Error
+		if err != nil {
+			return spamfilter.Result{}, err
+		}
+		for _, token := range tokens {
+			stats[token.Token] = spamfilter.Counts{Spam: token.Spam, Ham: token.Ham}
+		}
+	}
+
+	return spamfilter.Classify(content, stats, corpus), nil
+}
+
+
+// scoreSpam оценивает входящее письмо до фильтров получателя и переносит его
+// в спам, если оценка не ниже порога. Письма от сохраненных контактов в спам
+// автоматически не попадают. Фильтры и Sieve-скрипт применяются после оценки
+// и могут изменить метку.
+func scoreSpam(db *gorm.DB, message *Message) error {
+	settings, err := GetSpamSettings(db, message.ReceiverID)
+	if err != nil || !settings.Enabled {
+		return err
+	}
+
+	result, err := classifySpam(db, message, settings)
+	if err != nil {
+		return err
+	}
+	message.SpamScore = result.Score
+	if result.Score < settings.Threshold || message.Label != "inbox" {
+		return nil
+	}
+
+	contact, err := findContactByEmail(db, message.ReceiverID, normalizeAddress(message.SenderAddress))
+	if err == nil && !contact.Auto {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	message.Label = "spam"
+	return nil
+}
+
+
+// trainSpam обучает модель получателя на письме как на спаме или как на
+// обычном письме. Если письмо уже учтено в другом классе, прежний вклад
+// вычитается, поэтому повторные переносы не искажают статистику.
+func trainSpam(db *gorm.DB, message *Message, class string) error {
+	if message.SpamTrained == class {
+		return nil
+	}
+
+	tokens := spamfilter.Tokens(spamMessage(message))
+	return db.Transaction(func(tx *gorm.DB) error {
+		settings, err := GetSpamSettings(tx, message.ReceiverID)
+		if err != nil {
+			return err
+		}
+
+		switch message.SpamTrained {
+		case spamClassSpam:
+			settings.SpamMessages = max(settings.SpamMessages-1, 0)
+		case spamClassHam:
+			settings.HamMessages = max(settings.HamMessages-1, 0)
+		}
+		if message.SpamTrained != "" && len(tokens) > 0 {
+			column := message.SpamTrained
+			err := tx.Model(&SpamToken{}).
+				Where("user_id = ? AND token IN ? AND "+column+" > 0", message.ReceiverID, tokens).
+				Update(column, gorm.Expr(column+" - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		entries := make([]SpamToken, len(tokens))
+		for i, token := range tokens {
+			entries[i] = SpamToken{UserID: message.ReceiverID, Token: token}
+		}
+		if class == spamClassSpam {
+			settings.SpamMessages++
+			for i := range entries {
+				entries[i].Spam = 1
+			}
+		} else {
+			settings.HamMessages++
+			for i := range entries {
+				entries[i].Ham = 1
+			}
+		}
+		if len(entries) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "user_id"}, {Name: "token"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"spam": gorm.Expr("spam_tokens.spam + excluded.spam"),
+					"ham":  gorm.Expr("spam_tokens.ham + excluded.ham"),
+				}),
+			}).CreateInBatches(entries, 200).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(settings).Error; err != nil {
+			return err
+		}
+		message.SpamTrained = class
+		return tx.Model(message).Update("spam_trained", class).Error
+	})
+}
+
+
+// MarkNotSpam возвращает письмо из спама во входящие и обучает модель
+// получателя на нем как на обычном письме.
+func MarkNotSpam(db *gorm.DB, messageID, userID uint) (*Message, error) {
+	var message Message
+	if err := db.First(&message, messageID).Error; err != nil {
+		return nil, err
+	}
+	if message.ReceiverID != userID || message.Dropped {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if err := trainSpam(db, &message, spamClassHam); err != nil {
+		return nil, err
+	}
+	if err := db.Model(&message).Update("label", "inbox").Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestSpamSettings(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+
+	settings, err := GetSpamSettings(db, user.ID)
+	if err != nil || !settings.Enabled || settings.Threshold != DefaultSpamThreshold {
+		t.Fatalf("По умолчанию фильтр включен с порогом %v: %+v, %v", DefaultSpamThreshold, settings, err)
+	}
+
+	if _, err := UpdateSpamSettings(db, user.ID, true, 0.2); !errors.Is(err, ErrInvalidSpamThreshold) {
+		t.Errorf("Ожидалась ошибка порога, получено %v", err)
+	}
+	if _, err := UpdateSpamSettings(db, user.ID, false, 0.8); err != nil {
+		t.Fatalf("Ошибка сохранения настроек: %v", err)
+	}
+	settings, _ = GetSpamSettings(db, user.ID)
+	if settings.Enabled || settings.Threshold != 0.8 {
+		t.Errorf("Настройки не сохранены: %+v", settings)
+	}
+}
+
+func TestSpamTrainingOnDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	spammer, _ := CreateUser(db, "promo@shop.example", "password123")
+	colleague, _ := CreateUser(db, "colleague@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+
+	// Пользователь отмечает рассылки как спам, а письма коллеги — как не спам
+	for i := 0; i < 5; i++ {
+		delivery, _ := DeliverMessage(db, spammer, OutgoingMessage{To: receiver.Email, Subject: "Распродажа", Body: "Скидка на товары, купите сейчас"}, SendingPolicy{})
+		if _, err := UpdateMessageLabel(db, delivery.Messages[0].ID, receiver.ID, "spam"); err != nil {
+			t.Fatalf("Ошибка переноса в спам: %v", err)
+		}
+
+		delivery, _ = DeliverMessage(db, colleague, OutgoingMessage{To: receiver.Email, Subject: "Отчет", Body: "Отчет по проекту обсудим на встрече"}, SendingPolicy{})
+		UpdateMessageLabel(db, delivery.Messages[0].ID, receiver.ID, "spam")
+		if _, err := MarkNotSpam(db, delivery.Messages[0].ID, receiver.ID); err != nil {
+			t.Fatalf("Ошибка отметки «не спам»: %v", err)
+		}
+	}
+
+	settings, _ := GetSpamSettings(db, receiver.ID)
+	if settings.SpamMessages != 5 || settings.HamMessages != 5 {
+		t.Errorf("Повторное обучение должно заменять прежний класс письма: %+v", settings)
+	}
+
+	delivery, _ := DeliverMessage(db, spammer, OutgoingMessage{To: receiver.Email, Subject: "Распродажа", Body: "Скидка только сейчас"}, SendingPolicy{})
+	if message := delivery.Messages[0]; message.Label != "spam" || message.SpamScore < DefaultSpamThreshold {
+		t.Errorf("Похожее письмо должно попасть в спам: %+v", message)
+	}
+
+	delivery, _ = DeliverMessage(db, colleague, OutgoingMessage{To: receiver.Email, Subject: "Отчет", Body: "Обсудим проект"}, SendingPolicy{})
+	if message := delivery.Messages[0]; message.Label != "inbox" || message.SpamScore > 0.5 {
+		t.Errorf("Обычное письмо должно остаться во входящих: %+v", message)
+	}
+
+	// Письма от сохраненного контакта в спам автоматически не попадают
+	CreateContact(db, receiver.ID, ContactFields{Email: spammer.Email})
+	delivery, _ = DeliverMessage(db, spammer, OutgoingMessage{To: receiver.Email, Subject: "Распродажа", Body: "Скидка"}, SendingPolicy{})
+	if message := delivery.Messages[0]; message.Label != "inbox" || message.SpamScore < DefaultSpamThreshold {
+		t.Errorf("Письмо контакта получает оценку, но остается во входящих: %+v", message)
+	}
+
+	if _, err := MarkNotSpam(db, delivery.Messages[0].ID, spammer.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Отправитель не может обучать фильтр получателя, получено %v", err)
+	}
+}
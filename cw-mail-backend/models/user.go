@@ -2,10 +2,12 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -16,12 +18,29 @@ const (
 var ValidRoles = []string{RoleUser, RoleAdmin}
 
 type User struct {
-	ID                uint      `json:"id" gorm:"primaryKey"`
-	Email             string    `json:"email" gorm:"unique;not null"`
-	EncryptedPassword string    `json:"-" gorm:"not null"`
-	Role              string    `json:"role" gorm:"default:user;check:role IN ('user','admin')"`
-	CreatedAt         time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt         time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID                    uint       `json:"id" gorm:"primaryKey"`
+	Email                 string     `json:"email" gorm:"unique;not null"`
+	EncryptedPassword     string     `json:"-" gorm:"not null"`
+	Role                  string     `json:"role" gorm:"default:user;check:role IN ('user','admin')"`
+	EmailVerified         bool       `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	MFAEnabled            bool       `json:"mfa_enabled" gorm:"column:mfa_enabled;not null;default:false"`
+	MFASecret             string     `json:"-" gorm:"column:mfa_secret"`
+	MFALastStep           int64      `json:"-" gorm:"column:mfa_last_step;not null;default:0"`
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required" gorm:"not null;default:false"`
+	SessionsRevokedAt     *time.Time `json:"-"`
+	DisplayName           string     `json:"display_name" gorm:"size:100"`
+	AvatarPath            string     `json:"-"`
+	Timezone              string     `json:"timezone" gorm:"not null;default:UTC"`
+	Locale                string     `json:"locale" gorm:"not null;default:ru"`
+	Signature             string     `json:"signature" gorm:"type:text"`
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`
+	AnonymizedAt          *time.Time `json:"anonymized_at,omitempty"`
+	AliasQuota            *int       `json:"alias_quota,omitempty"`
+	BlockAction           string     `json:"block_action" gorm:"not null;default:spam"`
+	CreatedAt             time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt             time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
 func IsValidRole(role string) bool {
@@ -53,6 +72,27 @@ func (u *User) CanModifyRoles() bool {
 	return u.Role == RoleAdmin
 }
 
+// Name возвращает отображаемое имя пользователя, а если оно не задано — email.
+func (u *User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Email
+}
+
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// SessionValidAt сообщает, действует ли токен, выпущенный в момент issuedAt.
+// Токены, выпущенные до принудительного отзыва сессий, недействительны.
+func (u *User) SessionValidAt(issuedAt time.Time) bool {
+	if u.SessionsRevokedAt == nil {
+		return true
+	}
+	return !issuedAt.Before(u.SessionsRevokedAt.Truncate(time.Second))
+}
+
 func (u *User) SetPassword(password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -124,3 +164,115 @@ func UpdateUserRole(db *gorm.DB, userID uint, newRole string, modifierUser *User
 
 	return db.Model(&User{}).Where("id = ?", userID).Update("role", newRole).Error
 }
+
+type UserFilter struct {
+	Query  string
+	Role   string
+	Status string
+	Page   int
+	Limit  int
+}
+
+func SearchUsers(db *gorm.DB, filter UserFilter) ([]User, int64, error) {
+	query := db.Model(&User{})
+
+	if filter.Query != "" {
+		query = query.Where("LOWER(email) LIKE ?", "%"+strings.ToLower(filter.Query)+"%")
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	switch filter.Status {
+	case "active":
+		query = query.Where("disabled_at IS NULL")
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var users []User
+	err := query.Order("id ASC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&users).Error
+	return users, total, err
+}
+
+var ErrLastAdmin = errors.New("нельзя оставить систему без администратора")
+
+// EnsureAdminRemains проверяет, что после понижения, отключения или удаления
+// userID в системе останется действующий администратор. Вызывается в той же
+// транзакции, что и само изменение: строки администраторов блокируются, и два
+// администратора не могут одновременно понизить или отключить друг друга.
+// Отключенный администратор не считается действующим, в том числе когда
+// понижают или удаляют его самого.
+func EnsureAdminRemains(tx *gorm.DB, userID uint) error {
+	query := tx.Model(&User{})
+	if tx.Dialector.Name() == "postgres" {
+		// FOR UPDATE несовместим с агрегатами, поэтому выбираем id, а не COUNT
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var ids []uint
+	if err := query.Where("role = ? AND disabled_at IS NULL", RoleAdmin).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if id != userID {
+			return nil
+		}
+	}
+	if len(ids) > 0 {
+		return ErrLastAdmin
+	}
+	// действующих администраторов нет вовсе — изменение ничего не ухудшает
+	return nil
+}
+
+func SetUserDisabled(db *gorm.DB, userID uint, disabled bool) error {
+	if !disabled {
+		return db.Model(&User{}).Where("id = ?", userID).Update("disabled_at", nil).Error
+	}
+
+	now := time.Now()
+	return db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"disabled_at":         now,
+		"sessions_revoked_at": now,
+	}).Error
+}
+
+// ForcePasswordReset отзывает все выданные JWT и требует смены пароля при следующем входе.
+func ForcePasswordReset(db *gorm.DB, userID uint) error {
+	return db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password_reset_required": true,
+		"sessions_revoked_at":     time.Now(),
+	}).Error
+}
+
+func ChangePassword(db *gorm.DB, user *User, newPassword string) error {
+	if err := user.SetPassword(newPassword); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.PasswordResetRequired = false
+	user.SessionsRevokedAt = &now
+
+	return db.Model(user).Updates(map[string]interface{}{
+		"encrypted_password":      user.EncryptedPassword,
+		"password_reset_required": false,
+		"sessions_revoked_at":     now,
+	}).Error
+}
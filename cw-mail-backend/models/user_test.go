@@ -1,7 +1,9 @@
 package models
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestUserPassword(t *testing.T) {
@@ -61,3 +63,72 @@ func TestUserRoles(t *testing.T) {
 		t.Error("CanModifyRoles() должен возвращать false для обычного пользователя")
 	}
 }
+
+func TestSessionValidAt(t *testing.T) {
+	user := &User{}
+	if !user.SessionValidAt(time.Now().Add(-time.Hour)) {
+		t.Error("Без отзыва сессий любой токен должен быть действителен")
+	}
+
+	revokedAt := time.Now()
+	user.SessionsRevokedAt = &revokedAt
+
+	if user.SessionValidAt(revokedAt.Add(-time.Minute)) {
+		t.Error("Токен, выпущенный до отзыва сессий, должен быть недействителен")
+	}
+	if !user.SessionValidAt(revokedAt.Truncate(time.Second).Add(time.Second)) {
+		t.Error("Токен, выпущенный после отзыва сессий, должен быть действителен")
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	db := setupTestDB(t)
+
+	CreateUser(db, "alice@example.com", "password123")
+	bob, _ := CreateUser(db, "bob@example.com", "password123")
+	CreateUserWithRole(db, "root@corp.com", "password123", RoleAdmin)
+	SetUserDisabled(db, bob.ID, true)
+
+	users, total, err := SearchUsers(db, UserFilter{Query: "EXAMPLE"})
+	if err != nil || total != 2 || len(users) != 2 {
+		t.Fatalf("Ожидалось 2 пользователя example.com, получено %d (%v)", total, err)
+	}
+
+	_, total, _ = SearchUsers(db, UserFilter{Role: RoleAdmin})
+	if total != 1 {
+		t.Errorf("Ожидался 1 администратор, получено %d", total)
+	}
+
+	users, total, _ = SearchUsers(db, UserFilter{Status: "disabled"})
+	if total != 1 || users[0].ID != bob.ID || users[0].DisabledAt == nil {
+		t.Errorf("Ожидался один отключенный пользователь bob, получено %+v", users)
+	}
+
+	users, total, _ = SearchUsers(db, UserFilter{Page: 2, Limit: 2})
+	if total != 3 || len(users) != 1 {
+		t.Errorf("Вторая страница должна содержать одного пользователя из трех, получено %d из %d", len(users), total)
+	}
+}
+
+func TestEnsureAdminRemains(t *testing.T) {
+	db := setupTestDB(t)
+
+	root, _ := CreateUserWithRole(db, "root@example.com", "password123", RoleAdmin)
+	backup, _ := CreateUserWithRole(db, "backup@example.com", "password123", RoleAdmin)
+	SetUserDisabled(db, backup.ID, true)
+
+	// Отключенного администратора можно понизить или удалить: единственный
+	// действующий администратор остается
+	if err := EnsureAdminRemains(db, backup.ID); err != nil {
+		t.Errorf("Для отключенного администратора ожидался другой действующий, получено %v", err)
+	}
+	// Отключенный администратор не заменяет последнего действующего
+	if err := EnsureAdminRemains(db, root.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Ожидалась ErrLastAdmin, получено %v", err)
+	}
+
+	SetUserDisabled(db, backup.ID, false)
+	if err := EnsureAdminRemains(db, root.ID); err != nil {
+		t.Errorf("Включенный снова администратор должен считаться действующим, получено %v", err)
+	}
+}
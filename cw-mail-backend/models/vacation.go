@@ -0,0 +1,198 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mail-service/sieve"
+	"gorm.io/gorm"
+)
+
+
+const (
+	MaxVacationSubjectLength = 200
+	MaxVacationBodyLength    = 10000
+
+	// vacationHandle отличает автоответы из настроек от автоответов
+	// Sieve-скриптов в таблице auto_replies.
+	vacationHandle = "vacation"
+)
+
+
+var ErrInvalidVacation = errors.New("неверные настройки автоответа")
+
+
+// VacationSettings — автоответ «нет на месте». Пока он включен и текущее
+// время попадает в период StartsAt–EndsAt (границы необязательны), на каждое
+// входящее письмо отправителю уходит ответ, но не чаще раза в IntervalDays
+// дней одному отправителю.
+type VacationSettings struct {
+	ID           uint       `json:"-" gorm:"primaryKey"`
+	UserID       uint       `json:"-" gorm:"uniqueIndex;not null"`
+	Enabled      bool       `json:"enabled" gorm:"not null"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	Subject      string     `json:"subject"`
+	Body         string     `json:"body" gorm:"type:text"`
+	OnlyContacts bool       `json:"only_contacts" gorm:"not null"`
+	IntervalDays int        `json:"interval_days" gorm:"not null"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+
+// VacationFields — редактируемые поля автоответа. Пустой Subject означает
+// «Auto: » и тему исходного письма, нулевой IntervalDays — значение по
+// умолчанию.
+type VacationFields struct {
+	Enabled      bool
+	StartsAt     *time.Time
+	EndsAt       *time.Time
+	Subject      string
+	Body         string
+	OnlyContacts bool
+	IntervalDays int
+}
+
+
+func (f *VacationFields) normalize() error {
+	f.Subject = strings.TrimSpace(f.Subject)
+	f.Body = strings.TrimSpace(f.Body)
+	if f.IntervalDays == 0 {
+		f.IntervalDays = sieve.DefaultVacationDays
+	}
+
+	switch {
+	case f.Enabled && f.Body == "":
+		return fmt.Errorf("%w: не указан текст автоответа", ErrInvalidVacation)
+	case utf8.RuneCountInString(f.Subject) > MaxVacationSubjectLength:
+		return fmt.Errorf("%w: тема длиннее %d символов", ErrInvalidVacation, MaxVacationSubjectLength)
+	case utf8.RuneCountInString(f.Body) > MaxVacationBodyLength:
+		return fmt.Errorf("%w: текст длиннее %d символов", ErrInvalidVacation, MaxVacationBodyLength)
+	case strings.ContainsAny(f.Subject, "\r\n"):
+		return fmt.Errorf("%w: тема не может содержать переводы строк", ErrInvalidVacation)
+	case f.IntervalDays < sieve.MinVacationDays || f.IntervalDays > sieve.MaxVacationDays:
+		return fmt.Errorf("%w: интервал должен быть от %d до %d дней", ErrInvalidVacation, sieve.MinVacationDays, sieve.MaxVacationDays)
+	case f.StartsAt != nil && f.EndsAt != nil && !f.EndsAt.After(*f.StartsAt):
+		return fmt.Errorf("%w: окончание должно быть позже начала", ErrInvalidVacation)
+	}
+	return nil
+}
+
+
+// ActiveAt сообщает, отправляется ли автоответ в момент t.
+func (v *VacationSettings) ActiveAt(t time.Time) bool {
+	return v.Enabled &&
+		(v.StartsAt == nil || !t.Before(*v.StartsAt)) &&
+		(v.EndsAt == nil || t.Before(*v.EndsAt))
+}
+
+
+// GetVacationSettings возвращает настройки автоответа. Если пользователь их
+// еще не сохранял, возвращаются выключенные настройки по умолчанию.
+func GetVacationSettings(db *gorm.DB, userID uint) (*VacationSettings, error) {
+	var settings VacationSettings
+	err := db.Where("user_id = ?", userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &VacationSettings{UserID: userID, IntervalDays: sieve.DefaultVacationDays}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+
+// UpdateVacationSettings сохраняет настройки автоответа. При изменении текста
+// или периода отметки об отправленных ответах сбрасываются, чтобы о новом
+// отсутствии узнали и те, кому уже отвечали.
+func UpdateVacationSettings(db *gorm.DB, userID uint, fields VacationFields) (*VacationSettings, error) {
+	if err := fields.normalize(); err != nil {
+		return nil, err
+	}
+
+	settings, err := GetVacationSettings(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	changed := settings.Subject != fields.Subject || settings.Body != fields.Body ||
+		!sameTime(settings.StartsAt, fields.StartsAt) || !sameTime(settings.EndsAt, fields.EndsAt) ||
+		(fields.Enabled && !settings.Enabled)
+
+	settings.Enabled = fields.Enabled
+	settings.StartsAt = fields.StartsAt
+	settings.EndsAt = fields.EndsAt
+	settings.Subject = fields.Subject
+	settings.Body = fields.Body
+	settings.OnlyContacts = fields.OnlyContacts
+	settings.IntervalDays = fields.IntervalDays
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(settings).Error; err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		return tx.Where("user_id = ? AND handle = ?", userID, vacationHandle).Delete(&AutoReply{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+
+// sendVacationSettingsReply отправляет автоответ из настроек пользователя.
+// Письма из спама, из списков рассылки и автоматические письма остаются без
+// ответа; с OnlyContacts отвечают только сохраненным контактам.
+func sendVacationSettingsReply(db *gorm.DB, original *Message, owner User) (*Message, error) {
+	if !canAutoReply(original, owner) || original.Label == "spam" {
+		return nil, nil
+	}
+
+	settings, err := GetVacationSettings(db, owner.ID)
+	if err != nil || !settings.ActiveAt(time.Now()) {
+		return nil, err
+	}
+
+	if settings.OnlyContacts {
+		contact, err := findContactByEmail(db, owner.ID, normalizeAddress(original.SenderAddress))
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && contact.Auto) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	interval := time.Duration(settings.IntervalDays) * 24 * time.Hour
+	due, err := claimAutoReply(db, owner.ID, original.SenderAddress, vacationHandle, interval)
+	if err != nil || !due {
+		return nil, err
+	}
+
+	// Отвечаем с того адреса, на который пришло письмо, если это псевдоним
+	from, err := ResolveSenderAddress(db, &owner, original.RecipientAddress)
+	if errors.Is(err, ErrSenderAddressNotOwned) {
+		from = owner.Email
+	} else if err != nil {
+		return nil, err
+	}
+	subject := settings.Subject
+	if subject == "" {
+		subject = "Auto: " + original.Subject
+	}
+
+	return sendAutoReply(db, original, owner, from, subject, settings.Body)
+}
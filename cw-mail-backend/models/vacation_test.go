@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVacationSettingsValidation(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "user@example.com", "password123")
+
+	settings, err := GetVacationSettings(db, user.ID)
+	if err != nil || settings.Enabled || settings.IntervalDays != 7 {
+		t.Fatalf("По умолчанию автоответ выключен: %+v, %v", settings, err)
+	}
+
+	start := time.Now()
+	end := start.Add(-time.Hour)
+	tests := map[string]VacationFields{
+		"без текста":          {Enabled: true},
+		"перевод строки":      {Enabled: true, Subject: "a\nb", Body: "Текст"},
+		"неверный интервал":   {Enabled: true, Body: "Текст", IntervalDays: 31},
+		"конец раньше начала": {Enabled: true, Body: "Текст", StartsAt: &start, EndsAt: &end},
+	}
+	for name, fields := range tests {
+		if _, err := UpdateVacationSettings(db, user.ID, fields); !errors.Is(err, ErrInvalidVacation) {
+			t.Errorf("%s: ожидалась ошибка настроек, получено %v", name, err)
+		}
+	}
+
+	if _, err := UpdateVacationSettings(db, user.ID, VacationFields{}); err != nil {
+		t.Errorf("Выключенный автоответ можно сохранить без текста: %v", err)
+	}
+}
+
+func TestVacationAutoReply(t *testing.T) {
+	db := setupTestDB(t)
+	sender, _ := CreateUser(db, "sender@example.com", "password123")
+	receiver, _ := CreateUser(db, "receiver@example.com", "password123")
+	stranger, _ := CreateUser(db, "stranger@example.com", "password123")
+
+	future := time.Now().Add(24 * time.Hour)
+	if _, err := UpdateVacationSettings(db, receiver.ID, VacationFields{Enabled: true, StartsAt: &future, Body: "Я в отпуске"}); err != nil {
+		t.Fatalf("Ошибка сохранения настроек: %v", err)
+	}
+	delivery, _ := DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Вопрос", Body: "Текст"}, SendingPolicy{})
+	if len(delivery.AutoReplies) != 0 {
+		t.Errorf("До начала периода автоответ не отправляется: %+v", delivery.AutoReplies)
+	}
+
+	if _, err := UpdateVacationSettings(db, receiver.ID, VacationFields{Enabled: true, EndsAt: &future, Body: "Я в отпуске", OnlyContacts: true}); err != nil {
+		t.Fatalf("Ошибка сохранения настроек: %v", err)
+	}
+	CreateContact(db, receiver.ID, ContactFields{Email: sender.Email})
+	RecordContactUsage(db, receiver.ID, stranger.Email, "")
+
+	delivery, _ = DeliverMessage(db, stranger, OutgoingMessage{To: receiver.Email, Subject: "Вопрос", Body: "Текст"}, SendingPolicy{})
+	if len(delivery.AutoReplies) != 0 {
+		t.Errorf("С only_contacts автоматически учтенным адресатам не отвечают: %+v", delivery.AutoReplies)
+	}
+
+	delivery, err := DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Вопрос", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.AutoReplies) != 1 {
+		t.Fatalf("Ожидался один автоответ: %+v", delivery.AutoReplies)
+	}
+	reply := delivery.AutoReplies[0]
+	if reply.ReceiverID != sender.ID || reply.Subject != "Auto: Вопрос" || reply.Body != "Я в отпуске" || reply.AutoSubmitted != AutoSubmittedReplied {
+		t.Errorf("Неверный автоответ: %+v", reply)
+	}
+
+	delivery, _ = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Еще вопрос", Body: "Текст"}, SendingPolicy{})
+	if len(delivery.AutoReplies) != 0 {
+		t.Errorf("Одному отправителю отвечают не чаще раза в интервал: %+v", delivery.AutoReplies)
+	}
+
+	// Новый текст автоответа сбрасывает отметки об отправленных ответах
+	UpdateVacationSettings(db, receiver.ID, VacationFields{Enabled: true, Body: "Вернусь в понедельник", OnlyContacts: true})
+	delivery, _ = DeliverMessage(db, sender, OutgoingMessage{To: receiver.Email, Subject: "Вопрос", Body: "Текст"}, SendingPolicy{})
+	if len(delivery.AutoReplies) != 1 || delivery.AutoReplies[0].Body != "Вернусь в понедельник" {
+		t.Errorf("После изменения текста ответ отправляется снова: %+v", delivery.AutoReplies)
+	}
+}
+
+func TestVacationSkipsListMail(t *testing.T) {
+	f := createListFixture(t, ListPostMembers)
+	UpdateVacationSettings(f.db, f.member.ID, VacationFields{Enabled: true, Body: "Я в отпуске"})
+
+	delivery, err := DeliverMessage(f.db, f.owner, OutgoingMessage{To: f.list.Address, Subject: "Планерка", Body: "Текст"}, SendingPolicy{})
+	if err != nil {
+		t.Fatalf("Ошибка доставки: %v", err)
+	}
+	if len(delivery.Messages) != 1 || len(delivery.AutoReplies) != 0 {
+		t.Errorf("На письма из списков рассылки автоответ не отправляется: %+v", delivery.AutoReplies)
+	}
+}
@@ -0,0 +1,433 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+
+const (
+	// Вебхук пользователя получает события его почтового ящика, вебхук
+	// администратора — все события сервиса
+	WebhookScopeUser  = "user"
+	WebhookScopeAdmin = "admin"
+
+	WebhookSecretPrefix = "whsec_"
+
+	// WebhookTestEvent отправляется по запросу владельца для проверки адреса
+	WebhookTestEvent = "webhook.test"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+
+	// WebhookResponseLimit — сколько байт ответа получателя сохраняется в
+	// журнале доставки
+	WebhookResponseLimit = 1024
+)
+
+
+var (
+	ErrWebhookURL           = errors.New("адрес вебхука должен быть абсолютным URL со схемой http или https")
+	ErrWebhookQuotaExceeded = errors.New("достигнуто максимальное количество вебхуков")
+)
+
+
+// Webhook — подписка на события: сервис отправляет их POST-запросом на URL,
+// подписывая тело секретом (HMAC-SHA256). Events — ключи маршрутизации через
+// запятую; пустой список означает все события.
+type Webhook struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"index;not null"`
+	Scope       string    `json:"scope" gorm:"index;not null"`
+	URL         string    `json:"url" gorm:"not null"`
+	Description string    `json:"description"`
+	Events      string    `json:"-" gorm:"not null"`
+	Secret      string    `json:"-" gorm:"not null"`
+	Active      bool      `json:"active" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+
+// WebhookInput — изменяемые поля вебхука. При обновлении nil означает, что
+// поле не меняется.
+type WebhookInput struct {
+	URL         *string
+	Description *string
+	Events      []string
+	Active      *bool
+}
+
+
+func (w *Webhook) EventList() []string {
+	if w.Events == "" {
+		return []string{}
+	}
+	return strings.Split(w.Events, ",")
+}
+
+
+// Subscribes сообщает, подписан ли вебхук на событие.
+func (w *Webhook) Subscribes(routingKey string) bool {
+	if w.Events == "" || routingKey == WebhookTestEvent {
+		return true
+	}
+	for _, event := range w.EventList() {
+		if event == routingKey {
+			return true
+		}
+	}
+	return false
+}
+
+
+// WebhookDelivery — отправка одного события одному вебхуку и журнал ее
+// попыток. EventID — идентификатор события в шине; уникальный индекс по
+// вебхуку и событию не дает нескольким экземплярам сервиса, получившим одно
+// событие, отправить его дважды.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;uniqueIndex:idx_webhook_deliveries_event"`
+	EventID        string     `json:"event_id" gorm:"not null;uniqueIndex:idx_webhook_deliveries_event"`
+	Event          string     `json:"event" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"index;not null"`
+	Attempts       int        `json:"attempts" gorm:"not null"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"response_body,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DurationMs     int64      `json:"duration_ms"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index;not null"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+
+// WebhookAttempt — результат одной попытки доставки. Err == nil означает,
+// что получатель ответил кодом 2xx.
+type WebhookAttempt struct {
+	ResponseStatus int
+	ResponseBody   string
+	Duration       time.Duration
+	Err            error
+}
+
+
+func validateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrWebhookURL
+	}
+	return nil
+}
+
+
+// CreateWebhook создает вебхук с новым секретом. limit ограничивает число
+// вебхуков пользователя; для вебхуков администратора не применяется.
+func CreateWebhook(db *gorm.DB, userID uint, scope string, input WebhookInput, limit int) (*Webhook, error) {
+	if input.URL == nil {
+		return nil, ErrWebhookURL
+	}
+	if err := validateWebhookURL(*input.URL); err != nil {
+		return nil, err
+	}
+
+	if scope == WebhookScopeUser && limit > 0 {
+		var count int64
+		if err := db.Model(&Webhook{}).Where("user_id = ? AND scope = ?", userID, scope).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count >= int64(limit) {
+			return nil, ErrWebhookQuotaExceeded
+		}
+	}
+
+	secret, err := generateToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		UserID: userID,
+		Scope:  scope,
+		URL:    *input.URL,
+		Events: strings.Join(input.Events, ","),
+		Secret: WebhookSecretPrefix + secret,
+		Active: input.Active == nil || *input.Active,
+	}
+	if input.Description != nil {
+		webhook.Description = *input.Description
+	}
+	if err := db.Create(webhook).Error; err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+
+// webhookScope ограничивает выборку вебхуками пользователя или, для scope
+// admin, всеми вебхуками администраторов.
+func webhookScope(db *gorm.DB, scope string, userID uint) *gorm.DB {
+	if scope == WebhookScopeAdmin {
+		return db.Where("scope = ?", WebhookScopeAdmin)
+	}
+	return db.Where("scope = ? AND user_id = ?", WebhookScopeUser, userID)
+}
+
+
+func ListWebhooks(db *gorm.DB, scope string, userID uint) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := webhookScope(db, scope, userID).Order("id ASC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+
+func GetWebhook(db *gorm.DB, scope string, userID, id uint) (*Webhook, error) {
+	var webhook Webhook
+	if err := webhookScope(db, scope, userID).First(&webhook, id).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+
+func UpdateWebhook(db *gorm.DB, webhook *Webhook, input WebhookInput) error {
+	if input.URL != nil {
+		if err := validateWebhookURL(*input.URL); err != nil {
+			return err
+		}
+		webhook.URL = *input.URL
+	}
+	if input.Description != nil {
+		webhook.Description = *input.Description
+	}
+	if input.Events != nil {
+		webhook.Events = strings.Join(input.Events, ",")
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	return db.Model(webhook).Select("url", "description", "events", "active").Updates(webhook).Error
+}
+
+
+// DeleteWebhook удаляет вебхук вместе с журналом доставок.
+func DeleteWebhook(db *gorm.DB, webhook *Webhook) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+}
+
+
+// deleteUserWebhooks удаляет вебхуки пользователя. Вебхуки, созданные им как
+// администратором, принадлежат сервису и остаются.
+func deleteUserWebhooks(db *gorm.DB, userID uint) error {
+	webhooks := db.Model(&Webhook{}).Select("id").Where("user_id = ? AND scope = ?", userID, WebhookScopeUser)
+	if err := db.Where("webhook_id IN (?)", webhooks).Delete(&WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	return db.Where("user_id = ? AND scope = ?", userID, WebhookScopeUser).Delete(&Webhook{}).Error
+}
+
+
+// MatchingWebhooks возвращает включенные вебхуки, подписанные на событие:
+// все вебхуки администраторов и вебхуки пользователей userIDs.
+func MatchingWebhooks(db *gorm.DB, routingKey string, userIDs []uint) ([]Webhook, error) {
+	query := db.Where("active = ?", true)
+	if len(userIDs) > 0 {
+		query = query.Where("(scope = ? OR (scope = ? AND user_id IN ?))", WebhookScopeAdmin, WebhookScopeUser, userIDs)
+	} else {
+		query = query.Where("scope = ?", WebhookScopeAdmin)
+	}
+
+	var candidates []Webhook
+	if err := query.Order("id ASC").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	webhooks := candidates[:0]
+	for _, webhook := range candidates {
+		if webhook.Subscribes(routingKey) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+
+// GetWebhooksByID возвращает вебхуки с указанными ID по ключу ID.
+func GetWebhooksByID(db *gorm.DB, ids []uint) (map[uint]*Webhook, error) {
+	var webhooks []Webhook
+	if err := db.Where("id IN ?", ids).Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*Webhook, len(webhooks))
+	for i := range webhooks {
+		byID[webhooks[i].ID] = &webhooks[i]
+	}
+	return byID, nil
+}
+
+
+// EnqueueWebhookDeliveries ставит событие в очередь доставки каждому
+// вебхуку. Доставки, уже созданные для этого события, не дублируются.
+func EnqueueWebhookDeliveries(db *gorm.DB, webhooks []Webhook, eventID, event, payload string) error {
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	deliveries := make([]WebhookDelivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       payload,
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "webhook_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&deliveries).Error
+}
+
+
+// CreateWebhookDelivery создает одну доставку, например тестового события.
+func CreateWebhookDelivery(db *gorm.DB, webhook *Webhook, eventID, event, payload string) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       eventID,
+		Event:         event,
+		Payload:       payload,
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := db.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+
+// DueWebhookDeliveries возвращает ожидающие доставки, время попытки которых
+// наступило, в порядке создания.
+func DueWebhookDeliveries(db *gorm.DB, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := db.Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+
+// PostponeWebhookDeliveries откладывает доставки до until, чтобы другие
+// экземпляры сервиса не взяли их, пока идет попытка.
+func PostponeWebhookDeliveries(db *gorm.DB, deliveries []WebhookDelivery, until time.Time) error {
+	ids := make([]uint, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	return db.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", until).Error
+}
+
+
+// RecordWebhookAttempt записывает результат попытки. Неудачная доставка
+// повторяется в retryAt, а если retryAt == nil, отмечается как failed.
+func RecordWebhookAttempt(db *gorm.DB, delivery *WebhookDelivery, attempt WebhookAttempt, retryAt *time.Time) error {
+	body := attempt.ResponseBody
+	if len(body) > WebhookResponseLimit {
+		body = body[:WebhookResponseLimit]
+	}
+
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"response_status": attempt.ResponseStatus,
+		"response_body":   body,
+		"duration_ms":     attempt.Duration.Milliseconds(),
+	}
+	switch {
+	case attempt.Err == nil:
+		now := time.Now()
+		updates["status"] = WebhookDeliverySucceeded
+		updates["last_error"] = ""
+		updates["delivered_at"] = now
+		delivery.DeliveredAt = &now
+	case retryAt != nil:
+		updates["status"] = WebhookDeliveryPending
+		updates["last_error"] = attempt.Err.Error()
+		updates["next_attempt_at"] = *retryAt
+		delivery.NextAttemptAt = *retryAt
+	default:
+		updates["status"] = WebhookDeliveryFailed
+		updates["last_error"] = attempt.Err.Error()
+	}
+
+	if err := db.Model(delivery).Updates(updates).Error; err != nil {
+		return err
+	}
+	delivery.Attempts = attempts
+	delivery.ResponseStatus = attempt.ResponseStatus
+	delivery.ResponseBody = body
+	delivery.DurationMs = attempt.Duration.Milliseconds()
+	delivery.Status = updates["status"].(string)
+	delivery.LastError = updates["last_error"].(string)
+	return nil
+}
+
+
+type WebhookDeliveryFilter struct {
+	Status string
+	Page   int
+	Limit  int
+}
+
+
+func ListWebhookDeliveries(db *gorm.DB, webhookID uint, filter WebhookDeliveryFilter) ([]WebhookDelivery, int64, error) {
+	query := db.Model(&WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var deliveries []WebhookDelivery
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+
+// DeleteWebhookDeliveries удаляет завершенные доставки, созданные до before.
+func DeleteWebhookDeliveries(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("status <> ? AND created_at < ?", WebhookDeliveryPending, before).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookQuotaAndScope(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "alice@example.com", "password123")
+	other, _ := CreateUser(db, "bob@example.com", "password123")
+
+	url := "https://hooks.example.com/mail"
+	hook, err := CreateWebhook(db, user.ID, WebhookScopeUser, WebhookInput{URL: &url, Events: []string{"new_message", "message.read"}}, 1)
+	if err != nil {
+		t.Fatalf("Ошибка создания вебхука: %v", err)
+	}
+	if !strings.HasPrefix(hook.Secret, WebhookSecretPrefix) || !hook.Active {
+		t.Errorf("Вебхук создан с секретом %q и active=%v", hook.Secret, hook.Active)
+	}
+
+	if _, err := CreateWebhook(db, user.ID, WebhookScopeUser, WebhookInput{URL: &url}, 1); !errors.Is(err, ErrWebhookQuotaExceeded) {
+		t.Errorf("Ожидалась ошибка квоты, получено %v", err)
+	}
+	if _, err := CreateWebhook(db, user.ID, WebhookScopeAdmin, WebhookInput{URL: &url}, 1); err != nil {
+		t.Errorf("Квота не должна применяться к вебхукам администратора: %v", err)
+	}
+
+	invalid := "ftp://hooks.example.com"
+	if _, err := CreateWebhook(db, other.ID, WebhookScopeUser, WebhookInput{URL: &invalid}, 1); !errors.Is(err, ErrWebhookURL) {
+		t.Errorf("Ожидалась ошибка URL, получено %v", err)
+	}
+
+	if _, err := GetWebhook(db, WebhookScopeUser, other.ID, hook.ID); err == nil {
+		t.Error("Вебхук доступен другому пользователю")
+	}
+	if _, err := GetWebhook(db, WebhookScopeAdmin, other.ID, hook.ID); err == nil {
+		t.Error("Вебхук пользователя доступен как вебхук администратора")
+	}
+	if hooks, _ := ListWebhooks(db, WebhookScopeAdmin, other.ID); len(hooks) != 1 {
+		t.Errorf("Вебхуков администраторов: %d, ожидался 1", len(hooks))
+	}
+}
+
+func TestMatchingWebhooks(t *testing.T) {
+	db := setupTestDB(t)
+	alice, _ := CreateUser(db, "alice@example.com", "password123")
+	bob, _ := CreateUser(db, "bob@example.com", "password123")
+
+	url := "https://hooks.example.com/mail"
+	disabled := false
+	reads, _ := CreateWebhook(db, alice.ID, WebhookScopeUser, WebhookInput{URL: &url, Events: []string{"message.read"}}, 0)
+	all, _ := CreateWebhook(db, bob.ID, WebhookScopeUser, WebhookInput{URL: &url}, 0)
+	admin, _ := CreateWebhook(db, bob.ID, WebhookScopeAdmin, WebhookInput{URL: &url}, 0)
+	CreateWebhook(db, alice.ID, WebhookScopeUser, WebhookInput{URL: &url, Active: &disabled}, 0)
+
+	ids := func(hooks []Webhook) []uint {
+		result := []uint{}
+		for _, hook := range hooks {
+			result = append(result, hook.ID)
+		}
+		return result
+	}
+
+	hooks, err := MatchingWebhooks(db, "message.read", []uint{alice.ID})
+	if err != nil {
+		t.Fatalf("Ошибка выборки вебхуков: %v", err)
+	}
+	if got := ids(hooks); len(got) != 2 || got[0] != reads.ID || got[1] != admin.ID {
+		t.Errorf("message.read для alice: %v, ожидались %d и %d", got, reads.ID, admin.ID)
+	}
+
+	hooks, _ = MatchingWebhooks(db, "new_message", []uint{alice.ID, bob.ID})
+	if got := ids(hooks); len(got) != 2 || got[0] != all.ID || got[1] != admin.ID {
+		t.Errorf("new_message: %v, ожидались %d и %d", got, all.ID, admin.ID)
+	}
+
+	// События без пользователей получают только администраторы
+	hooks, _ = MatchingWebhooks(db, "user.registered", nil)
+	if got := ids(hooks); len(got) != 1 || got[0] != admin.ID {
+		t.Errorf("user.registered: %v, ожидался %d", got, admin.ID)
+	}
+}
+
+func TestWebhookDeliveryLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	user, _ := CreateUser(db, "alice@example.com", "password123")
+	url := "https://hooks.example.com/mail"
+	hook, _ := CreateWebhook(db, user.ID, WebhookScopeUser, WebhookInput{URL: &url}, 0)
+
+	// Повторно полученное событие не создает вторую доставку
+	for i := 0; i < 2; i++ {
+		if err := EnqueueWebhookDeliveries(db, []Webhook{*hook}, "42", "new_message", `{"id":"42"}`); err != nil {
+			t.Fatalf("Ошибка записи доставки: %v", err)
+		}
+	}
+	due, err := DueWebhookDeliveries(db, time.Now().Add(time.Second), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("Доставок к отправке: %d (%v), ожидалась 1", len(due), err)
+	}
+
+	delivery := &due[0]
+	retryAt := time.Now().Add(time.Hour)
+	RecordWebhookAttempt(db, delivery, WebhookAttempt{ResponseStatus: 500, ResponseBody: strings.Repeat("x", 2000), Err: errors.New("endpoint responded with status 500")}, &retryAt)
+	if delivery.Status != WebhookDeliveryPending || delivery.Attempts != 1 || len(delivery.ResponseBody) != WebhookResponseLimit {
+		t.Errorf("После ошибки: статус %s, попыток %d, ответ %d байт", delivery.Status, delivery.Attempts, len(delivery.ResponseBody))
+	}
+	if due, _ := DueWebhookDeliveries(db, time.Now().Add(time.Second), 10); len(due) != 0 {
+		t.Errorf("Отложенная доставка отправляется раньше времени")
+	}
+
+	RecordWebhookAttempt(db, delivery, WebhookAttempt{ResponseStatus: 204}, nil)
+	deliveries, total, _ := ListWebhookDeliveries(db, hook.ID, WebhookDeliveryFilter{Status: WebhookDeliverySucceeded, Page: 1, Limit: 20})
+	if total != 1 || deliveries[0].Attempts != 2 || deliveries[0].DeliveredAt == nil || deliveries[0].LastError != "" {
+		t.Errorf("Журнал доставок: %d записей, %+v", total, deliveries)
+	}
+
+	if deleted, _ := DeleteWebhookDeliveries(db, time.Now().Add(time.Minute)); deleted != 1 {
+		t.Errorf("Удалено %d записей журнала, ожидалась 1", deleted)
+	}
+}
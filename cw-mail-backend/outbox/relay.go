@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+
+// Publisher публикует готовое тело события. messageID — идентификатор события
+// в outbox; по нему потребители отбрасывают повторы, поскольку доставка
+// гарантируется не менее одного раза.
+type Publisher interface {
+	Publish(ctx context.Context, routingKey, messageID string, body []byte) error
+}
+
+
+// Relay публикует события из таблицы outbox_events. Событие отмечается
+// опубликованным только после подтверждения публикации; при ошибке следующая
+// попытка откладывается с экспоненциальной задержкой, а обработка пачки
+// прерывается: брокер, отказавший одному событию, скорее всего откажет и
+// остальным. Порядок публикации не гарантируется: отложенное событие уходит
+// после следующих за ним, а в PostgreSQL экземпляры сервиса публикуют
+// разные пачки одновременно.
+type Relay struct {
+	DB        *gorm.DB
+	Publisher Publisher
+	Config    *config.Config
+}
+
+
+func NewRelay(db *gorm.DB, cfg *config.Config, publisher Publisher) *Relay {
+	return &Relay{
+		DB:        db,
+		Publisher: publisher,
+		Config:    cfg,
+	}
+}
+
+
+// Start запускает публикацию в отдельной горутине и возвращает управление.
+func (r *Relay) Start(ctx context.Context) {
+	go r.run(ctx)
+}
+
+
+func (r *Relay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.Config.Outbox.PollInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Полная пачка означает, что в outbox могут остаться готовые события
+		for {
+			published, err := r.Flush(ctx)
+			if err != nil {
+				log.Printf("Ошибка публикации событий outbox: %v", err)
+			}
+			if err != nil || published < r.Config.Outbox.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= time.Hour {
+			lastCleanup = time.Now()
+			if _, err := models.DeletePublishedOutboxEvents(r.DB, lastCleanup.Add(-r.Config.Outbox.Retention)); err != nil {
+				log.Printf("Ошибка очистки outbox: %v", err)
+			}
+		}
+	}
+}
+
+
+// Flush публикует одну пачку готовых событий и возвращает число
+// опубликованных. В PostgreSQL строки пачки блокируются (SKIP LOCKED), чтобы
+// несколько экземпляров сервиса не публиковали одно событие одновременно.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	published := 0
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if tx.Dialector.Name() == "postgres" {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		events, err := models.PendingOutboxEvents(query, time.Now(), r.Config.Outbox.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range events {
+			event := &events[i]
+			err := r.Publisher.Publish(ctx, event.RoutingKey, strconv.FormatUint(uint64(event.ID), 10), []byte(event.Payload))
+			if err != nil {
+				log.Printf("Ошибка публикации события outbox %d (попытка %d): %v", event.ID, event.Attempts+1, err)
+				return models.MarkOutboxEventFailed(tx, event, err, time.Now().Add(r.backoff(event.Attempts)))
+			}
+			if err := models.MarkOutboxEventPublished(tx, event, time.Now()); err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
+
+
+// backoff возвращает задержку перед попыткой attempts+1: BaseBackoff,
+// удваиваемый после каждой ошибки, но не больше MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.Config.Outbox.BaseBackoff
+	for i := 0; i < attempts && delay < r.Config.Outbox.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.Config.Outbox.MaxBackoff)
+}
@@ -0,0 +1,128 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type published struct {
+	routingKey string
+	messageID  string
+	body       string
+}
+
+// fakePublisher запоминает опубликованные события; пока fail != nil,
+// публикация завершается ошибкой.
+type fakePublisher struct {
+	events []published
+	fail   error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	if p.fail != nil {
+		return p.fail
+	}
+	p.events = append(p.events, published{routingKey, messageID, string(body)})
+	return nil
+}
+
+func newTestRelay(t *testing.T) (*Relay, *fakePublisher) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.OutboxEvent{}); err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Outbox.BatchSize = 10
+	cfg.Outbox.BaseBackoff = time.Second
+	cfg.Outbox.MaxBackoff = 4 * time.Second
+
+	publisher := &fakePublisher{}
+	return NewRelay(db, cfg, publisher), publisher
+}
+
+func TestRelayPublishesCommittedEvents(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+
+	models.EnqueueOutboxEvent(relay.DB, "new_message", map[string]int{"message_id": 1})
+	relay.DB.Transaction(func(tx *gorm.DB) error {
+		models.EnqueueOutboxEvent(tx, "new_message", map[string]int{"message_id": 2})
+		return errors.New("откат")
+	})
+	models.EnqueueOutboxEvent(relay.DB, "scan.reject", map[string]string{"verdict": "reject"})
+
+	count, err := relay.Flush(context.Background())
+	if err != nil || count != 2 {
+		t.Fatalf("Flush() = %d, %v; ожидалось 2 события", count, err)
+	}
+	if len(publisher.events) != 2 || publisher.events[0].body != `{"message_id":1}` || publisher.events[1].routingKey != "scan.reject" {
+		t.Errorf("События отмененной транзакции не публикуются, порядок сохраняется: %+v", publisher.events)
+	}
+	if publisher.events[0].messageID == publisher.events[1].messageID {
+		t.Errorf("У событий должны быть разные идентификаторы: %+v", publisher.events)
+	}
+
+	if count, _ := relay.Flush(context.Background()); count != 0 {
+		t.Errorf("Опубликованные события не публикуются повторно, получено %d", count)
+	}
+}
+
+func TestRelayRetriesWithBackoff(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+	models.EnqueueOutboxEvent(relay.DB, "new_message", map[string]int{"message_id": 1})
+	models.EnqueueOutboxEvent(relay.DB, "new_message", map[string]int{"message_id": 2})
+
+	publisher.fail = errors.New("брокер недоступен")
+	for attempt := 1; attempt <= 4; attempt++ {
+		// Сдвигаем время следующей попытки, чтобы не ждать задержку
+		relay.DB.Model(&models.OutboxEvent{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+		if count, err := relay.Flush(context.Background()); err != nil || count != 0 {
+			t.Fatalf("Flush() = %d, %v при недоступном брокере", count, err)
+		}
+	}
+
+	var events []models.OutboxEvent
+	relay.DB.Order("id").Find(&events)
+	if events[0].Attempts != 4 || events[0].LastError == "" || events[0].PublishedAt != nil {
+		t.Errorf("Ошибка публикации должна учитываться: %+v", events[0])
+	}
+	if events[1].Attempts != 0 {
+		t.Errorf("После ошибки обработка пачки прерывается: %+v", events[1])
+	}
+	if delay := time.Until(events[0].NextAttemptAt); delay < 3*time.Second || delay > 4*time.Second {
+		t.Errorf("Задержка должна расти до MaxBackoff, получено %v", delay)
+	}
+
+	if count, _ := relay.Flush(context.Background()); count != 0 {
+		t.Errorf("Событие не публикуется до наступления времени повторной попытки")
+	}
+
+	publisher.fail = nil
+	relay.DB.Model(&models.OutboxEvent{}).Where("1 = 1").Update("next_attempt_at", time.Now())
+	if count, err := relay.Flush(context.Background()); err != nil || count != 2 {
+		t.Errorf("После восстановления брокера публикуются все события, получено %d, %v", count, err)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay, _ := newTestRelay(t)
+	for attempts, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if got := relay.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, ожидалось %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mail-service/eml"
+	"github.com/mail-service/models"
+	"github.com/mail-service/vcard"
+)
+
+
+// ProfileExport — содержимое profile.json в архиве выгрузки.
+type ProfileExport struct {
+	ID            uint       `json:"id"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	DisplayName   string     `json:"display_name"`
+	Timezone      string     `json:"timezone"`
+	Locale        string     `json:"locale"`
+	Signature     string     `json:"signature"`
+	EmailVerified bool       `json:"email_verified"`
+	MFAEnabled    bool       `json:"mfa_enabled"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Avatar        string     `json:"avatar,omitempty"`
+	ExportedAt    time.Time  `json:"exported_at"`
+	DeletionAt    *time.Time `json:"deletion_scheduled_at,omitempty"`
+	Aliases       []string   `json:"aliases,omitempty"`
+	BlockAction   string     `json:"block_action"`
+	Blocked       []string   `json:"blocked_senders,omitempty"`
+}
+
+
+func (s *Service) processExport(ctx context.Context, id uint) {
+	var export models.DataExport
+	if err := s.DB.WithContext(ctx).First(&export, id).Error; err != nil {
+		return
+	}
+	if export.Status != models.ExportStatusPending && export.Status != models.ExportStatusProcessing {
+		return
+	}
+
+	if err := models.MarkDataExportProcessing(s.DB, &export); err != nil {
+		log.Printf("Ошибка обновления выгрузки %d: %v", id, err)
+		return
+	}
+
+	name, size, err := s.buildArchive(ctx, &export)
+	if err != nil {
+		log.Printf("Ошибка сборки выгрузки %d: %v", id, err)
+		if err := models.FailDataExport(s.DB, &export, "не удалось собрать архив"); err != nil {
+			log.Printf("Ошибка обновления выгрузки %d: %v", id, err)
+		}
+		return
+	}
+
+	if err := models.CompleteDataExport(s.DB, &export, name, size, s.Config.Privacy.ExportTTL); err != nil {
+		log.Printf("Ошибка обновления выгрузки %d: %v", id, err)
+		s.removeFile(s.Config.Privacy.ExportDir, name)
+	}
+}
+
+
+// buildArchive собирает zip-архив: profile.json, адресную книгу в формате
+// vCard, письма в формате EML, разложенные по папкам, и файл аватара.
+// Возвращает путь относительно каталога выгрузок.
+func (s *Service) buildArchive(ctx context.Context, export *models.DataExport) (string, int64, error) {
+	var user models.User
+	if err := s.DB.WithContext(ctx).First(&user, export.UserID).Error; err != nil {
+		return "", 0, err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", 0, err
+	}
+	name := filepath.Join(fmt.Sprint(user.ID), fmt.Sprintf("export-%d-%s.zip", export.ID, hex.EncodeToString(suffix)))
+	path := filepath.Join(s.Config.Privacy.ExportDir, name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = s.writeArchive(ctx, file, &user)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return name, info.Size(), nil
+}
+
+
+func (s *Service) writeArchive(ctx context.Context, w io.Writer, user *models.User) error {
+	archive := zip.NewWriter(w)
+
+	profile := ProfileExport{
+		ID:            user.ID,
+		Email:         user.Email,
+		Role:          user.Role,
+		DisplayName:   user.DisplayName,
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		Signature:     user.Signature,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled,
+		CreatedAt:     user.CreatedAt,
+		ExportedAt:    time.Now().UTC(),
+		DeletionAt:    user.DeletionScheduledAt,
+		BlockAction:   user.BlockAction,
+	}
+
+	aliases, err := models.ListAliases(s.DB.WithContext(ctx), user.ID)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		profile.Aliases = append(profile.Aliases, alias.Address)
+	}
+
+	blocked, err := models.ListBlockedSenders(s.DB.WithContext(ctx), user.ID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range blocked {
+		profile.Blocked = append(profile.Blocked, entry.Pattern)
+	}
+
+	if user.AvatarPath != "" {
+		name := "avatar/" + filepath.Base(user.AvatarPath)
+		copied, err := copyIntoArchive(archive, name, filepath.Join(s.Config.Uploads.Dir, user.AvatarPath))
+		if err != nil {
+			return err
+		}
+		if copied {
+			profile.Avatar = name
+		}
+	}
+
+	entry, err := archive.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(profile); err != nil {
+		return err
+	}
+
+	contacts, err := models.ListContacts(s.DB.WithContext(ctx), user.ID, models.ContactFilter{})
+	if err != nil {
+		return err
+	}
+	if len(contacts) > 0 {
+		entry, err := archive.Create("contacts.vcf")
+		if err != nil {
+			return err
+		}
+		if err := vcard.Encode(entry, models.ContactCards(contacts), vcard.Version3); err != nil {
+			return err
+		}
+	}
+
+	rules, err := models.ListFilterRules(s.DB.WithContext(ctx), user.ID)
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		entry, err := archive.Create("filters.json")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rules); err != nil {
+			return err
+		}
+	}
+
+	vacation, err := models.GetVacationSettings(s.DB.WithContext(ctx), user.ID)
+	if err != nil {
+		return err
+	}
+	if vacation.ID != 0 {
+		entry, err := archive.Create("vacation.json")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(vacation); err != nil {
+			return err
+		}
+	}
+
+	scripts, err := models.ListSieveScripts(s.DB.WithContext(ctx), user.ID)
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		name := strings.NewReplacer("/", "_", "\\", "_").Replace(script.Name)
+		entry, err := archive.Create(fmt.Sprintf("sieve/%s.sieve", name))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, script.Content); err != nil {
+			return err
+		}
+	}
+
+	err = models.EachUserMessage(s.DB.WithContext(ctx), user.ID, func(message *models.Message) error {
+		for _, folder := range messageFolders(message, user.ID) {
+			entry, err := archive.Create(fmt.Sprintf("messages/%s/%d.eml", folder, message.ID))
+			if err != nil {
+				return err
+			}
+			if err := messageToEML(message).Write(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+
+// messageFolders определяет, в каких папках архива лежит письмо. Письмо
+// самому себе попадает и во входящие, и в отправленные.
+func messageFolders(message *models.Message, userID uint) []string {
+	var folders []string
+	if message.ReceiverID == userID {
+		folders = append(folders, message.Label)
+	}
+	if message.SenderID == userID {
+		folders = append(folders, "sent")
+	}
+	return folders
+}
+
+
+func messageToEML(message *models.Message) *eml.Message {
+	return &eml.Message{
+		From:      mail.Address{Name: message.Sender.DisplayName, Address: message.Sender.Email},
+		To:        mail.Address{Name: message.Receiver.DisplayName, Address: message.Receiver.Email},
+		Subject:   message.Subject,
+		Date:      message.CreatedAt,
+		MessageID: fmt.Sprintf("message-%d@cw-mail", message.ID),
+		Body:      message.Body,
+	}
+}
+
+
+func copyIntoArchive(archive *zip.Writer, name, path string) (bool, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer src.Close()
+
+	dst, err := archive.Create(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,165 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mail-service/audit"
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"gorm.io/gorm"
+)
+
+
+// Service выполняет фоновые задачи, связанные с персональными данными:
+// сборку архивов выгрузки, удаление просроченных архивов и анонимизацию
+// учетных записей, у которых истек период ожидания удаления.
+type Service struct {
+	DB     *gorm.DB
+	Config *config.Config
+	Audit  *audit.Logger
+
+	jobs chan uint
+}
+
+
+func NewService(db *gorm.DB, cfg *config.Config, auditLog *audit.Logger) *Service {
+	return &Service{
+		DB:     db,
+		Config: cfg,
+		Audit:  auditLog,
+		jobs:   make(chan uint, 64),
+	}
+}
+
+
+// Start запускает обработчик в отдельной горутине и возвращает управление.
+// Незавершенные выгрузки подхватываются при старте и при каждой очистке.
+func (s *Service) Start(ctx context.Context) {
+	go s.run(ctx)
+}
+
+
+func (s *Service) run(ctx context.Context) {
+	ticker := time.NewTicker(s.Config.Privacy.SweepInterval)
+	defer ticker.Stop()
+
+	s.Sweep(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.jobs:
+			s.processExport(ctx, id)
+		case <-ticker.C:
+			s.Sweep(ctx)
+		}
+	}
+}
+
+
+// RequestExport создает запрос на выгрузку и ставит его в очередь.
+func (s *Service) RequestExport(userID uint) (*models.DataExport, error) {
+	export, err := models.CreateDataExport(s.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.enqueue(export.ID)
+	return export, nil
+}
+
+
+// ExportPath возвращает путь к готовому архиву на диске.
+func (s *Service) ExportPath(export *models.DataExport) string {
+	return filepath.Join(s.Config.Privacy.ExportDir, export.FilePath)
+}
+
+
+func (s *Service) enqueue(id uint) {
+	select {
+	case s.jobs <- id:
+	default:
+		// Очередь переполнена: выгрузка останется в статусе pending и будет
+		// подхвачена при следующей очистке
+	}
+}
+
+
+// Sweep удаляет просроченные архивы, анонимизирует учетные записи с истекшим
+// периодом ожидания и повторно ставит в очередь незавершенные выгрузки.
+func (s *Service) Sweep(ctx context.Context) {
+	now := time.Now()
+
+	expired, err := models.ExpiredDataExports(s.DB, now)
+	if err != nil {
+		log.Printf("Ошибка поиска просроченных выгрузок: %v", err)
+	}
+	for i := range expired {
+		s.removeFile(s.Config.Privacy.ExportDir, expired[i].FilePath)
+		if err := models.DeleteDataExport(s.DB, expired[i].ID); err != nil {
+			log.Printf("Ошибка удаления выгрузки %d: %v", expired[i].ID, err)
+		}
+	}
+
+	due, err := models.DueAccountDeletions(s.DB, now)
+	if err != nil {
+		log.Printf("Ошибка поиска учетных записей к удалению: %v", err)
+	}
+	for i := range due {
+		if err := s.DeleteAccount(ctx, due[i].ID); err != nil {
+			log.Printf("Ошибка удаления учетной записи %d: %v", due[i].ID, err)
+			continue
+		}
+		s.Audit.Record(ctx, audit.Event{
+			Action:     audit.ActionAccountDeleted,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.ID(due[i].ID),
+			Details:    map[string]interface{}{"scheduled_at": due[i].DeletionScheduledAt},
+		})
+	}
+
+	pending, err := models.PendingDataExports(s.DB)
+	if err != nil {
+		log.Printf("Ошибка поиска незавершенных выгрузок: %v", err)
+	}
+	for i := range pending {
+		s.enqueue(pending[i].ID)
+	}
+}
+
+
+// DeleteAccount анонимизирует учетную запись и удаляет связанные с ней
+// файлы. Используется и после периода ожидания, и администратором.
+func (s *Service) DeleteAccount(ctx context.Context, userID uint) error {
+	exports, err := models.ListDataExports(s.DB.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+
+	previous, err := models.AnonymizeUser(s.DB.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+
+	s.removeFile(s.Config.Uploads.Dir, previous.AvatarPath)
+	for i := range exports {
+		s.removeFile(s.Config.Privacy.ExportDir, exports[i].FilePath)
+	}
+	return nil
+}
+
+
+func (s *Service) removeFile(dir, name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Ошибка удаления файла %s: %v", name, err)
+	}
+}
@@ -0,0 +1,167 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.User{}, &models.Message{}, &models.EmailVerification{},
+		&models.MFARecoveryCode{}, &models.APIToken{}, &models.AuditLog{}, &models.DataExport{},
+		&models.Contact{}, &models.ContactGroup{}, &models.DistributionList{}, &models.DistributionListMember{}, &models.EmailAlias{}, &models.BlockedSender{}, &models.FilterRule{},
+		&models.SieveScript{}, &models.AutoReply{}, &models.VacationSettings{}, &models.SpamSettings{}, &models.SpamToken{}, &models.QuarantinedMessage{}, &models.OutboxEvent{}, &models.DeadLetter{}, &models.Webhook{}, &models.WebhookDelivery{})
+	if err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Uploads.Dir = t.TempDir()
+	cfg.Privacy.ExportDir = t.TempDir()
+	cfg.Privacy.ExportTTL = time.Hour
+	cfg.Privacy.SweepInterval = time.Hour
+
+	return NewService(db, cfg, nil)
+}
+
+func readArchive(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Архив не открывается: %v", err)
+	}
+	defer archive.Close()
+
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestDataExportArchive(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	alice, _ := models.CreateUser(s.DB, "alice@example.com", "password123")
+	bob, _ := models.CreateUser(s.DB, "bob@example.com", "password123")
+	toBob, _ := models.SendMessage(s.DB, alice.ID, bob.Email, "Привет", "Текст", 0)
+	toAlice, _ := models.SendMessage(s.DB, bob.ID, alice.Email, "Ответ", "Текст ответа", 0)
+
+	os.MkdirAll(filepath.Join(s.Config.Uploads.Dir, "avatars"), 0o755)
+	os.WriteFile(filepath.Join(s.Config.Uploads.Dir, "avatars", "alice.png"), []byte("png"), 0o644)
+	models.SetUserAvatar(s.DB, alice, "avatars/alice.png")
+	models.CreateContact(s.DB, alice.ID, models.ContactFields{Email: "carol@example.com", Name: "Кэрол"})
+
+	export, err := s.RequestExport(alice.ID)
+	if err != nil {
+		t.Fatalf("Ошибка запроса выгрузки: %v", err)
+	}
+	if _, err := s.RequestExport(alice.ID); err != models.ErrExportInProgress {
+		t.Errorf("Вторая выгрузка не должна запускаться, пока идет первая, получено %v", err)
+	}
+
+	s.processExport(ctx, export.ID)
+
+	export, _ = models.GetDataExport(s.DB, export.ID, alice.ID)
+	if !export.IsReady() || export.ExpiresAt == nil {
+		t.Fatalf("Выгрузка должна быть готова: %+v", export)
+	}
+
+	files := readArchive(t, s.ExportPath(export))
+
+	var profile ProfileExport
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil {
+		t.Fatalf("profile.json не разбирается: %v", err)
+	}
+	if profile.Email != alice.Email || profile.Avatar != "avatar/alice.png" {
+		t.Errorf("Неверный профиль: %+v", profile)
+	}
+	if files["avatar/alice.png"] != "png" {
+		t.Error("Аватар должен попасть в архив")
+	}
+
+	if !strings.Contains(files["contacts.vcf"], "EMAIL;TYPE=INTERNET:carol@example.com") {
+		t.Errorf("Адресная книга не найдена в архиве: %q", files["contacts.vcf"])
+	}
+
+	sent := files["messages/sent/"+itoa(toBob.ID)+".eml"]
+	if !strings.Contains(sent, "To: <bob@example.com>") {
+		t.Errorf("Отправленное письмо не найдено в архиве: %q", sent)
+	}
+	if _, ok := files["messages/inbox/"+itoa(toAlice.ID)+".eml"]; !ok {
+		t.Errorf("Входящее письмо не найдено в архиве, файлы: %v", keys(files))
+	}
+
+	// Просроченный архив удаляется вместе с файлом
+	path := s.ExportPath(export)
+	s.DB.Model(export).Update("expires_at", time.Now().Add(-time.Minute))
+	s.Sweep(ctx)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Файл просроченной выгрузки должен быть удален")
+	}
+	if _, err := models.GetDataExport(s.DB, export.ID, alice.ID); err == nil {
+		t.Error("Запись о просроченной выгрузке должна быть удалена")
+	}
+}
+
+func TestSweepDeletesDueAccounts(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, _ := models.CreateUser(s.DB, "leaving@example.com", "password123")
+	avatar := filepath.Join(s.Config.Uploads.Dir, "avatars", "leaving.png")
+	os.MkdirAll(filepath.Dir(avatar), 0o755)
+	os.WriteFile(avatar, []byte("png"), 0o644)
+	models.SetUserAvatar(s.DB, user, "avatars/leaving.png")
+
+	models.ScheduleAccountDeletion(s.DB, user, -time.Minute)
+	s.Sweep(ctx)
+
+	var stored models.User
+	s.DB.First(&stored, user.ID)
+	if !stored.IsAnonymized() {
+		t.Fatal("Учетная запись с истекшим периодом ожидания должна быть удалена")
+	}
+	if _, err := os.Stat(avatar); !os.IsNotExist(err) {
+		t.Error("Аватар удаленного пользователя должен быть удален с диска")
+	}
+}
+
+func itoa(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func keys(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+
+var (
+	ErrNotConnected  = errors.New("not connected to RabbitMQ")
+	ErrPublishNacked = errors.New("publish was not confirmed by the broker")
+	ErrQueueClosed   = errors.New("notification queue is closed")
+)
+
+
+// Dialer открывает соединение с брокером. В тестах заменяется заглушкой
+// брокера.
+type Dialer func(uri string) (Connection, error)
+
+
+// Connection — соединение AMQP в объеме, который нужен NotificationQueue.
+type Connection interface {
+	Channel() (Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+
+// Channel — канал AMQP. Publish ждет подтверждения брокера, если канал
+// переведен в режим подтверждений (Confirm).
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueUnbind(name, key, exchange string, args amqp.Table) error
+	Confirm(noWait bool) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+
+// DialAMQP подключается к RabbitMQ.
+func DialAMQP(uri string) (Connection, error) {
+	conn, err := amqp.Dial(uri)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConnection{conn}, nil
+}
+
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+
+func (c amqpConnection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return amqpChannel{ch}, nil
+}
+
+
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+
+func (c amqpChannel) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	confirmation, err := c.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	// Канал не в режиме подтверждений
+	if confirmation == nil {
+		return nil
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrPublishNacked
+	}
+	return nil
+}
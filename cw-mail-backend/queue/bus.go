@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mail-service/config"
+	"github.com/redis/go-redis/v9"
+)
+
+
+// Handler получает уведомление: ключ маршрутизации, идентификатор события и
+// тело в формате JSON.
+type Handler func(routingKey, messageID string, body []byte)
+
+
+// EventPublisher — шина событий, через которую outbox публикует уведомления,
+// а хаб получает их для клиентов. Реализации: NotificationQueue (RabbitMQ),
+// RedisStreams и MemoryBus.
+type EventPublisher interface {
+	// Publish публикует уведомление. Ошибка означает, что уведомление не
+	// принято брокером и публикацию нужно повторить.
+	Publish(ctx context.Context, routingKey, messageID string, body []byte) error
+	// Subscribe передает handler уведомления с указанными ключами, пока не
+	// отменен ctx. Каждая подписка получает все такие уведомления.
+	Subscribe(ctx context.Context, routingKeys []string, handler Handler) error
+	// Ready сообщает, доступен ли брокер.
+	Ready() bool
+	Close() error
+}
+
+
+var (
+	_ EventPublisher = (*NotificationQueue)(nil)
+	_ EventPublisher = (*RedisStreams)(nil)
+	_ EventPublisher = (*MemoryBus)(nil)
+)
+
+
+// New создает шину событий по EVENT_BUS_DRIVER. Для драйвера redis нужен
+// клиент Redis.
+func New(cfg *config.Config, redisClient *redis.Client) (EventPublisher, error) {
+	switch cfg.Events.Driver {
+	case "", "rabbitmq":
+		return NewNotificationQueue(cfg), nil
+	case "redis":
+		if redisClient == nil {
+			return nil, fmt.Errorf("redis event bus requires a Redis client")
+		}
+		return NewRedisStreams(redisClient, int64(cfg.Events.StreamMaxLen)), nil
+	case "memory":
+		return NewMemoryBus(), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus driver: %s", cfg.Events.Driver)
+	}
+}
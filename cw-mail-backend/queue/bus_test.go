@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mail-service/config"
+)
+
+func TestNewEventBus(t *testing.T) {
+	cfg := &config.Config{}
+
+	cfg.Events.Driver = "memory"
+	bus, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("Ошибка создания шины memory: %v", err)
+	}
+	if _, ok := bus.(*MemoryBus); !ok {
+		t.Errorf("Драйвер memory создал %T", bus)
+	}
+
+	cfg.Events.Driver = "redis"
+	if _, err := New(cfg, nil); err == nil {
+		t.Error("Шина redis создана без клиента Redis")
+	}
+
+	cfg.Events.Driver = "kafka"
+	if _, err := New(cfg, nil); err == nil {
+		t.Error("Неизвестный драйвер не отклонен")
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+	if !bus.Ready() {
+		t.Fatal("Шина в памяти не готова")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var messages, scans []string
+	bus.Subscribe(ctx, []string{RoutingKey}, func(routingKey, messageID string, body []byte) {
+		messages = append(messages, messageID+":"+string(body))
+	})
+	bus.Subscribe(context.Background(), []string{RoutingKey, "scan.reject"}, func(routingKey, messageID string, body []byte) {
+		scans = append(scans, routingKey)
+	})
+
+	bus.Publish(context.Background(), RoutingKey, "1", []byte(`{}`))
+	bus.Publish(context.Background(), "scan.reject", "2", []byte(`{}`))
+	bus.Publish(context.Background(), "scan.clean", "3", []byte(`{}`))
+	if len(messages) != 1 || messages[0] != "1:{}" {
+		t.Errorf("Первый подписчик получил %v", messages)
+	}
+	if len(scans) != 2 || scans[1] != "scan.reject" {
+		t.Errorf("Второй подписчик получил %v", scans)
+	}
+
+	cancel()
+	waitFor(t, "отмена подписки", func() bool {
+		bus.mu.RLock()
+		defer bus.mu.RUnlock()
+		return len(bus.subscriptions) == 1
+	})
+	bus.Publish(context.Background(), RoutingKey, "4", []byte(`{}`))
+	if len(messages) != 1 {
+		t.Errorf("Отмененная подписка получила %v", messages)
+	}
+}
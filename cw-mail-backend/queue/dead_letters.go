@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+
+const (
+	// DeadLetterExchange получает сообщения, которые потребитель не смог
+	// обработать после всех повторов или отклонил. Ключ маршрутизации —
+	// имя исходной очереди, очередь недоставленных — <очередь>.dead.
+	DeadLetterExchange = ExchangeName + ".dlx"
+	DeadLetterSuffix   = ".dead"
+
+	// ConsumerPrefetch — сколько неподтвержденных сообщений получает
+	// потребитель постоянной очереди
+	ConsumerPrefetch = 10
+
+	// Заголовки, которые сервис добавляет при повторе
+	HeaderRetryCount         = "x-retry-count"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	HeaderLastError          = "x-last-error"
+
+	// DeadLetterReasonFailed — потребитель вернул ошибку на каждой попытке.
+	// Остальные причины задает брокер: rejected, expired, maxlen.
+	DeadLetterReasonFailed = "failed"
+)
+
+
+// ConsumerQueues — постоянные очереди, для которых объявлены очереди
+// повторов и очередь недоставленных.
+var ConsumerQueues = []string{QueueName, ScanQueueName, DomainQueueName, WebhookQueueName}
+
+
+// ConsumerHandler обрабатывает уведомление из постоянной очереди. Ошибка
+// означает, что обработку нужно повторить позже.
+type ConsumerHandler func(routingKey, messageID string, body []byte) error
+
+
+// DeadLetter — сообщение из очереди недоставленных.
+type DeadLetter struct {
+	Queue      string
+	RoutingKey string
+	MessageID  string
+	Body       []byte
+	Reason     string
+	Attempts   int
+	LastError  string
+}
+
+
+// DeadLetterQueue — брокер, который хранит недоставленные сообщения и
+// позволяет отправить их в исходную очередь повторно.
+type DeadLetterQueue interface {
+	CollectDeadLetters(ctx context.Context, sink func(letter DeadLetter) error) error
+	Replay(ctx context.Context, letter DeadLetter) error
+}
+
+
+// DurableConsumer — брокер, из постоянных очередей которого можно получать
+// сообщения с подтверждением обработки и повторами (Consume).
+type DurableConsumer interface {
+	Consume(ctx context.Context, queue string, handler ConsumerHandler) error
+}
+
+
+var (
+	_ DeadLetterQueue = (*NotificationQueue)(nil)
+	_ DurableConsumer = (*NotificationQueue)(nil)
+)
+
+
+// RetryDelays возвращает задержки повторов: base, 2*base, 4*base и так далее,
+// всего attempts.
+func RetryDelays(base time.Duration, attempts int) []time.Duration {
+	delays := make([]time.Duration, 0, attempts)
+	for i := 0; i < attempts && base > 0; i++ {
+		delays = append(delays, base<<i)
+	}
+	return delays
+}
+
+
+// RetryQueueName — очередь, в которой сообщение из queue ждет повтора delay.
+// Задержка входит в имя, поэтому изменение RABBITMQ_RETRY_* объявляет новые
+// очереди, а не конфликтует с аргументами существующих.
+func RetryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, delay.Milliseconds())
+}
+
+
+func deadLetterArgs(queue string) amqp.Table {
+	return amqp.Table{
+		"x-dead-letter-exchange":    DeadLetterExchange,
+		"x-dead-letter-routing-key": queue,
+	}
+}
+
+
+// declareRetryTopology объявляет exchange недоставленных, очереди <очередь>.dead
+// и очереди повторов. Сообщение в очереди повтора ждет истечения TTL и
+// возвращается брокером в исходную очередь через exchange по умолчанию.
+func declareRetryTopology(ch Channel, delays []time.Duration) error {
+	if err := ch.ExchangeDeclare(DeadLetterExchange, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare an exchange: %w", err)
+	}
+
+	for _, queue := range ConsumerQueues {
+		if _, err := ch.QueueDeclare(queue+DeadLetterSuffix, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("failed to declare a queue: %w", err)
+		}
+		if err := ch.QueueBind(queue+DeadLetterSuffix, queue, DeadLetterExchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue: %w", err)
+		}
+
+		for _, delay := range delays {
+			_, err := ch.QueueDeclare(RetryQueueName(queue, delay), true, false, false, false, amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to declare a queue: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+
+// Consume обрабатывает сообщения постоянной очереди queue. Если handler
+// вернул ошибку, сообщение отправляется в очередь повтора со следующей
+// задержкой, а после последней попытки — в очередь недоставленных. Как и
+// Subscribe, получение возобновляется после переподключения и прекращается
+// с отменой ctx.
+func (nq *NotificationQueue) Consume(ctx context.Context, queue string, handler ConsumerHandler) error {
+	return nq.register(&subscription{
+		ctx:   ctx,
+		queue: queue,
+		deliver: func(delivery amqp.Delivery) {
+			routingKey := originalRoutingKey(delivery)
+			err := handler(routingKey, delivery.MessageId, delivery.Body)
+			if err == nil {
+				delivery.Ack(false)
+				return
+			}
+
+			attempt := headerInt(delivery.Headers, HeaderRetryCount)
+			exchange, key := DeadLetterExchange, queue
+			if attempt < len(nq.retryDelays) {
+				exchange, key = "", RetryQueueName(queue, nq.retryDelays[attempt])
+			}
+
+			err = nq.publish(ctx, exchange, key, amqp.Publishing{
+				ContentType:  delivery.ContentType,
+				DeliveryMode: amqp.Persistent,
+				MessageId:    delivery.MessageId,
+				Body:         delivery.Body,
+				Headers: amqp.Table{
+					HeaderRetryCount:         int32(attempt + 1),
+					HeaderOriginalRoutingKey: routingKey,
+					HeaderLastError:          err.Error(),
+				},
+			})
+			if err != nil {
+				// Сообщение вернется в очередь и будет обработано заново
+				log.Printf("Не удалось отложить сообщение из %s: %v", queue, err)
+				delivery.Nack(false, true)
+				return
+			}
+			delivery.Ack(false)
+		},
+	})
+}
+
+
+// CollectDeadLetters передает sink сообщения из очередей недоставленных всех
+// ConsumerQueues. Сообщение удаляется из очереди после успешного вызова sink.
+func (nq *NotificationQueue) CollectDeadLetters(ctx context.Context, sink func(letter DeadLetter) error) error {
+	for _, queue := range ConsumerQueues {
+		queue := queue
+		err := nq.register(&subscription{
+			ctx:   ctx,
+			queue: queue + DeadLetterSuffix,
+			deliver: func(delivery amqp.Delivery) {
+				if err := sink(deadLetterFrom(queue, delivery)); err != nil {
+					log.Printf("Не удалось сохранить недоставленное сообщение из %s: %v", queue, err)
+					time.Sleep(time.Second)
+					delivery.Nack(false, true)
+					return
+				}
+				delivery.Ack(false)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+// Replay отправляет недоставленное сообщение в исходную очередь как новое:
+// счетчик повторов сбрасывается, исходный ключ маршрутизации сохраняется в
+// заголовке.
+func (nq *NotificationQueue) Replay(ctx context.Context, letter DeadLetter) error {
+	err := nq.publish(ctx, "", letter.Queue, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    letter.MessageID,
+		Body:         letter.Body,
+		Headers:      amqp.Table{HeaderOriginalRoutingKey: letter.RoutingKey},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay message: %w", err)
+	}
+	return nil
+}
+
+
+// originalRoutingKey возвращает ключ, с которым сообщение опубликовано в
+// exchange: после повтора или Replay сообщение приходит с ключом, равным
+// имени очереди.
+func originalRoutingKey(delivery amqp.Delivery) string {
+	if key, ok := delivery.Headers[HeaderOriginalRoutingKey].(string); ok {
+		return key
+	}
+	if death, ok := firstDeath(delivery.Headers); ok {
+		if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+			if key, ok := keys[0].(string); ok {
+				return key
+			}
+		}
+	}
+	return delivery.RoutingKey
+}
+
+
+func deadLetterFrom(queue string, delivery amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		Queue:      queue,
+		RoutingKey: originalRoutingKey(delivery),
+		MessageID:  delivery.MessageId,
+		Body:       delivery.Body,
+		Attempts:   headerInt(delivery.Headers, HeaderRetryCount),
+	}
+
+	if lastError, ok := delivery.Headers[HeaderLastError].(string); ok {
+		letter.Reason = DeadLetterReasonFailed
+		letter.LastError = lastError
+	} else if death, ok := firstDeath(delivery.Headers); ok {
+		letter.Reason, _ = death["reason"].(string)
+	}
+	return letter
+}
+
+
+// firstDeath возвращает последнюю запись x-death, которую брокер добавляет
+// при переносе сообщения в exchange недоставленных.
+func firstDeath(headers amqp.Table) (amqp.Table, bool) {
+	deaths, ok := headers["x-death"].([]interface{})
+	if !ok || len(deaths) == 0 {
+		return nil, false
+	}
+	death, ok := deaths[0].(amqp.Table)
+	return death, ok
+}
+
+
+func headerInt(headers amqp.Table, name string) int {
+	switch value := headers[name].(type) {
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case int:
+		return value
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryDelays(t *testing.T) {
+	delays := RetryDelays(10*time.Second, 3)
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second}
+	if len(delays) != len(want) {
+		t.Fatalf("Задержек: %d, ожидалось %d", len(delays), len(want))
+	}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("Задержка %d: %s, ожидалось %s", i, delays[i], want[i])
+		}
+	}
+	if len(RetryDelays(0, 3)) != 0 {
+		t.Error("Повторы с нулевой задержкой должны быть отключены")
+	}
+}
+
+func TestRetryTopology(t *testing.T) {
+	broker := newFakeBroker()
+	newTestQueue(t, broker)
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for _, queue := range ConsumerQueues {
+		args := broker.args[queue]
+		if args["x-dead-letter-exchange"] != DeadLetterExchange || args["x-dead-letter-routing-key"] != queue {
+			t.Errorf("%s: аргументы очереди %v", queue, args)
+		}
+
+		bound := false
+		for _, binding := range broker.bindings[queue+DeadLetterSuffix] {
+			bound = bound || binding == fakeBinding{DeadLetterExchange, queue}
+		}
+		if !bound {
+			t.Errorf("%s: очередь недоставленных не привязана", queue)
+		}
+
+		for _, delay := range []time.Duration{time.Second, 2 * time.Second} {
+			args := broker.args[RetryQueueName(queue, delay)]
+			if args["x-message-ttl"] != delay.Milliseconds() || args["x-dead-letter-exchange"] != "" || args["x-dead-letter-routing-key"] != queue {
+				t.Errorf("%s: аргументы очереди повтора %v", RetryQueueName(queue, delay), args)
+			}
+		}
+	}
+}
+
+func TestConsumeRetriesThenDeadLetters(t *testing.T) {
+	broker := newFakeBroker()
+	nq := newTestQueue(t, broker)
+
+	letters := make(chan DeadLetter, 1)
+	if err := nq.CollectDeadLetters(context.Background(), func(letter DeadLetter) error {
+		letters <- letter
+		return nil
+	}); err != nil {
+		t.Fatalf("Ошибка получения недоставленных: %v", err)
+	}
+
+	var failing atomic.Bool
+	failing.Store(true)
+	received := make(chan string, 8)
+	err := nq.Consume(context.Background(), DomainQueueName, func(routingKey, messageID string, body []byte) error {
+		received <- routingKey + " " + messageID
+		if failing.Load() {
+			return errors.New("database is down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Ошибка подписки: %v", err)
+	}
+
+	if err := nq.Publish(context.Background(), RoutingKeyMessageRead, "42", []byte(`{}`)); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+
+	// Первая попытка и два повтора
+	for i := 0; i < 3; i++ {
+		if got := receive(t, received); got != RoutingKeyMessageRead+" 42" {
+			t.Errorf("Попытка %d: получено %q", i+1, got)
+		}
+	}
+
+	var letter DeadLetter
+	select {
+	case letter = <-letters:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Сообщение не попало в очередь недоставленных")
+	}
+	if letter.Queue != DomainQueueName || letter.RoutingKey != RoutingKeyMessageRead || letter.MessageID != "42" {
+		t.Errorf("Недоставленное сообщение: %+v", letter)
+	}
+	if letter.Attempts != 3 || letter.Reason != DeadLetterReasonFailed || letter.LastError != "database is down" {
+		t.Errorf("Попыток %d, причина %q, ошибка %q", letter.Attempts, letter.Reason, letter.LastError)
+	}
+
+	// Повторная отправка приходит с исходным ключом и обрабатывается
+	failing.Store(false)
+	if err := nq.Replay(context.Background(), letter); err != nil {
+		t.Fatalf("Ошибка повторной отправки: %v", err)
+	}
+	if got := receive(t, received); got != RoutingKeyMessageRead+" 42" {
+		t.Errorf("После повторной отправки получено %q", got)
+	}
+	select {
+	case letter := <-letters:
+		t.Errorf("Обработанное сообщение попало в недоставленные: %+v", letter)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestDeadLetterFromBrokerReason(t *testing.T) {
+	letter := deadLetterFrom(ScanQueueName, amqp.Delivery{
+		RoutingKey: ScanQueueName,
+		MessageId:  "7",
+		Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": ScanQueueName, "reason": "rejected", "routing-keys": []interface{}{"scan.reject"}},
+		}},
+	})
+	if letter.Reason != "rejected" || letter.RoutingKey != "scan.reject" || letter.Attempts != 0 {
+		t.Errorf("Недоставленное сообщение: %+v", letter)
+	}
+}
+
+func TestReplayWithoutBroker(t *testing.T) {
+	broker := newFakeBroker()
+	broker.down = true
+	nq := newTestQueue(t, broker)
+
+	err := nq.Replay(context.Background(), DeadLetter{Queue: DomainQueueName, RoutingKey: RoutingKeyMessageRead})
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Повторная отправка без соединения: %v, ожидалось ErrNotConnected", err)
+	}
+}
@@ -0,0 +1,245 @@
+package queue
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+
+// EventVersion — версия схемы, которую сервис записывает в поле version
+// каждого события. Версия повышается только при несовместимом изменении
+// схемы (удаление или переименование поля, смена типа); новые необязательные
+// поля добавляются без смены версии, и потребители должны игнорировать
+// незнакомые поля.
+const EventVersion = 1
+
+
+// Ключи маршрутизации доменных событий. События публикуются в exchange
+// mail_notifications; очередь DomainQueueName получает все ключи из
+// DomainRoutingKeys.
+const (
+	RoutingKeyMessageRead      = "message.read"
+	RoutingKeyMessageDestroyed = "message.destroyed"
+	RoutingKeyMessageExpired   = "message.expired"
+	RoutingKeyMessageLabeled   = "message.labeled"
+	RoutingKeyMessageDeleted   = "message.deleted"
+	RoutingKeyUserRegistered   = "user.registered"
+	RoutingKeyUserRoleChanged  = "user.role_changed"
+
+	DomainQueueName = "domain_events.v2"
+
+	// Очередь webhooks получает все события каталога для рассылки вебхукам
+	WebhookQueueName = "webhooks"
+)
+
+
+var DomainRoutingKeys = []string{
+	RoutingKeyMessageRead,
+	RoutingKeyMessageDestroyed,
+	RoutingKeyMessageExpired,
+	RoutingKeyMessageLabeled,
+	RoutingKeyMessageDeleted,
+	RoutingKeyUserRegistered,
+	RoutingKeyUserRoleChanged,
+}
+
+
+// MessageReadNotification — получатель впервые открыл письмо.
+type MessageReadNotification struct {
+	Version    int       `json:"version"`
+	MessageID  uint      `json:"message_id"`
+	SenderID   uint      `json:"sender_id"`
+	ReceiverID uint      `json:"receiver_id"`
+	ReadCount  int       `json:"read_count"`
+	ReadLimit  int       `json:"read_limit"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+
+// MessageDestroyedNotification — письмо удалено после последнего
+// разрешенного прочтения.
+type MessageDestroyedNotification struct {
+	Version    int       `json:"version"`
+	MessageID  uint      `json:"message_id"`
+	SenderID   uint      `json:"sender_id"`
+	ReceiverID uint      `json:"receiver_id"`
+	ReadLimit  int       `json:"read_limit"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+
+// MessageExpiredNotification — письмо удалено по истечении срока хранения.
+type MessageExpiredNotification struct {
+	Version    int       `json:"version"`
+	MessageID  uint      `json:"message_id"`
+	SenderID   uint      `json:"sender_id"`
+	ReceiverID uint      `json:"receiver_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+
+// MessageLabeledNotification — пользователь перенес письмо в другую папку.
+type MessageLabeledNotification struct {
+	Version   int       `json:"version"`
+	MessageID uint      `json:"message_id"`
+	UserID    uint      `json:"user_id"`
+	From      string    `json:"from"`
+	Label     string    `json:"label"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+
+// MessageDeletedNotification — пользователь перенес письмо в корзину.
+type MessageDeletedNotification struct {
+	Version   int       `json:"version"`
+	MessageID uint      `json:"message_id"`
+	UserID    uint      `json:"user_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+
+type UserRegisteredNotification struct {
+	Version   int       `json:"version"`
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+
+// UserRoleChangedNotification — администратор ChangedByID изменил роль
+// пользователя.
+type UserRoleChangedNotification struct {
+	Version     int       `json:"version"`
+	UserID      uint      `json:"user_id"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	ChangedByID uint      `json:"changed_by_id"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+
+// EventType — запись каталога событий: ключ маршрутизации, версия схемы и
+// документ JSON Schema, описывающий тело события.
+type EventType struct {
+	RoutingKey  string `json:"routing_key" example:"message.read"`
+	Version     int    `json:"version" example:"1"`
+	Description string `json:"description" example:"Получатель впервые открыл письмо"`
+	Schema      string `json:"schema" example:"message.read.v1.json"`
+
+	// payload — тип тела события; по нему тесты совместимости сверяют схему
+	payload interface{}
+}
+
+
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+
+// Catalog — все события, которые публикует сервис.
+var Catalog = []EventType{
+	{RoutingKey, 1, "Новое письмо во входящих получателя", "new_message.v1.json", NewMessageNotification{}},
+	{ScanRoutingKeyPrefix + "clean", 1, "Письмо проверено сканером и не содержит угроз", "scan.v1.json", ScanNotification{}},
+	{ScanRoutingKeyPrefix + "quarantine", 1, "Письмо задержано сканером в карантине", "scan.v1.json", ScanNotification{}},
+	{ScanRoutingKeyPrefix + "reject", 1, "Письмо отклонено сканером", "scan.v1.json", ScanNotification{}},
+	{RoutingKeyMessageRead, 1, "Получатель впервые открыл письмо", "message.read.v1.json", MessageReadNotification{}},
+	{RoutingKeyMessageDestroyed, 1, "Письмо удалено после последнего разрешенного прочтения", "message.destroyed.v1.json", MessageDestroyedNotification{}},
+	{RoutingKeyMessageExpired, 1, "Письмо удалено по истечении срока хранения", "message.expired.v1.json", MessageExpiredNotification{}},
+	{RoutingKeyMessageLabeled, 1, "Письмо перенесено в другую папку", "message.labeled.v1.json", MessageLabeledNotification{}},
+	{RoutingKeyMessageDeleted, 1, "Письмо перенесено в корзину", "message.deleted.v1.json", MessageDeletedNotification{}},
+	{RoutingKeyUserRegistered, 1, "Зарегистрирован пользователь", "user.registered.v1.json", UserRegisteredNotification{}},
+	{RoutingKeyUserRoleChanged, 1, "Изменена роль пользователя", "user.role_changed.v1.json", UserRoleChangedNotification{}},
+}
+
+
+// LookupEventType находит событие каталога по ключу маршрутизации.
+func LookupEventType(routingKey string) (EventType, bool) {
+	for _, eventType := range Catalog {
+		if eventType.RoutingKey == routingKey {
+			return eventType, true
+		}
+	}
+	return EventType{}, false
+}
+
+
+// EventSchema возвращает документ JSON Schema события.
+func EventSchema(routingKey string) ([]byte, error) {
+	eventType, ok := LookupEventType(routingKey)
+	if !ok {
+		return nil, fmt.Errorf("unknown event: %s", routingKey)
+	}
+	return schemaFiles.ReadFile("schemas/" + eventType.Schema)
+}
+
+
+// eventUsers определяет, каких пользователей касается событие с данным
+// ключом маршрутизации: им событие доставляется в реальном времени и
+// пользовательским вебхукам. О письме, удаленном после прочтения или по
+// сроку, узнают и отправитель, и получатель: оно исчезает у обоих.
+var eventUsers = map[string]func(p participants) []uint{
+	RoutingKey:                 receiver,
+	RoutingKeyMessageRead:      receiver,
+	RoutingKeyMessageDestroyed: senderAndReceiver,
+	RoutingKeyMessageExpired:   senderAndReceiver,
+	RoutingKeyMessageLabeled:   actor,
+	RoutingKeyMessageDeleted:   actor,
+	RoutingKeyUserRoleChanged:  actor,
+}
+
+
+// participants — поля пользователей, общие для тел событий.
+type participants struct {
+	SenderID   uint `json:"sender_id"`
+	ReceiverID uint `json:"receiver_id"`
+	UserID     uint `json:"user_id"`
+}
+
+
+func receiver(p participants) []uint {
+	return []uint{p.ReceiverID}
+}
+
+
+func senderAndReceiver(p participants) []uint {
+	if p.SenderID == p.ReceiverID {
+		return []uint{p.ReceiverID}
+	}
+	return []uint{p.SenderID, p.ReceiverID}
+}
+
+
+func actor(p participants) []uint {
+	return []uint{p.UserID}
+}
+
+
+// UserRoutingKeys возвращает ключи событий, которые касаются отдельных
+// пользователей. Остальные события (регистрация, вердикты сканера) получают
+// только администраторы.
+func UserRoutingKeys() []string {
+	keys := make([]string, 0, len(eventUsers))
+	for key := range eventUsers {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+
+// EventUsers возвращает пользователей, которых касается событие. Для
+// событий, не входящих в UserRoutingKeys, возвращает nil.
+func EventUsers(routingKey string, body []byte) ([]uint, error) {
+	resolve, ok := eventUsers[routingKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var p participants
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	return resolve(p), nil
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Тесты совместимости каталога событий. Для каждого события в testdata/events
+// хранится тело, записанное при выпуске версии схемы. Такие тела уже
+// читают потребители, поэтому изменение типа события, из-за которого они
+// перестают соответствовать схеме или разбираться в тип события, — это
+// несовместимое изменение, требующее новой версии.
+
+func loadSchema(t *testing.T, eventType EventType) map[string]interface{} {
+	t.Helper()
+
+	raw, err := EventSchema(eventType.RoutingKey)
+	if err != nil {
+		t.Fatalf("%s: схема не найдена: %v", eventType.RoutingKey, err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("%s: схема не разбирается: %v", eventType.RoutingKey, err)
+	}
+	return schema
+}
+
+// payloadFields возвращает поля JSON типа события и признак omitempty.
+func payloadFields(payload interface{}) map[string]bool {
+	fields := make(map[string]bool)
+	typ := reflect.TypeOf(payload)
+	for i := 0; i < typ.NumField(); i++ {
+		name, options, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields[name] = options == "omitempty"
+	}
+	return fields
+}
+
+// validate проверяет value по подмножеству JSON Schema, которое используют
+// схемы событий: type, const, enum, minimum, format date-time, required и
+// properties.
+func validate(schema map[string]interface{}, value interface{}, path string) []string {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if want, ok := schema["const"]; ok && !reflect.DeepEqual(want, value) {
+		fail("ожидалось %v, получено %v", want, value)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			found = found || reflect.DeepEqual(option, value)
+		}
+		if !found {
+			fail("значение %v не входит в %v", value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("ожидался объект")
+			return errs
+		}
+		for _, name := range schema["required"].([]interface{}) {
+			if _, ok := object[name.(string)]; !ok {
+				fail("нет обязательного поля %s", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			if field, ok := object[name]; ok {
+				errs = append(errs, validate(property.(map[string]interface{}), field, path+"."+name)...)
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			fail("ожидалось целое число, получено %v", value)
+			return errs
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && number < minimum {
+			fail("%v меньше минимума %v", number, minimum)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("ожидалась строка, получено %v", value)
+			return errs
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				fail("неверная дата %q", text)
+			}
+		}
+	}
+	return errs
+}
+
+func TestEventCatalogSchemas(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, eventType := range Catalog {
+		key := eventType.RoutingKey
+		if seen[key] {
+			t.Errorf("%s: событие повторяется в каталоге", key)
+		}
+		seen[key] = true
+
+		schema := loadSchema(t, eventType)
+		properties := schema["properties"].(map[string]interface{})
+		version := properties["version"].(map[string]interface{})
+		if version["const"] != float64(eventType.Version) {
+			t.Errorf("%s: версия схемы %v, в каталоге %d", key, version["const"], eventType.Version)
+		}
+		if schema["additionalProperties"] != true {
+			t.Errorf("%s: схема должна допускать новые поля", key)
+		}
+
+		// Схема описывает все поля типа события, а обязательные поля
+		// присутствуют в каждом теле
+		fields := payloadFields(eventType.payload)
+		for name := range fields {
+			if _, ok := properties[name]; !ok {
+				t.Errorf("%s: поле %s не описано в схеме", key, name)
+			}
+		}
+		for _, name := range schema["required"].([]interface{}) {
+			omitempty, ok := fields[name.(string)]
+			if !ok || omitempty {
+				t.Errorf("%s: обязательное поле %s может отсутствовать в теле", key, name)
+			}
+		}
+	}
+
+	for _, key := range append([]string{RoutingKey}, DomainRoutingKeys...) {
+		if !seen[key] {
+			t.Errorf("%s: событие отсутствует в каталоге", key)
+		}
+	}
+	for _, verdict := range ScanVerdicts {
+		if !seen[ScanRoutingKeyPrefix+verdict] {
+			t.Errorf("%s: событие отсутствует в каталоге", ScanRoutingKeyPrefix+verdict)
+		}
+	}
+}
+
+func TestEventCompatibility(t *testing.T) {
+	for _, eventType := range Catalog {
+		key := eventType.RoutingKey
+		golden, err := os.ReadFile(fmt.Sprintf("testdata/events/%s.v%d.json", key, eventType.Version))
+		if err != nil {
+			t.Errorf("%s: нет записанного тела версии %d: %v", key, eventType.Version, err)
+			continue
+		}
+
+		var recorded map[string]interface{}
+		if err := json.Unmarshal(golden, &recorded); err != nil {
+			t.Fatalf("%s: записанное тело не разбирается: %v", key, err)
+		}
+		for _, problem := range validate(loadSchema(t, eventType), recorded, key) {
+			t.Errorf("Записанное тело не соответствует схеме: %s", problem)
+		}
+
+		// Тело разбирается в текущий тип без потери полей и с теми же
+		// значениями после повторной сериализации
+		payload := reflect.New(reflect.TypeOf(eventType.payload)).Interface()
+		decoder := json.NewDecoder(bytes.NewReader(golden))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(payload); err != nil {
+			t.Errorf("%s: записанное тело не разбирается в %T: %v", key, payload, err)
+			continue
+		}
+		encoded, _ := json.Marshal(payload)
+		var current map[string]interface{}
+		json.Unmarshal(encoded, &current)
+		for name, value := range recorded {
+			if !reflect.DeepEqual(current[name], value) {
+				t.Errorf("%s: поле %s: было %v, стало %v", key, name, value, current[name])
+			}
+		}
+	}
+}
+
+func TestDomainEventsBound(t *testing.T) {
+	broker := newFakeBroker()
+	newTestQueue(t, broker)
+
+	for _, eventType := range Catalog {
+		bound := false
+		broker.mu.Lock()
+		for queue, bindings := range broker.bindings {
+			for _, binding := range bindings {
+				bound = bound || (binding == fakeBinding{ExchangeName, eventType.RoutingKey} && !strings.HasPrefix(queue, "amq.gen-"))
+			}
+		}
+		broker.mu.Unlock()
+		if !bound {
+			t.Errorf("%s: ни одна постоянная очередь не получает событие", eventType.RoutingKey)
+		}
+	}
+}
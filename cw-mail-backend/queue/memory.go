@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+
+// MemoryBus доставляет уведомления подписчикам внутри процесса. Подходит для
+// разработки и тестов с одним экземпляром сервиса: внешние потребители
+// уведомления не получают.
+type MemoryBus struct {
+	mu            sync.RWMutex
+	subscriptions map[*memorySubscription]struct{}
+}
+
+
+type memorySubscription struct {
+	routingKeys map[string]bool
+	handler     Handler
+}
+
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subscriptions: make(map[*memorySubscription]struct{})}
+}
+
+
+// Publish синхронно вызывает обработчики подписок с ключом routingKey.
+func (b *MemoryBus) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	var handlers []Handler
+	for sub := range b.subscriptions {
+		if sub.routingKeys[routingKey] {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(routingKey, messageID, body)
+	}
+	return nil
+}
+
+
+func (b *MemoryBus) Subscribe(ctx context.Context, routingKeys []string, handler Handler) error {
+	sub := &memorySubscription{routingKeys: make(map[string]bool, len(routingKeys)), handler: handler}
+	for _, key := range routingKeys {
+		sub.routingKeys[key] = true
+	}
+
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscriptions, sub)
+		b.mu.Unlock()
+	}()
+	return nil
+}
+
+
+func (b *MemoryBus) Ready() bool {
+	return true
+}
+
+
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = make(map[*memorySubscription]struct{})
+	return nil
+}
@@ -2,8 +2,9 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/mail-service/config"
@@ -13,13 +14,38 @@ import (
 
 const (
 	ExchangeName   = "mail_notifications"
-	QueueName      = "notifications"
 	RoutingKey     = "new_message"
 	PublishTimeout = 5 * time.Second
+
+	// Постоянные очереди объявлены с exchange недоставленных. Суффикс версии
+	// меняется вместе с аргументами очереди: RabbitMQ не позволяет изменить
+	// аргументы существующей очереди.
+	QueueName = "notifications.v2"
+
+	// Вердикты сканера публикуются с ключом scan.<вердикт> в отдельную очередь
+	ScanQueueName        = "scan_verdicts.v2"
+	ScanRoutingKeyPrefix = "scan."
 )
 
 
+// ScanVerdicts — вердикты, для которых очередь ScanQueueName привязана к
+// exchange.
+var ScanVerdicts = []string{"clean", "quarantine", "reject"}
+
+
+// legacyBindings — привязки очередей прежних версий, объявленных без
+// exchange недоставленных. При подключении они снимаются: новые сообщения
+// идут только в очереди с суффиксом версии, а старые очереди дочитываются
+// потребителями и удаляются администратором. Сами очереди сервис не удаляет.
+var legacyBindings = map[string][]string{
+	"notifications": {RoutingKey},
+	"scan_verdicts": scanRoutingKeys(),
+	"domain_events": DomainRoutingKeys,
+}
+
+
 type NewMessageNotification struct {
+	Version    int       `json:"version"`
 	MessageID  uint      `json:"message_id"`
 	SenderID   uint      `json:"sender_id"`
 	ReceiverID uint      `json:"receiver_id"`
@@ -27,25 +53,206 @@ type NewMessageNotification struct {
 }
 
 
+// ScanNotification — вердикт сканера о письме. QuarantineID заполнен, если
+// письмо задержано в карантине.
+type ScanNotification struct {
+	Version      int       `json:"version"`
+	Verdict      string    `json:"verdict"`
+	Scanner      string    `json:"scanner"`
+	Reason       string    `json:"reason,omitempty"`
+	SenderID     uint      `json:"sender_id"`
+	To           string    `json:"to"`
+	Subject      string    `json:"subject"`
+	QuarantineID uint      `json:"quarantine_id,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+
+// NotificationQueue публикует уведомления в RabbitMQ и держит соединение с
+// брокером: при потере соединения переподключается с экспоненциальной
+// задержкой, заново объявляет exchange, очереди и привязки и возобновляет
+// подписки. Пока соединения нет, Ready возвращает false, а Publish —
+// ErrNotConnected; неопубликованные события остаются в outbox.
 type NotificationQueue struct {
-	Connection *amqp.Connection
-	Channel    *amqp.Channel
+	uri          string
+	dial         Dialer
+	reconnectMin time.Duration
+	reconnectMax time.Duration
+	retryDelays  []time.Duration
+
+	mu            sync.Mutex
+	conn          Connection
+	channel       Channel
+	lost          chan *amqp.Error
+	subscriptions map[*subscription]struct{}
+	closed        bool
+
+	done    chan struct{}
+	stopped chan struct{}
 }
 
 
-func NewNotificationQueue(cfg *config.Config) (*NotificationQueue, error) {
-	conn, err := amqp.Dial(cfg.GetRabbitMQURI())
+// subscription получает уведомления из временной очереди с привязками
+// routingKeys или, если задан queue, из постоянной очереди с подтверждением
+// обработки.
+type subscription struct {
+	ctx         context.Context
+	queue       string
+	routingKeys []string
+	deliver     func(delivery amqp.Delivery)
+}
+
+
+// NewNotificationQueue подключается к RabbitMQ. Если брокер недоступен,
+// подключение повторяется в фоне до вызова Close.
+func NewNotificationQueue(cfg *config.Config) *NotificationQueue {
+	return newNotificationQueue(cfg, DialAMQP)
+}
+
+
+func newNotificationQueue(cfg *config.Config, dial Dialer) *NotificationQueue {
+	nq := &NotificationQueue{
+		uri:           cfg.GetRabbitMQURI(),
+		dial:          dial,
+		reconnectMin:  cfg.RabbitMQ.ReconnectMin,
+		reconnectMax:  cfg.RabbitMQ.ReconnectMax,
+		retryDelays:   RetryDelays(cfg.RabbitMQ.RetryBase, cfg.RabbitMQ.RetryAttempts),
+		subscriptions: make(map[*subscription]struct{}),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	// Первая попытка выполняется сразу, чтобы при доступном брокере очередь
+	// была готова к публикации после возврата из конструктора
+	lost, err := nq.connect()
+	go nq.run(lost, err)
+	return nq
+}
+
+
+// Ready сообщает, есть ли соединение с брокером.
+func (nq *NotificationQueue) Ready() bool {
+	nq.mu.Lock()
+	defer nq.mu.Unlock()
+	return nq.channel != nil
+}
+
+
+func (nq *NotificationQueue) run(lost <-chan *amqp.Error, err error) {
+	defer close(nq.stopped)
+
+	delay := nq.reconnectMin
+	for {
+		if err != nil {
+			log.Printf("Не удалось подключиться к RabbitMQ: %v, повтор через %s", err, delay)
+			select {
+			case <-nq.done:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, nq.reconnectMax)
+		} else {
+			delay = nq.reconnectMin
+			select {
+			case <-nq.done:
+				nq.disconnect()
+				return
+			case cause := <-lost:
+				log.Printf("Соединение с RabbitMQ потеряно: %v", cause)
+				nq.disconnect()
+			}
+		}
+
+		lost, err = nq.connect()
+	}
+}
+
+
+// connect открывает соединение и канал публикации с подтверждениями,
+// объявляет топологию и возобновляет подписки. Возвращенный канал получает
+// значение, когда соединение или один из его каналов закрыт брокером.
+func (nq *NotificationQueue) connect() (<-chan *amqp.Error, error) {
+	conn, err := nq.dial(nq.uri)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to open a channel: %w", err)
 	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	if err := nq.declareTopology(ch); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	unbindLegacyQueues(conn)
+
+	lost := make(chan *amqp.Error, 1)
+	watchClose(conn.NotifyClose(make(chan *amqp.Error, 1)), lost, true)
+	watchClose(ch.NotifyClose(make(chan *amqp.Error, 1)), lost, true)
+
+	nq.mu.Lock()
+	defer nq.mu.Unlock()
+
+	if nq.closed {
+		conn.Close()
+		return nil, ErrQueueClosed
+	}
+	for sub := range nq.subscriptions {
+		if err := nq.consume(conn, sub, lost); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	nq.conn = conn
+	nq.channel = ch
+	nq.lost = lost
+	log.Printf("Подключение к RabbitMQ установлено")
+	return lost, nil
+}
+
+
+func (nq *NotificationQueue) disconnect() {
+	nq.mu.Lock()
+	conn := nq.conn
+	nq.conn = nil
+	nq.channel = nil
+	nq.lost = nil
+	nq.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+}
 
 
-	err = ch.ExchangeDeclare(
+// watchClose передает в lost причину закрытия соединения или канала. Если
+// always не задан, штатное закрытие (без ошибки) не считается потерей.
+func watchClose(closed <-chan *amqp.Error, lost chan<- *amqp.Error, always bool) {
+	go func() {
+		cause, ok := <-closed
+		if !ok && !always {
+			return
+		}
+		if cause == nil {
+			cause = amqp.ErrClosed
+		}
+		select {
+		case lost <- cause:
+		default:
+		}
+	}()
+}
+
+
+func (nq *NotificationQueue) declareTopology(ch Channel) error {
+	err := ch.ExchangeDeclare(
 		ExchangeName, // имя
 		"direct",     // тип
 		true,         // durable
@@ -55,20 +262,20 @@ func NewNotificationQueue(cfg *config.Config) (*NotificationQueue, error) {
 		nil,          // аргументы
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare an exchange: %w", err)
+		return fmt.Errorf("failed to declare an exchange: %w", err)
 	}
 
 
 	_, err = ch.QueueDeclare(
-		QueueName, // имя
-		true,      // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // аргументы
+		QueueName,                 // имя
+		true,                      // durable
+		false,                     // delete when unused
+		false,                     // exclusive
+		false,                     // no-wait
+		deadLetterArgs(QueueName), // аргументы
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare a queue: %w", err)
+		return fmt.Errorf("failed to declare a queue: %w", err)
 	}
 
 
@@ -80,58 +287,237 @@ func NewNotificationQueue(cfg *config.Config) (*NotificationQueue, error) {
 		nil,          // аргументы
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to bind queue: %w", err)
+		return fmt.Errorf("failed to bind queue: %w", err)
 	}
 
-	return &NotificationQueue{
-		Connection: conn,
-		Channel:    ch,
-	}, nil
+
+	_, err = ch.QueueDeclare(ScanQueueName, true, false, false, false, deadLetterArgs(ScanQueueName))
+	if err != nil {
+		return fmt.Errorf("failed to declare a queue: %w", err)
+	}
+	for _, key := range scanRoutingKeys() {
+		if err := ch.QueueBind(ScanQueueName, key, ExchangeName, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue: %w", err)
+		}
+	}
+
+
+	_, err = ch.QueueDeclare(DomainQueueName, true, false, false, false, deadLetterArgs(DomainQueueName))
+	if err != nil {
+		return fmt.Errorf("failed to declare a queue: %w", err)
+	}
+	for _, key := range DomainRoutingKeys {
+		if err := ch.QueueBind(DomainQueueName, key, ExchangeName, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue: %w", err)
+		}
+	}
+
+
+	_, err = ch.QueueDeclare(WebhookQueueName, true, false, false, false, deadLetterArgs(WebhookQueueName))
+	if err != nil {
+		return fmt.Errorf("failed to declare a queue: %w", err)
+	}
+	for _, eventType := range Catalog {
+		if err := ch.QueueBind(WebhookQueueName, eventType.RoutingKey, ExchangeName, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue: %w", err)
+		}
+	}
+
+	return declareRetryTopology(ch, nq.retryDelays)
+}
+
+
+// unbindLegacyQueues снимает legacyBindings. Очереди прежних версий может не
+// быть, а ошибка брокера закрывает канал, поэтому каждая очередь обрабатывается
+// в своем канале, и ошибка не мешает подключению.
+func unbindLegacyQueues(conn Connection) {
+	for queue, keys := range legacyBindings {
+		ch, err := conn.Channel()
+		if err != nil {
+			log.Printf("Не удалось открыть канал для очереди %s: %v", queue, err)
+			return
+		}
+		for _, key := range keys {
+			if err := ch.QueueUnbind(queue, key, ExchangeName, nil); err != nil {
+				log.Printf("Привязка %s очереди %s не снята: %v", key, queue, err)
+				break
+			}
+		}
+		ch.Close()
+	}
 }
 
 
-func (nq *NotificationQueue) PublishNewMessageNotification(messageID, senderID, receiverID uint) error {
-	notification := NewMessageNotification{
-		MessageID:  messageID,
-		SenderID:   senderID,
-		ReceiverID: receiverID,
-		Timestamp:  time.Now(),
+func scanRoutingKeys() []string {
+	keys := make([]string, len(ScanVerdicts))
+	for i, verdict := range ScanVerdicts {
+		keys[i] = ScanRoutingKeyPrefix + verdict
 	}
+	return keys
+}
+
 
-	body, err := json.Marshal(notification)
+// Publish публикует готовое тело уведомления в exchange mail_notifications и
+// ждет подтверждения брокера. messageID передается в свойстве message_id,
+// чтобы потребители могли отбрасывать повторы.
+func (nq *NotificationQueue) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	err := nq.publish(ctx, ExchangeName, routingKey, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    messageID,
+		Body:         body,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal notification: %w", err)
+		return fmt.Errorf("failed to publish notification: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), PublishTimeout)
+	return nil
+}
+
+
+// publish публикует сообщение через канал с подтверждениями.
+func (nq *NotificationQueue) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	nq.mu.Lock()
+	ch := nq.channel
+	nq.mu.Unlock()
+	if ch == nil {
+		return ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PublishTimeout)
 	defer cancel()
+	return ch.Publish(ctx, exchange, key, msg)
+}
 
-	err = nq.Channel.PublishWithContext(
-		ctx,
-		ExchangeName, // exchange
-		RoutingKey,   // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Body:         body,
+
+// Subscribe получает уведомления с указанными ключами и передает их handler.
+// Каждая подписка объявляет собственную временную очередь, поэтому каждый
+// экземпляр сервиса получает все уведомления, а не делит их с другими
+// потребителями очереди notifications. После переподключения подписка
+// возобновляется; уведомления, опубликованные без соединения, не приходят.
+// Получение прекращается с отменой ctx.
+func (nq *NotificationQueue) Subscribe(ctx context.Context, routingKeys []string, handler Handler) error {
+	return nq.register(&subscription{
+		ctx:         ctx,
+		routingKeys: routingKeys,
+		deliver: func(delivery amqp.Delivery) {
+			handler(delivery.RoutingKey, delivery.MessageId, delivery.Body)
 		},
-	)
+	})
+}
+
+
+// register добавляет подписку; если соединение сейчас есть, получение
+// начинается сразу, иначе — после подключения.
+func (nq *NotificationQueue) register(sub *subscription) error {
+	nq.mu.Lock()
+	defer nq.mu.Unlock()
+
+	if nq.closed {
+		return ErrQueueClosed
+	}
+	nq.subscriptions[sub] = struct{}{}
+	go func() {
+		select {
+		case <-sub.ctx.Done():
+			nq.mu.Lock()
+			delete(nq.subscriptions, sub)
+			nq.mu.Unlock()
+		case <-nq.done:
+		}
+	}()
+
+	if nq.conn == nil {
+		return nil
+	}
+	if err := nq.consume(nq.conn, sub, nq.lost); err != nil {
+		// Подписка возобновится вместе с соединением
+		log.Printf("Ошибка подписки на уведомления: %v, переподключение", err)
+		nq.conn.Close()
+	}
+	return nil
+}
+
+
+// consume начинает получение для подписки на соединении conn. Вызывается с
+// захваченным nq.mu.
+func (nq *NotificationQueue) consume(conn Connection, sub *subscription, lost chan<- *amqp.Error) error {
+	if sub.ctx.Err() != nil {
+		return nil
+	}
+
+	ch, err := conn.Channel()
 	if err != nil {
-		return fmt.Errorf("failed to publish notification: %w", err)
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	// Временная очередь подтверждается автоматически, постоянная — после
+	// обработки
+	queueName, temporary := sub.queue, sub.queue == ""
+	if temporary {
+		q, err := ch.QueueDeclare(
+			"",    // имя назначает брокер
+			false, // durable
+			true,  // delete when unused
+			true,  // exclusive
+			false, // no-wait
+			nil,   // аргументы
+		)
+		if err != nil {
+			ch.Close()
+			return fmt.Errorf("failed to declare a queue: %w", err)
+		}
+		for _, key := range sub.routingKeys {
+			if err := ch.QueueBind(q.Name, key, ExchangeName, false, nil); err != nil {
+				ch.Close()
+				return fmt.Errorf("failed to bind queue: %w", err)
+			}
+		}
+		queueName = q.Name
+	} else if err := ch.Qos(ConsumerPrefetch, 0, false); err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to set prefetch: %w", err)
 	}
 
+	deliveries, err := ch.Consume(queueName, "", temporary, temporary, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to consume: %w", err)
+	}
+
+	// Канал подписки, закрытый брокером, восстанавливается переподключением
+	watchClose(ch.NotifyClose(make(chan *amqp.Error, 1)), lost, false)
+
+	go func() {
+		defer ch.Close()
+		for {
+			select {
+			case <-sub.ctx.Done():
+				return
+			case delivery, ok := <-deliveries:
+				if !ok {
+					return
+				}
+				sub.deliver(delivery)
+			}
+		}
+	}()
 	return nil
 }
 
 
+// Close останавливает переподключение и закрывает соединение. Повторный
+// вызов ничего не делает.
 func (nq *NotificationQueue) Close() error {
-	if err := nq.Channel.Close(); err != nil {
-		return fmt.Errorf("failed to close channel: %w", err)
-	}
-	if err := nq.Connection.Close(); err != nil {
-		return fmt.Errorf("failed to close connection: %w", err)
+	nq.mu.Lock()
+	if nq.closed {
+		nq.mu.Unlock()
+		return nil
 	}
+	nq.closed = true
+	close(nq.done)
+	nq.mu.Unlock()
+
+	<-nq.stopped
 	return nil
 }
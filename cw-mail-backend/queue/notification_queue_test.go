@@ -0,0 +1,618 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mail-service/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker — заглушка RabbitMQ: маршрутизирует публикации в привязанные
+// очереди, хранит сообщения постоянных очередей до появления потребителя,
+// переносит отклоненные сообщения в exchange недоставленных и умеет
+// имитировать остановку брокера. Сообщения в очереди с TTL истекают сразу.
+type fakeBroker struct {
+	mu       sync.Mutex
+	down     bool
+	nack     bool
+	dials    int
+	declared []string
+	args     map[string]amqp.Table
+	bindings map[string][]fakeBinding
+	consumer map[string]chan amqp.Delivery
+	ready    map[string][]amqp.Delivery
+	conns    []*fakeConn
+	queueSeq int
+}
+
+type fakeBinding struct {
+	exchange string
+	key      string
+}
+
+// fakeAck подтверждает одно сообщение очереди queue.
+type fakeAck struct {
+	broker *fakeBroker
+	queue  string
+	key    string
+	msg    amqp.Publishing
+}
+
+type fakeConn struct {
+	broker   *fakeBroker
+	closed   bool
+	notify   []chan *amqp.Error
+	channels []*fakeChannel
+}
+
+type fakeChannel struct {
+	conn    *fakeConn
+	closed  bool
+	confirm bool
+	notify  []chan *amqp.Error
+	queues  []string
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		args:     make(map[string]amqp.Table),
+		bindings: make(map[string][]fakeBinding),
+		consumer: make(map[string]chan amqp.Delivery),
+		ready:    make(map[string][]amqp.Delivery),
+	}
+}
+
+func (b *fakeBroker) dial(uri string) (Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dials++
+	if b.down {
+		return nil, errors.New("connection refused")
+	}
+	conn := &fakeConn{broker: b}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+// stop разрывает все соединения, как при перезапуске брокера. Временные
+// очереди при этом удаляются.
+func (b *fakeBroker) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.down = true
+	for _, conn := range b.conns {
+		conn.close(&amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED", Server: true})
+	}
+	b.conns = nil
+	for queue := range b.bindings {
+		if strings.HasPrefix(queue, "amq.gen-") {
+			delete(b.bindings, queue)
+		}
+	}
+	for queue := range b.args {
+		if strings.HasPrefix(queue, "amq.gen-") {
+			delete(b.args, queue)
+		}
+	}
+}
+
+func (b *fakeBroker) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = false
+}
+
+func (b *fakeBroker) count(declaration string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, d := range b.declared {
+		if d == declaration {
+			n++
+		}
+	}
+	return n
+}
+
+func (b *fakeBroker) dialCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dials
+}
+
+// route доставляет сообщение в очереди, привязанные к exchange с ключом key;
+// exchange по умолчанию доставляет в очередь с именем key. Вызывается с
+// захваченным b.mu.
+func (b *fakeBroker) route(exchange, key string, msg amqp.Publishing) {
+	if exchange == "" {
+		b.enqueue(key, key, msg)
+		return
+	}
+	for queue, bindings := range b.bindings {
+		for _, binding := range bindings {
+			if binding == (fakeBinding{exchange, key}) {
+				b.enqueue(queue, key, msg)
+			}
+		}
+	}
+}
+
+func (b *fakeBroker) enqueue(queue, key string, msg amqp.Publishing) {
+	if _, ok := b.args[queue]["x-message-ttl"]; ok {
+		b.deadLetter(queue, key, msg, "expired")
+		return
+	}
+
+	delivery := amqp.Delivery{
+		Acknowledger: &fakeAck{broker: b, queue: queue, key: key, msg: msg},
+		Headers:      msg.Headers,
+		ContentType:  msg.ContentType,
+		MessageId:    msg.MessageId,
+		RoutingKey:   key,
+		Body:         msg.Body,
+	}
+	if deliveries, ok := b.consumer[queue]; ok {
+		deliveries <- delivery
+	} else if !strings.HasPrefix(queue, "amq.gen-") {
+		b.ready[queue] = append(b.ready[queue], delivery)
+	}
+}
+
+// deadLetter переносит сообщение по аргументам x-dead-letter-* очереди и
+// добавляет запись x-death, как это делает RabbitMQ.
+func (b *fakeBroker) deadLetter(queue, key string, msg amqp.Publishing, reason string) {
+	args := b.args[queue]
+	exchange, ok := args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	target := key
+	if deadLetterKey, ok := args["x-dead-letter-routing-key"].(string); ok {
+		target = deadLetterKey
+	}
+
+	headers := amqp.Table{}
+	for name, value := range msg.Headers {
+		headers[name] = value
+	}
+	deaths, _ := headers["x-death"].([]interface{})
+	headers["x-death"] = append([]interface{}{amqp.Table{
+		"queue":        queue,
+		"reason":       reason,
+		"routing-keys": []interface{}{key},
+	}}, deaths...)
+	msg.Headers = headers
+	b.route(exchange, target, msg)
+}
+
+// close закрывает соединение; cause == nil означает штатное закрытие.
+// Вызывается с захваченным broker.mu.
+func (c *fakeConn) close(cause *amqp.Error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for _, ch := range c.channels {
+		ch.close(cause)
+	}
+	notifyClosed(c.notify, cause)
+}
+
+func (c *fakeConn) Channel() (Channel, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &fakeChannel{conn: c}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *fakeConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.notify = append(c.notify, receiver)
+	return receiver
+}
+
+func (c *fakeConn) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.close(nil)
+	return nil
+}
+
+func (ch *fakeChannel) close(cause *amqp.Error) {
+	if ch.closed {
+		return
+	}
+	ch.closed = true
+	for _, queue := range ch.queues {
+		if deliveries, ok := ch.conn.broker.consumer[queue]; ok {
+			close(deliveries)
+			delete(ch.conn.broker.consumer, queue)
+		}
+	}
+	notifyClosed(ch.notify, cause)
+}
+
+func notifyClosed(receivers []chan *amqp.Error, cause *amqp.Error) {
+	for _, receiver := range receivers {
+		if cause != nil {
+			receiver <- cause
+		}
+		close(receiver)
+	}
+}
+
+func (ch *fakeChannel) declare(declaration string) error {
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.conn.broker.declared = append(ch.conn.broker.declared, declaration)
+	return nil
+}
+
+func (ch *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	ch.conn.broker.mu.Lock()
+	defer ch.conn.broker.mu.Unlock()
+	return ch.declare("exchange " + name)
+}
+
+func (ch *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.conn.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if name == "" {
+		b.queueSeq++
+		name = fmt.Sprintf("amq.gen-%d", b.queueSeq)
+	}
+	// Как RabbitMQ, отказывает в объявлении существующей очереди с другими
+	// аргументами и закрывает канал
+	if existing, ok := b.args[name]; ok && !reflect.DeepEqual(existing, args) {
+		cause := &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg", Server: true}
+		ch.close(cause)
+		return amqp.Queue{}, cause
+	}
+	if err := ch.declare("queue " + name); err != nil {
+		return amqp.Queue{}, err
+	}
+	b.args[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (ch *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	b := ch.conn.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := ch.declare("bind " + name + " " + key); err != nil {
+		return err
+	}
+	b.bindings[name] = append(b.bindings[name], fakeBinding{exchange, key})
+	return nil
+}
+
+// QueueUnbind снимает привязку; для несуществующей очереди брокер, как
+// RabbitMQ, отвечает NOT_FOUND и закрывает канал.
+func (ch *fakeChannel) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	b := ch.conn.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, declared := b.args[name]
+	if _, bound := b.bindings[name]; !declared && !bound {
+		cause := &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no queue '" + name + "'", Server: true}
+		ch.close(cause)
+		return cause
+	}
+	if err := ch.declare("unbind " + name + " " + key); err != nil {
+		return err
+	}
+	var kept []fakeBinding
+	for _, binding := range b.bindings[name] {
+		if binding != (fakeBinding{exchange, key}) {
+			kept = append(kept, binding)
+		}
+	}
+	b.bindings[name] = kept
+	return nil
+}
+
+func (ch *fakeChannel) Confirm(noWait bool) error {
+	ch.conn.broker.mu.Lock()
+	defer ch.conn.broker.mu.Unlock()
+	ch.confirm = true
+	return nil
+}
+
+func (ch *fakeChannel) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	b := ch.conn.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if !ch.confirm {
+		return errors.New("channel is not in confirm mode")
+	}
+	if b.nack {
+		return ErrPublishNacked
+	}
+	b.route(exchange, key, msg)
+	return nil
+}
+
+func (ch *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.conn.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+	deliveries := make(chan amqp.Delivery, 64)
+	b.consumer[queue] = deliveries
+	ch.queues = append(ch.queues, queue)
+	for _, delivery := range b.ready[queue] {
+		deliveries <- delivery
+	}
+	delete(b.ready, queue)
+	return deliveries, nil
+}
+
+func (ch *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (ch *fakeChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	ch.conn.broker.mu.Lock()
+	defer ch.conn.broker.mu.Unlock()
+	ch.notify = append(ch.notify, receiver)
+	return receiver
+}
+
+func (ch *fakeChannel) Close() error {
+	ch.conn.broker.mu.Lock()
+	defer ch.conn.broker.mu.Unlock()
+	ch.close(nil)
+	return nil
+}
+
+func (a *fakeAck) Ack(tag uint64, multiple bool) error {
+	return nil
+}
+
+// Nack возвращает сообщение в очередь или переносит его в exchange
+// недоставленных.
+func (a *fakeAck) Nack(tag uint64, multiple, requeue bool) error {
+	a.broker.mu.Lock()
+	defer a.broker.mu.Unlock()
+
+	if requeue {
+		a.broker.enqueue(a.queue, a.key, a.msg)
+	} else {
+		a.broker.deadLetter(a.queue, a.key, a.msg, "rejected")
+	}
+	return nil
+}
+
+func (a *fakeAck) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func newTestQueue(t *testing.T, broker *fakeBroker) *NotificationQueue {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.RabbitMQ.ReconnectMin = 5 * time.Millisecond
+	cfg.RabbitMQ.ReconnectMax = 20 * time.Millisecond
+	cfg.RabbitMQ.RetryBase = time.Second
+	cfg.RabbitMQ.RetryAttempts = 2
+	nq := newNotificationQueue(cfg, broker.dial)
+	t.Cleanup(func() { nq.Close() })
+	return nq
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Не дождались: %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, received <-chan string) string {
+	t.Helper()
+
+	select {
+	case id := <-received:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("Уведомление не получено")
+		return ""
+	}
+}
+
+func TestNotificationQueueReconnects(t *testing.T) {
+	broker := newFakeBroker()
+	nq := newTestQueue(t, broker)
+	if !nq.Ready() {
+		t.Fatal("Очередь не готова при доступном брокере")
+	}
+
+	received := make(chan string, 4)
+	err := nq.Subscribe(context.Background(), []string{RoutingKey}, func(routingKey, messageID string, body []byte) {
+		received <- messageID
+	})
+	if err != nil {
+		t.Fatalf("Ошибка подписки: %v", err)
+	}
+	if err := nq.Publish(context.Background(), RoutingKey, "1", []byte(`{}`)); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	if id := receive(t, received); id != "1" {
+		t.Errorf("Получено уведомление %s, ожидалось 1", id)
+	}
+
+	broker.stop()
+	waitFor(t, "потеря соединения", func() bool { return !nq.Ready() })
+	if err := nq.Publish(context.Background(), RoutingKey, "2", []byte(`{}`)); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Публикация без соединения: %v, ожидалось ErrNotConnected", err)
+	}
+
+	broker.start()
+	waitFor(t, "переподключение", nq.Ready)
+	for _, declaration := range []string{
+		"exchange " + ExchangeName,
+		"queue " + QueueName,
+		"bind " + QueueName + " " + RoutingKey,
+		"queue " + ScanQueueName,
+		"bind " + ScanQueueName + " scan.reject",
+	} {
+		if n := broker.count(declaration); n != 2 {
+			t.Errorf("%s объявлено %d раз, ожидалось 2", declaration, n)
+		}
+	}
+
+	// Подписка возобновлена на новой временной очереди
+	if err := nq.Publish(context.Background(), RoutingKey, "3", []byte(`{}`)); err != nil {
+		t.Fatalf("Ошибка публикации после переподключения: %v", err)
+	}
+	if id := receive(t, received); id != "3" {
+		t.Errorf("Получено уведомление %s, ожидалось 3", id)
+	}
+}
+
+func TestNotificationQueueStartsWithoutBroker(t *testing.T) {
+	broker := newFakeBroker()
+	broker.down = true
+	nq := newTestQueue(t, broker)
+
+	if nq.Ready() {
+		t.Fatal("Очередь готова без брокера")
+	}
+	received := make(chan string, 1)
+	err := nq.Subscribe(context.Background(), []string{RoutingKey}, func(routingKey, messageID string, body []byte) {
+		received <- messageID
+	})
+	if err != nil {
+		t.Fatalf("Подписка без брокера: %v", err)
+	}
+	waitFor(t, "повторные попытки подключения", func() bool { return broker.dialCount() >= 3 })
+
+	broker.start()
+	waitFor(t, "подключение", nq.Ready)
+	if err := nq.Publish(context.Background(), RoutingKey, "7", []byte(`{}`)); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	if id := receive(t, received); id != "7" {
+		t.Errorf("Получено уведомление %s, ожидалось 7", id)
+	}
+
+	// После Close очередь не переподключается
+	nq.Close()
+	if nq.Ready() {
+		t.Error("Очередь готова после Close")
+	}
+	broker.stop()
+	broker.start()
+	dials := broker.dialCount()
+	time.Sleep(50 * time.Millisecond)
+	if broker.dialCount() != dials {
+		t.Error("Очередь переподключилась после Close")
+	}
+}
+
+func TestNotificationQueuePublishNack(t *testing.T) {
+	broker := newFakeBroker()
+	broker.nack = true
+	nq := newTestQueue(t, broker)
+
+	err := nq.Publish(context.Background(), RoutingKey, "1", []byte(`{}`))
+	if !errors.Is(err, ErrPublishNacked) {
+		t.Errorf("Публикация без подтверждения: %v, ожидалось ErrPublishNacked", err)
+	}
+}
+
+func TestNotificationQueueSubscriptionCancel(t *testing.T) {
+	broker := newFakeBroker()
+	nq := newTestQueue(t, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := nq.Subscribe(ctx, []string{RoutingKey}, func(string, string, []byte) {}); err != nil {
+		t.Fatalf("Ошибка подписки: %v", err)
+	}
+	cancel()
+	waitFor(t, "отмена подписки", func() bool {
+		nq.mu.Lock()
+		defer nq.mu.Unlock()
+		return len(nq.subscriptions) == 0
+	})
+
+	// Штатное закрытие канала подписки не считается потерей соединения
+	time.Sleep(20 * time.Millisecond)
+	if dials := broker.dialCount(); dials != 1 {
+		t.Errorf("Подключений: %d, ожидалось 1", dials)
+	}
+}
+
+func TestNotificationQueueUpgradesLegacyTopology(t *testing.T) {
+	broker := newFakeBroker()
+	// Очереди предыдущей версии объявлены без аргументов
+	for _, name := range []string{"notifications", "scan_verdicts", "domain_events"} {
+		broker.args[name] = nil
+	}
+	broker.bindings["notifications"] = []fakeBinding{{ExchangeName, RoutingKey}}
+	broker.bindings["scan_verdicts"] = []fakeBinding{{ExchangeName, "scan.reject"}}
+	broker.ready["scan_verdicts"] = []amqp.Delivery{{RoutingKey: "scan.reject"}}
+	nq := newTestQueue(t, broker)
+
+	if !nq.Ready() {
+		t.Fatal("Очередь не готова после обновления топологии")
+	}
+	for _, queue := range []string{QueueName, ScanQueueName, DomainQueueName} {
+		if n := broker.count("queue " + queue); n != 1 {
+			t.Errorf("%s объявлена %d раз, ожидалась 1", queue, n)
+		}
+	}
+
+	// Новые события идут только в новые очереди, а прежние дочитываются
+	if err := nq.Publish(context.Background(), RoutingKey, "1", []byte(`{}`)); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	if err := nq.Publish(context.Background(), "scan.reject", "2", []byte(`{}`)); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+
+	// Очереди прежних версий сохраняются вместе с непрочитанными сообщениями
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.ready["notifications"]) != 0 || len(broker.ready[QueueName]) != 1 {
+		t.Errorf("new_message: в notifications %d, в %s %d, ожидалось 0 и 1", len(broker.ready["notifications"]), QueueName, len(broker.ready[QueueName]))
+	}
+	if len(broker.ready["scan_verdicts"]) != 1 {
+		t.Error("Потеряны непрочитанные вердикты очереди scan_verdicts")
+	}
+	if _, ok := broker.args["domain_events"]; !ok {
+		t.Error("Удалена очередь domain_events")
+	}
+}
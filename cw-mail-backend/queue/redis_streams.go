@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+
+const (
+	// StreamName — поток Redis, в который публикуются уведомления
+	StreamName = ExchangeName
+
+	// StreamBlock — сколько подписка ждет новых записей в одном XREAD
+	StreamBlock = 5 * time.Second
+	// StreamRetryDelay — пауза перед повтором чтения после ошибки Redis
+	StreamRetryDelay = time.Second
+)
+
+
+// RedisStreams публикует уведомления в поток Redis. Каждая запись содержит
+// поля routing_key, message_id и body. Поток обрезается примерно до MaxLen
+// записей; внешние потребители читают его через группы потребителей.
+type RedisStreams struct {
+	Client *redis.Client
+	Stream string
+	MaxLen int64
+}
+
+
+func NewRedisStreams(client *redis.Client, maxLen int64) *RedisStreams {
+	return &RedisStreams{
+		Client: client,
+		Stream: StreamName,
+		MaxLen: maxLen,
+	}
+}
+
+
+func (rs *RedisStreams) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, PublishTimeout)
+	defer cancel()
+
+	err := rs.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: rs.Stream,
+		MaxLen: rs.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"routing_key": routingKey,
+			"message_id":  messageID,
+			"body":        body,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish notification: %w", err)
+	}
+	return nil
+}
+
+
+// Subscribe читает поток с записи, последней на момент вызова, поэтому, как
+// и временная очередь RabbitMQ, получает только новые уведомления. После
+// ошибки Redis чтение продолжается с той же позиции.
+func (rs *RedisStreams) Subscribe(ctx context.Context, routingKeys []string, handler Handler) error {
+	keys := make(map[string]bool, len(routingKeys))
+	for _, key := range routingKeys {
+		keys[key] = true
+	}
+
+	last := "$"
+	latest, err := rs.Client.XRevRangeN(ctx, rs.Stream, "+", "-", 1).Result()
+	switch {
+	case err != nil:
+		log.Printf("Не удалось прочитать позицию потока %s: %v", rs.Stream, err)
+	case len(latest) > 0:
+		last = latest[0].ID
+	default:
+		last = "0-0"
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			streams, err := rs.Client.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{rs.Stream, last},
+				Count:   100,
+				Block:   StreamBlock,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Ошибка чтения потока %s: %v", rs.Stream, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(StreamRetryDelay):
+				}
+				continue
+			}
+
+			for _, stream := range streams {
+				for _, message := range stream.Messages {
+					last = message.ID
+					routingKey, _ := message.Values["routing_key"].(string)
+					if !keys[routingKey] {
+						continue
+					}
+					messageID, _ := message.Values["message_id"].(string)
+					body, _ := message.Values["body"].(string)
+					handler(routingKey, messageID, []byte(body))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+
+func (rs *RedisStreams) Ready() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return rs.Client.Ping(ctx).Err() == nil
+}
+
+
+// Close ничего не делает: клиентом Redis владеет вызывающий код.
+func (rs *RedisStreams) Close() error {
+	return nil
+}
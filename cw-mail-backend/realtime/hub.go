@@ -0,0 +1,155 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+
+// SubscriptionBuffer — сколько событий подписка может не забрать, прежде чем
+// хаб отключит ее как отстающую. Отключенный клиент переподключается с
+// Last-Event-ID и получает пропущенное из истории.
+const SubscriptionBuffer = 64
+
+
+// Event — событие для клиента. ID — идентификатор события в outbox; по нему
+// клиент возобновляет поток после переподключения.
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+
+	seq uint64
+}
+
+
+// Subscription — подключение клиента. Канал Events закрывается, когда
+// подписка отменена или отключена хабом.
+type Subscription struct {
+	Events <-chan Event
+
+	events chan Event
+	userID uint
+	types  map[string]bool
+	hub    *Hub
+}
+
+
+// Hub рассылает события подключенным клиентам по их пользователям и хранит
+// последние события каждого пользователя для возобновления потока.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[*Subscription]struct{}
+	history     map[uint][]Event
+	historySize int
+}
+
+
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		subscribers: make(map[uint]map[*Subscription]struct{}),
+		history:     make(map[uint][]Event),
+		historySize: historySize,
+	}
+}
+
+
+// Subscribe подписывает клиента на события пользователя. Пустой types
+// означает все типы. Если задан lastEventID, сначала в подписку попадают
+// сохраненные события новее него.
+func (h *Hub) Subscribe(userID uint, types []string, lastEventID string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{userID: userID, hub: h}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	var replay []Event
+	if last, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		for _, event := range h.history[userID] {
+			if event.seq > last && sub.accepts(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub.events = make(chan Event, len(replay)+SubscriptionBuffer)
+	sub.Events = sub.events
+	for _, event := range replay {
+		sub.events <- event
+	}
+
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+	return sub
+}
+
+
+// Close отменяет подписку. Повторный вызов ничего не делает.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+
+func (s *Subscription) accepts(event Event) bool {
+	return s.types == nil || s.types[event.Type]
+}
+
+
+// Publish отправляет событие всем подпискам пользователя. События с ID
+// сохраняются в истории.
+func (h *Hub) Publish(userID uint, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if seq, err := strconv.ParseUint(event.ID, 10, 64); err == nil && h.historySize > 0 {
+		event.seq = seq
+		history := append(h.history[userID], event)
+		if len(history) > h.historySize {
+			history = history[len(history)-h.historySize:]
+		}
+		h.history[userID] = history
+	}
+
+	for sub := range h.subscribers[userID] {
+		if !sub.accepts(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+
+// Connections возвращает число подключений пользователя.
+func (h *Hub) Connections(userID uint) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[userID])
+}
+
+
+func (h *Hub) remove(sub *Subscription) {
+	subs := h.subscribers[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
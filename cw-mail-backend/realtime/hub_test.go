@@ -0,0 +1,106 @@
+package realtime
+
+import (
+	"strconv"
+	"testing"
+)
+
+func receive(t *testing.T, sub *Subscription) []Event {
+	t.Helper()
+
+	var events []Event
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestHubDeliversToUserSubscriptions(t *testing.T) {
+	hub := NewHub(10)
+	first := hub.Subscribe(1, nil, "")
+	second := hub.Subscribe(1, []string{"new_message"}, "")
+	other := hub.Subscribe(2, nil, "")
+
+	hub.HandleNotification("new_message", "7", []byte(`{"message_id":3,"sender_id":2,"receiver_id":1}`))
+	hub.Publish(1, Event{ID: "8", Type: "message.read"})
+
+	if events := receive(t, first); len(events) != 2 || events[0].ID != "7" || string(events[0].Data) != `{"message_id":3,"sender_id":2,"receiver_id":1}` {
+		t.Errorf("Подписка получает все события пользователя: %+v", events)
+	}
+	if events := receive(t, second); len(events) != 1 || events[0].Type != "new_message" {
+		t.Errorf("Подписка с types получает только указанные типы: %+v", events)
+	}
+	if events := receive(t, other); len(events) != 0 {
+		t.Errorf("События не должны попадать к другим пользователям: %+v", events)
+	}
+
+	first.Close()
+	first.Close()
+	if hub.Connections(1) != 1 {
+		t.Errorf("Закрытая подписка должна удаляться, подключений: %d", hub.Connections(1))
+	}
+}
+
+func TestHubNotificationRecipients(t *testing.T) {
+	hub := NewHub(10)
+	sender := hub.Subscribe(1, nil, "")
+	receiver := hub.Subscribe(2, nil, "")
+
+	hub.HandleNotification("message.read", "1", []byte(`{"message_id":3,"sender_id":1,"receiver_id":2}`))
+	hub.HandleNotification("message.destroyed", "2", []byte(`{"message_id":3,"sender_id":1,"receiver_id":2}`))
+	hub.HandleNotification("message.labeled", "3", []byte(`{"message_id":4,"user_id":1,"from":"inbox","label":"trash"}`))
+	hub.HandleNotification("user.registered", "4", []byte(`{"user_id":2}`))
+
+	if events := receive(t, sender); len(events) != 2 || events[0].Type != "message.destroyed" || events[1].Type != "message.labeled" {
+		t.Errorf("События отправителя: %+v", events)
+	}
+	if events := receive(t, receiver); len(events) != 2 || events[0].Type != "message.read" || events[1].Type != "message.destroyed" {
+		t.Errorf("События получателя: %+v", events)
+	}
+}
+
+func TestHubResumesFromLastEventID(t *testing.T) {
+	hub := NewHub(3)
+	for id := 1; id <= 5; id++ {
+		hub.Publish(1, Event{ID: strconv.Itoa(id), Type: "new_message"})
+	}
+	hub.Publish(1, Event{Type: "heartbeat"})
+
+	events := receive(t, hub.Subscribe(1, nil, "3"))
+	if len(events) != 2 || events[0].ID != "4" || events[1].ID != "5" {
+		t.Errorf("Ожидались события новее 3: %+v", events)
+	}
+
+	events = receive(t, hub.Subscribe(1, nil, "0"))
+	if len(events) != 3 || events[0].ID != "3" {
+		t.Errorf("История ограничена последними событиями: %+v", events)
+	}
+
+	if events := receive(t, hub.Subscribe(1, nil, "")); len(events) != 0 {
+		t.Errorf("Новое подключение без Last-Event-ID не получает историю: %+v", events)
+	}
+}
+
+func TestHubDropsSlowSubscription(t *testing.T) {
+	hub := NewHub(0)
+	sub := hub.Subscribe(1, nil, "")
+
+	for i := 0; i <= SubscriptionBuffer; i++ {
+		hub.Publish(1, Event{Type: "new_message"})
+	}
+
+	if events := receive(t, sub); len(events) != SubscriptionBuffer {
+		t.Errorf("Ожидалось %d событий до отключения, получено %d", SubscriptionBuffer, len(events))
+	}
+	if _, ok := <-sub.Events; ok || hub.Connections(1) != 0 {
+		t.Error("Отстающая подписка должна отключаться")
+	}
+	sub.Close()
+}
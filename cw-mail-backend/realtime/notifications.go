@@ -0,0 +1,31 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/mail-service/queue"
+)
+
+
+// RoutingKeys возвращает ключи уведомлений, которые хаб доставляет клиентам.
+func RoutingKeys() []string {
+	return queue.UserRoutingKeys()
+}
+
+
+// HandleNotification доставляет уведомление из брокера подключенным
+// пользователям, которых оно касается (queue.EventUsers). Тип события
+// совпадает с ключом маршрутизации, а данные — с телом уведомления.
+func (h *Hub) HandleNotification(routingKey, messageID string, body []byte) {
+	users, err := queue.EventUsers(routingKey, body)
+	if err != nil {
+		log.Printf("Ошибка разбора уведомления %s: %v", routingKey, err)
+		return
+	}
+
+	event := Event{ID: messageID, Type: routingKey, Data: json.RawMessage(body)}
+	for _, userID := range users {
+		h.Publish(userID, event)
+	}
+}
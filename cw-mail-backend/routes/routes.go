@@ -2,19 +2,50 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/mail-service/audit"
 	"github.com/mail-service/config"
 	"github.com/mail-service/controllers"
+	"github.com/mail-service/lockout"
+	"github.com/mail-service/mailer"
 	"github.com/mail-service/middleware"
+	"github.com/mail-service/models"
+	"github.com/mail-service/privacy"
 	"github.com/mail-service/queue"
+	"github.com/mail-service/realtime"
+	"github.com/mail-service/scanner"
+	"github.com/mail-service/webhook"
 	"gorm.io/gorm"
 )
 
 
-func SetupRoutes(router *gin.Engine, db *gorm.DB, cfg *config.Config, notifyQueue *queue.NotificationQueue) {
+func SetupRoutes(router *gin.Engine, db *gorm.DB, cfg *config.Config, m mailer.Mailer, guard *lockout.Guard, auditLog *audit.Logger, privacyService *privacy.Service, scan *scanner.Hook, hub *realtime.Hub, bus queue.EventPublisher, webhooks *webhook.Service) {
 
-	authController := controllers.NewAuthController(db, cfg)
-	userController := controllers.NewUserController(db)
-	messageController := controllers.NewMessageController(db, notifyQueue, nil)
+	// Повторная отправка недоставленных событий есть только у RabbitMQ
+	replayer, _ := bus.(controllers.DeadLetterReplayer)
+
+	authController := controllers.NewAuthController(db, cfg, m, guard, auditLog)
+	userController := controllers.NewUserController(db, cfg, auditLog)
+	mfaController := controllers.NewMFAController(db, cfg, guard, auditLog)
+	adminController := controllers.NewAdminController(db, guard, auditLog, privacyService)
+	accountController := controllers.NewAccountController(db, cfg, privacyService, auditLog)
+	auditController := controllers.NewAuditController(db)
+	tokenController := controllers.NewTokenController(db, auditLog)
+	messageController := controllers.NewMessageController(db, cfg, scan, auditLog)
+	contactController := controllers.NewContactController(db)
+	listController := controllers.NewDistributionListController(db, cfg)
+	aliasController := controllers.NewAliasController(db, cfg, auditLog)
+	blockedSenderController := controllers.NewBlockedSenderController(db)
+	filterController := controllers.NewFilterController(db)
+	sieveController := controllers.NewSieveController(db)
+	vacationController := controllers.NewVacationController(db)
+	spamController := controllers.NewSpamController(db)
+	quarantineController := controllers.NewQuarantineController(db, cfg, auditLog)
+	realtimeController := controllers.NewRealtimeController(db, hub, cfg)
+	deadLetterController := controllers.NewDeadLetterController(db, replayer, auditLog)
+	webhookController := controllers.NewWebhookController(db, webhooks, cfg, auditLog, models.WebhookScopeUser)
+	adminWebhookController := controllers.NewWebhookController(db, webhooks, cfg, auditLog, models.WebhookScopeAdmin)
+	healthController := controllers.NewHealthController(db, bus)
+	eventCatalogController := controllers.NewEventCatalogController()
 
 
 	api := router.Group("/api")
@@ -24,6 +55,33 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, cfg *config.Config, notifyQueu
 		{
 			public.POST("/auth/register", authController.Register)
 			public.POST("/auth/login", authController.Login)
+			public.POST("/auth/login/mfa", mfaController.Login)
+			public.POST("/auth/login/mfa/enroll", mfaController.LoginEnroll)
+			public.POST("/auth/login/mfa/enroll/confirm", mfaController.LoginEnrollConfirm)
+			public.GET("/auth/verify-email", authController.VerifyEmail)
+			public.POST("/auth/verify-email", authController.VerifyEmail)
+			public.GET("/users/:id/avatar", userController.GetAvatar)
+			public.GET("/health/live", healthController.Live)
+			public.GET("/health/ready", healthController.Ready)
+			public.GET("/events/schemas", eventCatalogController.ListEventTypes)
+			public.GET("/events/schemas/:routing_key", eventCatalogController.GetEventSchema)
+		}
+
+
+		// EventSource и WebSocket не позволяют задать заголовки, поэтому токен
+		// можно передать в параметре access_token. Его значение скрывается в
+		// журнале запросов (middleware.RedactedLogger)
+		events := api.Group("/events")
+		events.Use(
+			middleware.TokenFromQuery("access_token"),
+			middleware.JWTAuthMiddleware(cfg, db),
+			middleware.RequirePasswordCurrent(),
+			middleware.RequireScope(models.ScopeMessagesRead),
+			middleware.RequireVerifiedEmail(cfg.Verification.RestrictReading),
+		)
+		{
+			events.GET("/stream", realtimeController.Stream)
+			events.GET("/ws", realtimeController.WebSocket)
 		}
 
 
@@ -33,25 +91,198 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, cfg *config.Config, notifyQueu
 
 			users := protected.Group("/users")
 			{
-				users.GET("/me", userController.GetCurrentUser)
+				users.GET("/me", middleware.RequireScope(models.ScopeProfileRead), userController.GetCurrentUser)
+				users.PUT("/me/password", middleware.RequireSessionAuth(), userController.ChangePassword)
+				users.GET("/:id/card", middleware.RequireScope(models.ScopeProfileRead), userController.GetUserCard)
 			}
 
 
 			auth := protected.Group("/auth")
 			{
-				auth.GET("/me", userController.GetCurrentUser)
+				auth.GET("/me", middleware.RequireScope(models.ScopeProfileRead), userController.GetCurrentUser)
+			}
+
+
+			// Остальные маршруты недоступны, пока администратор требует смены пароля
+			active := protected.Group("")
+			active.Use(middleware.RequirePasswordCurrent())
+
+
+			profile := active.Group("/users/me")
+			{
+				profile.GET("/profile", middleware.RequireScope(models.ScopeProfileRead), userController.GetProfile)
+				profile.PUT("/profile", middleware.RequireScope(models.ScopeProfileWrite), userController.UpdateProfile)
+				profile.POST("/avatar", middleware.RequireScope(models.ScopeProfileWrite), userController.UploadAvatar)
+				profile.DELETE("/avatar", middleware.RequireScope(models.ScopeProfileWrite), userController.DeleteAvatar)
+				profile.GET("/aliases", middleware.RequireScope(models.ScopeProfileRead), aliasController.ListAliases)
+				profile.POST("/aliases", middleware.RequireScope(models.ScopeProfileWrite), aliasController.CreateAlias)
+				profile.DELETE("/aliases/:id", middleware.RequireScope(models.ScopeProfileWrite), aliasController.DeleteAlias)
+				profile.GET("/blocked-senders", middleware.RequireScope(models.ScopeProfileRead), blockedSenderController.ListBlockedSenders)
+				profile.POST("/blocked-senders", middleware.RequireScope(models.ScopeProfileWrite), blockedSenderController.BlockSender)
+				profile.PUT("/blocked-senders/action", middleware.RequireScope(models.ScopeProfileWrite), blockedSenderController.UpdateBlockAction)
+				profile.DELETE("/blocked-senders/:id", middleware.RequireScope(models.ScopeProfileWrite), blockedSenderController.UnblockSender)
+				profile.GET("/vacation", middleware.RequireScope(models.ScopeProfileRead), vacationController.GetVacation)
+				profile.PUT("/vacation", middleware.RequireScope(models.ScopeProfileWrite), vacationController.UpdateVacation)
+				profile.GET("/spam", middleware.RequireScope(models.ScopeProfileRead), spamController.GetSettings)
+				profile.PUT("/spam", middleware.RequireScope(models.ScopeProfileWrite), spamController.UpdateSettings)
+			}
+
+
+			session := active.Group("")
+			session.Use(middleware.RequireSessionAuth())
+			{
+				session.POST("/auth/verify-email/resend", authController.ResendVerification)
+				session.POST("/auth/mfa/enroll", mfaController.Enroll)
+				session.POST("/auth/mfa/confirm", mfaController.Confirm)
+				session.POST("/auth/mfa/disable", mfaController.Disable)
+				session.POST("/auth/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes)
+
+				session.GET("/tokens", tokenController.ListTokens)
+				session.POST("/tokens", tokenController.CreateToken)
+				session.DELETE("/tokens/:id", tokenController.RevokeToken)
+
+				session.POST("/users/me/exports", accountController.RequestExport)
+				session.GET("/users/me/exports", accountController.ListExports)
+				session.GET("/users/me/exports/:id", accountController.GetExport)
+				session.GET("/users/me/exports/:id/download", accountController.DownloadExport)
+				session.POST("/users/me/deletion", accountController.ScheduleDeletion)
+				session.DELETE("/users/me/deletion", accountController.CancelDeletion)
+
+				session.GET("/webhooks", webhookController.ListWebhooks)
+				session.POST("/webhooks", webhookController.CreateWebhook)
+				session.GET("/webhooks/:id", webhookController.GetWebhook)
+				session.PUT("/webhooks/:id", webhookController.UpdateWebhook)
+				session.DELETE("/webhooks/:id", webhookController.DeleteWebhook)
+				session.GET("/webhooks/:id/deliveries", webhookController.ListDeliveries)
+				session.POST("/webhooks/:id/test", webhookController.SendTestEvent)
+			}
+
+
+			read := middleware.RequireScope(models.ScopeMessagesRead)
+			write := middleware.RequireScope(models.ScopeMessagesWrite)
+
+			messages := active.Group("/messages")
+			messages.Use(middleware.RequireVerifiedEmail(cfg.Verification.RestrictReading))
+			{
+				messages.POST("", middleware.RequireScope(models.ScopeMessagesSend), middleware.RequireVerifiedEmail(cfg.Verification.RestrictSending), messageController.SendMessage)
+				messages.GET("/inbox", read, messageController.GetInbox)
+				messages.GET("/sent", read, messageController.GetSent)
+				messages.GET("/spam", read, messageController.GetSpam)
+				messages.GET("/trash", read, messageController.GetTrash)
+				messages.GET("/:id", read, messageController.GetMessageByID)
+				messages.PUT("/:id/label", write, messageController.UpdateLabel)
+				messages.PUT("/:id/star", write, messageController.UpdateStar)
+				messages.POST("/:id/block-sender", write, messageController.BlockSender)
+				messages.POST("/:id/not-spam", write, messageController.NotSpam)
 			}
 
 
-			messages := protected.Group("/messages")
+			contactsRead := middleware.RequireScope(models.ScopeContactsRead)
+			contactsWrite := middleware.RequireScope(models.ScopeContactsWrite)
+
+			contacts := active.Group("/contacts")
 			{
-				messages.POST("", messageController.SendMessage)
-				messages.GET("/inbox", messageController.GetInbox)
-				messages.GET("/sent", messageController.GetSent)
-				messages.GET("/spam", messageController.GetSpam)
-				messages.GET("/trash", messageController.GetTrash)
-				messages.GET("/:id", messageController.GetMessageByID)
-				messages.PUT("/:id/label", messageController.UpdateLabel)
+				contacts.GET("", contactsRead, contactController.ListContacts)
+				contacts.POST("", contactsWrite, contactController.CreateContact)
+				contacts.GET("/frequent", contactsRead, contactController.FrequentContacts)
+				contacts.GET("/autocomplete", contactsRead, contactController.Autocomplete)
+				contacts.POST("/import", contactsWrite, contactController.ImportContacts)
+				contacts.GET("/export", contactsRead, contactController.ExportContacts)
+				contacts.GET("/groups", contactsRead, contactController.ListGroups)
+				contacts.POST("/groups", contactsWrite, contactController.CreateGroup)
+				contacts.PUT("/groups/:id", contactsWrite, contactController.RenameGroup)
+				contacts.DELETE("/groups/:id", contactsWrite, contactController.DeleteGroup)
+				contacts.GET("/:id", contactsRead, contactController.GetContact)
+				contacts.PUT("/:id", contactsWrite, contactController.UpdateContact)
+				contacts.DELETE("/:id", contactsWrite, contactController.DeleteContact)
+			}
+
+
+			listsRead := middleware.RequireScope(models.ScopeListsRead)
+			listsWrite := middleware.RequireScope(models.ScopeListsWrite)
+
+			lists := active.Group("/lists")
+			{
+				lists.GET("", listsRead, listController.ListMyLists)
+				lists.POST("", listsWrite, listController.CreateList)
+				lists.GET("/:id", listsRead, listController.GetList)
+				lists.PUT("/:id", listsWrite, listController.UpdateList)
+				lists.DELETE("/:id", listsWrite, listController.DeleteList)
+				lists.GET("/:id/members", listsRead, listController.ListMembers)
+				lists.POST("/:id/members", listsWrite, listController.AddMember)
+				lists.DELETE("/:id/members/:user_id", listsWrite, listController.RemoveMember)
+			}
+
+
+			filtersRead := middleware.RequireScope(models.ScopeFiltersRead)
+			filtersWrite := middleware.RequireScope(models.ScopeFiltersWrite)
+
+			filters := active.Group("/filters")
+			{
+				filters.GET("", filtersRead, filterController.ListRules)
+				filters.POST("", filtersWrite, filterController.CreateRule)
+				filters.PUT("/order", filtersWrite, filterController.ReorderRules)
+				filters.POST("/dry-run", filtersRead, filterController.DryRun)
+				filters.GET("/:id", filtersRead, filterController.GetRule)
+				filters.PUT("/:id", filtersWrite, filterController.UpdateRule)
+				filters.DELETE("/:id", filtersWrite, filterController.DeleteRule)
+				filters.POST("/:id/dry-run", filtersRead, filterController.DryRunRule)
+				filters.POST("/:id/apply", filtersWrite, filterController.ApplyRule)
+			}
+
+
+			sieve := active.Group("/sieve")
+			{
+				sieve.GET("/scripts", filtersRead, sieveController.ListScripts)
+				sieve.POST("/scripts", filtersWrite, sieveController.CreateScript)
+				sieve.POST("/scripts/check", filtersRead, sieveController.CheckScript)
+				sieve.GET("/scripts/:id", filtersRead, sieveController.GetScript)
+				sieve.PUT("/scripts/:id", filtersWrite, sieveController.UpdateScript)
+				sieve.DELETE("/scripts/:id", filtersWrite, sieveController.DeleteScript)
+				sieve.PUT("/active", filtersWrite, sieveController.SetActiveScript)
+			}
+
+
+			admin := active.Group("/admin")
+			admin.Use(middleware.RequireSessionAuth(), middleware.RequireAdmin())
+			{
+				admin.GET("/users", adminController.ListUsers)
+				admin.GET("/users/:id", adminController.GetUser)
+				admin.GET("/users/:id/stats", adminController.GetUserStats)
+				admin.PUT("/users/:id/role", adminController.UpdateUserRole)
+				admin.POST("/users/:id/disable", adminController.DisableUser)
+				admin.POST("/users/:id/enable", adminController.EnableUser)
+				admin.POST("/users/:id/force-password-reset", adminController.ForcePasswordReset)
+				admin.DELETE("/users/:id", adminController.DeleteUser)
+				admin.GET("/users/:id/lockout", adminController.GetLockoutStatus)
+				admin.POST("/users/:id/unlock", adminController.UnlockUser)
+				admin.GET("/users/:id/aliases", aliasController.AdminListAliases)
+				admin.POST("/users/:id/aliases", aliasController.AdminCreateAlias)
+				admin.DELETE("/users/:id/aliases/:alias_id", aliasController.AdminDeleteAlias)
+				admin.PUT("/users/:id/alias-quota", aliasController.UpdateAliasQuota)
+
+				admin.GET("/lists", listController.ListAllLists)
+
+				admin.GET("/quarantine", quarantineController.ListQuarantine)
+				admin.GET("/quarantine/:id", quarantineController.GetQuarantinedMessage)
+				admin.POST("/quarantine/:id/release", quarantineController.ReleaseMessage)
+				admin.DELETE("/quarantine/:id", quarantineController.DeleteMessage)
+
+				admin.GET("/dead-letters", deadLetterController.ListDeadLetters)
+				admin.GET("/dead-letters/:id", deadLetterController.GetDeadLetter)
+				admin.POST("/dead-letters/:id/replay", deadLetterController.ReplayDeadLetter)
+				admin.DELETE("/dead-letters/:id", deadLetterController.DiscardDeadLetter)
+
+				admin.GET("/webhooks", adminWebhookController.ListWebhooks)
+				admin.POST("/webhooks", adminWebhookController.CreateWebhook)
+				admin.GET("/webhooks/:id", adminWebhookController.GetWebhook)
+				admin.PUT("/webhooks/:id", adminWebhookController.UpdateWebhook)
+				admin.DELETE("/webhooks/:id", adminWebhookController.DeleteWebhook)
+				admin.GET("/webhooks/:id/deliveries", adminWebhookController.ListDeliveries)
+				admin.POST("/webhooks/:id/test", adminWebhookController.SendTestEvent)
+
+				admin.GET("/audit", auditController.ListAuditLogs)
+				admin.GET("/audit/export", auditController.ExportAuditLogs)
 			}
 		}
 	}
@@ -0,0 +1,173 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+
+const (
+	DefaultClamAVTimeout   = 30 * time.Second
+	DefaultClamAVChunkSize = 64 << 10
+)
+
+
+// ClamAV проверяет письма демоном clamd по его протоколу: каждая часть
+// передается командой zINSTREAM блоками с 4-байтной длиной (big-endian),
+// поток завершается блоком нулевой длины. Ответы clamd завершаются нулевым
+// байтом.
+type ClamAV struct {
+	// Network — "tcp" или "unix".
+	Network string
+	Address string
+	Timeout time.Duration
+	// ChunkSize — размер блока INSTREAM; не должен превышать StreamMaxLength
+	// в настройках clamd.
+	ChunkSize int
+	// InfectedVerdict применяется к письму, в котором найдена сигнатура.
+	InfectedVerdict Verdict
+}
+
+
+// NewClamAV создает клиент clamd. Адрес вида unix:/path/clamd.sock задает
+// Unix-сокет, иначе используется TCP (host:port).
+func NewClamAV(address string, timeout time.Duration, infected Verdict) *ClamAV {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+	}
+	return &ClamAV{
+		Network:         network,
+		Address:         address,
+		Timeout:         timeout,
+		ChunkSize:       DefaultClamAVChunkSize,
+		InfectedVerdict: infected,
+	}
+}
+
+
+func (c *ClamAV) Name() string {
+	return "clamav"
+}
+
+
+// Ping проверяет, что clamd доступен.
+func (c *ClamAV) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "zPING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: неожиданный ответ на PING: %q", reply)
+	}
+	return nil
+}
+
+
+// Scan проверяет части письма по очереди и останавливается на первой
+// найденной сигнатуре.
+func (c *ClamAV) Scan(ctx context.Context, content Content) (Result, error) {
+	for _, part := range content.Parts {
+		reply, err := c.command(ctx, "zINSTREAM", part.Data)
+		if err != nil {
+			return Result{}, err
+		}
+
+		signature, infected, err := parseScanReply(reply)
+		if err != nil {
+			return Result{}, err
+		}
+		if infected {
+			return Result{Verdict: c.InfectedVerdict, Scanner: c.Name(), Reason: part.Name + ": " + signature}, nil
+		}
+	}
+
+	return Result{Verdict: VerdictClean, Scanner: c.Name()}, nil
+}
+
+
+// command выполняет одну команду в отдельном соединении. Для zINSTREAM data
+// передается потоком.
+func (c *ClamAV) command(ctx context.Context, name string, data []byte) (string, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultClamAVTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte(name + "\x00")); err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	if name == "zINSTREAM" {
+		if err := c.stream(conn, data); err != nil {
+			return "", fmt.Errorf("clamd: %w", err)
+		}
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+
+func (c *ClamAV) stream(conn net.Conn, data []byte) error {
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultClamAVChunkSize
+	}
+
+	var size [4]byte
+	for len(data) > 0 {
+		chunk := data[:min(chunkSize, len(data))]
+		data = data[len(chunk):]
+
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		if _, err := conn.Write(size[:]); err != nil {
+			return err
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint32(size[:], 0)
+	_, err := conn.Write(size[:])
+	return err
+}
+
+
+// parseScanReply разбирает ответ вида "stream: OK",
+// "stream: Eicar-Signature FOUND" или "... ERROR".
+func parseScanReply(reply string) (signature string, infected bool, err error) {
+	result := reply
+	if i := strings.Index(reply, ": "); i >= 0 {
+		result = reply[i+2:]
+	}
+
+	switch {
+	case result == "OK":
+		return "", false, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), true, nil
+	default:
+		return "", false, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd — минимальный clamd: отвечает на zPING и zINSTREAM и находит в
+// потоке тестовую сигнатуру EICAR. Размеры полученных блоков сохраняются в
+// chunks.
+type fakeClamd struct {
+	listener net.Listener
+	chunks   chan []int
+	reply    string
+}
+
+func newFakeClamd(t *testing.T) *fakeClamd {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Ошибка запуска clamd: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	fake := &fakeClamd{listener: listener, chunks: make(chan []int, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	command, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch strings.TrimSuffix(command, "\x00") {
+	case "zPING":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM":
+		var data bytes.Buffer
+		var sizes []int
+		for {
+			var size uint32
+			if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			sizes = append(sizes, int(size))
+			if _, err := io.CopyN(&data, reader, int64(size)); err != nil {
+				return
+			}
+		}
+		f.chunks <- sizes
+
+		switch {
+		case f.reply != "":
+			conn.Write([]byte(f.reply + "\x00"))
+		case bytes.Contains(data.Bytes(), []byte(eicar)):
+			conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		default:
+			conn.Write([]byte("stream: OK\x00"))
+		}
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestClamAVPing(t *testing.T) {
+	fake := newFakeClamd(t)
+	clamav := NewClamAV(fake.listener.Addr().String(), time.Second, VerdictQuarantine)
+
+	if err := clamav.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() вернул ошибку: %v", err)
+	}
+}
+
+func TestClamAVScan(t *testing.T) {
+	fake := newFakeClamd(t)
+	clamav := NewClamAV(fake.listener.Addr().String(), time.Second, VerdictReject)
+	clamav.ChunkSize = 16
+
+	result, err := clamav.Scan(context.Background(), Content{Parts: []Part{{Name: "body", Data: []byte("Обычное письмо")}}})
+	if err != nil || result.Verdict != VerdictClean || result.Scanner != "clamav" {
+		t.Errorf("Чистое письмо: %+v, %v", result, err)
+	}
+	if sizes := <-fake.chunks; len(sizes) != 2 || sizes[0] != 16 || sizes[1] != 11 {
+		t.Errorf("Поток должен передаваться блоками по ChunkSize, получено %v", sizes)
+	}
+
+	result, err = clamav.Scan(context.Background(), Content{Parts: []Part{
+		{Name: "body", Data: []byte("Текст")},
+		{Name: "invoice.com", Data: []byte(eicar)},
+	}})
+	if err != nil || result.Verdict != VerdictReject || result.Reason != "invoice.com: Eicar-Test-Signature" {
+		t.Errorf("Зараженное письмо: %+v, %v", result, err)
+	}
+}
+
+func TestClamAVErrors(t *testing.T) {
+	fake := newFakeClamd(t)
+	fake.reply = "INSTREAM size limit exceeded. ERROR"
+	clamav := NewClamAV(fake.listener.Addr().String(), time.Second, VerdictQuarantine)
+
+	if _, err := clamav.Scan(context.Background(), Content{Parts: []Part{{Name: "body", Data: []byte("x")}}}); err == nil {
+		t.Error("Ответ ERROR должен возвращать ошибку")
+	}
+
+	hook := &Hook{Scanner: clamav, FailureVerdict: VerdictQuarantine}
+	if result := hook.Check(context.Background(), Content{Parts: []Part{{Name: "body", Data: []byte("x")}}}); result.Verdict != VerdictQuarantine || result.Reason == "" {
+		t.Errorf("При ошибке сканера применяется FailureVerdict: %+v", result)
+	}
+
+	fake.listener.Close()
+	if err := clamav.Ping(context.Background()); err == nil {
+		t.Error("Недоступный clamd должен возвращать ошибку")
+	}
+}
+
+func TestNilHook(t *testing.T) {
+	var hook *Hook
+	if result := hook.Check(context.Background(), Content{}); result.Verdict != VerdictClean {
+		t.Errorf("Нулевой Hook пропускает письма: %+v", result)
+	}
+	if hook.Notifies(VerdictReject) {
+		t.Error("Нулевой Hook не публикует уведомления")
+	}
+}
@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mail-service/config"
+)
+
+
+// Verdict — решение сканера о письме.
+type Verdict string
+
+
+const (
+	VerdictClean      Verdict = "clean"
+	VerdictQuarantine Verdict = "quarantine"
+	VerdictReject     Verdict = "reject"
+)
+
+
+// ParseVerdict разбирает вердикт из конфигурации.
+func ParseVerdict(value string) (Verdict, error) {
+	switch verdict := Verdict(strings.ToLower(strings.TrimSpace(value))); verdict {
+	case VerdictClean, VerdictQuarantine, VerdictReject:
+		return verdict, nil
+	default:
+		return "", fmt.Errorf("неизвестный вердикт сканера: %s", value)
+	}
+}
+
+
+// Part — проверяемая часть письма: тело или вложение.
+type Part struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+
+// Content — письмо, поступающее в почтовый ящик.
+type Content struct {
+	From    string
+	To      string
+	Subject string
+	Parts   []Part
+}
+
+
+// Result — вердикт сканера. Reason описывает причину для администратора,
+// например имя найденной сигнатуры.
+type Result struct {
+	Verdict Verdict `json:"verdict"`
+	Scanner string  `json:"scanner"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+
+// Scanner проверяет письмо до доставки. Ошибка означает, что проверить
+// письмо не удалось; вердикт в этом случае выбирает Hook.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, content Content) (Result, error)
+}
+
+
+// Hook вызывает сканер в конвейере отправки. Нулевой *Hook пропускает все
+// письма, поэтому его можно не передавать в тестах и при SCANNER_DRIVER=none.
+type Hook struct {
+	Scanner Scanner
+	// FailureVerdict применяется, если сканер недоступен или вернул ошибку.
+	FailureVerdict Verdict
+	// Notify — вердикты, о которых публикуются уведомления.
+	Notify map[Verdict]bool
+}
+
+
+// New создает Hook по настройкам. Для драйвера none возвращает nil.
+func New(cfg *config.Config) (*Hook, error) {
+	infected, err := ParseVerdict(cfg.Scanner.InfectedAction)
+	if err != nil {
+		return nil, fmt.Errorf("SCANNER_INFECTED_ACTION: %w", err)
+	}
+	failure, err := ParseVerdict(cfg.Scanner.FailureAction)
+	if err != nil {
+		return nil, fmt.Errorf("SCANNER_FAILURE_ACTION: %w", err)
+	}
+	notify := make(map[Verdict]bool)
+	for _, value := range strings.Split(cfg.Scanner.Notify, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		verdict, err := ParseVerdict(value)
+		if err != nil {
+			return nil, fmt.Errorf("SCANNER_NOTIFY: %w", err)
+		}
+		notify[verdict] = true
+	}
+
+	var s Scanner
+	switch cfg.Scanner.Driver {
+	case "", "none":
+		return nil, nil
+	case "clamav":
+		s = NewClamAV(cfg.Scanner.ClamAVAddress, cfg.Scanner.Timeout, infected)
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер сканера: %s", cfg.Scanner.Driver)
+	}
+
+	return &Hook{Scanner: s, FailureVerdict: failure, Notify: notify}, nil
+}
+
+
+// Check проверяет письмо. Ошибка сканера не прерывает отправку: письмо
+// получает FailureVerdict, а причина попадает в Reason.
+func (h *Hook) Check(ctx context.Context, content Content) Result {
+	if h == nil || h.Scanner == nil {
+		return Result{Verdict: VerdictClean}
+	}
+
+	result, err := h.Scanner.Scan(ctx, content)
+	if err != nil {
+		log.Printf("Ошибка сканера %s: %v", h.Scanner.Name(), err)
+		return Result{Verdict: h.FailureVerdict, Scanner: h.Scanner.Name(), Reason: "ошибка проверки: " + err.Error()}
+	}
+	if result.Scanner == "" {
+		result.Scanner = h.Scanner.Name()
+	}
+	return result
+}
+
+
+// Notifies сообщает, нужно ли публиковать уведомление о вердикте.
+func (h *Hook) Notifies(verdict Verdict) bool {
+	return h != nil && h.Notify[verdict]
+}
@@ -0,0 +1,604 @@
+package sieve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+)
+
+
+// compiler проверяет синтаксическое дерево и строит из него команды и тесты.
+type compiler struct {
+	required  map[string]bool
+	mailboxes []string
+}
+
+
+// Признак помеченного аргумента: флаг или тег со значением.
+const (
+	tagFlag = iota
+	tagValue
+)
+
+
+var (
+	matchTypeTags   = []string{MatchIs, MatchContains, MatchMatches}
+	addressPartTags = []string{PartAll, PartLocalpart, PartDomain}
+)
+
+
+func (c *compiler) require(extension string, line int, what string) error {
+	if !c.required[extension] {
+		return errorf(line, "%s requires require \"%s\"", what, extension)
+	}
+	return nil
+}
+
+
+func (c *compiler) block(nodes []*node, top bool) ([]command, error) {
+	var commands []command
+	var previousIf *ifCommand
+	requireAllowed := top
+
+	for _, n := range nodes {
+		if n.name != "require" {
+			requireAllowed = false
+		}
+		if n.name != "elsif" && n.name != "else" {
+			previousIf = nil
+		}
+
+		switch n.name {
+		case "require":
+			if !requireAllowed {
+				return nil, errorf(n.line, "require must come before other commands")
+			}
+			if err := c.compileRequire(n); err != nil {
+				return nil, err
+			}
+
+		case "if":
+			condition, body, err := c.conditional(n)
+			if err != nil {
+				return nil, err
+			}
+			previousIf = &ifCommand{tests: []test{condition}, blocks: [][]command{body}}
+			commands = append(commands, previousIf)
+
+		case "elsif":
+			if previousIf == nil {
+				return nil, errorf(n.line, "elsif without matching if")
+			}
+			condition, body, err := c.conditional(n)
+			if err != nil {
+				return nil, err
+			}
+			previousIf.tests = append(previousIf.tests, condition)
+			previousIf.blocks = append(previousIf.blocks, body)
+
+		case "else":
+			if previousIf == nil {
+				return nil, errorf(n.line, "else without matching if")
+			}
+			if len(n.args) > 0 || len(n.tests) > 0 || !n.hasBlock {
+				return nil, errorf(n.line, "else takes only a block")
+			}
+			body, err := c.block(n.block, false)
+			if err != nil {
+				return nil, err
+			}
+			previousIf.elseBlock = body
+			// После else цепочку продолжать нельзя
+			previousIf = nil
+
+		default:
+			if n.hasBlock {
+				return nil, errorf(n.line, "%s does not take a block", n.name)
+			}
+			if len(n.tests) > 0 {
+				return nil, errorf(n.line, "%s does not take a test", n.name)
+			}
+			action, err := c.action(n)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, action)
+		}
+	}
+
+	return commands, nil
+}
+
+
+func (c *compiler) compileRequire(n *node) error {
+	if len(n.args) != 1 || n.args[0].kind != tokenString || len(n.tests) > 0 || n.hasBlock {
+		return errorf(n.line, "require takes a string list")
+	}
+
+	for _, extension := range n.args[0].strings {
+		extension = strings.ToLower(extension)
+		if extension == "comparator-"+ComparatorOctet || extension == "comparator-"+ComparatorASCIICase {
+			continue
+		}
+		if !containsString(Extensions, extension) {
+			return errorf(n.line, "unsupported extension %q", extension)
+		}
+		c.required[extension] = true
+	}
+	return nil
+}
+
+
+func (c *compiler) conditional(n *node) (test, []command, error) {
+	if len(n.args) > 0 || len(n.tests) != 1 || !n.hasBlock {
+		return nil, nil, errorf(n.line, "%s takes a single test and a block", n.name)
+	}
+
+	condition, err := c.test(n.tests[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := c.block(n.block, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return condition, body, nil
+}
+
+
+// splitArguments отделяет помеченные аргументы от позиционных. spec задает
+// допустимые теги; значение тега со значением сохраняется вместо самого тега.
+// Помеченные аргументы должны идти перед позиционными.
+func splitArguments(n *node, spec map[string]int, positional int) (map[string]argument, []argument, error) {
+	tags := map[string]argument{}
+	var rest []argument
+
+	for i := 0; i < len(n.args); i++ {
+		arg := n.args[i]
+		if arg.kind != tokenTag {
+			rest = append(rest, arg)
+			continue
+		}
+		if len(rest) > 0 {
+			return nil, nil, errorf(arg.line, "tagged argument :%s must come before positional arguments", arg.tag)
+		}
+
+		kind, ok := spec[arg.tag]
+		if !ok {
+			return nil, nil, errorf(arg.line, "unknown tagged argument :%s for %s", arg.tag, n.name)
+		}
+		if _, duplicate := tags[arg.tag]; duplicate {
+			return nil, nil, errorf(arg.line, "duplicate tagged argument :%s", arg.tag)
+		}
+
+		tag := arg.tag
+		if kind == tagValue {
+			if i+1 >= len(n.args) || n.args[i+1].kind == tokenTag {
+				return nil, nil, errorf(arg.line, "tagged argument :%s requires a value", tag)
+			}
+			i++
+			arg = n.args[i]
+		}
+		tags[tag] = arg
+	}
+
+	if len(rest) != positional {
+		return nil, nil, errorf(n.line, "%s expects %d positional arguments, found %d", n.name, positional, len(rest))
+	}
+	return tags, rest, nil
+}
+
+
+// oneOf возвращает единственный указанный тег из группы или значение по
+// умолчанию. Взаимоисключающие теги (например, :is и :contains) — ошибка.
+func oneOf(n *node, tags map[string]argument, group []string, fallback string) (string, error) {
+	selected := ""
+	for _, tag := range group {
+		if _, ok := tags[tag]; !ok {
+			continue
+		}
+		if selected != "" {
+			return "", errorf(n.line, ":%s cannot be combined with :%s", tag, selected)
+		}
+		selected = tag
+	}
+	if selected == "" {
+		return fallback, nil
+	}
+	return selected, nil
+}
+
+
+func stringValue(arg argument, what string) (string, error) {
+	if arg.kind != tokenString || len(arg.strings) != 1 {
+		return "", errorf(arg.line, "%s must be a single string", what)
+	}
+	return arg.strings[0], nil
+}
+
+
+func stringListValue(arg argument, what string) ([]string, error) {
+	if arg.kind != tokenString {
+		return nil, errorf(arg.line, "%s must be a string list", what)
+	}
+	return arg.strings, nil
+}
+
+
+func numberValue(arg argument, what string) (int64, error) {
+	if arg.kind != tokenNumber {
+		return 0, errorf(arg.line, "%s must be a number", what)
+	}
+	return arg.number, nil
+}
+
+
+func withMatcherTags(spec map[string]int) map[string]int {
+	spec["comparator"] = tagValue
+	for _, tag := range matchTypeTags {
+		spec[tag] = tagFlag
+	}
+	return spec
+}
+
+
+func (c *compiler) matcher(n *node, tags map[string]argument) (matcher, error) {
+	m := matcher{comparator: ComparatorASCIICase}
+
+	if arg, ok := tags["comparator"]; ok {
+		comparator, err := stringValue(arg, ":comparator")
+		if err != nil {
+			return m, err
+		}
+		comparator = strings.ToLower(comparator)
+		if comparator != ComparatorOctet && comparator != ComparatorASCIICase {
+			return m, errorf(arg.line, "unsupported comparator %q", comparator)
+		}
+		m.comparator = comparator
+	}
+
+	matchType, err := oneOf(n, tags, matchTypeTags, MatchIs)
+	if err != nil {
+		return m, err
+	}
+	m.matchType = matchType
+	return m, nil
+}
+
+
+func (c *compiler) test(n *node) (test, error) {
+	switch n.name {
+	case "true", "false":
+		if len(n.args) > 0 || len(n.tests) > 0 {
+			return nil, errorf(n.line, "%s takes no arguments", n.name)
+		}
+		return constantTest(n.name == "true"), nil
+
+	case "not":
+		if len(n.args) > 0 || len(n.tests) != 1 {
+			return nil, errorf(n.line, "not takes a single test")
+		}
+		inner, err := c.test(n.tests[0])
+		if err != nil {
+			return nil, err
+		}
+		return notTest{inner}, nil
+
+	case "allof", "anyof":
+		if len(n.args) > 0 || len(n.tests) == 0 {
+			return nil, errorf(n.line, "%s takes a test list", n.name)
+		}
+		tests := make([]test, 0, len(n.tests))
+		for _, child := range n.tests {
+			inner, err := c.test(child)
+			if err != nil {
+				return nil, err
+			}
+			tests = append(tests, inner)
+		}
+		if n.name == "allof" {
+			return allOfTest(tests), nil
+		}
+		return anyOfTest(tests), nil
+	}
+
+	if len(n.tests) > 0 {
+		return nil, errorf(n.line, "%s does not take nested tests", n.name)
+	}
+
+	switch n.name {
+	case "header":
+		return c.headerTest(n)
+	case "address", "envelope":
+		return c.addressTest(n)
+	case "exists":
+		_, args, err := splitArguments(n, map[string]int{}, 1)
+		if err != nil {
+			return nil, err
+		}
+		headers, err := stringListValue(args[0], "header names")
+		if err != nil {
+			return nil, err
+		}
+		return existsTest{headers: headers}, nil
+	case "size":
+		return c.sizeTest(n)
+	case "body":
+		return c.bodyTest(n)
+	}
+
+	return nil, errorf(n.line, "unknown test %q", n.name)
+}
+
+
+func (c *compiler) headerTest(n *node) (test, error) {
+	tags, args, err := splitArguments(n, withMatcherTags(map[string]int{}), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.matcher(n, tags)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := stringListValue(args[0], "header names")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := stringListValue(args[1], "key list")
+	if err != nil {
+		return nil, err
+	}
+	return headerTest{matcher: m, headers: headers, keys: keys}, nil
+}
+
+
+func (c *compiler) addressTest(n *node) (test, error) {
+	envelope := n.name == "envelope"
+	if envelope {
+		if err := c.require("envelope", n.line, "envelope test"); err != nil {
+			return nil, err
+		}
+	}
+
+	spec := withMatcherTags(map[string]int{})
+	for _, tag := range addressPartTags {
+		spec[tag] = tagFlag
+	}
+	tags, args, err := splitArguments(n, spec, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.matcher(n, tags)
+	if err != nil {
+		return nil, err
+	}
+	part, err := oneOf(n, tags, addressPartTags, PartAll)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := stringListValue(args[0], "header names")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := stringListValue(args[1], "key list")
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope {
+		for i, header := range headers {
+			headers[i] = strings.ToLower(header)
+			if headers[i] != "from" && headers[i] != "to" {
+				return nil, errorf(n.line, "unsupported envelope part %q", header)
+			}
+		}
+	}
+
+	return addressTest{matcher: m, part: part, headers: headers, keys: keys, envelope: envelope}, nil
+}
+
+
+func (c *compiler) sizeTest(n *node) (test, error) {
+	tags, args, err := splitArguments(n, map[string]int{"over": tagFlag, "under": tagFlag}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison, err := oneOf(n, tags, []string{"over", "under"}, "")
+	if err != nil {
+		return nil, err
+	}
+	if comparison == "" {
+		return nil, errorf(n.line, "size requires :over or :under")
+	}
+	limit, err := numberValue(args[0], "size limit")
+	if err != nil {
+		return nil, err
+	}
+	return sizeTest{over: comparison == "over", limit: limit}, nil
+}
+
+
+func (c *compiler) bodyTest(n *node) (test, error) {
+	if err := c.require("body", n.line, "body test"); err != nil {
+		return nil, err
+	}
+
+	spec := withMatcherTags(map[string]int{"raw": tagFlag, "text": tagFlag})
+	tags, args, err := splitArguments(n, spec, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Письма сервиса — простой текст, поэтому :raw и :text совпадают
+	if _, err := oneOf(n, tags, []string{"raw", "text"}, "text"); err != nil {
+		return nil, err
+	}
+	m, err := c.matcher(n, tags)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := stringListValue(args[0], "key list")
+	if err != nil {
+		return nil, err
+	}
+	return bodyTest{matcher: m, keys: keys}, nil
+}
+
+
+func (c *compiler) action(n *node) (command, error) {
+	switch n.name {
+	case "keep", "discard", "stop":
+		if len(n.args) > 0 {
+			return nil, errorf(n.line, "%s takes no arguments", n.name)
+		}
+		return simpleCommand{name: n.name}, nil
+
+	case "fileinto", "redirect":
+		if n.name == "fileinto" {
+			if err := c.require("fileinto", n.line, "fileinto"); err != nil {
+				return nil, err
+			}
+		}
+		tags, args, err := splitArguments(n, map[string]int{"copy": tagFlag}, 1)
+		if err != nil {
+			return nil, err
+		}
+		_, withCopy := tags["copy"]
+		if withCopy {
+			if err := c.require("copy", n.line, ":copy"); err != nil {
+				return nil, err
+			}
+		}
+		target, err := stringValue(args[0], n.name+" argument")
+		if err != nil {
+			return nil, err
+		}
+
+		if n.name == "fileinto" {
+			if target == "" {
+				return nil, errorf(n.line, "fileinto requires a mailbox name")
+			}
+			if !containsString(c.mailboxes, target) {
+				c.mailboxes = append(c.mailboxes, target)
+			}
+			return fileIntoCommand{line: n.line, mailbox: target, copy: withCopy}, nil
+		}
+
+		address, err := parseAddress(target)
+		if err != nil {
+			return nil, errorf(n.line, "invalid redirect address %q", target)
+		}
+		return redirectCommand{line: n.line, address: address, copy: withCopy}, nil
+
+	case "reject":
+		if err := c.require("reject", n.line, "reject"); err != nil {
+			return nil, err
+		}
+		_, args, err := splitArguments(n, map[string]int{}, 1)
+		if err != nil {
+			return nil, err
+		}
+		reason, err := stringValue(args[0], "reject reason")
+		if err != nil {
+			return nil, err
+		}
+		return rejectCommand{line: n.line, reason: reason}, nil
+
+	case "vacation":
+		return c.vacation(n)
+	}
+
+	return nil, errorf(n.line, "unknown command %q", n.name)
+}
+
+
+func (c *compiler) vacation(n *node) (command, error) {
+	if err := c.require("vacation", n.line, "vacation"); err != nil {
+		return nil, err
+	}
+
+	spec := map[string]int{"days": tagValue, "subject": tagValue, "from": tagValue, "addresses": tagValue, "handle": tagValue, "mime": tagFlag}
+	tags, args, err := splitArguments(n, spec, 1)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tags["mime"]; ok {
+		return nil, errorf(n.line, "vacation :mime is not supported")
+	}
+
+	vacation := Vacation{Days: DefaultVacationDays}
+	if vacation.Reason, err = stringValue(args[0], "vacation reason"); err != nil {
+		return nil, err
+	}
+
+	if arg, ok := tags["days"]; ok {
+		days, err := numberValue(arg, ":days")
+		if err != nil {
+			return nil, err
+		}
+		vacation.Days = int(min(max(days, MinVacationDays), MaxVacationDays))
+	}
+	if arg, ok := tags["subject"]; ok {
+		if vacation.Subject, err = stringValue(arg, ":subject"); err != nil {
+			return nil, err
+		}
+	}
+	if arg, ok := tags["from"]; ok {
+		from, err := stringValue(arg, ":from")
+		if err != nil {
+			return nil, err
+		}
+		if vacation.From, err = parseAddress(from); err != nil {
+			return nil, errorf(arg.line, "invalid :from address %q", from)
+		}
+	}
+	if arg, ok := tags["addresses"]; ok {
+		addresses, err := stringListValue(arg, ":addresses")
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			parsed, err := parseAddress(address)
+			if err != nil {
+				return nil, errorf(arg.line, "invalid address %q in :addresses", address)
+			}
+			vacation.Addresses = append(vacation.Addresses, parsed)
+		}
+	}
+	if arg, ok := tags["handle"]; ok {
+		if vacation.Handle, err = stringValue(arg, ":handle"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Без :handle автоответы различаются по содержимому (RFC 5230, 4.2)
+	if vacation.Handle == "" {
+		sum := sha256.Sum256([]byte(vacation.Subject + "\x00" + vacation.From + "\x00" + vacation.Reason))
+		vacation.Handle = hex.EncodeToString(sum[:8])
+	}
+
+	return vacationCommand{line: n.line, vacation: vacation}, nil
+}
+
+
+func parseAddress(value string) (string, error) {
+	address, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,289 @@
+package sieve
+
+
+// execution — состояние выполнения скрипта для одного письма.
+type execution struct {
+	message      *Message
+	result       *Result
+	explicitKeep bool
+	cancelKeep   bool
+}
+
+
+type command interface {
+	// execute выполняет команду и сообщает, нужно ли остановить скрипт.
+	execute(e *execution) (bool, error)
+}
+
+
+type test interface {
+	evaluate(m *Message) bool
+}
+
+
+func runBlock(e *execution, commands []command) (bool, error) {
+	for _, cmd := range commands {
+		stop, err := cmd.execute(e)
+		if err != nil || stop {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+
+// finish определяет итоговое сохранение письма и проверяет совместимость
+// действий: reject нельзя сочетать с сохранением, пересылкой и автоответом.
+func (e *execution) finish() error {
+	r := e.result
+	r.Keep = e.explicitKeep || !e.cancelKeep
+
+	if r.Rejected && (e.explicitKeep || len(r.FileInto) > 0 || len(r.Redirect) > 0 || r.Vacation != nil) {
+		return &Error{Message: "reject cannot be combined with keep, fileinto, redirect or vacation"}
+	}
+	return nil
+}
+
+
+type ifCommand struct {
+	tests     []test
+	blocks    [][]command
+	elseBlock []command
+}
+
+
+func (c *ifCommand) execute(e *execution) (bool, error) {
+	for i, t := range c.tests {
+		if t.evaluate(e.message) {
+			return runBlock(e, c.blocks[i])
+		}
+	}
+	return runBlock(e, c.elseBlock)
+}
+
+
+// simpleCommand — keep, discard и stop.
+type simpleCommand struct {
+	name string
+}
+
+
+func (c simpleCommand) execute(e *execution) (bool, error) {
+	switch c.name {
+	case "keep":
+		e.explicitKeep = true
+	case "discard":
+		e.cancelKeep = true
+	case "stop":
+		return true, nil
+	}
+	return false, nil
+}
+
+
+type fileIntoCommand struct {
+	line    int
+	mailbox string
+	copy    bool
+}
+
+
+func (c fileIntoCommand) execute(e *execution) (bool, error) {
+	if !containsString(e.result.FileInto, c.mailbox) {
+		e.result.FileInto = append(e.result.FileInto, c.mailbox)
+	}
+	if !c.copy {
+		e.cancelKeep = true
+	}
+	return false, nil
+}
+
+
+type redirectCommand struct {
+	line    int
+	address string
+	copy    bool
+}
+
+
+func (c redirectCommand) execute(e *execution) (bool, error) {
+	if !containsString(e.result.Redirect, c.address) {
+		if len(e.result.Redirect) >= MaxRedirects {
+			return false, errorf(c.line, "too many redirects (limit %d)", MaxRedirects)
+		}
+		e.result.Redirect = append(e.result.Redirect, c.address)
+	}
+	if !c.copy {
+		e.cancelKeep = true
+	}
+	return false, nil
+}
+
+
+type rejectCommand struct {
+	line   int
+	reason string
+}
+
+
+func (c rejectCommand) execute(e *execution) (bool, error) {
+	if e.result.Rejected {
+		return false, errorf(c.line, "reject used more than once")
+	}
+	e.result.Rejected = true
+	e.result.RejectReason = c.reason
+	e.cancelKeep = true
+	return false, nil
+}
+
+
+type vacationCommand struct {
+	line     int
+	vacation Vacation
+}
+
+
+func (c vacationCommand) execute(e *execution) (bool, error) {
+	if e.result.Vacation != nil {
+		return false, errorf(c.line, "vacation used more than once")
+	}
+	vacation := c.vacation
+	e.result.Vacation = &vacation
+	return false, nil
+}
+
+
+type constantTest bool
+
+
+func (t constantTest) evaluate(*Message) bool {
+	return bool(t)
+}
+
+
+type notTest struct {
+	test test
+}
+
+
+func (t notTest) evaluate(m *Message) bool {
+	return !t.test.evaluate(m)
+}
+
+
+type allOfTest []test
+
+
+func (t allOfTest) evaluate(m *Message) bool {
+	for _, inner := range t {
+		if !inner.evaluate(m) {
+			return false
+		}
+	}
+	return true
+}
+
+
+type anyOfTest []test
+
+
+func (t anyOfTest) evaluate(m *Message) bool {
+	for _, inner := range t {
+		if inner.evaluate(m) {
+			return true
+		}
+	}
+	return false
+}
+
+
+type headerTest struct {
+	matcher
+	headers []string
+	keys    []string
+}
+
+
+func (t headerTest) evaluate(m *Message) bool {
+	for _, name := range t.headers {
+		for _, value := range m.Header.Values(name) {
+			if t.match(value, t.keys) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+
+type addressTest struct {
+	matcher
+	part     string
+	headers  []string
+	keys     []string
+	envelope bool
+}
+
+
+func (t addressTest) evaluate(m *Message) bool {
+	for _, name := range t.headers {
+		var addresses []string
+		switch {
+		case t.envelope && name == "from":
+			addresses = []string{m.EnvelopeFrom}
+		case t.envelope:
+			addresses = []string{m.EnvelopeTo}
+		default:
+			for _, value := range m.Header.Values(name) {
+				addresses = append(addresses, headerAddresses(value)...)
+			}
+		}
+
+		for _, address := range addresses {
+			if t.match(addressPart(address, t.part), t.keys) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+
+type existsTest struct {
+	headers []string
+}
+
+
+func (t existsTest) evaluate(m *Message) bool {
+	for _, name := range t.headers {
+		if len(m.Header.Values(name)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+
+type sizeTest struct {
+	over  bool
+	limit int64
+}
+
+
+func (t sizeTest) evaluate(m *Message) bool {
+	if t.over {
+		return m.Size() > t.limit
+	}
+	return m.Size() < t.limit
+}
+
+
+type bodyTest struct {
+	matcher
+	keys []string
+}
+
+
+func (t bodyTest) evaluate(m *Message) bool {
+	return t.match(m.Body, t.keys)
+}
@@ -0,0 +1,310 @@
+package sieve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+
+type tokenKind int
+
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenTag
+	tokenNumber
+	tokenString
+	tokenLeftBracket
+	tokenRightBracket
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBrace
+	tokenRightBrace
+	tokenComma
+	tokenSemicolon
+)
+
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number int64
+	line   int
+}
+
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of script"
+	case tokenString:
+		return "string"
+	case tokenNumber:
+		return "number"
+	case tokenTag:
+		return ":" + t.text
+	}
+	return strconv.Quote(t.text)
+}
+
+
+// Error — синтаксическая или семантическая ошибка скрипта с номером строки.
+// Ошибки выполнения, не связанные с одной командой, имеют Line = 0.
+type Error struct {
+	Line    int
+	Message string
+}
+
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return "sieve: " + e.Message
+	}
+	return fmt.Sprintf("sieve: line %d: %s", e.Line, e.Message)
+}
+
+
+func errorf(line int, format string, args ...interface{}) *Error {
+	return &Error{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+
+var punctuation = map[byte]tokenKind{
+	'[': tokenLeftBracket,
+	']': tokenRightBracket,
+	'(': tokenLeftParen,
+	')': tokenRightParen,
+	'{': tokenLeftBrace,
+	'}': tokenRightBrace,
+	',': tokenComma,
+	';': tokenSemicolon,
+}
+
+
+// Множители чисел: 10K, 1M, 2G.
+var quantifiers = map[byte]int64{'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}
+
+
+// lexer разбивает скрипт на лексемы по грамматике RFC 5228, раздел 8.1.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1}
+
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, line: l.line}, nil
+	}
+
+	line := l.line
+	c := l.src[l.pos]
+
+	if kind, ok := punctuation[c]; ok {
+		l.pos++
+		return token{kind: kind, text: string(c), line: line}, nil
+	}
+
+	switch {
+	case c == '"':
+		text, err := l.quotedString()
+		return token{kind: tokenString, text: text, line: line}, err
+	case c == ':':
+		l.pos++
+		name := l.identifier()
+		if name == "" {
+			return token{}, errorf(line, "expected tag name after ':'")
+		}
+		return token{kind: tokenTag, text: strings.ToLower(name), line: line}, nil
+	case isDigit(c):
+		return l.number()
+	case isIdentifierStart(c):
+		name := l.identifier()
+		if strings.EqualFold(name, "text") && l.pos < len(l.src) && l.src[l.pos] == ':' {
+			l.pos++
+			text, err := l.multiLineString()
+			return token{kind: tokenString, text: text, line: line}, err
+		}
+		return token{kind: tokenIdentifier, text: strings.ToLower(name), line: line}, nil
+	}
+
+	return token{}, errorf(line, "unexpected character %q", c)
+}
+
+
+func (l *lexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return errorf(l.line, "unterminated comment")
+			}
+			comment := l.src[l.pos : l.pos+2+end+2]
+			l.line += strings.Count(comment, "\n")
+			l.pos += len(comment)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+
+func (l *lexer) identifier() string {
+	start := l.pos
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if !isIdentifierStart(c) && !isDigit(c) {
+			break
+		}
+		l.pos++
+	}
+	return l.src[start:l.pos]
+}
+
+
+// number читает число с необязательным множителем K, M или G.
+func (l *lexer) number() (token, error) {
+	line := l.line
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+
+	value, err := strconv.ParseInt(l.src[start:l.pos], 10, 64)
+	if err != nil {
+		return token{}, errorf(line, "number out of range")
+	}
+
+	if l.pos < len(l.src) {
+		if multiplier, ok := quantifiers[l.src[l.pos]|0x20]; ok {
+			l.pos++
+			if value > (1<<62)/multiplier {
+				return token{}, errorf(line, "number out of range")
+			}
+			value *= multiplier
+		}
+	}
+
+	return token{kind: tokenNumber, text: l.src[start:l.pos], number: value, line: line}, nil
+}
+
+
+// quotedString читает строку в кавычках. Экранируются только \" и \\,
+// обратная косая черта перед другим символом отбрасывается (RFC 5228, 2.4.2).
+func (l *lexer) quotedString() (string, error) {
+	line := l.line
+	l.pos++
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return b.String(), nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			c = l.src[l.pos]
+		}
+		if c == '\n' {
+			l.line++
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+
+	return "", errorf(line, "unterminated string")
+}
+
+
+// multiLineString читает строку вида text: ... до строки из одной точки.
+// Начальная точка в строке, начинающейся с "..", удваивается отправителем и
+// убирается здесь. Строки соединяются через \n, как текст писем сервиса.
+func (l *lexer) multiLineString() (string, error) {
+	line := l.line
+
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t') {
+		l.pos++
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '#' {
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos >= len(l.src) || l.src[l.pos] != '\n' {
+		return "", errorf(line, "expected line break after text:")
+	}
+	l.pos++
+	l.line++
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		current := l.src[l.pos:]
+		if end := strings.IndexByte(current, '\n'); end >= 0 {
+			current = current[:end]
+			l.pos += end + 1
+			l.line++
+		} else {
+			l.pos = len(l.src)
+		}
+		current = strings.TrimSuffix(current, "\r")
+
+		if current == "." {
+			return b.String(), nil
+		}
+		if strings.HasPrefix(current, "..") {
+			current = current[1:]
+		}
+		b.WriteString(current)
+		b.WriteString("\n")
+	}
+
+	return "", errorf(line, "unterminated multi-line string")
+}
+
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,143 @@
+package sieve
+
+import (
+	"net/mail"
+	"strings"
+)
+
+
+const (
+	ComparatorOctet     = "i;octet"
+	ComparatorASCIICase = "i;ascii-casemap"
+
+	MatchIs       = "is"
+	MatchContains = "contains"
+	MatchMatches  = "matches"
+
+	PartAll       = "all"
+	PartLocalpart = "localpart"
+	PartDomain    = "domain"
+)
+
+
+// matcher — способ сравнения строк теста: компаратор и тип совпадения.
+type matcher struct {
+	comparator string
+	matchType  string
+}
+
+
+func (m matcher) match(value string, keys []string) bool {
+	if m.comparator == ComparatorASCIICase {
+		value = asciiLower(value)
+	}
+
+	for _, key := range keys {
+		if m.comparator == ComparatorASCIICase {
+			key = asciiLower(key)
+		}
+
+		var ok bool
+		switch m.matchType {
+		case MatchContains:
+			ok = strings.Contains(value, key)
+		case MatchMatches:
+			ok = matchWildcard([]rune(key), []rune(value))
+		default:
+			ok = value == key
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+
+// asciiLower приводит к нижнему регистру только латиницу, как требует
+// компаратор i;ascii-casemap (RFC 4790).
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return r
+	}, s)
+}
+
+
+// matchWildcard сравнивает строку с шаблоном :matches: * — любая
+// последовательность символов, ? — один символ, \ экранирует следующий символ.
+func matchWildcard(pattern, value []rune) bool {
+	p, v := 0, 0
+	starP, starV := -1, 0
+
+	for v < len(value) {
+		if p < len(pattern) {
+			switch c := pattern[p]; {
+			case c == '*':
+				starP, starV = p, v
+				p++
+				continue
+			case c == '?':
+				p++
+				v++
+				continue
+			case c == '\\' && p+1 < len(pattern):
+				if pattern[p+1] == value[v] {
+					p += 2
+					v++
+					continue
+				}
+			case c == value[v]:
+				p++
+				v++
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starV++
+		p, v = starP+1, starV
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+
+// addressPart возвращает часть адреса для тестов address и envelope.
+func addressPart(address, part string) string {
+	switch part {
+	case PartLocalpart:
+		if at := strings.LastIndex(address, "@"); at >= 0 {
+			return address[:at]
+		}
+		return address
+	case PartDomain:
+		if at := strings.LastIndex(address, "@"); at >= 0 {
+			return address[at+1:]
+		}
+		return ""
+	}
+	return address
+}
+
+
+// headerAddresses разбирает адреса из значения заголовка. Значение, которое не
+// удалось разобрать, используется целиком.
+func headerAddresses(value string) []string {
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return []string{strings.TrimSpace(value)}
+	}
+
+	addresses := make([]string, 0, len(list))
+	for _, address := range list {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
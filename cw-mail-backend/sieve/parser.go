@@ -0,0 +1,205 @@
+package sieve
+
+
+// argument — позиционный или помеченный (:tag) аргумент команды или теста.
+type argument struct {
+	line    int
+	tag     string
+	number  int64
+	strings []string
+	kind    tokenKind
+}
+
+
+// node — команда или тест до проверки семантики. У команды может быть блок,
+// у теста — вложенные тесты (allof, anyof, not).
+type node struct {
+	name     string
+	line     int
+	args     []argument
+	tests    []*node
+	block    []*node
+	hasBlock bool
+}
+
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+
+// parse строит синтаксическое дерево по грамматике RFC 5228, раздел 8.2.
+func parse(src string) ([]*node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	commands, err := p.commands()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errorf(tok.line, "unexpected %s", tok)
+	}
+	return commands, nil
+}
+
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.advance()
+	if tok.kind != kind {
+		return tok, errorf(tok.line, "expected %s, found %s", what, tok)
+	}
+	return tok, nil
+}
+
+
+func (p *parser) commands() ([]*node, error) {
+	var commands []*node
+	for p.peek().kind == tokenIdentifier {
+		command, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+
+func (p *parser) command() (*node, error) {
+	name := p.advance()
+	command := &node{name: name.text, line: name.line}
+
+	if err := p.arguments(command); err != nil {
+		return nil, err
+	}
+
+	switch tok := p.advance(); tok.kind {
+	case tokenSemicolon:
+		return command, nil
+	case tokenLeftBrace:
+		block, err := p.commands()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRightBrace, "'}'"); err != nil {
+			return nil, err
+		}
+		command.block = block
+		command.hasBlock = true
+		return command, nil
+	default:
+		return nil, errorf(tok.line, "expected ';' or '{' after %s, found %s", command.name, tok)
+	}
+}
+
+
+// arguments читает аргументы, а затем тест или список тестов в скобках.
+func (p *parser) arguments(n *node) error {
+	for {
+		tok := p.peek()
+		switch tok.kind {
+		case tokenTag:
+			p.advance()
+			n.args = append(n.args, argument{line: tok.line, tag: tok.text, kind: tokenTag})
+		case tokenNumber:
+			p.advance()
+			n.args = append(n.args, argument{line: tok.line, number: tok.number, kind: tokenNumber})
+		case tokenString, tokenLeftBracket:
+			values, err := p.stringList()
+			if err != nil {
+				return err
+			}
+			n.args = append(n.args, argument{line: tok.line, strings: values, kind: tokenString})
+		default:
+			return p.tests(n)
+		}
+	}
+}
+
+
+func (p *parser) stringList() ([]string, error) {
+	tok := p.advance()
+	if tok.kind == tokenString {
+		return []string{tok.text}, nil
+	}
+
+	var values []string
+	for {
+		value, err := p.expect(tokenString, "string")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value.text)
+
+		tok := p.advance()
+		if tok.kind == tokenRightBracket {
+			return values, nil
+		}
+		if tok.kind != tokenComma {
+			return nil, errorf(tok.line, "expected ',' or ']', found %s", tok)
+		}
+	}
+}
+
+
+func (p *parser) tests(n *node) error {
+	switch p.peek().kind {
+	case tokenIdentifier:
+		test, err := p.test()
+		if err != nil {
+			return err
+		}
+		n.tests = []*node{test}
+	case tokenLeftParen:
+		p.advance()
+		for {
+			test, err := p.test()
+			if err != nil {
+				return err
+			}
+			n.tests = append(n.tests, test)
+
+			tok := p.advance()
+			if tok.kind == tokenRightParen {
+				break
+			}
+			if tok.kind != tokenComma {
+				return errorf(tok.line, "expected ',' or ')', found %s", tok)
+			}
+		}
+	}
+	return nil
+}
+
+
+func (p *parser) test() (*node, error) {
+	name, err := p.expect(tokenIdentifier, "test")
+	if err != nil {
+		return nil, err
+	}
+
+	test := &node{name: name.text, line: name.line}
+	if err := p.arguments(test); err != nil {
+		return nil, err
+	}
+	return test, nil
+}
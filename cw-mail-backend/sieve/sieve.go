@@ -0,0 +1,139 @@
+// Package sieve реализует язык фильтрации почты Sieve (RFC 5228) с
+// расширениями fileinto, reject (RFC 5429), envelope, body (RFC 5173),
+// vacation (RFC 5230) и copy (RFC 3894).
+//
+// Скрипт разбирается и проверяется один раз функцией Parse, затем
+// выполняется для каждого письма методом Execute. Выполнение не меняет
+// письмо: результат описывает действия, которые должен выполнить вызывающий
+// код.
+package sieve
+
+import (
+	"strings"
+)
+
+
+// Extensions — расширения, которые можно указать в require. Компараторы
+// i;octet и i;ascii-casemap поддерживаются без require.
+var Extensions = []string{"fileinto", "reject", "envelope", "body", "vacation", "copy"}
+
+
+const (
+	// MaxRedirects — сколько раз скрипт может выполнить redirect для одного
+	// письма.
+	MaxRedirects = 5
+
+	DefaultVacationDays = 7
+	MinVacationDays     = 1
+	MaxVacationDays     = 30
+)
+
+
+// Header — заголовки письма. Имена не зависят от регистра.
+type Header map[string][]string
+
+
+func (h Header) Add(name, value string) {
+	name = strings.ToLower(name)
+	h[name] = append(h[name], value)
+}
+
+
+func (h Header) Values(name string) []string {
+	return h[strings.ToLower(name)]
+}
+
+
+// Message — письмо, к которому применяется скрипт. EnvelopeFrom и
+// EnvelopeTo — адреса конверта для теста envelope.
+type Message struct {
+	EnvelopeFrom string
+	EnvelopeTo   string
+	Header       Header
+	Body         string
+}
+
+
+// Size — размер письма в октетах для теста size: заголовки и тело.
+func (m *Message) Size() int64 {
+	size := len(m.Body) + 2
+	for name, values := range m.Header {
+		for _, value := range values {
+			size += len(name) + len(value) + 4
+		}
+	}
+	return int64(size)
+}
+
+
+// Vacation — параметры автоответа, запрошенного командой vacation. Handle
+// отличает разные автоответы одного пользователя: ответ одному отправителю
+// с тем же Handle отправляется не чаще раза в Days дней.
+type Vacation struct {
+	Days      int
+	Subject   string
+	From      string
+	Addresses []string
+	Handle    string
+	Reason    string
+}
+
+
+// Result — действия скрипта для письма. Keep означает, что письмо остается
+// во входящих: явной командой keep или потому, что неявное сохранение не
+// было отменено (RFC 5228, 2.10.2).
+type Result struct {
+	Keep         bool
+	FileInto     []string
+	Redirect     []string
+	Rejected     bool
+	RejectReason string
+	Vacation     *Vacation
+}
+
+
+// Script — разобранный и проверенный скрипт.
+type Script struct {
+	commands  []command
+	mailboxes []string
+}
+
+
+// Parse разбирает скрипт и проверяет его: синтаксис, объявление расширений в
+// require, аргументы команд и тестов. Ошибка имеет тип *Error с номером
+// строки.
+func Parse(src string) (*Script, error) {
+	nodes, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{required: map[string]bool{}}
+	commands, err := c.block(nodes, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Script{commands: commands, mailboxes: c.mailboxes}, nil
+}
+
+
+// Mailboxes возвращает папки, которые используются в командах fileinto.
+func (s *Script) Mailboxes() []string {
+	return s.mailboxes
+}
+
+
+// Execute выполняет скрипт для письма. Ошибка выполнения (например, reject
+// вместе с fileinto) означает, что действия скрипта не применяются и письмо
+// сохраняется как обычно (RFC 5228, 2.10.6).
+func (s *Script) Execute(message *Message) (*Result, error) {
+	e := &execution{message: message, result: &Result{}}
+	if _, err := runBlock(e, s.commands); err != nil {
+		return nil, err
+	}
+	if err := e.finish(); err != nil {
+		return nil, err
+	}
+	return e.result, nil
+}
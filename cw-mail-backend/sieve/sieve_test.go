@@ -0,0 +1,211 @@
+package sieve
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testMessage() *Message {
+	header := Header{}
+	header.Add("From", "Новости <News@Example.com>")
+	header.Add("To", "user@example.org")
+	header.Add("Subject", "[list] Еженедельная рассылка")
+	header.Add("List-Id", "<list.example.com>")
+
+	return &Message{
+		EnvelopeFrom: "bounce@mailer.example.com",
+		EnvelopeTo:   "user@example.org",
+		Header:       header,
+		Body:         "Привет!\nСрочно прочитайте.",
+	}
+}
+
+func execute(t *testing.T, src string) *Result {
+	t.Helper()
+	script, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Ошибка разбора скрипта: %v", err)
+	}
+	result, err := script.Execute(testMessage())
+	if err != nil {
+		t.Fatalf("Ошибка выполнения скрипта: %v", err)
+	}
+	return result
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+	}{
+		{"нет точки с запятой", "keep", 1},
+		{"незакрытая строка", "require \"fileinto\";\nfileinto \"spam", 2},
+		{"fileinto без require", "\n\nfileinto \"spam\";", 3},
+		{"неизвестная команда", "redirect \"a@example.com\";\nnotify;", 2},
+		{"неизвестное расширение", "require \"imap4flags\";", 1},
+		{"require после команд", "keep;\nrequire \"fileinto\";", 2},
+		{"elsif без if", "elsif true { keep; }", 1},
+		{"конфликт типов совпадения", "if header :is :contains \"subject\" \"x\" { keep; }", 1},
+		{"неизвестный компаратор", "if header :comparator \"i;unicode\" \"subject\" \"x\" { keep; }", 1},
+		{"size без :over", "if size 10K { keep; }", 1},
+		{"неверный адрес redirect", "redirect \"не адрес\";", 1},
+		{"vacation :mime", "require \"vacation\";\nvacation :mime \"text\";", 2},
+		{"незакрытый блок", "if true {\nkeep;\n", 3},
+		{"незакрытый комментарий", "/* комментарий\nkeep;", 1},
+		{"лишние аргументы", "keep \"inbox\";", 1},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: ожидалась ошибка разбора, получено %v", tt.name, err)
+			continue
+		}
+		if parseErr.Line != tt.line {
+			t.Errorf("%s: ожидалась ошибка в строке %d, получено %v", tt.name, tt.line, err)
+		}
+	}
+}
+
+func TestParseStrings(t *testing.T) {
+	script, err := Parse("require [\"reject\"];\r\n# комментарий\r\nreject text: # пояснение\r\nПисьмо отклонено.\r\n..точка\r\n.\r\n;")
+	if err != nil {
+		t.Fatalf("Ошибка разбора скрипта: %v", err)
+	}
+	result, err := script.Execute(testMessage())
+	if err != nil {
+		t.Fatalf("Ошибка выполнения скрипта: %v", err)
+	}
+	if !result.Rejected || result.RejectReason != "Письмо отклонено.\n.точка\n" {
+		t.Errorf("Неверный текст многострочной строки: %q", result.RejectReason)
+	}
+}
+
+func TestTests(t *testing.T) {
+	tests := []struct {
+		test string
+		want bool
+	}{
+		{`header :contains "subject" "рассылка"`, true},
+		{`header :is "subject" "[LIST] Еженедельная рассылка"`, true},
+		{`header :is "subject" "[list] еженедельная рассылка"`, false},
+		{`header :matches "subject" "\\[list\\] *"`, true},
+		{`header :matches "subject" "?list*x"`, false},
+		{`header :comparator "i;octet" :contains "subject" "[LIST]"`, false},
+		{`address :is "from" "news@example.com"`, true},
+		{`address :domain :is ["from", "to"] "example.org"`, true},
+		{`address :localpart :matches "from" "n*s"`, true},
+		{`envelope :domain :is "from" "mailer.example.com"`, true},
+		{`envelope :is "to" "other@example.org"`, false},
+		{`exists ["list-id", "subject"]`, true},
+		{`exists ["list-id", "x-spam"]`, false},
+		{`size :over 10`, true},
+		{`size :under 1K`, true},
+		{`body :contains "Срочно"`, true},
+		{`not body :text :contains "скидка"`, true},
+		{`allof (true, header :contains "list-id" "list.example.com")`, true},
+		{`anyof (false, not true)`, false},
+	}
+
+	for _, tt := range tests {
+		src := "require [\"envelope\", \"body\", \"fileinto\"];\nif " + tt.test + " { fileinto \"spam\"; }"
+		result := execute(t, src)
+		if matched := len(result.FileInto) > 0; matched != tt.want {
+			t.Errorf("%s: ожидалось %v, получено %v", tt.test, tt.want, matched)
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want Result
+	}{
+		{"неявное сохранение", `if false { discard; }`, Result{Keep: true}},
+		{"discard", `discard;`, Result{}},
+		{"fileinto", `fileinto "Junk"; fileinto "Junk";`, Result{FileInto: []string{"Junk"}}},
+		{"fileinto :copy", `fileinto :copy "Junk";`, Result{Keep: true, FileInto: []string{"Junk"}}},
+		{"keep после discard", `discard; keep;`, Result{Keep: true}},
+		{"redirect", `redirect "Archive@Example.com";`, Result{Redirect: []string{"archive@example.com"}}},
+		{"stop", `if true { stop; } discard;`, Result{Keep: true}},
+		{
+			"elsif и else",
+			`if header :is "subject" "x" { discard; } elsif body :contains "Привет" { fileinto "a"; } else { fileinto "b"; }`,
+			Result{FileInto: []string{"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		src := "require [\"fileinto\", \"copy\", \"body\"];\n" + tt.src
+		if result := execute(t, src); !reflect.DeepEqual(*result, tt.want) {
+			t.Errorf("%s: ожидалось %+v, получено %+v", tt.name, tt.want, *result)
+		}
+	}
+}
+
+func TestVacation(t *testing.T) {
+	result := execute(t, `require "vacation";
+vacation :days 100 :subject "В отпуске" :from "me@example.org" :addresses ["Alias@Example.org"] "Вернусь в понедельник";`)
+
+	vacation := result.Vacation
+	if vacation == nil || !result.Keep {
+		t.Fatalf("Ожидался автоответ с сохранением письма: %+v", result)
+	}
+	if vacation.Days != MaxVacationDays || vacation.Subject != "В отпуске" || vacation.From != "me@example.org" {
+		t.Errorf("Неверные параметры автоответа: %+v", vacation)
+	}
+	if len(vacation.Addresses) != 1 || vacation.Addresses[0] != "alias@example.org" || vacation.Reason != "Вернусь в понедельник" {
+		t.Errorf("Неверные адреса или текст автоответа: %+v", vacation)
+	}
+
+	other := execute(t, `require "vacation"; vacation "Другой текст";`)
+	if other.Vacation.Handle == "" || other.Vacation.Handle == vacation.Handle {
+		t.Errorf("Автоответы с разным текстом должны различаться: %q, %q", other.Vacation.Handle, vacation.Handle)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []string{
+		"require [\"reject\", \"fileinto\"];\nreject \"нет\";\nfileinto \"a\";",
+		"require \"vacation\";\nvacation \"a\";\nvacation \"b\";",
+		strings.Repeat("redirect \"same@example.com\";\n", MaxRedirects+1) + "redirect \"b@example.com\";\nredirect \"c@example.com\";\nredirect \"d@example.com\";\nredirect \"e@example.com\";\nredirect \"f@example.com\";",
+	}
+
+	for _, src := range tests {
+		script, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Ошибка разбора скрипта: %v", err)
+		}
+		if _, err := script.Execute(testMessage()); err == nil {
+			t.Errorf("Ожидалась ошибка выполнения:\n%s", src)
+		}
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"*", "", true},
+		{"a*c", "abbbc", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*@example.com", "user@example.com", true},
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"*a*b", "xaxxb", true},
+		{"п?ивет", "привет", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchWildcard([]rune(tt.pattern), []rune(tt.value)); got != tt.want {
+			t.Errorf("%q ~ %q: ожидалось %v", tt.pattern, tt.value, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package spamfilter
+
+import (
+	"strings"
+	"unicode"
+)
+
+
+// Rule — эвристическое правило. Вес сработавшего правила прибавляется к
+// байесовской оценке.
+type Rule struct {
+	Name   string
+	Weight float64
+	Match  func(m Message) bool
+}
+
+
+// spamPhrases — фразы, характерные для рекламных и мошеннических рассылок.
+var spamPhrases = []string{
+	"viagra", "casino", "lottery", "you have won", "you've won", "click here",
+	"100% free", "earn money", "make money fast", "wire transfer", "act now",
+	"вы выиграли", "казино", "лотерея", "заработок без вложений", "быстрый заработок",
+	"100% бесплатно", "переведите деньги", "только сегодня", "ваш выигрыш",
+}
+
+
+var Rules = []Rule{
+	{Name: "spam_phrases", Weight: 0.3, Match: hasSpamPhrase},
+	{Name: "subject_caps", Weight: 0.15, Match: subjectShouting},
+	{Name: "exclamations", Weight: 0.1, Match: func(m Message) bool {
+		return strings.Contains(m.Subject, "!!") || strings.Count(m.Body, "!") >= 10
+	}},
+	{Name: "many_links", Weight: 0.15, Match: func(m Message) bool {
+		return len(linkHosts(m.Body)) >= 5
+	}},
+	{Name: "empty_subject_link", Weight: 0.15, Match: func(m Message) bool {
+		return strings.TrimSpace(m.Subject) == "" && len(linkHosts(m.Body)) > 0
+	}},
+}
+
+
+func hasSpamPhrase(m Message) bool {
+	text := strings.ToLower(m.Subject + "\n" + m.Body)
+	for _, phrase := range spamPhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+
+// subjectShouting — тема из восьми и более букв, почти все прописные.
+func subjectShouting(m Message) bool {
+	var letters, upper int
+	for _, r := range m.Subject {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= 8 && upper*10 >= letters*9
+}
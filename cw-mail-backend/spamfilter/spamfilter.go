@@ -0,0 +1,220 @@
+// Package spamfilter оценивает вероятность того, что письмо — спам. Оценка
+// складывается из наивного байесовского классификатора, обученного на
+// письмах самого пользователя, и эвристических правил.
+//
+// Классификатор использует метод Робинсона: вероятность для каждого слова
+// сглаживается с учетом числа наблюдений, а вероятности слов объединяются
+// критерием хи-квадрат Фишера. Пока пользователь не отметил достаточно писем
+// как спам и как не спам, байесовская часть нейтральна (0.5) и оценку
+// определяют только правила.
+package spamfilter
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+
+const (
+	// MinTrainingMessages — сколько писем каждого класса нужно для
+	// байесовской оценки.
+	MinTrainingMessages = 5
+
+	// MaxTokens ограничивает число слов письма, которые учитываются при
+	// обучении и оценке.
+	MaxTokens = 1000
+
+	// maxInteresting — сколько самых показательных слов участвуют в оценке.
+	maxInteresting = 150
+
+	minTokenLength = 3
+	maxTokenLength = 40
+
+	// Параметры сглаживания Робинсона: вес априорной вероятности и сама
+	// априорная вероятность для слова без наблюдений.
+	priorStrength = 1.0
+	priorProb     = 0.5
+
+	// minDeviation — слова с вероятностью ближе к 0.5 не учитываются.
+	minDeviation = 0.1
+)
+
+
+// Message — поля письма, которые анализирует фильтр.
+type Message struct {
+	From    string
+	Subject string
+	Body    string
+}
+
+
+// Counts — сколько раз слово (или сколько писем) встретилось в спаме и в
+// обычных письмах.
+type Counts struct {
+	Spam int
+	Ham  int
+}
+
+
+// Result — оценка письма. Score от 0 до 1; Bayes — оценка классификатора,
+// Trained — хватило ли данных для нее; Rules — сработавшие правила.
+type Result struct {
+	Score   float64  `json:"score"`
+	Bayes   float64  `json:"bayes"`
+	Trained bool     `json:"trained"`
+	Rules   []string `json:"rules,omitempty"`
+}
+
+
+// Tokens возвращает уникальные слова письма. Слова темы, домен отправителя и
+// домены ссылок помечаются префиксами, чтобы отличаться от слов текста.
+func Tokens(m Message) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(token string) {
+		if len(tokens) < MaxTokens && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	if at := strings.LastIndex(m.From, "@"); at >= 0 {
+		add("from:" + strings.ToLower(m.From[at+1:]))
+	}
+	for _, word := range words(m.Subject) {
+		add("subject:" + word)
+	}
+	for _, host := range linkHosts(m.Body) {
+		add("url:" + host)
+	}
+	for _, word := range words(m.Body) {
+		add(word)
+	}
+	return tokens
+}
+
+
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	result := fields[:0]
+	for _, field := range fields {
+		if n := utf8.RuneCountInString(field); n >= minTokenLength && n <= maxTokenLength {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+
+func linkHosts(text string) []string {
+	var hosts []string
+	for _, field := range strings.Fields(text) {
+		lower := strings.ToLower(field)
+		start := strings.Index(lower, "http://")
+		if start < 0 {
+			start = strings.Index(lower, "https://")
+		}
+		if start < 0 {
+			continue
+		}
+		link, err := url.Parse(strings.TrimRight(lower[start:], ".,;:!?)\"'>"))
+		if err == nil && link.Hostname() != "" {
+			hosts = append(hosts, link.Hostname())
+		}
+	}
+	return hosts
+}
+
+
+// Classify оценивает письмо. tokens — статистика слов письма у пользователя
+// (слова без статистики можно не передавать), corpus — число писем, на
+// которых обучен классификатор.
+func Classify(m Message, tokens map[string]Counts, corpus Counts) Result {
+	result := Result{Bayes: 0.5}
+	if corpus.Spam >= MinTrainingMessages && corpus.Ham >= MinTrainingMessages {
+		result.Trained = true
+		result.Bayes = bayes(Tokens(m), tokens, corpus)
+	}
+
+	score := result.Bayes
+	for _, rule := range Rules {
+		if rule.Match(m) {
+			result.Rules = append(result.Rules, rule.Name)
+			score += rule.Weight
+		}
+	}
+	result.Score = math.Max(0, math.Min(1, score))
+	return result
+}
+
+
+// tokenProbability — сглаженная вероятность того, что письмо со словом —
+// спам (Робинсон, «A Statistical Approach to the Spam Problem»).
+func tokenProbability(counts Counts, corpus Counts) float64 {
+	spamRatio := float64(counts.Spam) / float64(corpus.Spam)
+	hamRatio := float64(counts.Ham) / float64(corpus.Ham)
+	if spamRatio+hamRatio == 0 {
+		return priorProb
+	}
+
+	p := spamRatio / (spamRatio + hamRatio)
+	n := float64(counts.Spam + counts.Ham)
+	return (priorStrength*priorProb + n*p) / (priorStrength + n)
+}
+
+
+func bayes(tokens []string, stats map[string]Counts, corpus Counts) float64 {
+	var probs []float64
+	for _, token := range tokens {
+		counts, ok := stats[token]
+		if !ok {
+			continue
+		}
+		if p := tokenProbability(counts, corpus); math.Abs(p-0.5) >= minDeviation {
+			probs = append(probs, p)
+		}
+	}
+	if len(probs) == 0 {
+		return 0.5
+	}
+
+	sort.Slice(probs, func(i, j int) bool {
+		return math.Abs(probs[i]-0.5) > math.Abs(probs[j]-0.5)
+	})
+	if len(probs) > maxInteresting {
+		probs = probs[:maxInteresting]
+	}
+
+	// Критерий Фишера: H — свидетельство в пользу обычного письма, S — в
+	// пользу спама
+	var hamLog, spamLog float64
+	for _, p := range probs {
+		hamLog += math.Log(p)
+		spamLog += math.Log(1 - p)
+	}
+	dof := 2 * len(probs)
+	h := chi2Q(-2*hamLog, dof)
+	s := chi2Q(-2*spamLog, dof)
+	return (1 + h - s) / 2
+}
+
+
+// chi2Q — вероятность того, что величина с распределением хи-квадрат с dof
+// (четным) степенями свободы больше x.
+func chi2Q(x float64, dof int) float64 {
+	m := x / 2
+	term := math.Exp(-m)
+	sum := term
+	for i := 1; i < dof/2; i++ {
+		term *= m / float64(i)
+		sum += term
+	}
+	return math.Min(sum, 1)
+}
@@ -0,0 +1,75 @@
+package spamfilter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	tokens := Tokens(Message{
+		From:    "Promo@Shop.Example",
+		Subject: "Скидки!",
+		Body:    "Скидки на всё: https://shop.example/sale, и ещё раз скидки. ok",
+	})
+	want := []string{"from:shop.example", "subject:скидки", "url:shop.example", "скидки", "всё", "https", "shop", "example", "sale", "ещё", "раз"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Tokens() = %q, ожидалось %q", tokens, want)
+	}
+}
+
+func TestClassifyUntrained(t *testing.T) {
+	result := Classify(Message{Subject: "Привет", Body: "Встречаемся завтра в 10"}, nil, Counts{})
+	if result.Trained || result.Score != 0.5 || len(result.Rules) != 0 {
+		t.Errorf("Без обучения обычное письмо получает нейтральную оценку: %+v", result)
+	}
+
+	result = Classify(Message{Subject: "ВЫ ВЫИГРАЛИ ПРИЗ!!", Body: "Казино дарит бонус"}, nil, Counts{})
+	if result.Score < 0.9 || !reflect.DeepEqual(result.Rules, []string{"spam_phrases", "subject_caps", "exclamations"}) {
+		t.Errorf("Правила должны поднять оценку: %+v", result)
+	}
+}
+
+func TestClassifyBayes(t *testing.T) {
+	corpus := Counts{Spam: 20, Ham: 20}
+	stats := map[string]Counts{
+		"subject:распродажа": {Spam: 15},
+		"скидка":             {Spam: 18, Ham: 1},
+		"купите":             {Spam: 12},
+		"отчет":              {Ham: 14},
+		"subject:встреча":    {Ham: 10, Spam: 1},
+		"завтра":             {Spam: 3, Ham: 12},
+		"сегодня":            {Spam: 8, Ham: 8},
+	}
+
+	spam := Classify(Message{Subject: "Распродажа", Body: "Скидка сегодня, купите"}, stats, corpus)
+	if !spam.Trained || spam.Bayes < 0.95 {
+		t.Errorf("Письмо со словами из спама должно получить высокую оценку: %+v", spam)
+	}
+
+	ham := Classify(Message{Subject: "Встреча", Body: "Отчет обсудим завтра сегодня"}, stats, corpus)
+	if ham.Bayes > 0.05 {
+		t.Errorf("Письмо со словами из обычных писем должно получить низкую оценку: %+v", ham)
+	}
+
+	unknown := Classify(Message{Subject: "Новое", Body: "Совсем другие слова"}, stats, corpus)
+	if unknown.Bayes != 0.5 {
+		t.Errorf("Письмо без известных слов получает нейтральную оценку: %+v", unknown)
+	}
+}
+
+func TestChi2Q(t *testing.T) {
+	tests := []struct {
+		x    float64
+		dof  int
+		want float64
+	}{
+		{0, 2, 1},
+		{2, 2, 0.36788},
+		{10, 4, 0.04043},
+	}
+	for _, tt := range tests {
+		if got := chi2Q(tt.x, tt.dof); got < tt.want-1e-4 || got > tt.want+1e-4 {
+			t.Errorf("chi2Q(%v, %d) = %v, ожидалось %v", tt.x, tt.dof, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет и ожидаемые значения из приложения B RFC 6238 (SHA1), последние 6 цифр.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateCodeRFCVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := GenerateCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Ошибка генерации кода: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("Для t=%d ожидался код %s, получен %s", tt.unix, tt.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("Ошибка генерации секрета: %v", err)
+	}
+
+	now := time.Now()
+	code, _ := GenerateCode(secret, now.Add(-Period*time.Second))
+
+	step, ok := Validate(secret, code, now, 1)
+	if !ok {
+		t.Fatal("Код предыдущего шага должен приниматься при skew=1")
+	}
+	if step != Step(now)-1 {
+		t.Errorf("Ожидался шаг %d, получен %d", Step(now)-1, step)
+	}
+
+	if _, ok := Validate(secret, code, now, 0); ok {
+		t.Error("Код предыдущего шага не должен приниматься при skew=0")
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(secret, bad, now, 1); ok {
+			t.Errorf("Код %q не должен приниматься", bad)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("CW Mail", "user@example.com", "ABC")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/CW%20Mail:user@example.com?") {
+		t.Errorf("Неверный префикс URI: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=CW+Mail") {
+		t.Errorf("URI не содержит секрет или издателя: %s", uri)
+	}
+}
@@ -0,0 +1,331 @@
+package vcard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+
+const (
+	Version3 = "3.0"
+	Version4 = "4.0"
+
+	// maxLineOctets — максимальная длина строки до переноса (RFC 6350, 3.2).
+	maxLineOctets = 75
+)
+
+
+var (
+	ErrInvalidCard        = errors.New("vcard: malformed card")
+	ErrUnsupportedVersion = errors.New("vcard: unsupported version")
+)
+
+
+// Card — поля vCard, которые хранит адресная книга. Остальные свойства
+// при разборе пропускаются.
+type Card struct {
+	Version       string
+	UID           string
+	FormattedName string
+	FamilyName    string
+	GivenName     string
+	Emails        []string
+	Phones        []string
+	Organization  string
+	Note          string
+	Categories    []string
+}
+
+
+// Decode разбирает поток из одной или нескольких карточек vCard 3.0 или 4.0.
+func Decode(r io.Reader) ([]Card, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	var current *Card
+
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		name, params, value, ok := parseLine(line)
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidCard, n+1)
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			if current != nil {
+				return nil, fmt.Errorf("%w: nested BEGIN on line %d", ErrInvalidCard, n+1)
+			}
+			current = &Card{}
+			continue
+		case name == "END" && strings.EqualFold(value, "VCARD"):
+			if current == nil {
+				return nil, fmt.Errorf("%w: END without BEGIN on line %d", ErrInvalidCard, n+1)
+			}
+			if current.Version != Version3 && current.Version != Version4 {
+				return nil, fmt.Errorf("%w: %q", ErrUnsupportedVersion, current.Version)
+			}
+			cards = append(cards, *current)
+			current = nil
+			continue
+		case current == nil:
+			return nil, fmt.Errorf("%w: property outside of card on line %d", ErrInvalidCard, n+1)
+		}
+
+		current.set(name, params, value)
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("%w: missing END", ErrInvalidCard)
+	}
+	return cards, nil
+}
+
+
+func (c *Card) set(name string, params map[string]string, value string) {
+	switch name {
+	case "VERSION":
+		c.Version = strings.TrimSpace(value)
+	case "UID":
+		c.UID = unescape(value)
+	case "FN":
+		c.FormattedName = unescape(value)
+	case "N":
+		parts := splitEscaped(value, ';')
+		if len(parts) > 0 {
+			c.FamilyName = unescape(parts[0])
+		}
+		if len(parts) > 1 {
+			c.GivenName = unescape(parts[1])
+		}
+	case "EMAIL":
+		if email := strings.TrimSpace(unescape(value)); email != "" {
+			c.Emails = append(c.Emails, strings.TrimPrefix(email, "mailto:"))
+		}
+	case "TEL":
+		phone := strings.TrimSpace(unescape(value))
+		if strings.EqualFold(params["VALUE"], "uri") || strings.HasPrefix(phone, "tel:") {
+			phone = strings.TrimPrefix(phone, "tel:")
+		}
+		if phone != "" {
+			c.Phones = append(c.Phones, phone)
+		}
+	case "ORG":
+		var units []string
+		for _, unit := range splitEscaped(value, ';') {
+			if unit = unescape(unit); unit != "" {
+				units = append(units, unit)
+			}
+		}
+		c.Organization = strings.Join(units, ", ")
+	case "NOTE":
+		c.Note = unescape(value)
+	case "CATEGORIES":
+		for _, category := range splitEscaped(value, ',') {
+			if category = strings.TrimSpace(unescape(category)); category != "" {
+				c.Categories = append(c.Categories, category)
+			}
+		}
+	}
+}
+
+
+// Name возвращает отображаемое имя карточки: FN, а если его нет — имя из N.
+func (c *Card) Name() string {
+	if c.FormattedName != "" {
+		return c.FormattedName
+	}
+	return strings.TrimSpace(c.GivenName + " " + c.FamilyName)
+}
+
+
+// Encode записывает карточки в указанной версии с CRLF-переводами строк и
+// переносом длинных строк.
+func Encode(w io.Writer, cards []Card, version string) error {
+	if version != Version3 && version != Version4 {
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+
+	bw := bufio.NewWriter(w)
+	for i := range cards {
+		writeCard(bw, &cards[i], version)
+	}
+	return bw.Flush()
+}
+
+
+func writeCard(w *bufio.Writer, c *Card, version string) {
+	property := func(name, value string) {
+		writeFolded(w, name+":"+value)
+	}
+
+	property("BEGIN", "VCARD")
+	property("VERSION", version)
+	if c.UID != "" {
+		property("UID", escape(c.UID))
+	}
+
+	name := c.Name()
+	if name == "" && len(c.Emails) > 0 {
+		name = c.Emails[0]
+	}
+	property("FN", escape(name))
+	property("N", escape(c.FamilyName)+";"+escape(c.GivenName)+";;;")
+
+	for _, email := range c.Emails {
+		if version == Version3 {
+			property("EMAIL;TYPE=INTERNET", escape(email))
+		} else {
+			property("EMAIL", escape(email))
+		}
+	}
+	for _, phone := range c.Phones {
+		if version == Version3 {
+			property("TEL", escape(phone))
+		} else {
+			property("TEL;VALUE=uri", "tel:"+phone)
+		}
+	}
+	if c.Organization != "" {
+		property("ORG", escape(c.Organization))
+	}
+	if c.Note != "" {
+		property("NOTE", escape(c.Note))
+	}
+	if len(c.Categories) > 0 {
+		escaped := make([]string, len(c.Categories))
+		for i, category := range c.Categories {
+			escaped[i] = escape(category)
+		}
+		property("CATEGORIES", strings.Join(escaped, ","))
+	}
+	property("END", "VCARD")
+}
+
+
+// writeFolded переносит строку длиннее 75 октетов, не разрывая символы UTF-8.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Пробел в начале строки продолжения тоже считается
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+
+// unfold читает строки и склеивает перенесенные: строка, начинающаяся с
+// пробела или табуляции, продолжает предыдущую.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+
+// parseLine разбирает строку вида [group.]NAME[;PARAM=VALUE]:value.
+func parseLine(line string) (string, map[string]string, string, bool) {
+	colon := -1
+	quoted := false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return "", nil, "", false
+	}
+
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+
+	name := strings.ToUpper(parts[0])
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+
+	params := make(map[string]string, len(parts)-1)
+	for _, param := range parts[1:] {
+		key, val, found := strings.Cut(param, "=")
+		if !found {
+			// vCard 2.1 допускала параметры без имени: TEL;CELL
+			key, val = "TYPE", key
+		}
+		params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+	}
+
+	return name, params, value, true
+}
+
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", "", ",", `\,`, ";", `\;`).Replace(s)
+}
+
+
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+
+// splitEscaped делит значение по разделителю, пропуская экранированные.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == sep {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,146 @@
+package vcard
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeVersion3(t *testing.T) {
+	input := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"FN:Иван Петров\r\n" +
+		"N:Петров;Иван;;;\r\n" +
+		"item1.EMAIL;TYPE=INTERNET,pref:ivan@example.com\r\n" +
+		"TEL;TYPE=CELL:+7 900 000-00-00\r\n" +
+		"ORG:Рога и копыта;Бухгалтерия\r\n" +
+		"NOTE:Первая строка\\nвторая\\, с запятой\r\n" +
+		"CATEGORIES:Работа,Друзья\r\n" +
+		"X-CUSTOM:пропускается\r\n" +
+		"END:VCARD\r\n"
+
+	cards, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+	if len(cards) != 1 {
+		t.Fatalf("Ожидалась одна карточка, получено %d", len(cards))
+	}
+
+	want := Card{
+		Version:       Version3,
+		FormattedName: "Иван Петров",
+		FamilyName:    "Петров",
+		GivenName:     "Иван",
+		Emails:        []string{"ivan@example.com"},
+		Phones:        []string{"+7 900 000-00-00"},
+		Organization:  "Рога и копыта, Бухгалтерия",
+		Note:          "Первая строка\nвторая, с запятой",
+		Categories:    []string{"Работа", "Друзья"},
+	}
+	if !reflect.DeepEqual(cards[0], want) {
+		t.Errorf("Неверная карточка:\n%+v\nожидалось\n%+v", cards[0], want)
+	}
+}
+
+func TestDecodeVersion4(t *testing.T) {
+	input := "BEGIN:VCARD\n" +
+		"VERSION:4.0\n" +
+		"UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1\n" +
+		"FN:Anna\n" +
+		" Smith\n" +
+		"EMAIL;TYPE=work:anna@example.com\n" +
+		"TEL;VALUE=uri;TYPE=\"voice,cell\":tel:+1-555-555-5555\n" +
+		"END:VCARD\n" +
+		"BEGIN:VCARD\n" +
+		"VERSION:4.0\n" +
+		"N:Doe;John;;;\n" +
+		"END:VCARD\n"
+
+	cards, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+	if len(cards) != 2 {
+		t.Fatalf("Ожидалось две карточки, получено %d", len(cards))
+	}
+	if cards[0].FormattedName != "AnnaSmith" {
+		t.Errorf("Перенесенная строка склеена неверно: %q", cards[0].FormattedName)
+	}
+	if cards[0].UID != "urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1" {
+		t.Errorf("Неверный UID: %q", cards[0].UID)
+	}
+	if !reflect.DeepEqual(cards[0].Phones, []string{"+1-555-555-5555"}) {
+		t.Errorf("Телефон в виде URI разобран неверно: %v", cards[0].Phones)
+	}
+	if cards[1].Name() != "John Doe" {
+		t.Errorf("Имя без FN должно собираться из N, получено %q", cards[1].Name())
+	}
+}
+
+func TestDecodeRejectsInvalidInput(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  error
+	}{
+		"версия 2.1":      {"BEGIN:VCARD\nVERSION:2.1\nFN:A\nEND:VCARD\n", ErrUnsupportedVersion},
+		"без версии":      {"BEGIN:VCARD\nFN:A\nEND:VCARD\n", ErrUnsupportedVersion},
+		"без END":         {"BEGIN:VCARD\nVERSION:3.0\nFN:A\n", ErrInvalidCard},
+		"END без BEGIN":   {"END:VCARD\n", ErrInvalidCard},
+		"строка без ':'":  {"BEGIN:VCARD\nVERSION:3.0\nFN\nEND:VCARD\n", ErrInvalidCard},
+		"вне карточки":    {"FN:A\n", ErrInvalidCard},
+		"вложенный BEGIN": {"BEGIN:VCARD\nBEGIN:VCARD\n", ErrInvalidCard},
+	}
+
+	for name, tt := range tests {
+		if _, err := Decode(strings.NewReader(tt.input)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ожидалась ошибка %v, получено %v", name, tt.want, err)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	card := Card{
+		UID:           "contact-1",
+		FormattedName: "Мария Иванова-Длиннофамильная, руководитель отдела по работе с клиентами",
+		FamilyName:    "Иванова",
+		GivenName:     "Мария",
+		Emails:        []string{"maria@example.com", "m.ivanova@example.org"},
+		Phones:        []string{"+79000000000"},
+		Organization:  "ООО \"Пример\"",
+		Note:          "Строка 1\nСтрока 2; с точкой с запятой",
+		Categories:    []string{"Работа", "Клиенты, VIP"},
+	}
+
+	for _, version := range []string{Version3, Version4} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, []Card{card}, version); err != nil {
+			t.Fatalf("%s: ошибка записи: %v", version, err)
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+			if len(line) > maxLineOctets {
+				t.Errorf("%s: строка длиннее %d октетов: %q", version, maxLineOctets, line)
+			}
+		}
+
+		cards, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: ошибка разбора записанной карточки: %v", version, err)
+		}
+
+		want := card
+		want.Version = version
+		if !reflect.DeepEqual(cards, []Card{want}) {
+			t.Errorf("%s: карточка изменилась после записи и разбора:\n%+v\nожидалось\n%+v", version, cards[0], want)
+		}
+	}
+}
+
+func TestEncodeRejectsUnknownVersion(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, nil, "2.1"); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Ожидалась ошибка версии, получено %v", err)
+	}
+}
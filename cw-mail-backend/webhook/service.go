@@ -0,0 +1,330 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+
+const UserAgent = "mail-service-webhooks/1.0"
+
+
+// Envelope — тело запроса вебхука. Data — тело события из шины без
+// изменений; его схема описана в каталоге событий (/api/events/schemas).
+type Envelope struct {
+	ID        string          `json:"id" example:"42"`
+	Event     string          `json:"event" example:"new_message"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+
+// TestEventData — данные тестового события webhook.test.
+type TestEventData struct {
+	Version   int       `json:"version"`
+	WebhookID uint      `json:"webhook_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+
+// Service рассылает события вебхукам. HandleEvent получает события из шины
+// и записывает доставки в базу, а фоновая задача (Start) отправляет их и
+// повторяет неудачные попытки с экспоненциальной задержкой. Доставка
+// гарантируется не менее одного раза; поле id конверта — идентификатор
+// события, по которому получатель отбрасывает повторы. Порядок доставки
+// событий не гарантируется.
+type Service struct {
+	DB     *gorm.DB
+	Config *config.Config
+	Policy *TargetPolicy
+	Client *http.Client
+}
+
+
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	policy := &TargetPolicy{AdminNetworks: cfg.Webhooks.AdminNetworks}
+	return &Service{
+		DB:     db,
+		Config: cfg,
+		Policy: policy,
+		Client: &http.Client{
+			Timeout: cfg.Webhooks.Timeout,
+			// Прокси из окружения не используется: он подключался бы к
+			// внутренним адресам в обход проверки
+			Transport: &http.Transport{
+				DialContext:         policy.DialContext,
+				TLSHandshakeTimeout: cfg.Webhooks.Timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			// Перенаправление считается ошибкой: подписанный запрос не
+			// должен уходить на адрес, который не указал владелец
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+
+// CheckURL проверяет, что вебхук с областью scope может отправлять события
+// на rawURL. Возвращает ErrTargetNotAllowed для внутренних адресов.
+func (s *Service) CheckURL(ctx context.Context, scope, rawURL string) error {
+	return s.Policy.CheckURL(ctx, scope, rawURL)
+}
+
+
+// HandleEvent ставит событие в очередь доставки подписанным на него
+// вебхукам. Ошибка означает, что событие нужно получить повторно.
+func (s *Service) HandleEvent(routingKey, messageID string, body []byte) error {
+	users, err := queue.EventUsers(routingKey, body)
+	if err != nil {
+		// Повтор не исправит тело события
+		log.Printf("Ошибка разбора события %s для вебхуков: %v", routingKey, err)
+		return nil
+	}
+
+	webhooks, err := models.MatchingWebhooks(s.DB, routingKey, users)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	// События, опубликованные не через outbox, приходят без идентификатора;
+	// идентификатор из тела одинаков на всех экземплярах сервиса
+	if messageID == "" {
+		sum := sha256.Sum256(append([]byte(routingKey+"\n"), body...))
+		messageID = hex.EncodeToString(sum[:16])
+	}
+
+	payload, err := json.Marshal(Envelope{ID: messageID, Event: routingKey, CreatedAt: time.Now(), Data: body})
+	if err != nil {
+		log.Printf("Ошибка разбора события %s для вебхуков: %v", routingKey, err)
+		return nil
+	}
+	return models.EnqueueWebhookDeliveries(s.DB, webhooks, messageID, routingKey, string(payload))
+}
+
+
+// Subscribe подписывает сервис на все события каталога. С RabbitMQ события
+// читаются из общей очереди webhooks с повторами и очередью недоставленных;
+// с другими драйверами шины ошибка записи доставки только журналируется.
+func (s *Service) Subscribe(ctx context.Context, bus queue.EventPublisher) error {
+	if consumer, ok := bus.(queue.DurableConsumer); ok {
+		return consumer.Consume(ctx, queue.WebhookQueueName, s.HandleEvent)
+	}
+
+	routingKeys := make([]string, 0, len(queue.Catalog))
+	for _, eventType := range queue.Catalog {
+		routingKeys = append(routingKeys, eventType.RoutingKey)
+	}
+	return bus.Subscribe(ctx, routingKeys, func(routingKey, messageID string, body []byte) {
+		if err := s.HandleEvent(routingKey, messageID, body); err != nil {
+			log.Printf("Ошибка записи доставки вебхуков для события %s: %v", routingKey, err)
+		}
+	})
+}
+
+
+// Start запускает отправку в отдельной горутине и возвращает управление.
+func (s *Service) Start(ctx context.Context) {
+	go s.run(ctx)
+}
+
+
+func (s *Service) run(ctx context.Context) {
+	ticker := time.NewTicker(s.Config.Webhooks.PollInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			sent, err := s.Flush(ctx)
+			if err != nil {
+				log.Printf("Ошибка отправки вебхуков: %v", err)
+			}
+			if err != nil || sent < s.Config.Webhooks.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= time.Hour {
+			lastCleanup = time.Now()
+			if _, err := models.DeleteWebhookDeliveries(s.DB, lastCleanup.Add(-s.Config.Webhooks.Retention)); err != nil {
+				log.Printf("Ошибка очистки журнала вебхуков: %v", err)
+			}
+		}
+	}
+}
+
+
+// Flush отправляет одну пачку доставок, время попытки которых наступило, и
+// возвращает их число. Доставки пачки откладываются на время отправки, чтобы
+// другие экземпляры сервиса не взяли их; запросы выполняются параллельно и
+// вне транзакции.
+func (s *Service) Flush(ctx context.Context) (int, error) {
+	var deliveries []models.WebhookDelivery
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if tx.Dialector.Name() == "postgres" {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		var err error
+		now := time.Now()
+		deliveries, err = models.DueWebhookDeliveries(query, now, s.Config.Webhooks.BatchSize)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		return models.PostponeWebhookDeliveries(tx, deliveries, now.Add(2*s.Config.Webhooks.Timeout+time.Minute))
+	})
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uint, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.WebhookID)
+	}
+	webhooks, err := models.GetWebhooksByID(s.DB, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		webhook := webhooks[delivery.WebhookID]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Deliver(ctx, webhook, delivery); err != nil {
+				log.Printf("Ошибка записи доставки вебхука %d: %v", delivery.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+
+// Deliver выполняет одну попытку доставки и записывает ее результат. После
+// MaxAttempts неудачных попыток доставка отмечается как failed. Тестовое
+// событие не повторяется и отправляется и отключенному вебхуку.
+func (s *Service) Deliver(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) error {
+	var attempt models.WebhookAttempt
+	if webhook == nil || (!webhook.Active && delivery.Event != models.WebhookTestEvent) {
+		attempt.Err = fmt.Errorf("webhook is disabled")
+		return models.RecordWebhookAttempt(s.DB, delivery, attempt, nil)
+	}
+
+	attempt = s.send(ctx, webhook, delivery)
+
+	var retryAt *time.Time
+	if attempt.Err != nil && delivery.Event != models.WebhookTestEvent && delivery.Attempts+1 < s.Config.Webhooks.MaxAttempts {
+		next := time.Now().Add(s.backoff(delivery.Attempts))
+		retryAt = &next
+	}
+	return models.RecordWebhookAttempt(s.DB, delivery, attempt, retryAt)
+}
+
+
+// SendTest отправляет вебхуку тестовое событие webhook.test и возвращает
+// запись о доставке с ответом получателя.
+func (s *Service) SendTest(ctx context.Context, webhook *models.Webhook) (*models.WebhookDelivery, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	eventID := "test-" + hex.EncodeToString(buf)
+
+	now := time.Now()
+	data, err := json.Marshal(TestEventData{Version: queue.EventVersion, WebhookID: webhook.ID, Timestamp: now})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(Envelope{ID: eventID, Event: models.WebhookTestEvent, CreatedAt: now, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := models.CreateWebhookDelivery(s.DB, webhook, eventID, models.WebhookTestEvent, string(payload))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Deliver(ctx, webhook, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+
+func (s *Service) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) models.WebhookAttempt {
+	var attempt models.WebhookAttempt
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(withScope(ctx, webhook.Scope), http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, time.Now(), body))
+
+	start := time.Now()
+	resp, err := s.Client.Do(req)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	// Тело ответа сохраняется только для вебхуков администраторов: даже если
+	// проверку адреса удастся обойти, пользователь не прочитает ответ
+	// внутреннего сервиса через журнал доставок
+	attempt.ResponseStatus = resp.StatusCode
+	if webhook.Scope == models.WebhookScopeAdmin {
+		response, _ := io.ReadAll(io.LimitReader(resp.Body, models.WebhookResponseLimit))
+		attempt.ResponseBody = string(response)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Err = fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+
+// backoff возвращает задержку перед попыткой attempts+1: BaseBackoff,
+// удваиваемый после каждой ошибки, но не больше MaxBackoff.
+func (s *Service) backoff(attempts int) time.Duration {
+	delay := s.Config.Webhooks.BaseBackoff
+	for i := 0; i < attempts && delay < s.Config.Webhooks.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.Config.Webhooks.MaxBackoff)
+}
@@ -0,0 +1,358 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mail-service/config"
+	"github.com/mail-service/models"
+	"github.com/mail-service/queue"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// endpoint — получатель вебхуков, отвечающий кодами из statuses по очереди.
+type endpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, receivedRequest{header: r.Header.Clone(), body: body})
+	status := http.StatusOK
+	if len(e.statuses) > 0 {
+		status, e.statuses = e.statuses[0], e.statuses[1:]
+	}
+	w.WriteHeader(status)
+	w.Write([]byte("ok"))
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка открытия тестовой базы: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&models.User{}, &models.Webhook{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("Ошибка миграции тестовой базы: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Webhooks.BatchSize = 10
+	cfg.Webhooks.Timeout = time.Second
+	cfg.Webhooks.MaxAttempts = 3
+	cfg.Webhooks.BaseBackoff = time.Minute
+	cfg.Webhooks.MaxBackoff = 3 * time.Minute
+	s := NewService(db, cfg)
+	// Тестовые получатели слушают loopback; проверка адресов проверяется
+	// отдельно в TestTargetPolicy
+	s.Client.Transport = &http.Transport{}
+	return s
+}
+
+func createWebhook(t *testing.T, s *Service, userID uint, scope, url string, events ...string) *models.Webhook {
+	t.Helper()
+
+	hook, err := models.CreateWebhook(s.DB, userID, scope, models.WebhookInput{URL: &url, Events: events}, 0)
+	if err != nil {
+		t.Fatalf("Ошибка создания вебхука: %v", err)
+	}
+	return hook
+}
+
+// makeDue переносит время следующей попытки всех доставок в прошлое.
+func makeDue(s *Service) {
+	s.DB.Model(&models.WebhookDelivery{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	header := Sign("whsec_test", time.Now(), body)
+
+	if err := Verify("whsec_test", header, body, time.Minute); err != nil {
+		t.Errorf("Подпись не прошла проверку: %v", err)
+	}
+	if err := Verify("whsec_other", header, body, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Подпись с другим секретом: ожидалась ErrInvalidSignature, получено %v", err)
+	}
+	if err := Verify("whsec_test", header, []byte(`{"id":"2"}`), time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Измененное тело: ожидалась ErrInvalidSignature, получено %v", err)
+	}
+
+	old := Sign("whsec_test", time.Now().Add(-time.Hour), body)
+	if err := Verify("whsec_test", old, body, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Устаревшая подпись: ожидалась ErrInvalidSignature, получено %v", err)
+	}
+	if err := Verify("whsec_test", old, body, 0); err != nil {
+		t.Errorf("Без проверки времени подпись должна проходить: %v", err)
+	}
+}
+
+func TestHandleEventDeliversSignedEnvelope(t *testing.T) {
+	s := newTestService(t)
+	receiver := &endpoint{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	alice, _ := models.CreateUser(s.DB, "alice@example.com", "password123")
+	bob, _ := models.CreateUser(s.DB, "bob@example.com", "password123")
+	hook := createWebhook(t, s, alice.ID, models.WebhookScopeUser, server.URL, queue.RoutingKeyMessageRead)
+	createWebhook(t, s, bob.ID, models.WebhookScopeUser, server.URL)
+
+	body := []byte(`{"version":1,"message_id":5,"sender_id":2,"receiver_id":1}`)
+	// Событие, полученное дважды (например, двумя экземплярами), доставляется один раз
+	for i := 0; i < 2; i++ {
+		if err := s.HandleEvent(queue.RoutingKeyMessageRead, "42", body); err != nil {
+			t.Fatalf("Ошибка обработки события: %v", err)
+		}
+	}
+
+	sent, err := s.Flush(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("Отправлено %d доставок (%v), ожидалась 1", sent, err)
+	}
+	if len(receiver.requests) != 1 {
+		t.Fatalf("Получено %d запросов, ожидался 1", len(receiver.requests))
+	}
+
+	request := receiver.requests[0]
+	if err := Verify(hook.Secret, request.header.Get(HeaderSignature), request.body, time.Minute); err != nil {
+		t.Errorf("Подпись запроса не прошла проверку: %v", err)
+	}
+	if event := request.header.Get(HeaderEvent); event != queue.RoutingKeyMessageRead {
+		t.Errorf("Заголовок события: %q", event)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(request.body, &envelope); err != nil {
+		t.Fatalf("Ошибка разбора тела запроса: %v", err)
+	}
+	if envelope.ID != "42" || envelope.Event != queue.RoutingKeyMessageRead || string(envelope.Data) != string(body) {
+		t.Errorf("Тело запроса: %+v", envelope)
+	}
+
+	deliveries, _, _ := models.ListWebhookDeliveries(s.DB, hook.ID, models.WebhookDeliveryFilter{Page: 1, Limit: 20})
+	if len(deliveries) != 1 || deliveries[0].Status != models.WebhookDeliverySucceeded || deliveries[0].ResponseStatus != http.StatusOK {
+		t.Errorf("Журнал доставок: %+v", deliveries)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	s := newTestService(t)
+	receiver := &endpoint{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	admin, _ := models.CreateUser(s.DB, "admin@example.com", "password123")
+	hook := createWebhook(t, s, admin.ID, models.WebhookScopeAdmin, server.URL)
+
+	if err := s.HandleEvent(queue.RoutingKeyUserRegistered, "7", []byte(`{"version":1,"user_id":3}`)); err != nil {
+		t.Fatalf("Ошибка обработки события: %v", err)
+	}
+
+	var delivery models.WebhookDelivery
+	for attempt := 1; attempt <= 3; attempt++ {
+		start := time.Now()
+		if sent, err := s.Flush(context.Background()); err != nil || sent != 1 {
+			t.Fatalf("Попытка %d: отправлено %d доставок (%v)", attempt, sent, err)
+		}
+		s.DB.Where("webhook_id = ?", hook.ID).First(&delivery)
+		if delivery.Attempts != attempt {
+			t.Errorf("Попытка %d: записано попыток %d", attempt, delivery.Attempts)
+		}
+
+		if attempt < 3 {
+			// Задержка удваивается: 1 мин, 2 мин
+			expected := time.Minute << (attempt - 1)
+			if delay := delivery.NextAttemptAt.Sub(start); delay < expected || delay > expected+time.Second {
+				t.Errorf("Попытка %d: задержка %v, ожидалось %v", attempt, delay, expected)
+			}
+			if delivery.Status != models.WebhookDeliveryPending {
+				t.Errorf("Попытка %d: статус %s", attempt, delivery.Status)
+			}
+			if sent, _ := s.Flush(context.Background()); sent != 0 {
+				t.Errorf("Попытка %d: доставка отправлена до истечения задержки", attempt)
+			}
+			makeDue(s)
+		}
+	}
+
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.ResponseStatus != http.StatusServiceUnavailable || delivery.LastError == "" {
+		t.Errorf("После всех попыток: %+v", delivery)
+	}
+	makeDue(s)
+	if sent, _ := s.Flush(context.Background()); sent != 0 {
+		t.Error("Неудачная доставка отправлена после MaxAttempts")
+	}
+}
+
+func TestUserEventsNotSentToOtherUsers(t *testing.T) {
+	s := newTestService(t)
+	alice, _ := models.CreateUser(s.DB, "alice@example.com", "password123")
+	bob, _ := models.CreateUser(s.DB, "bob@example.com", "password123")
+	createWebhook(t, s, bob.ID, models.WebhookScopeUser, "https://hooks.example.com/bob")
+
+	body := []byte(`{"version":1,"message_id":5,"sender_id":` + jsonID(alice.ID) + `,"receiver_id":` + jsonID(alice.ID) + `}`)
+	s.HandleEvent(queue.RoutingKeyMessageRead, "1", body)
+	s.HandleEvent(queue.RoutingKeyUserRegistered, "2", []byte(`{"version":1,"user_id":`+jsonID(bob.ID)+`}`))
+
+	var count int64
+	s.DB.Model(&models.WebhookDelivery{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Вебхуку пользователя записано %d чужих или административных событий", count)
+	}
+}
+
+func TestSendTestAndDisabledWebhook(t *testing.T) {
+	s := newTestService(t)
+	receiver := &endpoint{statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	user, _ := models.CreateUser(s.DB, "alice@example.com", "password123")
+	hook := createWebhook(t, s, user.ID, models.WebhookScopeUser, server.URL)
+
+	// Тестовое событие не повторяется
+	delivery, err := s.SendTest(context.Background(), hook)
+	if err != nil {
+		t.Fatalf("Ошибка отправки тестового события: %v", err)
+	}
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("Тестовое событие с ошибкой: %+v", delivery)
+	}
+	if delivery, _ = s.SendTest(context.Background(), hook); delivery.Status != models.WebhookDeliverySucceeded {
+		t.Errorf("Тестовое событие: статус %s", delivery.Status)
+	}
+	if event := receiver.requests[1].header.Get(HeaderEvent); event != models.WebhookTestEvent {
+		t.Errorf("Заголовок события: %q", event)
+	}
+
+	// Доставки отключенного вебхука не отправляются
+	s.HandleEvent(queue.RoutingKeyMessageRead, "3", []byte(`{"version":1,"sender_id":`+jsonID(user.ID)+`,"receiver_id":`+jsonID(user.ID)+`}`))
+	disabled := false
+	models.UpdateWebhook(s.DB, hook, models.WebhookInput{Active: &disabled})
+	s.Flush(context.Background())
+	if len(receiver.requests) != 2 {
+		t.Errorf("Отключенному вебхуку отправлено %d запросов", len(receiver.requests)-2)
+	}
+	deliveries, _, _ := models.ListWebhookDeliveries(s.DB, hook.ID, models.WebhookDeliveryFilter{Status: models.WebhookDeliveryFailed, Page: 1, Limit: 20})
+	if len(deliveries) != 2 {
+		t.Errorf("Неудачных доставок %d, ожидалось 2", len(deliveries))
+	}
+}
+
+func jsonID(id uint) string {
+	data, _ := json.Marshal(id)
+	return string(data)
+}
+
+func TestTargetPolicy(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	policy := &TargetPolicy{
+		AdminNetworks: []*net.IPNet{loopback},
+		LookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			switch host {
+			case "hooks.example.com":
+				return []net.IP{net.ParseIP("203.0.113.10")}, nil
+			case "rebind.example.com":
+				return []net.IP{net.ParseIP("203.0.113.10"), net.ParseIP("10.0.0.5")}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+	}
+
+	cases := []struct {
+		scope, url string
+		allowed    bool
+	}{
+		{models.WebhookScopeUser, "https://hooks.example.com/mail", true},
+		{models.WebhookScopeUser, "http://127.0.0.1:8080/", false},
+		{models.WebhookScopeUser, "http://[::1]/", false},
+		{models.WebhookScopeUser, "http://[::ffff:10.0.0.1]/", false},
+		{models.WebhookScopeUser, "http://169.254.169.254/latest/meta-data", false},
+		{models.WebhookScopeUser, "http://192.168.1.10/", false},
+		{models.WebhookScopeUser, "http://[fd00::1]/", false},
+		{models.WebhookScopeUser, "http://0.0.0.0/", false},
+		{models.WebhookScopeUser, "http://rebind.example.com/", false},
+		{models.WebhookScopeUser, "http://clamav:3310/", false},
+		{models.WebhookScopeAdmin, "http://127.0.0.1:8080/", true},
+		{models.WebhookScopeAdmin, "http://169.254.169.254/", false},
+	}
+	for _, tc := range cases {
+		err := policy.CheckURL(context.Background(), tc.scope, tc.url)
+		if (err == nil) != tc.allowed {
+			t.Errorf("%s %s: ошибка %v, ожидалось разрешено=%v", tc.scope, tc.url, err, tc.allowed)
+		}
+	}
+}
+
+func TestDeliverBlocksInternalAddresses(t *testing.T) {
+	s := newTestService(t)
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	s.Config.Webhooks.AdminNetworks = []*net.IPNet{loopback}
+	s.Policy.AdminNetworks = s.Config.Webhooks.AdminNetworks
+	s.Client = NewService(s.DB, s.Config).Client
+
+	receiver := &endpoint{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	user, _ := models.CreateUser(s.DB, "alice@example.com", "password123")
+	// Адрес мог стать внутренним после сохранения вебхука (DNS rebinding):
+	// соединение проверяется заново
+	userHook := createWebhook(t, s, user.ID, models.WebhookScopeUser, server.URL)
+	delivery, err := s.SendTest(context.Background(), userHook)
+	if err != nil {
+		t.Fatalf("Ошибка отправки тестового события: %v", err)
+	}
+	if delivery.Status != models.WebhookDeliveryFailed || !strings.Contains(delivery.LastError, ErrTargetNotAllowed.Error()) {
+		t.Errorf("Вебхук пользователя во внутреннюю сеть: %+v", delivery)
+	}
+	if len(receiver.requests) != 0 {
+		t.Errorf("Вебхук пользователя отправил %d запросов на loopback", len(receiver.requests))
+	}
+
+	adminHook := createWebhook(t, s, user.ID, models.WebhookScopeAdmin, server.URL)
+	if delivery, _ = s.SendTest(context.Background(), adminHook); delivery.Status != models.WebhookDeliverySucceeded || delivery.ResponseBody != "ok" {
+		t.Errorf("Вебхук администратора в разрешенную сеть: %+v", delivery)
+	}
+}
+
+func TestUserWebhookResponseBodyNotStored(t *testing.T) {
+	s := newTestService(t)
+	server := httptest.NewServer(&endpoint{})
+	defer server.Close()
+
+	user, _ := models.CreateUser(s.DB, "alice@example.com", "password123")
+	hook := createWebhook(t, s, user.ID, models.WebhookScopeUser, server.URL)
+	delivery, err := s.SendTest(context.Background(), hook)
+	if err != nil {
+		t.Fatalf("Ошибка отправки тестового события: %v", err)
+	}
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.ResponseBody != "" {
+		t.Errorf("Доставка вебхука пользователя: статус %s, тело ответа %q", delivery.Status, delivery.ResponseBody)
+	}
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"syscall"
+
+	"github.com/mail-service/models"
+)
+
+
+var ErrTargetNotAllowed = errors.New("webhook target address is not allowed")
+
+
+// reservedNetworks — специальные диапазоны, не покрытые методами net.IP.
+var reservedNetworks = parseNetworks(
+	"0.0.0.0/8",     // "эта" сеть
+	"100.64.0.0/10", // CGNAT
+	"192.0.0.0/24",  // служебные адреса IETF
+	"198.18.0.0/15", // тестирование производительности
+	"240.0.0.0/4",   // зарезервировано, включая broadcast
+	"64:ff9b::/96",  // NAT64 отображает IPv4-адреса, в том числе внутренние
+)
+
+
+type scopeKey struct{}
+
+
+// TargetPolicy решает, на какие адреса можно отправлять вебхуки. Вебхукам
+// нельзя обращаться к loopback, частным, link-local, ULA и неуказанным
+// адресам: иначе пользователь мог бы через вебхук читать внутренние сервисы.
+// Вебхукам администраторов доступны внутренние сети из AdminNetworks.
+type TargetPolicy struct {
+	AdminNetworks []*net.IPNet
+	// LookupIP разрешает имя хоста; nil — системный резолвер
+	LookupIP func(ctx context.Context, host string) ([]net.IP, error)
+}
+
+
+// Allowed сообщает, можно ли вебхуку с областью scope обратиться к ip.
+func (p *TargetPolicy) Allowed(scope string, ip net.IP) bool {
+	if !internalIP(ip) {
+		return true
+	}
+	if scope != models.WebhookScopeAdmin {
+		return false
+	}
+	for _, network := range p.AdminNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+
+// CheckURL проверяет при сохранении вебхука, что все адреса хоста из URL
+// разрешены. Адрес проверяется еще раз при каждом соединении (Control), так
+// как имя может разрешиться иначе к моменту отправки.
+func (p *TargetPolicy) CheckURL(ctx context.Context, scope, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return models.ErrWebhookURL
+	}
+
+	ips, err := p.lookup(ctx, parsed.Hostname())
+	if err != nil || len(ips) == 0 {
+		return ErrTargetNotAllowed
+	}
+	for _, ip := range ips {
+		if !p.Allowed(scope, ip) {
+			return ErrTargetNotAllowed
+		}
+	}
+	return nil
+}
+
+
+// Control проверяет адрес, к которому действительно подключается net.Dialer.
+func (p *TargetPolicy) Control(scope string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !p.Allowed(scope, ip) {
+			return ErrTargetNotAllowed
+		}
+		return nil
+	}
+}
+
+
+// DialContext подключается с проверкой адреса для области вебхука из
+// контекста запроса.
+func (p *TargetPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	scope, _ := ctx.Value(scopeKey{}).(string)
+	dialer := &net.Dialer{Control: p.Control(scope)}
+	return dialer.DialContext(ctx, network, address)
+}
+
+
+func (p *TargetPolicy) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if p.LookupIP != nil {
+		return p.LookupIP(ctx, host)
+	}
+	return net.DefaultResolver.LookupIP(ctx, "ip", host)
+}
+
+
+func withScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+
+func internalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}